@@ -1,11 +1,10 @@
 package device
 
 import (
-	"fmt"
 	"log"
-	"time"
 
 	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/av/transcode"
 	"github.com/Youngju-Heo/gomedia/core/media/ffmpeg"
 )
 
@@ -16,11 +15,11 @@ type PacketTranscoder struct {
 
 	decoder       av.AudioDecoder
 	encoder       av.AudioEncoder
+	resampler     *ffmpeg.Resampler
+	audio         *transcode.AudioTranscoder
 	needTranscode bool
 }
 
-var debug = false
-
 // NewTranscoder create new transcoder instance
 func NewTranscoder(src av.AudioCodecData,
 	forceDecoding bool,
@@ -43,7 +42,7 @@ func NewTranscoder(src av.AudioCodecData,
 	} else {
 		// need
 		var decoder av.AudioDecoder
-		var encoder av.AudioEncoder
+		var encoder *ffmpeg.AudioEncoder
 		if decoder, err = ffmpeg.NewAudioDecoder(src); err != nil {
 			return
 		}
@@ -59,16 +58,26 @@ func NewTranscoder(src av.AudioCodecData,
 				encoder.SetOption(k, v)
 			}
 		}
-		var dst av.AudioCodecData
-		if dst, err = encoder.CodecData(); err != nil {
+		var audio *transcode.AudioTranscoder
+		if audio, err = transcode.NewAudioTranscoder(decoder, encoder); err != nil {
 			return
 		}
+		// decoded frames are resampled and re-chunked to encoder frames before encoding
+		resampler := &ffmpeg.Resampler{
+			OutSampleFormat:  encoder.SampleFormat,
+			OutSampleRate:    encoder.SampleRate,
+			OutChannelLayout: encoder.ChannelLayout,
+		}
+		audio.Resampler = resampler
+		audio.FrameSampleCount = encoder.FrameSampleCount
 
 		trans = &PacketTranscoder{
 			adecodec:      src,
-			aencodec:      dst,
+			aencodec:      audio.CodecData(),
 			decoder:       decoder,
 			encoder:       encoder,
+			resampler:     resampler,
+			audio:         audio,
 			needTranscode: true,
 		}
 
@@ -93,13 +102,22 @@ func (trans *PacketTranscoder) Do(src av.Packet) (out []av.Packet, err error) {
 	if !trans.needTranscode {
 		out = []av.Packet{src}
 	} else {
-		if out, err = trans.decodeAndEncode(src); err != nil {
+		if out, err = trans.audio.Do(src); err != nil {
 			return
 		}
 	}
 	return
 }
 
+// Flush returns packets left in decoder and encoder at end of stream,
+// transcoder can not be used after it
+func (trans *PacketTranscoder) Flush() (out []av.Packet, err error) {
+	if !trans.needTranscode {
+		return
+	}
+	return trans.audio.Flush()
+}
+
 // Close close transcoder
 func (trans *PacketTranscoder) Close() (err error) {
 	if trans.decoder != nil {
@@ -112,47 +130,9 @@ func (trans *PacketTranscoder) Close() (err error) {
 		trans.encoder = nil
 	}
 
-	return
-}
-
-func (trans *PacketTranscoder) decodeAndEncode(src av.Packet) (out []av.Packet, err error) {
-	var dur time.Duration
-	var frame av.AudioFrame
-	var ok bool
-	if ok, frame, err = trans.decoder.Decode(src.Data); err != nil {
-		return
-	}
-	if !ok {
-		return
-	}
-
-	if dur, err = trans.adecodec.PacketDuration(src.Data); err != nil {
-		err = fmt.Errorf("transcode: PacketDuration() failed for input stream #%d", src.Idx)
-		return
-	}
-
-	if debug {
-		fmt.Println("transcode: push", src.Time, dur)
-		log.Println("transcode push", src.Time, dur)
-	}
-
-	var encodedPkts [][]byte
-	if encodedPkts, err = trans.encoder.Encode(frame); err != nil {
-		return
-	}
-	for _, encPkt := range encodedPkts {
-		if dur, err = trans.aencodec.PacketDuration(encPkt); err != nil {
-			err = fmt.Errorf("transcode: PacketDuration() failed for output stream #%d", src.Idx)
-			return
-		}
-		outpkt := av.Packet{Idx: src.Idx, Data: encPkt}
-		outpkt.Time = src.Time
-
-		if debug {
-			fmt.Println("transcode: pop ", outpkt.Time, dur)
-		}
-
-		out = append(out, outpkt)
+	if trans.resampler != nil {
+		trans.resampler.Close()
+		trans.resampler = nil
 	}
 
 	return
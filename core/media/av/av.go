@@ -3,6 +3,7 @@ package av
 
 import (
 	"fmt"
+	"image"
 	"time"
 )
 
@@ -136,12 +137,22 @@ var (
 	H264 = MakeVideoCodecType(avCodecTypeMagic + 1)
 	JPEG = MakeVideoCodecType(avCodecTypeMagic + 2)
 	HEVC = MakeVideoCodecType(avCodecTypeMagic + 3)
+	// MPEG4 is MPEG-4 Part 2 visual
+	MPEG4 = MakeVideoCodecType(avCodecTypeMagic + 4)
+	// H263 is Sorenson H.263 of flv, not ITU-T H.263
+	H263 = MakeVideoCodecType(avCodecTypeMagic + 5)
 
 	// define audio
-	AAC  = MakeAudioCodecType(avCodecTypeMagic + 1)
-	PCMU = MakeAudioCodecType(avCodecTypeMagic + 2)
-	PCMA = MakeAudioCodecType(avCodecTypeMagic + 3)
-	MP3  = MakeAudioCodecType(avCodecTypeMagic + 4)
+	AAC   = MakeAudioCodecType(avCodecTypeMagic + 1)
+	PCMU  = MakeAudioCodecType(avCodecTypeMagic + 2)
+	PCMA  = MakeAudioCodecType(avCodecTypeMagic + 3)
+	MP3   = MakeAudioCodecType(avCodecTypeMagic + 4)
+	SPEEX = MakeAudioCodecType(avCodecTypeMagic + 5)
+	AC3   = MakeAudioCodecType(avCodecTypeMagic + 6)
+
+	// define data
+	KLV  = MakeDataCodecType(avCodecTypeDataMagic + 1)
+	DATA = MakeDataCodecType(avCodecTypeDataMagic + 2)
 )
 
 const codecTypeAudioBit = 0x1
@@ -157,6 +168,10 @@ func (ctype CodecType) String() string {
 		return "JPEG"
 	case HEVC:
 		return "HEVC"
+	case MPEG4:
+		return "MPEG4"
+	case H263:
+		return "H263"
 
 	// from audio
 	case AAC:
@@ -167,6 +182,16 @@ func (ctype CodecType) String() string {
 		return "PCMA"
 	case MP3:
 		return "MP3"
+	case SPEEX:
+		return "SPEEX"
+	case AC3:
+		return "AC3"
+
+	// from data
+	case KLV:
+		return "KLV"
+	case DATA:
+		return "DATA"
 	}
 	return ""
 }
@@ -181,6 +206,10 @@ func (ctype CodecType) CodecName() string {
 		return "jpeg"
 	case HEVC:
 		return "hevc"
+	case MPEG4:
+		return "mpeg4"
+	case H263:
+		return "flv"
 
 	// from audio
 	case AAC:
@@ -191,6 +220,10 @@ func (ctype CodecType) CodecName() string {
 		return "pcm_alaw"
 	case MP3:
 		return "libmp3lame"
+	case SPEEX:
+		return "libspeex"
+	case AC3:
+		return "ac3"
 	}
 	return ""
 }
@@ -202,7 +235,12 @@ func (ctype CodecType) IsAudio() bool {
 
 // IsVideo IsVideo
 func (ctype CodecType) IsVideo() bool {
-	return ctype&codecTypeAudioBit == 0
+	return ctype&codecTypeAudioBit == 0 && !ctype.IsData()
+}
+
+// IsData IsData
+func (ctype CodecType) IsData() bool {
+	return ctype&codecTypeAudioBit == 0 && uint32(ctype>>codecTypeOtherBits) >= avCodecTypeDataMagic
 }
 
 // MakeAudioCodecType Make a new audio codec type.
@@ -217,12 +255,19 @@ func MakeVideoCodecType(base uint32) (c CodecType) {
 	return
 }
 
+// MakeDataCodecType Make a new data codec type.
+func MakeDataCodecType(base uint32) (c CodecType) {
+	c = CodecType(base) << codecTypeOtherBits
+	return
+}
+
 const avCodecTypeMagic = 0x10000
+const avCodecTypeDataMagic = 0x20000
 
 // CodecData is some important bytes for initializing audio/video decoder,
 // can be converted to VideoCodecData or AudioCodecData using:
 //
-//     codecdata.(AudioCodecData) or codecdata.(VideoCodecData)
+//	codecdata.(AudioCodecData) or codecdata.(VideoCodecData)
 //
 // for H264, CodecData is AVCDecoderConfigure bytes, includes SPS/PPS.
 type CodecData interface {
@@ -349,6 +394,10 @@ func (frame AudioFrame) Slice(start int, end int) (out AudioFrame) {
 	out.Data = append([][]byte(nil), out.Data...)
 	out.SampleCount = end - start
 	size := frame.SampleFormat.BytesPerSample()
+	// packed samples of all channels are interleaved in one plane
+	if !frame.SampleFormat.IsPlanar() {
+		size *= frame.ChannelLayout.Count()
+	}
 	for i := range out.Data {
 		out.Data[i] = out.Data[i][start*size : end*size]
 	}
@@ -387,7 +436,49 @@ type AudioDecoder interface {
 	Close()                                  // close decode, free cgo contexts
 }
 
+// AudioEncoderFlusher is implemented by AudioEncoder which buffers samples.
+// It is checked by type assertion, so AudioEncoder without Flush still works.
+type AudioEncoderFlusher interface {
+	Flush() ([][]byte, error) // encode buffered samples and return last packets at end of stream
+}
+
+// AudioDecoderFlusher is implemented by AudioDecoder which buffers frames.
+// It is checked by type assertion, so AudioDecoder without Flush still works.
+type AudioDecoderFlusher interface {
+	Flush() ([]AudioFrame, error) // return frames buffered in decoder at end of stream
+}
+
 // AudioResampler can convert raw audio frames in different sample rate/format/channel layout.
 type AudioResampler interface {
 	Resample(AudioFrame) (AudioFrame, error) // convert raw audio frames
 }
+
+// VideoFrame Raw video frame.
+type VideoFrame struct {
+	Image image.YCbCr   // planar YUV image, chroma subsampling is in Image.SubsampleRatio
+	Time  time.Duration // presentation time
+}
+
+// VideoEncoder can encode raw video frame into compressed video packets.
+// cgo/ffmpeg implements VideoEncoder, using ffmpeg.NewVideoEncoderByCodecType to create it.
+// CodecData of H264 encoder can be muxed by mp4, flv and ts, MPEG4 by mp4 and H263 by flv.
+type VideoEncoder interface {
+	CodecData() (VideoCodecData, error)  // encoder's codec data can put into container
+	Encode(VideoFrame) ([]Packet, error) // encode raw video frame into compressed packet(s), with keyframe flag and PTS/DTS
+	Flush() ([]Packet, error)            // return packets buffered in encoder at end of stream
+	Close()                              // close encoder, free cgo contexts
+	SetFrameSize(int, int) error         // set encoder width and height
+	SetFrameRate(int, int) error         // set encoder frame rate, numerator and denominator
+	SetBitrate(int) error                // set encoder bitrate
+	SetGOP(int) error                    // set keyframe interval in frames
+	SetOption(string, interface{}) error // encoder setopt, in ffmpeg is av_opt_set_dict()
+	GetOption(string, interface{}) error // encoder getopt
+}
+
+// VideoDecoder can decode compressed video packets into raw video frame.
+// use ffmpeg.NewVideoDecoder to create it.
+type VideoDecoder interface {
+	DecodePacket(Packet) ([]VideoFrame, error) // decode one compressed video packet, frame Time is its presentation time
+	Flush() ([]VideoFrame, error)              // return frames buffered in decoder at end of stream
+	Close()                                    // close decode, free cgo contexts
+}
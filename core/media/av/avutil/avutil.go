@@ -72,6 +72,8 @@ type RegisterHandler struct {
 	Probe         func([]byte) bool
 	AudioEncoder  func(av.CodecType) (av.AudioEncoder, error)
 	AudioDecoder  func(av.AudioCodecData) (av.AudioDecoder, error)
+	VideoEncoder  func(av.CodecType) (av.VideoEncoder, error)
+	VideoDecoder  func(av.VideoCodecData) (av.VideoDecoder, error)
 	ServerDemuxer func(string) (bool, av.DemuxCloser, error)
 	ServerMuxer   func(string) (bool, av.MuxCloser, error)
 	CodecTypes    []av.CodecType
@@ -130,6 +132,19 @@ func (hndl *Handlers) NewAudioEncoder(typ av.CodecType) (enc av.AudioEncoder, er
 	return
 }
 
+// NewVideoEncoder NewVideoEncoder
+func (hndl *Handlers) NewVideoEncoder(typ av.CodecType) (enc av.VideoEncoder, err error) {
+	for _, handler := range hndl.handlers {
+		if handler.VideoEncoder != nil {
+			if enc, _ = handler.VideoEncoder(typ); enc != nil {
+				return
+			}
+		}
+	}
+	err = fmt.Errorf("avutil: encoder %s %s", typ, "not found")
+	return
+}
+
 // NewAudioDecoderParam NewAudioDecoderParam
 func (hndl *Handlers) NewAudioDecoderParam(codec av.AudioCodecData) (dec av.AudioDecoder, err error) {
 	for _, handler := range hndl.handlers {
@@ -143,6 +158,19 @@ func (hndl *Handlers) NewAudioDecoderParam(codec av.AudioCodecData) (dec av.Audi
 	return
 }
 
+// NewVideoDecoderParam NewVideoDecoderParam
+func (hndl *Handlers) NewVideoDecoderParam(codec av.VideoCodecData) (dec av.VideoDecoder, err error) {
+	for _, handler := range hndl.handlers {
+		if handler.VideoDecoder != nil {
+			if dec, _ = handler.VideoDecoder(codec); dec != nil {
+				return
+			}
+		}
+	}
+	err = fmt.Errorf("avutil: decoder %d not found", codec.Type())
+	return
+}
+
 // Open Open
 func (hndl *Handlers) Open(uri string) (demuxer av.DemuxCloser, err error) {
 	listen := false
@@ -6,8 +6,8 @@ import (
 	"sync"
 	"time"
 
-	"../../av"
-	"../../av/pktque"
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/av/pktque"
 )
 
 //        time
@@ -179,6 +179,25 @@ func (instance *Queue) DelayedGopCount(n int) *QueueCursor {
 	return cursor
 }
 
+// LatestGop Create cursor position at keyframe of latest GOP in buffered packets,
+// or at latest packet if there is no video.
+func (instance *Queue) LatestGop() *QueueCursor {
+	cursor := instance.newCursor()
+	cursor.init = func(buf *pktque.Buf, videoidx int) pktque.BufPos {
+		if videoidx == -1 {
+			return buf.Tail
+		}
+		for i := buf.Tail - 1; buf.IsValidPos(i); i-- {
+			pkt := buf.Get(i)
+			if pkt.Idx == int8(videoidx) && pkt.IsKeyFrame {
+				return i
+			}
+		}
+		return buf.Head
+	}
+	return cursor
+}
+
 // Streams func
 func (instance *QueueCursor) Streams() (streams []av.CodecData, err error) {
 	instance.que.cond.L.Lock()
@@ -0,0 +1,76 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/codec"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/fake"
+)
+
+// testQueue writes audio stream 0 and video stream 1, keyframe every 3 video packets
+func testQueue(t *testing.T, video bool) (que *Queue, pkts []av.Packet) {
+	streams := []av.CodecData{codec.NewPCMMulawCodecData()}
+	if video {
+		streams = append(streams, fake.CodecData{CodecTypeItem: av.H264})
+	}
+	que = NewQueue()
+	que.SetMaxGopCount(4)
+	if err := que.WriteHeader(streams); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 8; i++ {
+		pkts = append(pkts, av.Packet{Idx: 0, Time: time.Duration(i) * 40 * time.Millisecond})
+		if video {
+			pkts = append(pkts, av.Packet{Idx: 1, IsKeyFrame: i%3 == 0, Time: time.Duration(i) * 40 * time.Millisecond})
+		}
+	}
+	for _, pkt := range pkts {
+		if err := que.WritePacket(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	que.Close()
+	return
+}
+
+func testReadCursor(t *testing.T, cursor *QueueCursor) (pkts []av.Packet) {
+	for {
+		pkt, err := cursor.ReadPacket()
+		if err != nil {
+			return
+		}
+		pkts = append(pkts, pkt)
+	}
+}
+
+func TestQueueCursor(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		video  bool
+		cursor func(que *Queue) *QueueCursor
+		// index of first packet read in written packets
+		start int
+	}{
+		{"oldest", true, (*Queue).Oldest, 0},
+		{"latest", true, (*Queue).Latest, 16},
+		// packet before keyframe of latest GOP
+		{"delayed gop count", true, func(que *Queue) *QueueCursor { return que.DelayedGopCount(1) }, 12},
+		{"latest gop", true, (*Queue).LatestGop, 13},
+		{"latest gop without video", false, (*Queue).LatestGop, 8},
+	} {
+		que, pkts := testQueue(t, test.video)
+		got := testReadCursor(t, test.cursor(que))
+		want := pkts[test.start:]
+		if len(got) != len(want) {
+			t.Errorf("%s: read %d packets, want %d", test.name, len(got), len(want))
+			continue
+		}
+		for i := range got {
+			if got[i].Idx != want[i].Idx || got[i].Time != want[i].Time || got[i].IsKeyFrame != want[i].IsKeyFrame {
+				t.Errorf("%s: packet#%d=%+v, want %+v", test.name, i, got[i], want[i])
+			}
+		}
+	}
+}
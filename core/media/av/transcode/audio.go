@@ -0,0 +1,281 @@
+package transcode
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+)
+
+// DefaultMaxAudioGap is MaxGap of NewAudioTranscoder
+const DefaultMaxAudioGap = time.Second
+
+// audio clock restarts at start, output sample index, with time base
+type audioSegment struct {
+	start int64
+	base  time.Duration
+}
+
+// AudioTranscoder decodes and encodes audio packets, encoded packets are stamped by
+// sample accurate output clock instead of time of input packets.
+type AudioTranscoder struct {
+	Resampler        av.AudioResampler // converts decoded frames into format of encoder, encoder converts them if nil
+	FrameSampleCount int               // decoded frames are re-chunked to it, 0 if encoder re-chunks or accepts any size
+	MaxGap           time.Duration     // gaps up to MaxGap are filled with silence, larger gaps restart clock
+
+	dec    av.AudioDecoder
+	enc    av.AudioEncoder
+	codec  av.AudioCodecData // output codec
+	idx    int8
+	buf    av.AudioFrame // samples less than FrameSampleCount
+	inBase time.Duration // expected time of next input sample is inBase + inSamples/inRate
+	inRate int
+	// samples fed since inBase, fed output samples before inBase
+	inSamples, fedOut int64
+	outSamples        int64 // output samples of encoded packets
+	segs              []audioSegment
+}
+
+// NewAudioTranscoder func
+func NewAudioTranscoder(dec av.AudioDecoder, enc av.AudioEncoder) (trans *AudioTranscoder, err error) {
+	var codec av.AudioCodecData
+	if codec, err = enc.CodecData(); err != nil {
+		return
+	}
+	trans = &AudioTranscoder{
+		MaxGap: DefaultMaxAudioGap,
+		dec:    dec,
+		enc:    enc,
+		codec:  codec,
+	}
+	return
+}
+
+// CodecData returns codec data of encoder
+func (trans *AudioTranscoder) CodecData() av.AudioCodecData {
+	return trans.codec
+}
+
+// fed returns count of output samples fed into encoder
+func (trans *AudioTranscoder) fed() int64 {
+	if trans.inRate == 0 {
+		return trans.fedOut
+	}
+	return trans.fedOut + trans.inSamples*int64(trans.codec.SampleRate())/int64(trans.inRate)
+}
+
+// restart starts new clock segment at tm
+func (trans *AudioTranscoder) restart(tm time.Duration, rate int) {
+	trans.fedOut = trans.fed()
+	trans.inBase = tm
+	trans.inSamples = 0
+	trans.inRate = rate
+	trans.segs = append(trans.segs, audioSegment{start: trans.fedOut, base: tm})
+}
+
+// silence makes frame of n samples in format of frame
+func silence(frame av.AudioFrame, n int) (out av.AudioFrame) {
+	out = frame
+	out.SampleCount = n
+	size := n * frame.SampleFormat.BytesPerSample()
+	if !frame.SampleFormat.IsPlanar() {
+		size *= frame.ChannelLayout.Count()
+	}
+	out.Data = make([][]byte, len(frame.Data))
+	for i := range out.Data {
+		out.Data[i] = make([]byte, size)
+		if frame.SampleFormat == av.U8 || frame.SampleFormat == av.U8P {
+			for j := range out.Data[i] {
+				out.Data[i][j] = 0x80
+			}
+		}
+	}
+	return
+}
+
+// sync checks time of frame against input clock. Gap is filled with silence, overlap of
+// early frame is trimmed or frame is dropped, and clock is restarted if they are larger than MaxGap.
+func (trans *AudioTranscoder) sync(tm time.Duration, frame av.AudioFrame) (in av.AudioFrame, out []av.Packet, err error) {
+	in = frame
+	if len(trans.segs) == 0 || frame.SampleRate != trans.inRate {
+		trans.restart(tm, frame.SampleRate)
+		return
+	}
+
+	expected := trans.inBase + time.Duration(trans.inSamples)*time.Second/time.Duration(trans.inRate)
+	gap := tm - expected
+	tolerance := frame.Duration() / 2
+	switch {
+	case gap >= -tolerance && gap <= tolerance:
+	case gap > 0 && gap <= trans.MaxGap:
+		n := int(int64(gap) * int64(frame.SampleRate) / int64(time.Second))
+		if Debug {
+			fmt.Println("transcode: insert silence", expected, gap, n)
+		}
+		out, err = trans.feed(silence(frame, n))
+	case gap < 0 && gap >= -trans.MaxGap:
+		n := int(int64(-gap) * int64(frame.SampleRate) / int64(time.Second))
+		if n > frame.SampleCount {
+			n = frame.SampleCount
+		}
+		if Debug {
+			fmt.Println("transcode: drop overlap", expected, gap, n)
+		}
+		in = frame.Slice(n, frame.SampleCount)
+	default:
+		if Debug {
+			fmt.Println("transcode: restart clock", expected, tm)
+		}
+		trans.restart(tm, frame.SampleRate)
+	}
+	return
+}
+
+// feed passes decoded frame to encoder, re-chunked to FrameSampleCount
+func (trans *AudioTranscoder) feed(frame av.AudioFrame) (out []av.Packet, err error) {
+	trans.inSamples += int64(frame.SampleCount)
+
+	if trans.Resampler != nil && (frame.SampleFormat != trans.codec.SampleFormat() ||
+		frame.ChannelLayout != trans.codec.ChannelLayout() || frame.SampleRate != trans.codec.SampleRate()) {
+		if frame, err = trans.Resampler.Resample(frame); err != nil {
+			return
+		}
+	}
+	if trans.FrameSampleCount == 0 {
+		return trans.encode(frame)
+	}
+
+	if trans.buf.SampleCount == 0 {
+		trans.buf = frame
+	} else {
+		trans.buf = trans.buf.Concat(frame)
+	}
+	var pkts []av.Packet
+	for trans.buf.SampleCount >= trans.FrameSampleCount {
+		chunk := trans.buf.Slice(0, trans.FrameSampleCount)
+		trans.buf = trans.buf.Slice(trans.FrameSampleCount, trans.buf.SampleCount)
+		if pkts, err = trans.encode(chunk); err != nil {
+			return
+		}
+		out = append(out, pkts...)
+	}
+	return
+}
+
+func (trans *AudioTranscoder) encode(frame av.AudioFrame) (out []av.Packet, err error) {
+	if frame.SampleCount == 0 {
+		return
+	}
+	var data [][]byte
+	if data, err = trans.enc.Encode(frame); err != nil {
+		return
+	}
+	return trans.stamp(data)
+}
+
+// stamp makes packets of encoded data, time is taken from output sample index
+func (trans *AudioTranscoder) stamp(data [][]byte) (out []av.Packet, err error) {
+	rate := int64(trans.codec.SampleRate())
+	for _, b := range data {
+		var n int64
+		if dur, derr := trans.codec.PacketDuration(b); derr == nil {
+			n = (int64(dur)*rate + int64(time.Second)/2) / int64(time.Second)
+		} else if trans.FrameSampleCount != 0 {
+			n = int64(trans.FrameSampleCount)
+		} else {
+			err = fmt.Errorf("transcode: PacketDuration() failed for output stream #%d", trans.idx)
+			return
+		}
+
+		for len(trans.segs) > 1 && trans.segs[1].start <= trans.outSamples {
+			trans.segs = trans.segs[1:]
+		}
+		seg := trans.segs[0]
+		pkt := av.Packet{Idx: trans.idx, Data: b}
+		pkt.Time = seg.base + time.Duration((trans.outSamples-seg.start)*int64(time.Second)/rate)
+		trans.outSamples += n
+
+		if Debug {
+			fmt.Println("transcode: pop", pkt.Time, n)
+		}
+		out = append(out, pkt)
+	}
+	return
+}
+
+// Do decodes packet and returns encoded packets
+func (trans *AudioTranscoder) Do(pkt av.Packet) (out []av.Packet, err error) {
+	var frame av.AudioFrame
+	var ok bool
+	trans.idx = pkt.Idx
+	if ok, frame, err = trans.dec.Decode(pkt.Data); err != nil {
+		return
+	}
+	if !ok {
+		return
+	}
+
+	if Debug {
+		fmt.Println("transcode: push", pkt.Time, frame.Duration())
+	}
+	var pkts []av.Packet
+	if frame, out, err = trans.sync(pkt.Time, frame); err != nil {
+		return
+	}
+	// frame overlapped by earlier input is dropped
+	if frame.SampleCount == 0 {
+		return
+	}
+	if pkts, err = trans.feed(frame); err != nil {
+		return
+	}
+	out = append(out, pkts...)
+	return
+}
+
+// Flush returns packets of samples left in decoder, chunk buffer and encoder at end of stream.
+// Decoder and encoder are flushed if they implement av.AudioDecoderFlusher and av.AudioEncoderFlusher.
+func (trans *AudioTranscoder) Flush() (out []av.Packet, err error) {
+	var frames []av.AudioFrame
+	if flusher, ok := trans.dec.(av.AudioDecoderFlusher); ok {
+		if frames, err = flusher.Flush(); err != nil {
+			return
+		}
+	}
+	var pkts []av.Packet
+	for _, frame := range frames {
+		// frames left in decoder follow last input
+		if len(trans.segs) == 0 {
+			trans.restart(0, frame.SampleRate)
+		}
+		if pkts, err = trans.feed(frame); err != nil {
+			return
+		}
+		out = append(out, pkts...)
+	}
+
+	// last chunk may be shorter
+	buf := trans.buf
+	trans.buf = av.AudioFrame{}
+	if pkts, err = trans.encode(buf); err != nil {
+		return
+	}
+	out = append(out, pkts...)
+
+	flusher, ok := trans.enc.(av.AudioEncoderFlusher)
+	if !ok {
+		return
+	}
+	var data [][]byte
+	if data, err = flusher.Flush(); err != nil {
+		return
+	}
+	if len(trans.segs) == 0 {
+		return
+	}
+	if pkts, err = trans.stamp(data); err != nil {
+		return
+	}
+	out = append(out, pkts...)
+	return
+}
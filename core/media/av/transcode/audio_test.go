@@ -0,0 +1,322 @@
+package transcode
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/fake"
+)
+
+const (
+	testSampleRate  = 8000
+	testFrameSize   = 160 // 20ms
+	testChunkSize   = 1024
+	testSampleBytes = 4 // S16 stereo
+)
+
+// testAudioCodecData is S16 stereo, packet holds raw samples
+type testAudioCodecData struct {
+	fake.CodecData
+}
+
+func (codec testAudioCodecData) PacketDuration(b []byte) (time.Duration, error) {
+	return time.Duration(len(b)/testSampleBytes) * time.Second / testSampleRate, nil
+}
+
+// testAudioDecoder returns packet data as samples
+type testAudioDecoder struct{}
+
+func (dec testAudioDecoder) Decode(b []byte) (bool, av.AudioFrame, error) {
+	return true, av.AudioFrame{
+		SampleFormat:  av.S16,
+		ChannelLayout: av.ChStereo,
+		SampleRate:    testSampleRate,
+		SampleCount:   len(b) / testSampleBytes,
+		Data:          [][]byte{b},
+	}, nil
+}
+
+func (dec testAudioDecoder) Close() {}
+
+// testTailAudioDecoder returns tail packets as frames left in decoder
+type testTailAudioDecoder struct {
+	testAudioDecoder
+	tail [][]byte
+}
+
+func (dec *testTailAudioDecoder) Flush() (frames []av.AudioFrame, err error) {
+	for _, b := range dec.tail {
+		_, frame, _ := dec.Decode(b)
+		frames = append(frames, frame)
+	}
+	dec.tail = nil
+	return
+}
+
+// testAudioEncoder returns samples of frame as packet
+type testAudioEncoder struct{}
+
+func (enc testAudioEncoder) CodecData() (av.AudioCodecData, error) {
+	return testAudioCodecData{fake.CodecData{
+		CodecTypeItem:     av.PCMA,
+		SampleRateItem:    testSampleRate,
+		SampleFormatItem:  av.S16,
+		ChannelLayoutItem: av.ChStereo,
+	}}, nil
+}
+
+func (enc testAudioEncoder) Encode(frame av.AudioFrame) ([][]byte, error) {
+	return [][]byte{append([]byte{}, frame.Data[0]...)}, nil
+}
+
+func (enc testAudioEncoder) Close()                                  {}
+func (enc testAudioEncoder) SetSampleRate(int) error                 { return nil }
+func (enc testAudioEncoder) SetChannelLayout(av.ChannelLayout) error { return nil }
+func (enc testAudioEncoder) SetSampleFormat(av.SampleFormat) error   { return nil }
+func (enc testAudioEncoder) SetBitrate(int) error                    { return nil }
+func (enc testAudioEncoder) SetOption(string, interface{}) error     { return nil }
+func (enc testAudioEncoder) GetOption(string, interface{}) error     { return nil }
+
+// testDelayAudioEncoder holds one frame like encoders with lookahead
+type testDelayAudioEncoder struct {
+	testAudioEncoder
+	held []byte
+}
+
+func (enc *testDelayAudioEncoder) Encode(frame av.AudioFrame) (pkts [][]byte, err error) {
+	if enc.held != nil {
+		pkts = append(pkts, enc.held)
+	}
+	enc.held = append([]byte{}, frame.Data[0]...)
+	return
+}
+
+func (enc *testDelayAudioEncoder) Flush() (pkts [][]byte, err error) {
+	if enc.held != nil {
+		pkts = append(pkts, enc.held)
+	}
+	enc.held = nil
+	return
+}
+
+// testAudioFrame makes 20ms packet #i, every sample holds its index
+func testAudioFrame(i int) []byte {
+	b := make([]byte, testFrameSize*testSampleBytes)
+	for j := 0; j < testFrameSize; j++ {
+		v := i*testFrameSize + j
+		b[j*4], b[j*4+1] = byte(v>>8), byte(v)
+		b[j*4+2], b[j*4+3] = byte(v>>8), byte(v)
+	}
+	return b
+}
+
+func testFrameTime(i int) time.Duration {
+	return time.Duration(i) * 20 * time.Millisecond
+}
+
+// testSegment is run of expected output samples with time of its first sample
+type testSegment struct {
+	time time.Duration
+	data []byte
+}
+
+func TestAudioTranscoder(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		// times of input packets, -1 skips packet
+		times  []time.Duration
+		maxGap time.Duration
+		segs   []testSegment
+	}{
+		{
+			name:  "continuous with jitter",
+			times: testTimes(50, func(i int, tm time.Duration) time.Duration { return tm + time.Duration(i%3)*time.Millisecond }),
+			segs:  []testSegment{{0, testFrames(0, 50)}},
+		},
+		{
+			name:  "small gap filled with silence",
+			times: testTimes(30, func(i int, tm time.Duration) time.Duration { return testSkip(i >= 10 && i < 12, tm) }),
+			segs: []testSegment{{0, bytes.Join([][]byte{
+				testFrames(0, 10), make([]byte, 2*testFrameSize*testSampleBytes), testFrames(12, 30),
+			}, nil)}},
+		},
+		{
+			name: "large gap restarts clock",
+			times: testTimes(30, func(i int, tm time.Duration) time.Duration {
+				if i >= 10 {
+					return tm + 2*time.Second
+				}
+				return tm
+			}),
+			segs: []testSegment{
+				{0, testFrames(0, 10)},
+				{testFrameTime(10) + 2*time.Second, testFrames(10, 30)},
+			},
+		},
+		{
+			name: "early input is trimmed",
+			times: testTimes(30, func(i int, tm time.Duration) time.Duration {
+				if i >= 10 {
+					return tm - 15*time.Millisecond
+				}
+				return tm
+			}),
+			segs: []testSegment{{0, bytes.Join([][]byte{
+				testFrames(0, 10), testAudioFrame(10)[120*testSampleBytes:], testFrames(11, 30),
+			}, nil)}},
+		},
+		{
+			name: "overlapped input is dropped",
+			times: testTimes(30, func(i int, tm time.Duration) time.Duration {
+				if i == 10 {
+					return testFrameTime(8)
+				}
+				return tm
+			}),
+			// hole left by dropped input is filled with silence
+			segs: []testSegment{{0, bytes.Join([][]byte{
+				testFrames(0, 10), make([]byte, testFrameSize*testSampleBytes), testFrames(11, 30),
+			}, nil)}},
+		},
+		{
+			name: "large backward jump restarts clock",
+			times: testTimes(60, func(i int, tm time.Duration) time.Duration {
+				if i >= 30 {
+					return tm - testFrameTime(30)
+				}
+				return tm
+			}),
+			maxGap: 500 * time.Millisecond,
+			segs: []testSegment{
+				{0, testFrames(0, 30)},
+				{0, testFrames(30, 60)},
+			},
+		},
+	} {
+		trans, err := NewAudioTranscoder(testAudioDecoder{}, testAudioEncoder{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		trans.FrameSampleCount = testChunkSize
+		if test.maxGap != 0 {
+			trans.MaxGap = test.maxGap
+		}
+
+		var out []av.Packet
+		for i, tm := range test.times {
+			if tm < 0 {
+				continue
+			}
+			pkts, err := trans.Do(av.Packet{Idx: 1, Time: tm, Data: testAudioFrame(i)})
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			out = append(out, pkts...)
+		}
+		pkts, err := trans.Flush()
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		out = append(out, pkts...)
+
+		testCheckAudio(t, test.name, out, test.segs)
+	}
+}
+
+func TestAudioTranscoderFlush(t *testing.T) {
+	const n = 30
+	dec := &testTailAudioDecoder{tail: [][]byte{testAudioFrame(n)}}
+	trans, err := NewAudioTranscoder(dec, &testDelayAudioEncoder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trans.FrameSampleCount = testChunkSize
+
+	var out []av.Packet
+	for i := 0; i < n; i++ {
+		pkts, err := trans.Do(av.Packet{Idx: 1, Time: testFrameTime(i), Data: testAudioFrame(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, pkts...)
+	}
+	pkts, err := trans.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// chunk held by encoder and short chunk with frame left in decoder
+	if len(pkts) != 2 {
+		t.Errorf("flushed %d packets, want 2", len(pkts))
+	}
+	out = append(out, pkts...)
+	testCheckAudio(t, "flush", out, []testSegment{{0, testFrames(0, n+1)}})
+}
+
+func testTimes(n int, f func(i int, tm time.Duration) time.Duration) (times []time.Duration) {
+	for i := 0; i < n; i++ {
+		times = append(times, f(i, testFrameTime(i)))
+	}
+	return
+}
+
+func testSkip(skip bool, tm time.Duration) time.Duration {
+	if skip {
+		return -1
+	}
+	return tm
+}
+
+func testFrames(start, end int) (b []byte) {
+	for i := start; i < end; i++ {
+		b = append(b, testAudioFrame(i)...)
+	}
+	return
+}
+
+// testCheckAudio checks samples of output are those of segs, all but last packet are chunks, and
+// time of packet is time of its first sample, packets starting in segment are stamped by its clock
+func testCheckAudio(t *testing.T, name string, out []av.Packet, segs []testSegment) {
+	var want, got []byte
+	// output sample index where segment starts
+	starts := []int{}
+	for _, seg := range segs {
+		starts = append(starts, len(want)/testSampleBytes)
+		want = append(want, seg.data...)
+	}
+
+	pos := 0
+	for i, pkt := range out {
+		n := len(pkt.Data) / testSampleBytes
+		if pkt.Idx != 1 {
+			t.Errorf("%s: packet#%d idx=%d", name, i, pkt.Idx)
+		}
+		if n != testChunkSize && i != len(out)-1 {
+			t.Errorf("%s: packet#%d has %d samples", name, i, n)
+		}
+
+		seg := 0
+		for seg+1 < len(starts) && starts[seg+1] <= pos {
+			seg++
+		}
+		wantTime := segs[seg].time + time.Duration(pos-starts[seg])*time.Second/testSampleRate
+		if pkt.Time != wantTime {
+			t.Errorf("%s: packet#%d time=%v, want %v", name, i, pkt.Time, wantTime)
+		}
+		if i > 0 && seg == 0 && pkt.Time <= out[i-1].Time {
+			t.Errorf("%s: packet#%d time=%v is not after %v", name, i, pkt.Time, out[i-1].Time)
+		}
+		got = append(got, pkt.Data...)
+		pos += n
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s: %d samples, want %d samples", name, len(got)/testSampleBytes, len(want)/testSampleBytes)
+		for i := 0; i < len(got) && i < len(want); i += testSampleBytes {
+			if !bytes.Equal(got[i:i+testSampleBytes], want[i:i+testSampleBytes]) {
+				t.Errorf("%s: first different sample #%d", name, i/testSampleBytes)
+				break
+			}
+		}
+	}
+}
@@ -1,23 +1,23 @@
-// Package transcode implements Transcoder based on Muxer/Demuxer and AudioEncoder/AudioDecoder interface.
+// Package transcode implements Transcoder based on Muxer/Demuxer, AudioEncoder/AudioDecoder and VideoEncoder/VideoDecoder interface.
 package transcode
 
 import (
 	"fmt"
-	"time"
+	"io"
 
 	"github.com/Youngju-Heo/gomedia/core/media/av"
-	"github.com/Youngju-Heo/gomedia/core/media/av/pktque"
 )
 
 // Debug type
 var Debug bool
 
 type tStream struct {
-	codec              av.CodecData
-	timeline           *pktque.Timeline
-	aencodec, adecodec av.AudioCodecData
-	aenc               av.AudioEncoder
-	adec               av.AudioDecoder
+	codec  av.CodecData
+	atrans *AudioTranscoder
+	aenc   av.AudioEncoder
+	adec   av.AudioDecoder
+	venc   av.VideoEncoder
+	vdec   av.VideoDecoder
 }
 
 // Options struct
@@ -26,11 +26,17 @@ type Options struct {
 	FindAudioDecoderEncoder func(codec av.AudioCodecData, i int) (
 		need bool, dec av.AudioDecoder, enc av.AudioEncoder, err error,
 	)
+	// check if transcode is needed, and create the VideoDecoder and VideoEncoder.
+	// frame size of enc must be set, frames are scaled into it and frame rate of enc drops frames if lower than input.
+	FindVideoDecoderEncoder func(codec av.VideoCodecData, i int) (
+		need bool, dec av.VideoDecoder, enc av.VideoEncoder, err error,
+	)
 }
 
 // Transcoder struct
 type Transcoder struct {
 	streams []*tStream
+	flushed bool
 }
 
 // NewTranscoder func
@@ -50,16 +56,32 @@ func NewTranscoder(streams []av.CodecData, options Options) (_self *Transcoder,
 					if err != nil {
 						return
 					}
-					ts.timeline = &pktque.Timeline{}
-					if ts.codec, err = enc.CodecData(); err != nil {
+					if ts.atrans, err = NewAudioTranscoder(dec, enc); err != nil {
 						return
 					}
-					ts.aencodec = ts.codec.(av.AudioCodecData)
-					ts.adecodec = stream.(av.AudioCodecData)
+					ts.atrans.idx = int8(i)
+					ts.codec = ts.atrans.CodecData()
 					ts.aenc = enc
 					ts.adec = dec
 				}
 			}
+		} else if stream.Type().IsVideo() {
+			if options.FindVideoDecoderEncoder != nil {
+				var ok bool
+				var enc av.VideoEncoder
+				var dec av.VideoDecoder
+				ok, dec, enc, err = options.FindVideoDecoderEncoder(stream.(av.VideoCodecData), i)
+				if ok {
+					if err != nil {
+						return
+					}
+					if ts.codec, err = enc.CodecData(); err != nil {
+						return
+					}
+					ts.venc = enc
+					ts.vdec = dec
+				}
+			}
 		}
 		instance.streams = append(instance.streams, ts)
 	}
@@ -68,46 +90,48 @@ func NewTranscoder(streams []av.CodecData, options Options) (_self *Transcoder,
 	return
 }
 
-func (instance *tStream) audioDecodeAndEncode(inpkt av.Packet) (outpkts []av.Packet, err error) {
-	var dur time.Duration
-	var frame av.AudioFrame
-	var ok bool
-	if ok, frame, err = instance.adec.Decode(inpkt.Data); err != nil {
+func (instance *tStream) videoDecodeAndEncode(inpkt av.Packet) (outpkts []av.Packet, err error) {
+	var frames []av.VideoFrame
+	if frames, err = instance.vdec.DecodePacket(inpkt); err != nil {
 		return
 	}
-	if !ok {
-		return
+	return instance.videoEncode(inpkt.Idx, frames)
+}
+
+func (instance *tStream) videoEncode(idx int8, frames []av.VideoFrame) (outpkts []av.Packet, err error) {
+	var pkts []av.Packet
+	for _, frame := range frames {
+		if Debug {
+			fmt.Println("transcode: frame", frame.Time)
+		}
+		if pkts, err = instance.venc.Encode(frame); err != nil {
+			return
+		}
+		outpkts = append(outpkts, pkts...)
 	}
+	for i := range outpkts {
+		outpkts[i].Idx = idx
+	}
+	return
+}
 
-	if dur, err = instance.adecodec.PacketDuration(inpkt.Data); err != nil {
-		err = fmt.Errorf("transcode: PacketDuration() failed for input stream #%d", inpkt.Idx)
+// videoFlush drains decoder and encoder
+func (instance *tStream) videoFlush(idx int8) (outpkts []av.Packet, err error) {
+	var frames []av.VideoFrame
+	if frames, err = instance.vdec.Flush(); err != nil {
 		return
 	}
-
-	if Debug {
-		fmt.Println("transcode: push", inpkt.Time, dur)
+	if outpkts, err = instance.videoEncode(idx, frames); err != nil {
+		return
 	}
-	instance.timeline.Push(inpkt.Time, dur)
-
-	var _outpkts [][]byte
-	if _outpkts, err = instance.aenc.Encode(frame); err != nil {
+	var pkts []av.Packet
+	if pkts, err = instance.venc.Flush(); err != nil {
 		return
 	}
-	for _, _outpkt := range _outpkts {
-		if dur, err = instance.aencodec.PacketDuration(_outpkt); err != nil {
-			err = fmt.Errorf("transcode: PacketDuration() failed for output stream #%d", inpkt.Idx)
-			return
-		}
-		outpkt := av.Packet{Idx: inpkt.Idx, Data: _outpkt}
-		outpkt.Time = instance.timeline.Pop(dur)
-
-		if Debug {
-			fmt.Println("transcode: pop", outpkt.Time, dur)
-		}
-
-		outpkts = append(outpkts, outpkt)
+	for i := range pkts {
+		pkts[i].Idx = idx
 	}
-
+	outpkts = append(outpkts, pkts...)
 	return
 }
 
@@ -115,10 +139,15 @@ func (instance *tStream) audioDecodeAndEncode(inpkt av.Packet) (outpkts []av.Pac
 //
 // In audio transcoding one Packet may transcode into many Packets
 // packet time will be adjusted automatically.
+// In video transcoding packets are reordered by encoder, Time and CompositionTime are DTS and PTS-DTS of encoder.
 func (instance *Transcoder) Do(pkt av.Packet) (out []av.Packet, err error) {
 	stream := instance.streams[pkt.Idx]
 	if stream.aenc != nil && stream.adec != nil {
-		if out, err = stream.audioDecodeAndEncode(pkt); err != nil {
+		if out, err = stream.atrans.Do(pkt); err != nil {
+			return
+		}
+	} else if stream.venc != nil && stream.vdec != nil {
+		if out, err = stream.videoDecodeAndEncode(pkt); err != nil {
 			return
 		}
 	} else {
@@ -127,6 +156,27 @@ func (instance *Transcoder) Do(pkt av.Packet) (out []av.Packet, err error) {
 	return
 }
 
+// Flush returns packets buffered in decoders and encoders at end of stream,
+// transcoder can not be used after it.
+func (instance *Transcoder) Flush() (out []av.Packet, err error) {
+	instance.flushed = true
+	var pkts []av.Packet
+	for i, stream := range instance.streams {
+		if stream.aenc != nil && stream.adec != nil {
+			if pkts, err = stream.atrans.Flush(); err != nil {
+				return
+			}
+			out = append(out, pkts...)
+		} else if stream.venc != nil && stream.vdec != nil {
+			if pkts, err = stream.videoFlush(int8(i)); err != nil {
+				return
+			}
+			out = append(out, pkts...)
+		}
+	}
+	return
+}
+
 // Streams Get CodecDatas after transcoding.
 func (instance *Transcoder) Streams() (streams []av.CodecData, err error) {
 	for _, stream := range instance.streams {
@@ -136,7 +186,14 @@ func (instance *Transcoder) Streams() (streams []av.CodecData, err error) {
 }
 
 // Close transcoder, close related encoder and decoders.
+// Transcoder is drained if Flush was not called, error is returned if packets are dropped.
 func (instance *Transcoder) Close() (err error) {
+	if !instance.flushed {
+		var pkts []av.Packet
+		if pkts, err = instance.Flush(); err == nil && len(pkts) > 0 {
+			err = fmt.Errorf("transcode: %d packets dropped, Flush not called before Close", len(pkts))
+		}
+	}
 	for _, stream := range instance.streams {
 		if stream.aenc != nil {
 			stream.aenc.Close()
@@ -146,6 +203,14 @@ func (instance *Transcoder) Close() (err error) {
 			stream.adec.Close()
 			stream.adec = nil
 		}
+		if stream.venc != nil {
+			stream.venc.Close()
+			stream.venc = nil
+		}
+		if stream.vdec != nil {
+			stream.vdec.Close()
+			stream.vdec = nil
+		}
 	}
 	instance.streams = nil
 	return
@@ -188,6 +253,20 @@ func (instance *Muxer) WritePacket(pkt av.Packet) (err error) {
 	return
 }
 
+// WriteTrailer func, packets left in transcoder are written before trailer
+func (instance *Muxer) WriteTrailer() (err error) {
+	var outpkts []av.Packet
+	if outpkts, err = instance.transcoder.Flush(); err != nil {
+		return
+	}
+	for _, pkt := range outpkts {
+		if err = instance.Muxer.WritePacket(pkt); err != nil {
+			return
+		}
+	}
+	return instance.Muxer.WriteTrailer()
+}
+
 // Close func
 func (instance *Muxer) Close() (err error) {
 	if instance.transcoder != nil {
@@ -203,6 +282,7 @@ type Demuxer struct {
 	Options
 	transcoder *Transcoder
 	outpkts    []av.Packet
+	flushed    bool
 }
 
 func (instance *Demuxer) prepare() (err error) {
@@ -229,8 +309,20 @@ func (instance *Demuxer) ReadPacket() (pkt av.Packet, err error) {
 			instance.outpkts = instance.outpkts[1:]
 			return
 		}
+		if instance.flushed {
+			err = io.EOF
+			return
+		}
 		var rpkt av.Packet
 		if rpkt, err = instance.Demuxer.ReadPacket(); err != nil {
+			// packets left in transcoder are read before EOF
+			if err == io.EOF {
+				instance.flushed = true
+				if instance.outpkts, err = instance.transcoder.Flush(); err != nil {
+					return
+				}
+				continue
+			}
 			return
 		}
 		if instance.outpkts, err = instance.transcoder.Do(rpkt); err != nil {
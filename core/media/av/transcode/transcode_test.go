@@ -0,0 +1,412 @@
+package transcode
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"testing"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/fake"
+)
+
+// testVideoDecoder holds one frame, frame image is packet data
+type testVideoDecoder struct {
+	held    *av.VideoFrame
+	packets int
+}
+
+func (dec *testVideoDecoder) DecodePacket(pkt av.Packet) (frames []av.VideoFrame, err error) {
+	dec.packets++
+	if dec.held != nil {
+		frames = append(frames, *dec.held)
+	}
+	dec.held = &av.VideoFrame{Time: pkt.Time + pkt.CompositionTime, Image: image.YCbCr{Y: pkt.Data}}
+	return
+}
+
+func (dec *testVideoDecoder) Flush() (frames []av.VideoFrame, err error) {
+	if dec.held != nil {
+		frames = append(frames, *dec.held)
+	}
+	dec.held = nil
+	return
+}
+
+func (dec *testVideoDecoder) Close() {}
+
+// testVideoEncoder holds one packet, packet is 0xee and frame image
+type testVideoEncoder struct {
+	held   *av.Packet
+	frames int
+}
+
+func (enc *testVideoEncoder) CodecData() (av.VideoCodecData, error) {
+	return fake.CodecData{CodecTypeItem: av.HEVC, WidthItem: 32, HeightItem: 32}, nil
+}
+
+func (enc *testVideoEncoder) Encode(frame av.VideoFrame) (pkts []av.Packet, err error) {
+	enc.frames++
+	if enc.held != nil {
+		pkts = append(pkts, *enc.held)
+	}
+	enc.held = &av.Packet{Time: frame.Time, Data: append([]byte{0xee}, frame.Image.Y...)}
+	return
+}
+
+func (enc *testVideoEncoder) Flush() (pkts []av.Packet, err error) {
+	if enc.held != nil {
+		pkts = append(pkts, *enc.held)
+	}
+	enc.held = nil
+	return
+}
+
+func (enc *testVideoEncoder) Close()                              {}
+func (enc *testVideoEncoder) SetFrameSize(int, int) error         { return nil }
+func (enc *testVideoEncoder) SetFrameRate(int, int) error         { return nil }
+func (enc *testVideoEncoder) SetBitrate(int) error                { return nil }
+func (enc *testVideoEncoder) SetGOP(int) error                    { return nil }
+func (enc *testVideoEncoder) SetOption(string, interface{}) error { return nil }
+func (enc *testVideoEncoder) GetOption(string, interface{}) error { return nil }
+
+// testDemuxer reads packets of slice
+type testDemuxer struct {
+	streams []av.CodecData
+	pkts    []av.Packet
+}
+
+func (demuxer *testDemuxer) Streams() ([]av.CodecData, error) { return demuxer.streams, nil }
+
+func (demuxer *testDemuxer) ReadPacket() (pkt av.Packet, err error) {
+	if len(demuxer.pkts) == 0 {
+		err = io.EOF
+		return
+	}
+	pkt = demuxer.pkts[0]
+	demuxer.pkts = demuxer.pkts[1:]
+	return
+}
+
+// testMuxer records header and packets, packets after trailer are rejected
+type testMuxer struct {
+	streams []av.CodecData
+	pkts    []av.Packet
+	trailer bool
+}
+
+func (muxer *testMuxer) WriteHeader(streams []av.CodecData) error {
+	muxer.streams = streams
+	return nil
+}
+
+func (muxer *testMuxer) WritePacket(pkt av.Packet) error {
+	if muxer.trailer {
+		return fmt.Errorf("packet after trailer")
+	}
+	muxer.pkts = append(muxer.pkts, pkt)
+	return nil
+}
+
+func (muxer *testMuxer) WriteTrailer() error {
+	muxer.trailer = true
+	return nil
+}
+
+const testFlushFrames = 10
+
+// testFlushInput is passthrough video stream #0 and audio stream #1
+func testFlushInput() (streams []av.CodecData, pkts []av.Packet) {
+	streams = []av.CodecData{
+		fake.CodecData{CodecTypeItem: av.H264},
+		testAudioCodecData{fake.CodecData{CodecTypeItem: av.PCMU, SampleRateItem: testSampleRate}},
+	}
+	for i := 0; i < testFlushFrames; i++ {
+		pkts = append(pkts,
+			av.Packet{Idx: 0, Time: testFrameTime(i), Data: []byte{byte(i)}},
+			av.Packet{Idx: 1, Time: testFrameTime(i), Data: testAudioFrame(i)},
+		)
+	}
+	return
+}
+
+// testFlushOptions transcodes audio by decoder with one frame left and encoder holding one frame
+func testFlushOptions() Options {
+	return Options{
+		FindAudioDecoderEncoder: func(codec av.AudioCodecData, i int) (bool, av.AudioDecoder, av.AudioEncoder, error) {
+			dec := &testTailAudioDecoder{tail: [][]byte{testAudioFrame(testFlushFrames)}}
+			return true, dec, &testDelayAudioEncoder{}, nil
+		},
+	}
+}
+
+// testCheckFlushed checks video is passed through and all audio frames with frame left in decoder are output
+func testCheckFlushed(t *testing.T, name string, out []av.Packet) {
+	var video []byte
+	var audio []av.Packet
+	for _, pkt := range out {
+		if pkt.Idx == 0 {
+			video = append(video, pkt.Data...)
+		} else {
+			audio = append(audio, pkt)
+		}
+	}
+	if want := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}; !bytes.Equal(video, want) {
+		t.Errorf("%s: video=%v, want %v", name, video, want)
+	}
+	if len(audio) != testFlushFrames+1 {
+		t.Fatalf("%s: %d audio packets, want %d", name, len(audio), testFlushFrames+1)
+	}
+	for i, pkt := range audio {
+		if pkt.Idx != 1 || pkt.Time != testFrameTime(i) || !bytes.Equal(pkt.Data, testAudioFrame(i)) {
+			t.Errorf("%s: audio#%d idx=%d time=%v", name, i, pkt.Idx, pkt.Time)
+		}
+	}
+}
+
+func TestTranscoderFlush(t *testing.T) {
+	streams, pkts := testFlushInput()
+	trans, err := NewTranscoder(streams, testFlushOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []av.Packet
+	for _, pkt := range pkts {
+		outpkts, err := trans.Do(pkt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, outpkts...)
+	}
+	// decoder and encoder hold two frames
+	if n := len(out) - testFlushFrames; n != testFlushFrames-1 {
+		t.Errorf("%d audio packets before flush", n)
+	}
+	outpkts, err := trans.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCheckFlushed(t, "transcoder", append(out, outpkts...))
+	if err = trans.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTranscoderClose(t *testing.T) {
+	streams, pkts := testFlushInput()
+	for _, test := range []struct {
+		name    string
+		options Options
+		err     bool
+	}{
+		{name: "packets left", options: testFlushOptions(), err: true},
+		{
+			name: "nothing left",
+			options: Options{
+				FindAudioDecoderEncoder: func(codec av.AudioCodecData, i int) (bool, av.AudioDecoder, av.AudioEncoder, error) {
+					return true, testAudioDecoder{}, testAudioEncoder{}, nil
+				},
+			},
+		},
+	} {
+		trans, err := NewTranscoder(streams, test.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pkt := range pkts {
+			if _, err = trans.Do(pkt); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Close without Flush
+		if err = trans.Close(); (err != nil) != test.err {
+			t.Errorf("%s: close err=%v", test.name, err)
+		}
+	}
+}
+
+func TestDemuxerFlush(t *testing.T) {
+	streams, pkts := testFlushInput()
+	demuxer := &Demuxer{Demuxer: &testDemuxer{streams: streams, pkts: pkts}, Options: testFlushOptions()}
+	outstreams, err := demuxer.Streams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outstreams[1].Type() != av.PCMA {
+		t.Errorf("audio stream=%v, want encoder codec data", outstreams[1].Type())
+	}
+
+	// flushed packets are read before EOF
+	var out []av.Packet
+	for {
+		pkt, err := demuxer.ReadPacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, pkt)
+	}
+	testCheckFlushed(t, "demuxer", out)
+	if _, err = demuxer.ReadPacket(); err != io.EOF {
+		t.Errorf("read after EOF err=%v", err)
+	}
+	if err = demuxer.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMuxerWriteTrailer(t *testing.T) {
+	streams, pkts := testFlushInput()
+	out := &testMuxer{}
+	muxer := &Muxer{Muxer: out, Options: testFlushOptions()}
+	if err := muxer.WriteHeader(streams); err != nil {
+		t.Fatal(err)
+	}
+	if out.streams[1].Type() != av.PCMA {
+		t.Errorf("audio stream=%v, want encoder codec data", out.streams[1].Type())
+	}
+	for _, pkt := range pkts {
+		if err := muxer.WritePacket(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// flushed packets are written before trailer
+	if err := muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+	if !out.trailer {
+		t.Error("no trailer")
+	}
+	testCheckFlushed(t, "muxer", out.pkts)
+	if err := muxer.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+// testVideoInput is passthrough audio stream #0 and video stream #1
+func testVideoInput() (streams []av.CodecData, pkts []av.Packet) {
+	streams = []av.CodecData{
+		fake.CodecData{CodecTypeItem: av.PCMU, SampleRateItem: testSampleRate},
+		fake.CodecData{CodecTypeItem: av.H264, WidthItem: 16, HeightItem: 16},
+	}
+	for i := 0; i < testFlushFrames; i++ {
+		pkts = append(pkts,
+			av.Packet{Idx: 0, Time: testFrameTime(i), Data: []byte{byte(i)}},
+			av.Packet{Idx: 1, Time: testFrameTime(i), IsKeyFrame: i == 0, Data: []byte{byte(i), byte(i)}},
+		)
+	}
+	return
+}
+
+func TestTranscoderVideo(t *testing.T) {
+	streams, pkts := testVideoInput()
+	dec, enc := &testVideoDecoder{}, &testVideoEncoder{}
+	options := Options{
+		FindVideoDecoderEncoder: func(codec av.VideoCodecData, i int) (bool, av.VideoDecoder, av.VideoEncoder, error) {
+			if i != 1 || codec != streams[1] {
+				t.Errorf("find stream#%d %v", i, codec)
+			}
+			return true, dec, enc, nil
+		},
+	}
+	trans, err := NewTranscoder(streams, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outstreams, err := trans.Streams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outstreams[0] != streams[0] {
+		t.Errorf("audio stream=%v, want input", outstreams[0])
+	}
+	if codec, _ := enc.CodecData(); outstreams[1] != codec {
+		t.Errorf("video stream=%v, want encoder codec data", outstreams[1])
+	}
+
+	var out []av.Packet
+	for _, pkt := range pkts {
+		outpkts, err := trans.Do(pkt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, outpkts...)
+	}
+	// decoder and encoder hold one frame each
+	if n := len(out) - testFlushFrames; n != testFlushFrames-2 {
+		t.Errorf("%d video packets before flush", n)
+	}
+	outpkts, err := trans.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = append(out, outpkts...)
+	if dec.packets != testFlushFrames || enc.frames != testFlushFrames {
+		t.Errorf("decoded %d packets, encoded %d frames", dec.packets, enc.frames)
+	}
+
+	var audio []byte
+	i := 0
+	for _, pkt := range out {
+		if pkt.Idx == 0 {
+			audio = append(audio, pkt.Data...)
+			continue
+		}
+		want := []byte{0xee, byte(i), byte(i)}
+		if pkt.Idx != 1 || pkt.Time != testFrameTime(i) || !bytes.Equal(pkt.Data, want) {
+			t.Errorf("video#%d idx=%d time=%v data=% x, want idx=1 time=%v data=% x",
+				i, pkt.Idx, pkt.Time, pkt.Data, testFrameTime(i), want)
+		}
+		i++
+	}
+	if i != testFlushFrames {
+		t.Errorf("%d video packets, want %d", i, testFlushFrames)
+	}
+	if want := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}; !bytes.Equal(audio, want) {
+		t.Errorf("audio=%v, want %v", audio, want)
+	}
+	if err = trans.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTranscoderVideoPassthrough(t *testing.T) {
+	streams, pkts := testVideoInput()
+	options := Options{
+		FindVideoDecoderEncoder: func(codec av.VideoCodecData, i int) (bool, av.VideoDecoder, av.VideoEncoder, error) {
+			return false, nil, nil, nil
+		},
+	}
+	trans, err := NewTranscoder(streams, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outstreams, _ := trans.Streams()
+	if outstreams[1] != streams[1] {
+		t.Errorf("video stream=%v, want input", outstreams[1])
+	}
+	for _, pkt := range pkts {
+		out, err := trans.Do(pkt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out) != 1 || out[0].Idx != pkt.Idx || out[0].Time != pkt.Time || !bytes.Equal(out[0].Data, pkt.Data) {
+			t.Fatalf("packet %+v passed as %+v", pkt, out)
+		}
+	}
+	if out, err := trans.Flush(); err != nil || len(out) != 0 {
+		t.Errorf("flush=%v err=%v", out, err)
+	}
+	trans.Close()
+
+	// error is returned only if transcode is needed
+	options.FindVideoDecoderEncoder = func(codec av.VideoCodecData, i int) (bool, av.VideoDecoder, av.VideoEncoder, error) {
+		return true, nil, nil, fmt.Errorf("no encoder")
+	}
+	if _, err = NewTranscoder(streams, options); err == nil {
+		t.Error("error of FindVideoDecoderEncoder is ignored")
+	}
+}
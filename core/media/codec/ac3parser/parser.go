@@ -0,0 +1,164 @@
+package ac3parser
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+)
+
+// SyncWord of AC-3 frame
+const SyncWord = 0x0b77
+
+// HeaderLength is bytes needed to parse frame header
+const HeaderLength = 8
+
+// SamplesPerFrame is number of samples per channel in frame
+const SamplesPerFrame = 1536
+
+var sampleRateTable = [3]int{48000, 44100, 32000}
+
+// kbps, indexed by frmsizecod/2
+var bitrateTable = [19]int{32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 448, 512, 576, 640}
+
+// indexed by acmod
+var channelLayoutTable = [8]av.ChannelLayout{
+	av.ChStereo, // 1+1 dual mono
+	av.ChMono,
+	av.ChStereo,
+	av.ChSurround,
+	av.ChStereo | av.ChBackCenter,
+	av.ChSurround | av.ChBackCenter,
+	av.ChStereo | av.ChSideLeft | av.ChSideRight,
+	av.ChSurround | av.ChSideLeft | av.ChSideRight,
+}
+
+// FrameHeader struct
+type FrameHeader struct {
+	Bitrate       int // bits per second
+	SampleRate    int
+	BSID          int
+	BSMod         int
+	ACMod         int
+	LFE           bool
+	ChannelLayout av.ChannelLayout
+	// FrameLength includes header
+	FrameLength int
+}
+
+// ParseFrameHeader func
+func ParseFrameHeader(b []byte) (hdr FrameHeader, err error) {
+	if len(b) < HeaderLength {
+		err = fmt.Errorf("ac3parser: frame header too short")
+		return
+	}
+	if int(b[0])<<8|int(b[1]) != SyncWord {
+		err = fmt.Errorf("ac3parser: frame sync not found")
+		return
+	}
+
+	fscod := int(b[4] >> 6)
+	frmsizecod := int(b[4] & 0x3f)
+	if fscod == 3 || frmsizecod >= len(bitrateTable)*2 {
+		err = fmt.Errorf("ac3parser: invalid sample rate or frame size code")
+		return
+	}
+	hdr.BSID = int(b[5] >> 3)
+	if hdr.BSID > 10 {
+		err = fmt.Errorf("ac3parser: bsid=%d is not AC-3", hdr.BSID)
+		return
+	}
+	hdr.BSMod = int(b[5] & 0x7)
+	hdr.ACMod = int(b[6] >> 5)
+
+	// lfeon follows optional cmixlev, surmixlev and dsurmod
+	bit := 3
+	if hdr.ACMod&0x1 != 0 && hdr.ACMod != 1 {
+		bit += 2
+	}
+	if hdr.ACMod&0x4 != 0 {
+		bit += 2
+	}
+	if hdr.ACMod == 2 {
+		bit += 2
+	}
+	bits := uint16(b[6])<<8 | uint16(b[7])
+	hdr.LFE = (bits>>uint(15-bit))&0x1 != 0
+
+	hdr.SampleRate = sampleRateTable[fscod]
+	hdr.Bitrate = bitrateTable[frmsizecod/2] * 1000
+	words := hdr.Bitrate / 1000 * 96000 / hdr.SampleRate
+	if fscod == 1 {
+		words += frmsizecod & 0x1
+	}
+	hdr.FrameLength = words * 2
+
+	hdr.ChannelLayout = channelLayoutTable[hdr.ACMod]
+	if hdr.LFE {
+		hdr.ChannelLayout |= av.ChLowFreq
+	}
+	return
+}
+
+// CodecData struct
+type CodecData struct {
+	Header FrameHeader
+}
+
+// Type func
+func (inst CodecData) Type() av.CodecType {
+	return av.AC3
+}
+
+// ChannelLayout func
+func (inst CodecData) ChannelLayout() av.ChannelLayout {
+	return inst.Header.ChannelLayout
+}
+
+// SampleRate func
+func (inst CodecData) SampleRate() int {
+	return inst.Header.SampleRate
+}
+
+// SampleFormat func
+func (inst CodecData) SampleFormat() av.SampleFormat {
+	return av.FLTP
+}
+
+// PacketDuration func, counts frames in data which may hold several frames
+func (inst CodecData) PacketDuration(data []byte) (dur time.Duration, err error) {
+	frames := 0
+	for len(data) > 0 {
+		var hdr FrameHeader
+		if hdr, err = ParseFrameHeader(data); err != nil {
+			break
+		}
+		frames++
+		if hdr.FrameLength >= len(data) {
+			break
+		}
+		data = data[hdr.FrameLength:]
+	}
+	if frames == 0 {
+		if err != nil {
+			return
+		}
+		frames = 1
+	}
+	err = nil
+	dur = time.Duration(frames*SamplesPerFrame) * time.Second / time.Duration(inst.Header.SampleRate)
+	return
+}
+
+// NewCodecDataFromFrameHeader func
+func NewCodecDataFromFrameHeader(hdr FrameHeader) CodecData {
+	return CodecData{Header: hdr}
+}
+
+// NewCodecDataFromFrame parses header of first frame in data
+func NewCodecDataFromFrame(data []byte) (inst CodecData, err error) {
+	if inst.Header, err = ParseFrameHeader(data); err != nil {
+		return
+	}
+	return
+}
@@ -0,0 +1,50 @@
+package ac3parser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFrameHeader(t *testing.T) {
+	for _, tc := range []struct {
+		hdr        []byte
+		sampleRate int
+		channels   int
+		lfe        bool
+		length     int
+	}{
+		{[]byte{0x0b, 0x77, 0x00, 0x00, 0x1c, 0x40, 0xe1, 0x00}, 48000, 6, true, 1536},
+		{[]byte{0x0b, 0x77, 0x00, 0x00, 0x55, 0x40, 0x40, 0x00}, 44100, 2, false, 836},
+		{[]byte{0x0b, 0x77, 0x00, 0x00, 0x88, 0x40, 0x30, 0x00}, 32000, 2, true, 384},
+	} {
+		hdr, err := ParseFrameHeader(tc.hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.SampleRate != tc.sampleRate || hdr.ChannelLayout.Count() != tc.channels ||
+			hdr.LFE != tc.lfe || hdr.FrameLength != tc.length {
+			t.Errorf("header=%x parsed=%+v", tc.hdr, hdr)
+		}
+	}
+
+	if _, err := ParseFrameHeader([]byte{0x0b, 0x77, 0x00, 0x00, 0xc0, 0x40, 0x40, 0x00}); err == nil {
+		t.Error("reserved sample rate should fail")
+	}
+}
+
+func TestPacketDuration(t *testing.T) {
+	frame := make([]byte, 1536)
+	copy(frame, []byte{0x0b, 0x77, 0x00, 0x00, 0x1c, 0x40, 0xe1, 0x00})
+	codecData, err := NewCodecDataFromFrame(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append(append([]byte{}, frame...), frame...)
+	dur, err := codecData.PacketDuration(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 64 * time.Millisecond; dur != want {
+		t.Errorf("duration=%v want=%v", dur, want)
+	}
+}
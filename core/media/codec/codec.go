@@ -64,12 +64,36 @@ func (codecData SpeexCodecData) PacketDuration(data []byte) (time.Duration, erro
 	return time.Millisecond * 20, nil
 }
 
-// // NewSpeexCodecData func
-// func NewSpeexCodecData(sr int, cl av.ChannelLayout) SpeexCodecData {
-// 	codec := SpeexCodecData{}
-// 	codec.CodecTypeItem = av.SPEEX
-// 	codec.SampleFormatItem = av.S16
-// 	codec.SampleRateItem = sr
-// 	codec.ChannelLayoutItem = cl
-// 	return codec
-// }
+// NewSpeexCodecData func
+func NewSpeexCodecData(sr int, cl av.ChannelLayout) SpeexCodecData {
+	codec := SpeexCodecData{}
+	codec.CodecTypeItem = av.SPEEX
+	codec.SampleFormatItem = av.S16
+	codec.SampleRateItem = sr
+	codec.ChannelLayoutItem = cl
+	return codec
+}
+
+// DataCodecData struct, for timed metadata such as KLV
+type DataCodecData struct {
+	typ av.CodecType
+}
+
+// Type func
+func (codecData DataCodecData) Type() av.CodecType {
+	return codecData.typ
+}
+
+// NewKLVCodecData func
+func NewKLVCodecData() av.CodecData {
+	return DataCodecData{
+		typ: av.KLV,
+	}
+}
+
+// NewDataCodecData func, for private data of unknown format
+func NewDataCodecData() av.CodecData {
+	return DataCodecData{
+		typ: av.DATA,
+	}
+}
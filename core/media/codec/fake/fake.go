@@ -10,6 +10,8 @@ type CodecData struct {
 	SampleRateItem    int
 	SampleFormatItem  av.SampleFormat
 	ChannelLayoutItem av.ChannelLayout
+	WidthItem         int
+	HeightItem        int
 }
 
 // Type func
@@ -31,3 +33,13 @@ func (inst CodecData) ChannelLayout() av.ChannelLayout {
 func (inst CodecData) SampleRate() int {
 	return inst.SampleRateItem
 }
+
+// Width func
+func (inst CodecData) Width() int {
+	return inst.WidthItem
+}
+
+// Height func
+func (inst CodecData) Height() int {
+	return inst.HeightItem
+}
@@ -0,0 +1,122 @@
+// Package h263parser parses picture header of Sorenson H.263, the H.263 variant of FLV video codec id 2.
+package h263parser
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits"
+)
+
+// PictureStartCode is first 17 bits of picture
+const PictureStartCode = 1
+
+// PictureType of picture header
+const (
+	PictureTypeIntra      = 0
+	PictureTypeInter      = 1
+	PictureTypeDisposable = 2
+)
+
+// size of picture for PictureSize 2 to 6, 0 and 1 are custom sizes
+var pictureSizeTable = [7][2]uint{
+	{}, {}, {352, 288}, {176, 144}, {128, 96}, {320, 240}, {160, 120},
+}
+
+// PictureHeader struct
+type PictureHeader struct {
+	Version     uint
+	Width       uint
+	Height      uint
+	PictureType uint
+}
+
+// ParsePictureHeader parses header at start of picture
+func ParsePictureHeader(b []byte) (inst PictureHeader, err error) {
+	r := &bits.GolombBitReader{R: bytes.NewReader(b)}
+
+	var code uint
+	if code, err = r.ReadBits(17); err != nil {
+		return
+	}
+	if code != PictureStartCode {
+		err = fmt.Errorf("h263parser: picture start code not found")
+		return
+	}
+	if inst.Version, err = r.ReadBits(5); err != nil {
+		return
+	}
+	if inst.Version > 1 {
+		err = fmt.Errorf("h263parser: version=%d invalid", inst.Version)
+		return
+	}
+	// temporal reference
+	if _, err = r.ReadBits(8); err != nil {
+		return
+	}
+
+	var size uint
+	if size, err = r.ReadBits(3); err != nil {
+		return
+	}
+	switch size {
+	case 0, 1:
+		n := 8 << size
+		if inst.Width, err = r.ReadBits(n); err != nil {
+			return
+		}
+		if inst.Height, err = r.ReadBits(n); err != nil {
+			return
+		}
+	case 7:
+		err = fmt.Errorf("h263parser: picture size=%d reserved", size)
+		return
+	default:
+		inst.Width, inst.Height = pictureSizeTable[size][0], pictureSizeTable[size][1]
+	}
+
+	if inst.PictureType, err = r.ReadBits(2); err != nil {
+		return
+	}
+	if inst.PictureType > PictureTypeDisposable {
+		err = fmt.Errorf("h263parser: picture type=%d invalid", inst.PictureType)
+		return
+	}
+	return
+}
+
+// CodecData struct, Sorenson H.263 has no decoder config, size is of first picture
+type CodecData struct {
+	width, height int
+}
+
+// Type func
+func (codecData CodecData) Type() av.CodecType {
+	return av.H263
+}
+
+// Width func
+func (codecData CodecData) Width() int {
+	return codecData.width
+}
+
+// Height func
+func (codecData CodecData) Height() int {
+	return codecData.height
+}
+
+// NewCodecData func
+func NewCodecData(width, height int) CodecData {
+	return CodecData{width: width, height: height}
+}
+
+// NewCodecDataFromPicture func
+func NewCodecDataFromPicture(b []byte) (codecData CodecData, err error) {
+	var hdr PictureHeader
+	if hdr, err = ParsePictureHeader(b); err != nil {
+		return
+	}
+	codecData = NewCodecData(int(hdr.Width), int(hdr.Height))
+	return
+}
@@ -0,0 +1,59 @@
+package h263parser
+
+import (
+	"testing"
+)
+
+// testBits packs pairs of value and bit count, last byte is padded with zeros
+func testBits(fields ...uint) (b []byte) {
+	n := 0
+	for i := 0; i < len(fields); i += 2 {
+		for j := int(fields[i+1]) - 1; j >= 0; j-- {
+			if n%8 == 0 {
+				b = append(b, 0)
+			}
+			b[len(b)-1] |= byte(fields[i]>>uint(j)&1) << uint(7-n%8)
+			n++
+		}
+	}
+	return
+}
+
+func TestParsePictureHeader(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		b    []byte
+		hdr  PictureHeader
+		ok   bool
+	}{
+		{"custom 8 bit size", testBits(1, 17, 0, 5, 3, 8, 0, 3, 100, 8, 60, 8, 0, 2, 0, 8), PictureHeader{0, 100, 60, PictureTypeIntra}, true},
+		{"custom 16 bit size", testBits(1, 17, 1, 5, 3, 8, 1, 3, 1000, 16, 700, 16, 2, 2, 0, 8), PictureHeader{1, 1000, 700, PictureTypeDisposable}, true},
+		{"qvga", testBits(1, 17, 0, 5, 3, 8, 5, 3, 1, 2, 0, 8), PictureHeader{0, 320, 240, PictureTypeInter}, true},
+		{"cif", testBits(1, 17, 0, 5, 3, 8, 2, 3, 0, 2, 0, 8), PictureHeader{0, 352, 288, PictureTypeIntra}, true},
+		{"no start code", testBits(3, 17, 0, 5, 3, 8, 2, 3, 0, 2, 0, 8), PictureHeader{}, false},
+		{"reserved size", testBits(1, 17, 0, 5, 3, 8, 7, 3, 0, 2, 0, 8), PictureHeader{}, false},
+		{"invalid type", testBits(1, 17, 0, 5, 3, 8, 2, 3, 3, 2, 0, 8), PictureHeader{}, false},
+		{"short", testBits(1, 17, 0, 5), PictureHeader{}, false},
+	} {
+		hdr, err := ParsePictureHeader(test.b)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%s: parsed without error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if hdr != test.hdr {
+			t.Errorf("%s: header=%+v, want %+v", test.name, hdr, test.hdr)
+		}
+	}
+
+	codecData, err := NewCodecDataFromPicture(testBits(1, 17, 0, 5, 3, 8, 5, 3, 0, 2, 0, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codecData.Width() != 320 || codecData.Height() != 240 {
+		t.Errorf("size=%dx%d", codecData.Width(), codecData.Height())
+	}
+}
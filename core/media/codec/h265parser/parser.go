@@ -0,0 +1,524 @@
+package h265parser
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits"
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
+)
+
+const (
+	// NaluBlaWLp const
+	NaluBlaWLp = 16
+	// NaluIdrWRadl const
+	NaluIdrWRadl = 19
+	// NaluIdrNLp const
+	NaluIdrNLp = 20
+	// NaluCraNut const
+	NaluCraNut = 21
+	// NaluVps const
+	NaluVps = 32
+	// NaluSps const
+	NaluSps = 33
+	// NaluPps const
+	NaluPps = 34
+	// NaluAud const
+	NaluAud = 35
+	// NaluPrefixSei const
+	NaluPrefixSei = 39
+	// NaluSuffixSei const
+	NaluSuffixSei = 40
+)
+
+/*
+Table 7-1 – NAL unit type codes and NAL unit type classes
+0-9      TRAIL_N ... RASL_R     Coded slice segment of a non-IRAP picture    VCL
+16-21    BLA/IDR/CRA            Coded slice segment of an IRAP picture       VCL
+22-23    RSV_IRAP_VCL22..23     Reserved IRAP VCL NAL unit types             VCL
+32       VPS_NUT                Video parameter set                          non-VCL
+33       SPS_NUT                Sequence parameter set                       non-VCL
+34       PPS_NUT                Picture parameter set                        non-VCL
+35       AUD_NUT                Access unit delimiter                        non-VCL
+39-40    PREFIX/SUFFIX_SEI_NUT  Supplemental enhancement information         non-VCL
+
+  +---------------+---------------+
+  |0|1|2|3|4|5|6|7|0|1|2|3|4|5|6|7|
+  +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+  |F|   Type    |  LayerId  | TID |
+  +-------------+-----------------+
+*/
+
+// AUDBytes var, access unit delimiter followed by start code of next nalu
+var AUDBytes = []byte{0, 0, 0, 1, 0x46, 0x01, 0x50, 0, 0, 0, 1}
+
+// NALUType func
+func NALUType(b []byte) int {
+	return int(b[0]>>1) & 0x3f
+}
+
+// IsDataNALU func
+func IsDataNALU(b []byte) bool {
+	return NALUType(b) < 32
+}
+
+// IsKeyFrameNALU reports if nalu is slice of IRAP picture
+func IsKeyFrameNALU(b []byte) bool {
+	typ := NALUType(b)
+	return typ >= NaluBlaWLp && typ <= 23
+}
+
+// RemoveEmulationPrevention converts NAL unit payload into RBSP by dropping 0x03 of 0x000003
+func RemoveEmulationPrevention(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c == 3 {
+			zeros = 0
+			continue
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// ProfileTierLevel is general part of profile_tier_level()
+type ProfileTierLevel struct {
+	ProfileSpace              uint
+	TierFlag                  uint
+	ProfileIdc                uint
+	ProfileCompatibilityFlags uint32
+	ConstraintIndicatorFlags  uint64
+	LevelIdc                  uint
+}
+
+// SPSInfo struct
+type SPSInfo struct {
+	ProfileTierLevel
+
+	MaxSubLayersMinus1    uint
+	TemporalIDNestingFlag uint
+
+	ChromaFormatIdc      uint
+	BitDepthLumaMinus8   uint
+	BitDepthChromaMinus8 uint
+
+	PicWidth  uint
+	PicHeight uint
+
+	CropLeft   uint
+	CropRight  uint
+	CropTop    uint
+	CropBottom uint
+
+	Width  uint
+	Height uint
+}
+
+func readProfileTierLevel(r *bits.GolombBitReader, maxSubLayersMinus1 uint) (ptl ProfileTierLevel, err error) {
+	if ptl.ProfileSpace, err = r.ReadBits(2); err != nil {
+		return
+	}
+	if ptl.TierFlag, err = r.ReadBit(); err != nil {
+		return
+	}
+	if ptl.ProfileIdc, err = r.ReadBits(5); err != nil {
+		return
+	}
+
+	var u uint
+	for i := 0; i < 2; i++ {
+		if u, err = r.ReadBits(16); err != nil {
+			return
+		}
+		ptl.ProfileCompatibilityFlags = ptl.ProfileCompatibilityFlags<<16 | uint32(u)
+	}
+
+	// progressive_source_flag, interlaced_source_flag, non_packed_constraint_flag,
+	// frame_only_constraint_flag, 43 reserved bits, 1 bit
+	for i := 0; i < 3; i++ {
+		if u, err = r.ReadBits(16); err != nil {
+			return
+		}
+		ptl.ConstraintIndicatorFlags = ptl.ConstraintIndicatorFlags<<16 | uint64(u)
+	}
+
+	if ptl.LevelIdc, err = r.ReadBits(8); err != nil {
+		return
+	}
+
+	profilePresent := make([]uint, maxSubLayersMinus1)
+	levelPresent := make([]uint, maxSubLayersMinus1)
+	for i := uint(0); i < maxSubLayersMinus1; i++ {
+		if profilePresent[i], err = r.ReadBit(); err != nil {
+			return
+		}
+		if levelPresent[i], err = r.ReadBit(); err != nil {
+			return
+		}
+	}
+	if maxSubLayersMinus1 > 0 {
+		for i := maxSubLayersMinus1; i < 8; i++ {
+			// reserved_zero_2bits
+			if _, err = r.ReadBits(2); err != nil {
+				return
+			}
+		}
+	}
+	for i := uint(0); i < maxSubLayersMinus1; i++ {
+		if profilePresent[i] != 0 {
+			// sub_layer profile space ... sub_layer_reserved_zero_43bits, 88 bits
+			for j := 0; j < 11; j++ {
+				if _, err = r.ReadBits(8); err != nil {
+					return
+				}
+			}
+		}
+		if levelPresent[i] != 0 {
+			if _, err = r.ReadBits(8); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// ParseSPS parses SPS nalu including 2 bytes nal unit header
+func ParseSPS(data []byte) (inst SPSInfo, err error) {
+	if len(data) < 3 {
+		err = fmt.Errorf("h265parser: sps too short")
+		return
+	}
+	r := &bits.GolombBitReader{R: bytes.NewReader(RemoveEmulationPrevention(data[2:]))}
+
+	// sps_video_parameter_set_id
+	if _, err = r.ReadBits(4); err != nil {
+		return
+	}
+	if inst.MaxSubLayersMinus1, err = r.ReadBits(3); err != nil {
+		return
+	}
+	if inst.TemporalIDNestingFlag, err = r.ReadBit(); err != nil {
+		return
+	}
+	if inst.ProfileTierLevel, err = readProfileTierLevel(r, inst.MaxSubLayersMinus1); err != nil {
+		return
+	}
+
+	// sps_seq_parameter_set_id
+	if _, err = r.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+
+	if inst.ChromaFormatIdc, err = r.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+	var separateColourPlaneFlag uint
+	if inst.ChromaFormatIdc == 3 {
+		if separateColourPlaneFlag, err = r.ReadBit(); err != nil {
+			return
+		}
+	}
+
+	if inst.PicWidth, err = r.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+	if inst.PicHeight, err = r.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+
+	var conformanceWindowFlag uint
+	if conformanceWindowFlag, err = r.ReadBit(); err != nil {
+		return
+	}
+	if conformanceWindowFlag != 0 {
+		if inst.CropLeft, err = r.ReadExponentialGolombCode(); err != nil {
+			return
+		}
+		if inst.CropRight, err = r.ReadExponentialGolombCode(); err != nil {
+			return
+		}
+		if inst.CropTop, err = r.ReadExponentialGolombCode(); err != nil {
+			return
+		}
+		if inst.CropBottom, err = r.ReadExponentialGolombCode(); err != nil {
+			return
+		}
+	}
+
+	if inst.BitDepthLumaMinus8, err = r.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+	if inst.BitDepthChromaMinus8, err = r.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+
+	// Table 6-1 – SubWidthC, and SubHeightC values
+	subWidthC, subHeightC := uint(1), uint(1)
+	if separateColourPlaneFlag == 0 {
+		switch inst.ChromaFormatIdc {
+		case 1:
+			subWidthC, subHeightC = 2, 2
+		case 2:
+			subWidthC = 2
+		}
+	}
+	inst.Width = inst.PicWidth - subWidthC*(inst.CropLeft+inst.CropRight)
+	inst.Height = inst.PicHeight - subHeightC*(inst.CropTop+inst.CropBottom)
+
+	return
+}
+
+// CodecData struct
+type CodecData struct {
+	Record     []byte
+	RecordInfo HEVCDecoderConfRecord
+	SPSInfo    SPSInfo
+}
+
+// Type func
+func (codecData CodecData) Type() av.CodecType {
+	return av.HEVC
+}
+
+// HEVCDecoderConfRecordBytes func
+func (codecData CodecData) HEVCDecoderConfRecordBytes() []byte {
+	return codecData.Record
+}
+
+// VPS func
+func (codecData CodecData) VPS() []byte {
+	return codecData.RecordInfo.VPS[0]
+}
+
+// SPS func
+func (codecData CodecData) SPS() []byte {
+	return codecData.RecordInfo.SPS[0]
+}
+
+// PPS func
+func (codecData CodecData) PPS() []byte {
+	return codecData.RecordInfo.PPS[0]
+}
+
+// Width func
+func (codecData CodecData) Width() int {
+	return int(codecData.SPSInfo.Width)
+}
+
+// Height func
+func (codecData CodecData) Height() int {
+	return int(codecData.SPSInfo.Height)
+}
+
+// NewCodecDataFromHEVCDecoderConfRecord func
+func NewCodecDataFromHEVCDecoderConfRecord(record []byte) (codecData CodecData, err error) {
+	codecData.Record = record
+	if _, err = (&codecData.RecordInfo).Unmarshal(record); err != nil {
+		return
+	}
+	if len(codecData.RecordInfo.VPS) == 0 {
+		err = fmt.Errorf("h265parser: no VPS found in HEVCDecoderConfRecord")
+		return
+	}
+	if len(codecData.RecordInfo.SPS) == 0 {
+		err = fmt.Errorf("h265parser: no SPS found in HEVCDecoderConfRecord")
+		return
+	}
+	if len(codecData.RecordInfo.PPS) == 0 {
+		err = fmt.Errorf("h265parser: no PPS found in HEVCDecoderConfRecord")
+		return
+	}
+	if codecData.SPSInfo, err = ParseSPS(codecData.RecordInfo.SPS[0]); err != nil {
+		err = fmt.Errorf("h265parser: parse SPS failed(%s)", err)
+		return
+	}
+	return
+}
+
+// NewCodecDataFromVPSAndSPSAndPPS func
+func NewCodecDataFromVPSAndSPSAndPPS(vps, sps, pps []byte) (codecData CodecData, err error) {
+	if codecData.SPSInfo, err = ParseSPS(sps); err != nil {
+		return
+	}
+	info := codecData.SPSInfo
+
+	recordinfo := HEVCDecoderConfRecord{}
+	recordinfo.GeneralProfileSpace = uint8(info.ProfileSpace)
+	recordinfo.GeneralTierFlag = uint8(info.TierFlag)
+	recordinfo.GeneralProfileIdc = uint8(info.ProfileIdc)
+	recordinfo.GeneralProfileCompatibilityFlags = info.ProfileCompatibilityFlags
+	recordinfo.GeneralConstraintIndicatorFlags = info.ConstraintIndicatorFlags
+	recordinfo.GeneralLevelIdc = uint8(info.LevelIdc)
+	recordinfo.ChromaFormat = uint8(info.ChromaFormatIdc)
+	recordinfo.BitDepthLumaMinus8 = uint8(info.BitDepthLumaMinus8)
+	recordinfo.BitDepthChromaMinus8 = uint8(info.BitDepthChromaMinus8)
+	recordinfo.NumTemporalLayers = uint8(info.MaxSubLayersMinus1 + 1)
+	recordinfo.TemporalIDNested = uint8(info.TemporalIDNestingFlag)
+	recordinfo.LengthSizeMinusOne = 3
+	recordinfo.VPS = [][]byte{vps}
+	recordinfo.SPS = [][]byte{sps}
+	recordinfo.PPS = [][]byte{pps}
+
+	buf := make([]byte, recordinfo.Len())
+	recordinfo.Marshal(buf)
+
+	codecData.RecordInfo = recordinfo
+	codecData.Record = buf
+	return
+}
+
+// HEVCDecoderConfRecord is hvcC box content, ISO/IEC 14496-15 8.3.3.1
+type HEVCDecoderConfRecord struct {
+	GeneralProfileSpace              uint8
+	GeneralTierFlag                  uint8
+	GeneralProfileIdc                uint8
+	GeneralProfileCompatibilityFlags uint32
+	GeneralConstraintIndicatorFlags  uint64
+	GeneralLevelIdc                  uint8
+	MinSpatialSegmentationIdc        uint16
+	ParallelismType                  uint8
+	ChromaFormat                     uint8
+	BitDepthLumaMinus8               uint8
+	BitDepthChromaMinus8             uint8
+	AvgFrameRate                     uint16
+	ConstantFrameRate                uint8
+	NumTemporalLayers                uint8
+	TemporalIDNested                 uint8
+	LengthSizeMinusOne               uint8
+	VPS                              [][]byte
+	SPS                              [][]byte
+	PPS                              [][]byte
+}
+
+// ErrDecconfInvalid var
+var ErrDecconfInvalid = fmt.Errorf("h265parser: HEVCDecoderConfRecord invalid")
+
+const hvccHeaderLength = 23
+
+// Unmarshal func
+func (confRecord *HEVCDecoderConfRecord) Unmarshal(b []byte) (n int, err error) {
+	if len(b) < hvccHeaderLength {
+		err = ErrDecconfInvalid
+		return
+	}
+
+	confRecord.GeneralProfileSpace = b[1] >> 6
+	confRecord.GeneralTierFlag = (b[1] >> 5) & 0x01
+	confRecord.GeneralProfileIdc = b[1] & 0x1f
+	confRecord.GeneralProfileCompatibilityFlags = pio.U32BE(b[2:])
+	confRecord.GeneralConstraintIndicatorFlags = uint64(pio.U16BE(b[6:]))<<32 | uint64(pio.U32BE(b[8:]))
+	confRecord.GeneralLevelIdc = b[12]
+	confRecord.MinSpatialSegmentationIdc = pio.U16BE(b[13:]) & 0x0fff
+	confRecord.ParallelismType = b[15] & 0x03
+	confRecord.ChromaFormat = b[16] & 0x03
+	confRecord.BitDepthLumaMinus8 = b[17] & 0x07
+	confRecord.BitDepthChromaMinus8 = b[18] & 0x07
+	confRecord.AvgFrameRate = pio.U16BE(b[19:])
+	confRecord.ConstantFrameRate = b[21] >> 6
+	confRecord.NumTemporalLayers = (b[21] >> 3) & 0x07
+	confRecord.TemporalIDNested = (b[21] >> 2) & 0x01
+	confRecord.LengthSizeMinusOne = b[21] & 0x03
+	arrays := int(b[22])
+	n += hvccHeaderLength
+
+	for i := 0; i < arrays; i++ {
+		if len(b) < n+3 {
+			err = ErrDecconfInvalid
+			return
+		}
+		typ := int(b[n] & 0x3f)
+		count := int(pio.U16BE(b[n+1:]))
+		n += 3
+
+		for j := 0; j < count; j++ {
+			if len(b) < n+2 {
+				err = ErrDecconfInvalid
+				return
+			}
+			size := int(pio.U16BE(b[n:]))
+			n += 2
+
+			if len(b) < n+size {
+				err = ErrDecconfInvalid
+				return
+			}
+			nalu := b[n : n+size]
+			switch typ {
+			case NaluVps:
+				confRecord.VPS = append(confRecord.VPS, nalu)
+			case NaluSps:
+				confRecord.SPS = append(confRecord.SPS, nalu)
+			case NaluPps:
+				confRecord.PPS = append(confRecord.PPS, nalu)
+			}
+			n += size
+		}
+	}
+
+	return
+}
+
+// Len func
+func (confRecord HEVCDecoderConfRecord) Len() (n int) {
+	n = hvccHeaderLength
+	for _, array := range [][][]byte{confRecord.VPS, confRecord.SPS, confRecord.PPS} {
+		if len(array) > 0 {
+			n += 3
+		}
+		for _, nalu := range array {
+			n += 2 + len(nalu)
+		}
+	}
+	return
+}
+
+// Marshal func
+func (confRecord HEVCDecoderConfRecord) Marshal(b []byte) (n int) {
+	b[0] = 1
+	b[1] = confRecord.GeneralProfileSpace<<6 | confRecord.GeneralTierFlag<<5 | confRecord.GeneralProfileIdc&0x1f
+	pio.PutU32BE(b[2:], confRecord.GeneralProfileCompatibilityFlags)
+	pio.PutU16BE(b[6:], uint16(confRecord.GeneralConstraintIndicatorFlags>>32))
+	pio.PutU32BE(b[8:], uint32(confRecord.GeneralConstraintIndicatorFlags))
+	b[12] = confRecord.GeneralLevelIdc
+	pio.PutU16BE(b[13:], confRecord.MinSpatialSegmentationIdc|0xf000)
+	b[15] = confRecord.ParallelismType | 0xfc
+	b[16] = confRecord.ChromaFormat | 0xfc
+	b[17] = confRecord.BitDepthLumaMinus8 | 0xf8
+	b[18] = confRecord.BitDepthChromaMinus8 | 0xf8
+	pio.PutU16BE(b[19:], confRecord.AvgFrameRate)
+	b[21] = confRecord.ConstantFrameRate<<6 | confRecord.NumTemporalLayers<<3 | confRecord.TemporalIDNested<<2 | confRecord.LengthSizeMinusOne&0x03
+	n += 23
+
+	arrays := 0
+	for _, array := range [][][]byte{confRecord.VPS, confRecord.SPS, confRecord.PPS} {
+		if len(array) > 0 {
+			arrays++
+		}
+	}
+	b[22] = uint8(arrays)
+
+	for i, array := range [][][]byte{confRecord.VPS, confRecord.SPS, confRecord.PPS} {
+		if len(array) == 0 {
+			continue
+		}
+		// array_completeness=1
+		b[n] = 0x80 | uint8(NaluVps+i)
+		pio.PutU16BE(b[n+1:], uint16(len(array)))
+		n += 3
+		for _, nalu := range array {
+			pio.PutU16BE(b[n:], uint16(len(nalu)))
+			n += 2
+			copy(b[n:], nalu)
+			n += len(nalu)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,47 @@
+package h265parser
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseSPS(t *testing.T) {
+	for _, tc := range []struct {
+		sps           string
+		width, height uint
+	}{
+		{"420101016000000300900000030000030078a003c08010e58dae4932b4dc0404040200000300020000030032", 1920, 1080},
+		{"420101016000000300b0000003000003005da00280802d165959a4932bc05a70800001f480003a980400", 1280, 720},
+	} {
+		sps, _ := hex.DecodeString(tc.sps)
+		info, err := ParseSPS(sps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Width != tc.width || info.Height != tc.height || info.ProfileIdc != 1 {
+			t.Errorf("sps=%s info=%+v", tc.sps, info)
+		}
+	}
+}
+
+func TestCodecDataRecord(t *testing.T) {
+	vps, _ := hex.DecodeString("40010c01ffff016000000300900000030000030078999809")
+	sps, _ := hex.DecodeString("420101016000000300900000030000030078a003c08010e58dae4932b4dc0404040200000300020000030032")
+	pps, _ := hex.DecodeString("4401c172b46240")
+
+	codecData, err := NewCodecDataFromVPSAndSPSAndPPS(vps, sps, pps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := NewCodecDataFromHEVCDecoderConfRecord(codecData.HEVCDecoderConfRecordBytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(parsed.VPS(), vps) || !bytes.Equal(parsed.SPS(), sps) || !bytes.Equal(parsed.PPS(), pps) {
+		t.Errorf("record=%x", codecData.Record)
+	}
+	if parsed.Width() != 1920 || parsed.Height() != 1080 || parsed.RecordInfo.LengthSizeMinusOne != 3 {
+		t.Errorf("parsed=%+v", parsed.RecordInfo)
+	}
+}
@@ -0,0 +1,187 @@
+package mp3parser
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+)
+
+// MPEG audio versions
+const (
+	MPEG1  = 1
+	MPEG2  = 2
+	MPEG25 = 3
+)
+
+// FrameHeaderLength const
+const FrameHeaderLength = 4
+
+var bitrateTable = [2][3][15]int{
+	// MPEG1 layer 1, 2, 3
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	// MPEG2 and MPEG2.5 layer 1, 2, 3
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+var sampleRateTable = [3][3]int{
+	{44100, 48000, 32000},
+	{22050, 24000, 16000},
+	{11025, 12000, 8000},
+}
+
+// FrameHeader struct
+type FrameHeader struct {
+	Version       int
+	Layer         int
+	Bitrate       int // bits per second, 0 is free format
+	SampleRate    int
+	ChannelLayout av.ChannelLayout
+	Padding       bool
+	// FrameLength includes header, 0 for free format
+	FrameLength int
+	// Samples is number of samples per channel in frame
+	Samples int
+}
+
+// ParseFrameHeader func
+func ParseFrameHeader(b []byte) (hdr FrameHeader, err error) {
+	if len(b) < FrameHeaderLength {
+		err = fmt.Errorf("mp3parser: frame header too short")
+		return
+	}
+	if b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		err = fmt.Errorf("mp3parser: frame sync not found")
+		return
+	}
+
+	versionBits := (b[1] >> 3) & 0x3
+	layerBits := (b[1] >> 1) & 0x3
+	bitrateIdx := int(b[2] >> 4)
+	sampleRateIdx := int(b[2]>>2) & 0x3
+	padding := (b[2] >> 1) & 0x1
+	channelMode := b[3] >> 6
+
+	switch versionBits {
+	case 0:
+		hdr.Version = MPEG25
+	case 2:
+		hdr.Version = MPEG2
+	case 3:
+		hdr.Version = MPEG1
+	default:
+		err = fmt.Errorf("mp3parser: reserved version")
+		return
+	}
+	if layerBits == 0 {
+		err = fmt.Errorf("mp3parser: reserved layer")
+		return
+	}
+	hdr.Layer = 4 - int(layerBits)
+	if bitrateIdx == 0xf || sampleRateIdx == 0x3 {
+		err = fmt.Errorf("mp3parser: invalid bitrate or sample rate index")
+		return
+	}
+
+	tableIdx := 0
+	if hdr.Version != MPEG1 {
+		tableIdx = 1
+	}
+	hdr.Bitrate = bitrateTable[tableIdx][hdr.Layer-1][bitrateIdx] * 1000
+	hdr.SampleRate = sampleRateTable[hdr.Version-1][sampleRateIdx]
+	hdr.Padding = padding != 0
+	if channelMode == 3 {
+		hdr.ChannelLayout = av.ChMono
+	} else {
+		hdr.ChannelLayout = av.ChStereo
+	}
+
+	switch {
+	case hdr.Layer == 1:
+		hdr.Samples = 384
+	case hdr.Layer == 3 && hdr.Version != MPEG1:
+		hdr.Samples = 576
+	default:
+		hdr.Samples = 1152
+	}
+
+	if hdr.Bitrate != 0 {
+		if hdr.Layer == 1 {
+			hdr.FrameLength = (12*hdr.Bitrate/hdr.SampleRate + int(padding)) * 4
+		} else {
+			hdr.FrameLength = hdr.Samples/8*hdr.Bitrate/hdr.SampleRate + int(padding)
+		}
+	}
+	return
+}
+
+// CodecData struct
+type CodecData struct {
+	Header FrameHeader
+}
+
+// Type func
+func (inst CodecData) Type() av.CodecType {
+	return av.MP3
+}
+
+// ChannelLayout func
+func (inst CodecData) ChannelLayout() av.ChannelLayout {
+	return inst.Header.ChannelLayout
+}
+
+// SampleRate func
+func (inst CodecData) SampleRate() int {
+	return inst.Header.SampleRate
+}
+
+// SampleFormat func
+func (inst CodecData) SampleFormat() av.SampleFormat {
+	return av.FLTP
+}
+
+// PacketDuration func, counts frames in data which may hold several frames
+func (inst CodecData) PacketDuration(data []byte) (dur time.Duration, err error) {
+	samples := 0
+	for len(data) > 0 {
+		var hdr FrameHeader
+		if hdr, err = ParseFrameHeader(data); err != nil {
+			break
+		}
+		samples += hdr.Samples
+		if hdr.FrameLength == 0 || hdr.FrameLength >= len(data) {
+			break
+		}
+		data = data[hdr.FrameLength:]
+	}
+	if samples == 0 {
+		if err != nil {
+			return
+		}
+		samples = inst.Header.Samples
+	}
+	err = nil
+	dur = time.Duration(samples) * time.Second / time.Duration(inst.Header.SampleRate)
+	return
+}
+
+// NewCodecDataFromFrameHeader func
+func NewCodecDataFromFrameHeader(hdr FrameHeader) CodecData {
+	return CodecData{Header: hdr}
+}
+
+// NewCodecDataFromFrame parses header of first frame in data
+func NewCodecDataFromFrame(data []byte) (inst CodecData, err error) {
+	if inst.Header, err = ParseFrameHeader(data); err != nil {
+		return
+	}
+	return
+}
@@ -0,0 +1,54 @@
+package mp3parser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFrameHeader(t *testing.T) {
+	for _, tc := range []struct {
+		hdr        []byte
+		version    int
+		layer      int
+		sampleRate int
+		channels   int
+		length     int
+		samples    int
+	}{
+		{[]byte{0xff, 0xfb, 0x90, 0x64}, MPEG1, 3, 44100, 2, 417, 1152},
+		{[]byte{0xff, 0xfb, 0x92, 0xc4}, MPEG1, 3, 44100, 1, 418, 1152},
+		{[]byte{0xff, 0xf3, 0x84, 0xc4}, MPEG2, 3, 24000, 1, 192, 576},
+		{[]byte{0xff, 0xe3, 0x88, 0xc4}, MPEG25, 3, 8000, 1, 576, 576},
+		{[]byte{0xff, 0xfd, 0x90, 0x04}, MPEG1, 2, 44100, 2, 522, 1152},
+	} {
+		hdr, err := ParseFrameHeader(tc.hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Version != tc.version || hdr.Layer != tc.layer || hdr.SampleRate != tc.sampleRate ||
+			hdr.ChannelLayout.Count() != tc.channels || hdr.FrameLength != tc.length || hdr.Samples != tc.samples {
+			t.Errorf("header=%x parsed=%+v", tc.hdr, hdr)
+		}
+	}
+
+	if _, err := ParseFrameHeader([]byte{0xff, 0xfb, 0xf0, 0x64}); err == nil {
+		t.Error("bad bitrate index should fail")
+	}
+}
+
+func TestPacketDuration(t *testing.T) {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x64})
+	codecData, err := NewCodecDataFromFrame(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append(append([]byte{}, frame...), frame...)
+	dur, err := codecData.PacketDuration(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 2 * 1152 * time.Second / 44100; dur != want {
+		t.Errorf("duration=%v want=%v", dur, want)
+	}
+}
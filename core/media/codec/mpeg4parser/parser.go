@@ -0,0 +1,222 @@
+// Package mpeg4parser parses MPEG-4 Part 2 visual (ISO/IEC 14496-2) headers.
+package mpeg4parser
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits"
+)
+
+// start codes follow 00 00 01 prefix
+const (
+	VisualObjectSequenceStartCode = 0xb0
+	VisualObjectStartCode         = 0xb5
+	VOPStartCode                  = 0xb6
+	// VideoObjectLayerStartCode is first of 0x20 to 0x2f
+	VideoObjectLayerStartCode = 0x20
+)
+
+// vop_coding_type of VOP header
+const (
+	VOPTypeI = 0
+	VOPTypeP = 1
+	VOPTypeB = 2
+	VOPTypeS = 3
+)
+
+const shapeRectangular = 0
+
+// VOLInfo is parsed video object layer header
+type VOLInfo struct {
+	ObjectType              uint // video_object_type_indication
+	Width                   uint
+	Height                  uint
+	TimeIncrementResolution uint
+}
+
+// findStartCode returns data after first start code for which match is true
+func findStartCode(b []byte, match func(code byte) bool) []byte {
+	for {
+		i := bytes.Index(b, []byte{0, 0, 1})
+		if i < 0 || i+3 >= len(b) {
+			return nil
+		}
+		if match(b[i+3]) {
+			return b[i+4:]
+		}
+		b = b[i+3:]
+	}
+}
+
+func isVOL(code byte) bool {
+	return code >= VideoObjectLayerStartCode && code <= VideoObjectLayerStartCode+0xf
+}
+
+// ParseVOL parses video object layer header, data follows its start code
+func ParseVOL(data []byte) (inst VOLInfo, err error) {
+	r := &bits.GolombBitReader{R: bytes.NewReader(data)}
+
+	// random_accessible_vol
+	if _, err = r.ReadBit(); err != nil {
+		return
+	}
+	if inst.ObjectType, err = r.ReadBits(8); err != nil {
+		return
+	}
+
+	verid := uint(1)
+	var flag uint
+	// is_object_layer_identifier
+	if flag, err = r.ReadBit(); err != nil {
+		return
+	}
+	if flag != 0 {
+		if verid, err = r.ReadBits(4); err != nil {
+			return
+		}
+		// video_object_layer_priority
+		if _, err = r.ReadBits(3); err != nil {
+			return
+		}
+	}
+
+	var aspect uint
+	if aspect, err = r.ReadBits(4); err != nil {
+		return
+	}
+	// extended PAR, par_width and par_height
+	if aspect == 0xf {
+		if _, err = r.ReadBits(16); err != nil {
+			return
+		}
+	}
+
+	// vol_control_parameters
+	if flag, err = r.ReadBit(); err != nil {
+		return
+	}
+	if flag != 0 {
+		// chroma_format, low_delay
+		if _, err = r.ReadBits(3); err != nil {
+			return
+		}
+		// vbv_parameters
+		if flag, err = r.ReadBit(); err != nil {
+			return
+		}
+		if flag != 0 {
+			// bit rate, buffer size and occupancy with markers
+			if _, err = r.ReadBits(79); err != nil {
+				return
+			}
+		}
+	}
+
+	var shape uint
+	if shape, err = r.ReadBits(2); err != nil {
+		return
+	}
+	// grayscale shape extension
+	if shape == 3 && verid != 1 {
+		if _, err = r.ReadBits(4); err != nil {
+			return
+		}
+	}
+
+	// marker, vop_time_increment_resolution, marker
+	if _, err = r.ReadBit(); err != nil {
+		return
+	}
+	if inst.TimeIncrementResolution, err = r.ReadBits(16); err != nil {
+		return
+	}
+	if _, err = r.ReadBit(); err != nil {
+		return
+	}
+	// fixed_vop_rate
+	if flag, err = r.ReadBit(); err != nil {
+		return
+	}
+	if flag != 0 {
+		n := 1
+		for (inst.TimeIncrementResolution-1)>>uint(n) != 0 {
+			n++
+		}
+		if _, err = r.ReadBits(n); err != nil {
+			return
+		}
+	}
+
+	if shape != shapeRectangular {
+		err = fmt.Errorf("mpeg4parser: video object layer shape=%d not supported", shape)
+		return
+	}
+	// marker, width, marker, height, marker
+	if _, err = r.ReadBit(); err != nil {
+		return
+	}
+	if inst.Width, err = r.ReadBits(13); err != nil {
+		return
+	}
+	if _, err = r.ReadBit(); err != nil {
+		return
+	}
+	if inst.Height, err = r.ReadBits(13); err != nil {
+		return
+	}
+	return
+}
+
+// VOPType returns vop_coding_type of first VOP in packet
+func VOPType(pkt []byte) (typ int, err error) {
+	vop := findStartCode(pkt, func(code byte) bool { return code == VOPStartCode })
+	if len(vop) < 1 {
+		err = fmt.Errorf("mpeg4parser: VOP not found")
+		return
+	}
+	typ = int(vop[0] >> 6)
+	return
+}
+
+// CodecData struct, Config is decoder specific info of esds, which holds VOS, VO and VOL headers
+type CodecData struct {
+	Config  []byte
+	VOLInfo VOLInfo
+}
+
+// Type func
+func (codecData CodecData) Type() av.CodecType {
+	return av.MPEG4
+}
+
+// ConfigBytes func
+func (codecData CodecData) ConfigBytes() []byte {
+	return codecData.Config
+}
+
+// Width func
+func (codecData CodecData) Width() int {
+	return int(codecData.VOLInfo.Width)
+}
+
+// Height func
+func (codecData CodecData) Height() int {
+	return int(codecData.VOLInfo.Height)
+}
+
+// NewCodecDataFromConfig func
+func NewCodecDataFromConfig(config []byte) (codecData CodecData, err error) {
+	vol := findStartCode(config, isVOL)
+	if vol == nil {
+		err = fmt.Errorf("mpeg4parser: no VOL header found in config")
+		return
+	}
+	if codecData.VOLInfo, err = ParseVOL(vol); err != nil {
+		err = fmt.Errorf("mpeg4parser: parse VOL failed(%s)", err)
+		return
+	}
+	codecData.Config = config
+	return
+}
@@ -0,0 +1,88 @@
+package mpeg4parser
+
+import (
+	"testing"
+)
+
+// testBits packs pairs of value and bit count, last byte is padded with zeros
+func testBits(fields ...uint) (b []byte) {
+	n := 0
+	for i := 0; i < len(fields); i += 2 {
+		for j := int(fields[i+1]) - 1; j >= 0; j-- {
+			if n%8 == 0 {
+				b = append(b, 0)
+			}
+			b[len(b)-1] |= byte(fields[i]>>uint(j)&1) << uint(7-n%8)
+			n++
+		}
+	}
+	return
+}
+
+// testConfig makes VOS and VO headers followed by VOL
+func testConfig(vol []byte) []byte {
+	config := []byte{0, 0, 1, VisualObjectSequenceStartCode, 0xf5, 0, 0, 1, VisualObjectStartCode, 0x09}
+	config = append(config, 0, 0, 1, VideoObjectLayerStartCode)
+	return append(config, vol...)
+}
+
+func TestNewCodecDataFromConfig(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		vol           []byte
+		width, height int
+	}{
+		{
+			name: "simple",
+			vol: testBits(0, 1, 1, 8, 0, 1, 1, 4, 0, 1, 0, 2,
+				1, 1, 25, 16, 1, 1, 0, 1,
+				1, 1, 320, 13, 1, 1, 240, 13, 1, 1, 0, 1, 1, 1),
+			width: 320, height: 240,
+		},
+		{
+			// layer identifier, extended PAR, vbv parameters and fixed vop rate
+			name: "all optional fields",
+			vol: testBits(1, 1, 17, 8, 1, 1, 2, 4, 1, 3, 0xf, 4, 12, 8, 11, 8,
+				1, 1, 1, 2, 1, 1, 1, 1, 0x7fff, 15, 1, 1, 0x7fff, 15, 1, 1, 0x7fff, 15, 1, 1, 7, 3, 0x7ff, 11, 1, 1, 0x7fff, 15, 1, 1,
+				0, 2, 1, 1, 30000, 16, 1, 1, 1, 1, 1001, 15,
+				1, 1, 176, 13, 1, 1, 144, 13, 1, 1),
+			width: 176, height: 144,
+		},
+	} {
+		codecData, err := NewCodecDataFromConfig(testConfig(test.vol))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if codecData.Width() != test.width || codecData.Height() != test.height {
+			t.Errorf("%s: size=%dx%d, want %dx%d", test.name, codecData.Width(), codecData.Height(), test.width, test.height)
+		}
+	}
+
+	// binary shape has no size
+	if _, err := NewCodecDataFromConfig(testConfig(testBits(0, 1, 1, 8, 0, 1, 1, 4, 0, 1, 1, 2, 1, 1, 25, 16, 1, 1, 0, 1))); err == nil {
+		t.Error("binary shape accepted")
+	}
+	if _, err := NewCodecDataFromConfig([]byte{0, 0, 1, VisualObjectSequenceStartCode, 0xf5}); err == nil {
+		t.Error("config without VOL accepted")
+	}
+}
+
+func TestVOPType(t *testing.T) {
+	for _, test := range []struct {
+		pkt []byte
+		typ int
+	}{
+		{[]byte{0, 0, 1, VOPStartCode, 0x10, 0x20}, VOPTypeI},
+		{[]byte{0, 0, 1, VOPStartCode, 0x50}, VOPTypeP},
+		{[]byte{0, 0, 1, 0xb3, 0, 0, 0, 0, 1, VOPStartCode, 0x80}, VOPTypeB},
+	} {
+		typ, err := VOPType(test.pkt)
+		if err != nil || typ != test.typ {
+			t.Errorf("pkt=% x: type=%d err=%v, want %d", test.pkt, typ, err, test.typ)
+		}
+	}
+	if _, err := VOPType([]byte{0, 0, 1, 0xb3, 0}); err == nil {
+		t.Error("packet without VOP accepted")
+	}
+}
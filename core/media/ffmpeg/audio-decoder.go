@@ -3,15 +3,10 @@ package ffmpeg
 /*
 #cgo CFLAGS: -I../../../deps/include
 #include "ffmpeg.h"
-int decode_audio(AVCodecContext *ctx, AVFrame *frame, void *data, int size, int *got) {
+// NULL data sends flush packet
+int send_audio_packet(AVCodecContext *ctx, void *data, int size) {
   struct AVPacket pkt = {.data = data, .size = size};
-  int result;
-  *got = 0;
-  if ((result = avcodec_send_packet(ctx, &pkt)) == 0 && (result = avcodec_receive_frame(ctx, frame)) == 0) {
-    *got = 1;
-  }
-
-  return result;
+  return avcodec_send_packet(ctx, data == NULL ? NULL : &pkt);
 }
 
 */
@@ -114,26 +109,70 @@ func (decoder *AudioDecoder) Setup() error {
 	return nil
 }
 
-// Decode frame
-func (decoder *AudioDecoder) Decode(pkt []byte) (bool, av.AudioFrame, error) {
+// receiveFrames receives all frames decoded from sent packets
+func (decoder *AudioDecoder) receiveFrames() (frames []av.AudioFrame, err error) {
 	ff := &decoder.ff.ff
-	var frame av.AudioFrame
-	var gotFrame bool
+	for {
+		cerr := C.avcodec_receive_frame(ff.codecCtx, ff.frame)
+		if cerr == (-C.EAGAIN) || cerr == C.AVERROR_EOF {
+			return
+		} else if cerr < C.int(0) {
+			msg := GetFFErrorMessage(int(cerr))
+			err = fmt.Errorf("%08x/%v", uint32(C.int(cerr)), msg)
+			return
+		}
+
+		var frame av.AudioFrame
+		audioFrameAssignToAV(ff.frame, &frame)
+		frame.SampleRate = decoder.SampleRate
+		frames = append(frames, frame)
+	}
+}
+
+// DecodeFrames decodes packet into all frames of it
+func (decoder *AudioDecoder) DecodeFrames(pkt []byte) (frames []av.AudioFrame, err error) {
+	ff := &decoder.ff.ff
+	if len(pkt) == 0 {
+		return
+	}
 
-	cgotFrame := C.int(0)
-	cerr := C.decode_audio(ff.codecCtx, ff.frame, unsafe.Pointer(&pkt[0]), C.int(len(pkt)), &cgotFrame)
+	cerr := C.send_audio_packet(ff.codecCtx, unsafe.Pointer(&pkt[0]), C.int(len(pkt)))
 	if cerr < C.int(0) {
 		msg := GetFFErrorMessage(int(cerr))
-		return false, frame, fmt.Errorf("%08x/%v", uint32(C.int(cerr)), msg)
+		err = fmt.Errorf("%08x/%v", uint32(C.int(cerr)), msg)
+		return
 	}
+	return decoder.receiveFrames()
+}
 
-	if cgotFrame != C.int(0) {
-		gotFrame = true
-		audioFrameAssignToAV(ff.frame, &frame)
-		frame.SampleRate = decoder.SampleRate
+// Decode frame, frames of one packet are concatenated
+func (decoder *AudioDecoder) Decode(pkt []byte) (bool, av.AudioFrame, error) {
+	var frame av.AudioFrame
+
+	frames, err := decoder.DecodeFrames(pkt)
+	if err != nil || len(frames) == 0 {
+		return false, frame, err
+	}
+	frame = frames[0]
+	for _, f := range frames[1:] {
+		frame = frame.Concat(f)
 	}
+	return true, frame, nil
+}
+
+// Flush returns frames buffered in decoder at end of stream, decoder can be used again after it
+func (decoder *AudioDecoder) Flush() (frames []av.AudioFrame, err error) {
+	ff := &decoder.ff.ff
 
-	return gotFrame, frame, nil
+	cerr := C.send_audio_packet(ff.codecCtx, nil, 0)
+	if cerr < C.int(0) && cerr != C.AVERROR_EOF {
+		msg := GetFFErrorMessage(int(cerr))
+		err = fmt.Errorf("%08x/%v", uint32(C.int(cerr)), msg)
+		return
+	}
+	frames, err = decoder.receiveFrames()
+	C.avcodec_flush_buffers(ff.codecCtx)
+	return
 }
 
 // Close decoder
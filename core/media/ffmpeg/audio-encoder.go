@@ -168,47 +168,42 @@ func (encoder *AudioEncoder) CodecData() (codec av.AudioCodecData, err error) {
 	return
 }
 
-func (encoder *AudioEncoder) encodeOne(frame av.AudioFrame) (gotpkt bool, pkt []byte, err error) {
+// receivePackets receives all packets encoded from sent frames
+func (encoder *AudioEncoder) receivePackets() (pkts [][]byte, err error) {
+	ff := &encoder.ff.ff
+	for {
+		cpkt := C.AVPacket{}
+		cerr := C.avcodec_receive_packet(ff.codecCtx, &cpkt)
+		if cerr == (-C.EAGAIN) || cerr == C.AVERROR_EOF {
+			return
+		} else if cerr < C.int(0) {
+			err = fmt.Errorf("ffmpeg: avcodec_receive_packet failed: %d", cerr)
+			return
+		}
+
+		pkt := C.GoBytes(unsafe.Pointer(cpkt.data), cpkt.size)
+		C.av_packet_unref(&cpkt)
+		if debug {
+			fmt.Println("ffmpeg: Encode", "len", len(pkt))
+		}
+		pkts = append(pkts, pkt)
+	}
+}
+
+func (encoder *AudioEncoder) encodeOne(frame av.AudioFrame) (pkts [][]byte, err error) {
 	if err = encoder.prepare(); err != nil {
 		return
 	}
 
 	ff := &encoder.ff.ff
 
-	cpkt := C.AVPacket{}
 	audioFrameAssignToFF(frame, ff.frame)
-
-	if false {
-		farr := []string{}
-		for i := 0; i < len(frame.Data[0])/4; i++ {
-			var f *float64 = (*float64)(unsafe.Pointer(&frame.Data[0][i*4]))
-			farr = append(farr, fmt.Sprintf("%.8f", *f))
-		}
-		fmt.Println(farr)
-	}
-	//cerr := C.avcodec_send_frame(ff.codecCtx, &cpkt, ff.frame, &cgotpkt)
 	cerr := C.avcodec_send_frame(ff.codecCtx, ff.frame)
 	if cerr < C.int(0) {
-		err = fmt.Errorf("ffmpeg: avcodec_encode_audio2 failed: %d", cerr)
+		err = fmt.Errorf("ffmpeg: avcodec_send_frame failed: %d", cerr)
 		return
 	}
-	if cerr >= C.int(0) {
-		cerr = C.avcodec_receive_packet(ff.codecCtx, &cpkt)
-		if cerr == (-C.EAGAIN) || cerr == C.AVERROR_EOF {
-			return
-		} else if cerr >= C.int(0) {
-
-			gotpkt = true
-			pkt = C.GoBytes(unsafe.Pointer(cpkt.data), cpkt.size)
-			C.av_packet_unref(&cpkt)
-
-			if debug {
-				fmt.Println("ffmpeg: Encode", frame.SampleCount, frame.SampleRate, frame.ChannelLayout, frame.SampleFormat, "len", len(pkt))
-			}
-		}
-	}
-
-	return
+	return encoder.receivePackets()
 }
 
 func (encoder *AudioEncoder) resample(in av.AudioFrame) (out av.AudioFrame, err error) {
@@ -227,8 +222,7 @@ func (encoder *AudioEncoder) resample(in av.AudioFrame) (out av.AudioFrame, err
 
 // Encode func
 func (encoder *AudioEncoder) Encode(frame av.AudioFrame) (pkts [][]byte, err error) {
-	var gotpkt bool
-	var pkt []byte
+	var _pkts [][]byte
 
 	if frame.SampleFormat != encoder.SampleFormat || frame.ChannelLayout != encoder.ChannelLayout || frame.SampleRate != encoder.SampleRate {
 		if frame, err = encoder.resample(frame); err != nil {
@@ -244,23 +238,48 @@ func (encoder *AudioEncoder) Encode(frame av.AudioFrame) (pkts [][]byte, err err
 		}
 		for encoder.framebuf.SampleCount >= encoder.FrameSampleCount {
 			frame := encoder.framebuf.Slice(0, encoder.FrameSampleCount)
-			if gotpkt, pkt, err = encoder.encodeOne(frame); err != nil {
+			if _pkts, err = encoder.encodeOne(frame); err != nil {
 				return
 			}
-			if gotpkt {
-				pkts = append(pkts, pkt)
-			}
+			pkts = append(pkts, _pkts...)
 			encoder.framebuf = encoder.framebuf.Slice(encoder.FrameSampleCount, encoder.framebuf.SampleCount)
 		}
 	} else {
-		if gotpkt, pkt, err = encoder.encodeOne(frame); err != nil {
+		if pkts, err = encoder.encodeOne(frame); err != nil {
 			return
 		}
-		if gotpkt {
-			pkts = append(pkts, pkt)
+	}
+
+	return
+}
+
+// Flush encodes samples left in frame buffer as last frame and returns packets buffered in encoder,
+// encoder can not be used after it
+func (encoder *AudioEncoder) Flush() (pkts [][]byte, err error) {
+	if err = encoder.prepare(); err != nil {
+		return
+	}
+	ff := &encoder.ff.ff
+
+	// last frame may be shorter, ffmpeg pads it if encoder needs
+	if encoder.framebuf.SampleCount > 0 {
+		frame := encoder.framebuf
+		encoder.framebuf = av.AudioFrame{}
+		if pkts, err = encoder.encodeOne(frame); err != nil {
+			return
 		}
 	}
 
+	cerr := C.avcodec_send_frame(ff.codecCtx, nil)
+	if cerr < C.int(0) && cerr != C.AVERROR_EOF {
+		err = fmt.Errorf("ffmpeg: avcodec_send_frame failed: %d", cerr)
+		return
+	}
+	var _pkts [][]byte
+	if _pkts, err = encoder.receivePackets(); err != nil {
+		return
+	}
+	pkts = append(pkts, _pkts...)
 	return
 }
 
@@ -7,6 +7,7 @@ package ffmpeg
 import "C"
 import (
 	"fmt"
+	"image"
 	"time"
 	"unsafe"
 
@@ -136,9 +137,17 @@ func audioFrameAssignToAVParams(f *C.AVFrame, frame *av.AudioFrame) {
 
 func audioFrameAssignToAVData(f *C.AVFrame, frame *av.AudioFrame) {
 	frame.SampleCount = int(f.nb_samples)
-	frame.Data = make([][]byte, int(f.channels))
-	for i := 0; i < int(f.channels); i++ {
-		frame.Data[i] = C.GoBytes(unsafe.Pointer(f.data[i]), f.linesize[0])
+	// linesize is padded, frames are concatenated by sample count
+	format := sampleFormatFF2AV(int32(f.format))
+	planes := int(f.channels)
+	size := frame.SampleCount * format.BytesPerSample()
+	if !format.IsPlanar() {
+		size *= planes
+		planes = 1
+	}
+	frame.Data = make([][]byte, planes)
+	for i := 0; i < planes; i++ {
+		frame.Data[i] = C.GoBytes(unsafe.Pointer(f.data[i]), C.int(size))
 	}
 }
 
@@ -166,6 +175,72 @@ func audioFrameAssignToFF(frame av.AudioFrame, f *C.AVFrame) {
 	audioFrameAssignToFFData(frame, f)
 }
 
+// PixelFormat is pixel format of VideoFrame, values are same as AVPixelFormat of ffmpeg
+type PixelFormat int32
+
+// define pixel formats
+const (
+	PixelFormatNone = PixelFormat(C.AV_PIX_FMT_NONE)
+	YUV420P         = PixelFormat(C.AV_PIX_FMT_YUV420P)  // planar YUV 4:2:0
+	YUV422P         = PixelFormat(C.AV_PIX_FMT_YUV422P)  // planar YUV 4:2:2
+	YUV444P         = PixelFormat(C.AV_PIX_FMT_YUV444P)  // planar YUV 4:4:4
+	YUV440P         = PixelFormat(C.AV_PIX_FMT_YUV440P)  // planar YUV 4:4:0
+	YUV411P         = PixelFormat(C.AV_PIX_FMT_YUV411P)  // planar YUV 4:1:1
+	YUV410P         = PixelFormat(C.AV_PIX_FMT_YUV410P)  // planar YUV 4:1:0
+	YUVJ420P        = PixelFormat(C.AV_PIX_FMT_YUVJ420P) // planar YUV 4:2:0, full range (JPEG)
+	YUVJ422P        = PixelFormat(C.AV_PIX_FMT_YUVJ422P) // planar YUV 4:2:2, full range (JPEG)
+	YUVJ444P        = PixelFormat(C.AV_PIX_FMT_YUVJ444P) // planar YUV 4:4:4, full range (JPEG)
+	YUVJ440P        = PixelFormat(C.AV_PIX_FMT_YUVJ440P) // planar YUV 4:4:0, full range (JPEG)
+	YUVJ411P        = PixelFormat(C.AV_PIX_FMT_YUVJ411P) // planar YUV 4:1:1, full range (JPEG)
+	NV12            = PixelFormat(C.AV_PIX_FMT_NV12)     // Y plane and interleaved UV plane, 4:2:0
+	NV21            = PixelFormat(C.AV_PIX_FMT_NV21)     // Y plane and interleaved VU plane, 4:2:0
+	GRAY8           = PixelFormat(C.AV_PIX_FMT_GRAY8)
+	RGBA            = PixelFormat(C.AV_PIX_FMT_RGBA)
+	BGRA            = PixelFormat(C.AV_PIX_FMT_BGRA)
+	RGB24           = PixelFormat(C.AV_PIX_FMT_RGB24)
+	BGR24           = PixelFormat(C.AV_PIX_FMT_BGR24)
+)
+
+// String func
+func (format PixelFormat) String() string {
+	name := C.av_get_pix_fmt_name(int32(format))
+	if name == nil {
+		return "?"
+	}
+	return C.GoString(name)
+}
+
+// SubsampleRatio returns chroma subsampling of planar YUV format, ok is false for other formats
+func (format PixelFormat) SubsampleRatio() (ratio image.YCbCrSubsampleRatio, ok bool) {
+	ok = true
+	switch format {
+	case YUV420P, YUVJ420P:
+		ratio = image.YCbCrSubsampleRatio420
+	case YUV422P, YUVJ422P:
+		ratio = image.YCbCrSubsampleRatio422
+	case YUV444P, YUVJ444P:
+		ratio = image.YCbCrSubsampleRatio444
+	case YUV440P, YUVJ440P:
+		ratio = image.YCbCrSubsampleRatio440
+	case YUV411P, YUVJ411P:
+		ratio = image.YCbCrSubsampleRatio411
+	case YUV410P:
+		ratio = image.YCbCrSubsampleRatio410
+	default:
+		ok = false
+	}
+	return
+}
+
+// IsFullRange checks if format is full range (JPEG) YUV
+func (format PixelFormat) IsFullRange() bool {
+	switch format {
+	case YUVJ420P, YUVJ422P, YUVJ444P, YUVJ440P, YUVJ411P:
+		return true
+	}
+	return false
+}
+
 type audioCodecData struct {
 	codecID       uint32
 	sampleFormat  av.SampleFormat
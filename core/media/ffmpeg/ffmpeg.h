@@ -4,6 +4,7 @@
 #include <libswresample/swresample.h>
 #include <libavutil/opt.h>
 #include <libavutil/avstring.h>
+#include <libavutil/pixdesc.h>
 #include <libswscale/swscale.h>
 
 typedef struct {
@@ -4,17 +4,13 @@ package ffmpeg
 #cgo CFLAGS: -I../../../deps/include
 #include "ffmpeg.h"
 
-int decode_video(AVCodecContext *ctx, AVFrame *frame, void *data, int size, int *got) {
-  struct AVPacket pkt = {.data = data, .size = size};
-  int result;
-  *got = 0;
-
-  if ((result = avcodec_send_packet(ctx, &pkt)) == 0 && (result = avcodec_receive_frame(ctx, frame)) == 0) {
-    *got = 1;
-  }
-
-	return result;
+// NULL data sends flush packet
+int send_video_packet(AVCodecContext *ctx, void *data, int size, int64_t pts) {
+  struct AVPacket pkt = {.data = data, .size = size, .pts = pts, .dts = AV_NOPTS_VALUE};
+  return avcodec_send_packet(ctx, data == NULL ? NULL : &pkt);
 }
+
+static const int64_t nopts_value = AV_NOPTS_VALUE;
 */
 import "C"
 import (
@@ -22,17 +18,166 @@ import (
 	"image"
 	"reflect"
 	"runtime"
+	"time"
 	"unsafe"
 
 	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/h264parser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/h265parser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/mpeg4parser"
 )
 
 // VideoFrame decoded frame
 type VideoFrame struct {
-	Image image.YCbCr
+	Image image.YCbCr // refers to frame data, set only for planar YUV formats
 	frame *C.AVFrame
 }
 
+// newVideoFrame wraps frame, Image is set if frame is planar YUV
+func newVideoFrame(frame *C.AVFrame) *VideoFrame {
+	img := &VideoFrame{frame: frame}
+
+	format := PixelFormat(frame.format)
+	if ratio, ok := format.SubsampleRatio(); ok {
+		w := int(frame.width)
+		h := int(frame.height)
+		ys := int(frame.linesize[0])
+		cs := int(frame.linesize[1])
+		_, ch := chromaSize(ratio, w, h)
+
+		img.Image = image.YCbCr{
+			Y:              fromCPtr(unsafe.Pointer(frame.data[0]), ys*h),
+			Cb:             fromCPtr(unsafe.Pointer(frame.data[1]), cs*ch),
+			Cr:             fromCPtr(unsafe.Pointer(frame.data[2]), cs*ch),
+			YStride:        ys,
+			CStride:        cs,
+			SubsampleRatio: ratio,
+			Rect:           image.Rect(0, 0, w, h),
+		}
+	}
+	runtime.SetFinalizer(img, freeVideoFrame)
+	return img
+}
+
+// PixelFormat returns pixel format of frame
+func (instance *VideoFrame) PixelFormat() PixelFormat {
+	return PixelFormat(instance.frame.format)
+}
+
+// IsFullRange checks if frame is full range (JPEG) YUV
+func (instance *VideoFrame) IsFullRange() bool {
+	return instance.PixelFormat().IsFullRange() || instance.frame.color_range == C.AVCOL_RANGE_JPEG
+}
+
+// Width func
+func (instance *VideoFrame) Width() int {
+	return int(instance.frame.width)
+}
+
+// Height func
+func (instance *VideoFrame) Height() int {
+	return int(instance.frame.height)
+}
+
+// plane returns rows of plane i, each n bytes
+func (instance *VideoFrame) plane(i, n, rows int) (b []byte, stride int) {
+	stride = int(instance.frame.linesize[i])
+	b = fromCPtr(unsafe.Pointer(instance.frame.data[i]), stride*(rows-1)+n)
+	return
+}
+
+// ToImage copies frame into *image.YCbCr for planar YUV and NV12/NV21, *image.Gray for GRAY8,
+// *image.NRGBA for RGBA/BGRA and *image.RGBA for RGB24/BGR24. Other formats must be converted by Scaler.
+func (instance *VideoFrame) ToImage() (img image.Image, err error) {
+	w := instance.Width()
+	h := instance.Height()
+	rect := image.Rect(0, 0, w, h)
+
+	switch format := instance.PixelFormat(); format {
+	case NV12, NV21:
+		out := image.NewYCbCr(rect, image.YCbCrSubsampleRatio420)
+		cw, ch := chromaSize(out.SubsampleRatio, w, h)
+		src, stride := instance.plane(0, w, h)
+		for y := 0; y < h; y++ {
+			copy(out.Y[y*out.YStride:y*out.YStride+w], src[y*stride:])
+		}
+		cb, cr := out.Cb, out.Cr
+		if format == NV21 {
+			cb, cr = cr, cb
+		}
+		src, stride = instance.plane(1, cw*2, ch)
+		for y := 0; y < ch; y++ {
+			for x := 0; x < cw; x++ {
+				cb[y*out.CStride+x] = src[y*stride+x*2]
+				cr[y*out.CStride+x] = src[y*stride+x*2+1]
+			}
+		}
+		img = out
+
+	case GRAY8:
+		out := image.NewGray(rect)
+		src, stride := instance.plane(0, w, h)
+		for y := 0; y < h; y++ {
+			copy(out.Pix[y*out.Stride:y*out.Stride+w], src[y*stride:])
+		}
+		img = out
+
+	case RGBA, BGRA:
+		out := image.NewNRGBA(rect)
+		src, stride := instance.plane(0, w*4, h)
+		for y := 0; y < h; y++ {
+			row := out.Pix[y*out.Stride : y*out.Stride+w*4]
+			copy(row, src[y*stride:])
+			if format == BGRA {
+				for x := 0; x < len(row); x += 4 {
+					row[x], row[x+2] = row[x+2], row[x]
+				}
+			}
+		}
+		img = out
+
+	case RGB24, BGR24:
+		out := image.NewRGBA(rect)
+		r, b := 0, 2
+		if format == BGR24 {
+			r, b = 2, 0
+		}
+		src, stride := instance.plane(0, w*3, h)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				i := y*out.Stride + x*4
+				j := y*stride + x*3
+				out.Pix[i] = src[j+r]
+				out.Pix[i+1] = src[j+1]
+				out.Pix[i+2] = src[j+b]
+				out.Pix[i+3] = 0xff
+			}
+		}
+		img = out
+
+	default:
+		ratio, ok := format.SubsampleRatio()
+		if !ok {
+			err = fmt.Errorf("ffmpeg: pixel format %v can not convert to image", format)
+			return
+		}
+		out := image.NewYCbCr(rect, ratio)
+		cw, ch := chromaSize(ratio, w, h)
+		src, stride := instance.plane(0, w, h)
+		for y := 0; y < h; y++ {
+			copy(out.Y[y*out.YStride:y*out.YStride+w], src[y*stride:])
+		}
+		for i, dst := range [][]byte{out.Cb, out.Cr} {
+			src, stride = instance.plane(i+1, cw, ch)
+			for y := 0; y < ch; y++ {
+				copy(dst[y*out.CStride:y*out.CStride+cw], src[y*stride:])
+			}
+		}
+		img = out
+	}
+	return
+}
+
 // Free VideoFrame
 func (instance *VideoFrame) Free() {
 	instance.Image = image.YCbCr{}
@@ -47,6 +192,8 @@ func freeVideoFrame(instance *VideoFrame) {
 type VideoDecoder struct {
 	ff        *ffctx
 	Extradata []byte
+	scaler    *Scaler
+	frames    []*VideoFrame // received by Decode but not returned yet
 }
 
 // NewDecoder initialize new decoder
@@ -83,6 +230,59 @@ func NewDecoder(codecType av.CodecType) (*VideoDecoder, error) {
 	return decoder, nil
 }
 
+// NewVideoDecoder initialize decoder of codec, decoder specific info of codec is used as extradata
+func NewVideoDecoder(codec av.VideoCodecData) (decoder *VideoDecoder, err error) {
+	var id uint32
+	var extradata []byte
+
+	switch codec.Type() {
+	case av.H264:
+		id = C.AV_CODEC_ID_H264
+		if h264, ok := codec.(h264parser.CodecData); ok {
+			extradata = h264.AVCDecoderConfRecordBytes()
+		}
+	case av.HEVC:
+		id = C.AV_CODEC_ID_HEVC
+		if h265, ok := codec.(h265parser.CodecData); ok {
+			extradata = h265.HEVCDecoderConfRecordBytes()
+		}
+	case av.MPEG4:
+		id = C.AV_CODEC_ID_MPEG4
+		if mpeg4, ok := codec.(mpeg4parser.CodecData); ok {
+			extradata = mpeg4.ConfigBytes()
+		}
+	case av.H263:
+		id = C.AV_CODEC_ID_FLV1
+	case av.JPEG:
+		id = C.AV_CODEC_ID_MJPEG
+	default:
+		err = fmt.Errorf("ffmpeg: cannot find decoder codecType=%v", codec.Type())
+		return
+	}
+
+	c := C.avcodec_find_decoder(id)
+	if c == nil || C.avcodec_get_type(id) != C.AVMEDIA_TYPE_VIDEO {
+		err = fmt.Errorf("ffmpeg: cannot find video decoder codecID=%d", id)
+		return
+	}
+
+	_decoder := &VideoDecoder{}
+	if _decoder.ff, err = newFFCtxByCodec(c); err != nil {
+		return
+	}
+	if len(extradata) > 0 {
+		// decoder reads ahead, extradata must be padded
+		buf := make([]byte, len(extradata)+C.AV_INPUT_BUFFER_PADDING_SIZE)
+		copy(buf, extradata)
+		_decoder.Extradata = buf[:len(extradata)]
+	}
+	if err = _decoder.Setup(); err != nil {
+		return
+	}
+	decoder = _decoder
+	return
+}
+
 // Setup initialize VideoDecoder
 func (decoder *VideoDecoder) Setup() error {
 	ff := &decoder.ff.ff
@@ -106,41 +306,142 @@ func fromCPtr(buf unsafe.Pointer, size int) (ret []uint8) {
 	return
 }
 
-// Decode decode video frame
-func (decoder *VideoDecoder) Decode(pkt []byte) (bool, *VideoFrame, error) {
+// receiveFrames receives all frames decoded from sent packets
+func (decoder *VideoDecoder) receiveFrames() (frames []*VideoFrame, err error) {
 	ff := &decoder.ff.ff
-	cgotimg := C.int(0)
+	for {
+		frame := C.av_frame_alloc()
+		cerr := C.avcodec_receive_frame(ff.codecCtx, frame)
+		if cerr < C.int(0) {
+			C.av_frame_free(&frame)
+			if cerr != (-C.EAGAIN) && cerr != C.AVERROR_EOF {
+				err = fmt.Errorf("ffmpeg: video decode failed: %s", GetFFErrorMessage(int(cerr)))
+			}
+			return
+		}
+		frames = append(frames, newVideoFrame(frame))
+	}
+}
 
-	var img *VideoFrame
+func (decoder *VideoDecoder) decodeFrames(data []byte, pts C.int64_t) (frames []*VideoFrame, err error) {
+	ff := &decoder.ff.ff
+	if len(data) == 0 {
+		return
+	}
 
-	frame := C.av_frame_alloc()
-	cerr := C.decode_video(ff.codecCtx, frame, unsafe.Pointer(&pkt[0]), C.int(len(pkt)), &cgotimg)
+	cerr := C.send_video_packet(ff.codecCtx, unsafe.Pointer(&data[0]), C.int(len(data)), pts)
 	if cerr < C.int(0) {
-		return false, nil, fmt.Errorf("video decode failed: %d", cerr)
+		err = fmt.Errorf("ffmpeg: video decode failed: %s", GetFFErrorMessage(int(cerr)))
+		return
 	}
+	return decoder.receiveFrames()
+}
 
-	if cgotimg != C.int(0) {
-		w := int(frame.width)
-		h := int(frame.height)
-		ys := int(frame.linesize[0])
-		cs := int(frame.linesize[1])
+// DecodeFrames decodes packet into all frames of it, decoder with delay returns no frame for first packets
+func (decoder *VideoDecoder) DecodeFrames(pkt []byte) (frames []*VideoFrame, err error) {
+	return decoder.decodeFrames(pkt, C.nopts_value)
+}
 
-		img = &VideoFrame{Image: image.YCbCr{
-			Y:              fromCPtr(unsafe.Pointer(frame.data[0]), ys*h),
-			Cb:             fromCPtr(unsafe.Pointer(frame.data[1]), cs*h/2),
-			Cr:             fromCPtr(unsafe.Pointer(frame.data[2]), cs*h/2),
-			YStride:        ys,
-			CStride:        cs,
-			SubsampleRatio: image.YCbCrSubsampleRatio420,
-			Rect:           image.Rect(0, 0, w, h),
-		}, frame: frame}
-		runtime.SetFinalizer(img, freeVideoFrame)
+// Decode decode video frame, frames more than one of packet are returned by following calls
+func (decoder *VideoDecoder) Decode(pkt []byte) (bool, *VideoFrame, error) {
+	frames, err := decoder.DecodeFrames(pkt)
+	if err != nil {
+		return false, nil, err
 	}
+	decoder.frames = append(decoder.frames, frames...)
+	if len(decoder.frames) == 0 {
+		return false, nil, nil
+	}
+	img := decoder.frames[0]
+	decoder.frames = decoder.frames[1:]
+	return true, img, nil
+}
 
-	return cgotimg != C.int(0), img, nil
+// FlushFrames returns frames buffered in decoder at end of stream, decoder can be used again after it
+func (decoder *VideoDecoder) FlushFrames() (frames []*VideoFrame, err error) {
+	ff := &decoder.ff.ff
+
+	frames = decoder.frames
+	decoder.frames = nil
+
+	cerr := C.send_video_packet(ff.codecCtx, nil, 0, C.nopts_value)
+	if cerr < C.int(0) && cerr != C.AVERROR_EOF {
+		err = fmt.Errorf("ffmpeg: video decode failed: %s", GetFFErrorMessage(int(cerr)))
+		return
+	}
+	var _frames []*VideoFrame
+	_frames, err = decoder.receiveFrames()
+	frames = append(frames, _frames...)
+	C.avcodec_flush_buffers(ff.codecCtx)
+	return
+}
+
+// toAV copies frame into av.VideoFrame, frames which are not planar YUV are converted into YUV420P
+func (decoder *VideoDecoder) toAV(in *VideoFrame) (frame av.VideoFrame, err error) {
+	if ts := in.frame.best_effort_timestamp; ts != C.nopts_value {
+		frame.Time = time.Duration(ts) * time.Microsecond
+	}
+
+	if _, ok := in.PixelFormat().SubsampleRatio(); !ok {
+		if decoder.scaler == nil {
+			decoder.scaler = &Scaler{OutPixelFormat: YUV420P}
+		}
+		if in, err = decoder.scaler.Scale(in); err != nil {
+			return
+		}
+		defer in.Free()
+	}
+
+	var img image.Image
+	if img, err = in.ToImage(); err != nil {
+		return
+	}
+	frame.Image = *img.(*image.YCbCr)
+	return
+}
+
+func (decoder *VideoDecoder) framesToAV(in []*VideoFrame) (frames []av.VideoFrame, err error) {
+	for _, f := range in {
+		var frame av.VideoFrame
+		frame, err = decoder.toAV(f)
+		f.Free()
+		if err != nil {
+			return
+		}
+		frames = append(frames, frame)
+	}
+	return
+}
+
+// DecodePacket decode video packet into av.VideoFrame, Time of frame is its presentation time.
+// Image is copied from decoder, frames which are not planar YUV are converted into YUV420P.
+func (decoder *VideoDecoder) DecodePacket(pkt av.Packet) (frames []av.VideoFrame, err error) {
+	var in []*VideoFrame
+	pts := C.int64_t((pkt.Time + pkt.CompositionTime) / time.Microsecond)
+	if in, err = decoder.decodeFrames(pkt.Data, pts); err != nil {
+		return
+	}
+	return decoder.framesToAV(in)
+}
+
+// Flush returns frames buffered in decoder at end of stream as av.VideoFrame
+func (decoder *VideoDecoder) Flush() (frames []av.VideoFrame, err error) {
+	var in []*VideoFrame
+	if in, err = decoder.FlushFrames(); err != nil {
+		return
+	}
+	return decoder.framesToAV(in)
 }
 
 // Close close VideoDecoder
 func (decoder *VideoDecoder) Close() {
-
+	freeFFCtx(decoder.ff)
+	for _, frame := range decoder.frames {
+		frame.Free()
+	}
+	decoder.frames = nil
+	if decoder.scaler != nil {
+		decoder.scaler.Close()
+		decoder.scaler = nil
+	}
 }
@@ -0,0 +1,120 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// testVideoFrame allocates frame of format, plane i is filled with rows of planes[i]
+func testVideoFrame(t *testing.T, w, h int, format PixelFormat, planes ...[][]byte) *VideoFrame {
+	f, err := allocVideoFrame(w, h, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := newVideoFrame(f)
+	for i, rows := range planes {
+		b, stride := frame.plane(i, len(rows[0]), len(rows))
+		for y, row := range rows {
+			copy(b[y*stride:], row)
+		}
+	}
+	return frame
+}
+
+// testCompareImage compares type, bounds and color of every pixel
+func testCompareImage(t *testing.T, name string, got, want image.Image) {
+	if fmt.Sprintf("%T", got) != fmt.Sprintf("%T", want) || got.Bounds() != want.Bounds() {
+		t.Errorf("%s: image %T %v, want %T %v", name, got, got.Bounds(), want, want.Bounds())
+		return
+	}
+	r := want.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if got.At(x, y) != want.At(x, y) {
+				t.Errorf("%s: pixel (%d,%d)=%v, want %v", name, x, y, got.At(x, y), want.At(x, y))
+				return
+			}
+		}
+	}
+}
+
+func testYCbCr(ratio image.YCbCrSubsampleRatio, y, cb, cr []byte) *image.YCbCr {
+	img := image.NewYCbCr(image.Rect(0, 0, 4, 2), ratio)
+	copy(img.Y, y)
+	copy(img.Cb, cb)
+	copy(img.Cr, cr)
+	return img
+}
+
+func TestVideoFrameToImage(t *testing.T) {
+	luma := [][]byte{{1, 2, 3, 4}, {5, 6, 7, 8}}
+	pixels := [][]byte{
+		{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		{17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32},
+	}
+	rgb := [][]byte{
+		{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12},
+		{13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24},
+	}
+
+	gray := image.NewGray(image.Rect(0, 0, 4, 2))
+	copy(gray.Pix, []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	rgba := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	copy(rgba.Pix, append(append([]byte{}, pixels[0]...), pixels[1]...))
+	bgra := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	for i := 0; i < 8; i++ {
+		row := pixels[i/4][i%4*4:]
+		bgra.SetNRGBA(i%4, i/4, color.NRGBA{R: row[2], G: row[1], B: row[0], A: row[3]})
+	}
+	rgb24 := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	bgr24 := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for i := 0; i < 8; i++ {
+		p := rgb[i/4][i%4*3:]
+		rgb24.SetRGBA(i%4, i/4, color.RGBA{R: p[0], G: p[1], B: p[2], A: 0xff})
+		bgr24.SetRGBA(i%4, i/4, color.RGBA{R: p[2], G: p[1], B: p[0], A: 0xff})
+	}
+
+	for _, test := range []struct {
+		name   string
+		format PixelFormat
+		planes [][][]byte
+		want   image.Image
+	}{
+		{
+			name: "yuv420p", format: YUV420P,
+			planes: [][][]byte{luma, {{10, 11}}, {{20, 21}}},
+			want:   testYCbCr(image.YCbCrSubsampleRatio420, []byte{1, 2, 3, 4, 5, 6, 7, 8}, []byte{10, 11}, []byte{20, 21}),
+		},
+		{
+			name: "yuvj422p", format: YUVJ422P,
+			planes: [][][]byte{luma, {{10, 11}, {12, 13}}, {{20, 21}, {22, 23}}},
+			want:   testYCbCr(image.YCbCrSubsampleRatio422, []byte{1, 2, 3, 4, 5, 6, 7, 8}, []byte{10, 11, 12, 13}, []byte{20, 21, 22, 23}),
+		},
+		{
+			name: "nv12", format: NV12,
+			planes: [][][]byte{luma, {{10, 20, 11, 21}}},
+			want:   testYCbCr(image.YCbCrSubsampleRatio420, []byte{1, 2, 3, 4, 5, 6, 7, 8}, []byte{10, 11}, []byte{20, 21}),
+		},
+		{
+			name: "nv21", format: NV21,
+			planes: [][][]byte{luma, {{10, 20, 11, 21}}},
+			want:   testYCbCr(image.YCbCrSubsampleRatio420, []byte{1, 2, 3, 4, 5, 6, 7, 8}, []byte{20, 21}, []byte{10, 11}),
+		},
+		{name: "gray8", format: GRAY8, planes: [][][]byte{luma}, want: gray},
+		{name: "rgba", format: RGBA, planes: [][][]byte{pixels}, want: rgba},
+		{name: "bgra", format: BGRA, planes: [][][]byte{pixels}, want: bgra},
+		{name: "rgb24", format: RGB24, planes: [][][]byte{rgb}, want: rgb24},
+		{name: "bgr24", format: BGR24, planes: [][][]byte{rgb}, want: bgr24},
+	} {
+		frame := testVideoFrame(t, 4, 2, test.format, test.planes...)
+		img, err := frame.ToImage()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else {
+			testCompareImage(t, test.name, img, test.want)
+		}
+		frame.Free()
+	}
+}
@@ -0,0 +1,604 @@
+package ffmpeg
+
+/*
+#cgo CFLAGS: -I../../../deps/include
+#include "ffmpeg.h"
+
+static int codec_has_pix_fmt(AVCodec *codec, int format) {
+	const enum AVPixelFormat *p;
+	if (codec->pix_fmts == NULL)
+		return 1;
+	for (p = codec->pix_fmts; *p != AV_PIX_FMT_NONE; p++)
+		if (*p == format)
+			return 1;
+	return 0;
+}
+
+static int open_video_encoder(AVCodecContext *ctx, AVCodec *codec, AVDictionary *options) {
+	AVDictionary *opts = NULL;
+	int result;
+	av_dict_copy(&opts, options, 0);
+	result = avcodec_open2(ctx, codec, &opts);
+	av_dict_free(&opts);
+	return result;
+}
+*/
+import "C"
+import (
+	"fmt"
+	"image"
+	"time"
+	"unsafe"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/av/avutil"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/h263parser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/h264parser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/mpeg4parser"
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
+)
+
+// VideoEncoder struct
+type VideoEncoder struct {
+	ff             *ffctx
+	Width          int
+	Height         int
+	FrameRateNum   int
+	FrameRateDen   int
+	Bitrate        int
+	GOP            int
+	SubsampleRatio image.YCbCrSubsampleRatio
+	codecData      av.VideoCodecData
+	lastPTS        int64
+	scaler         *Scaler
+	scaleFrame     *C.AVFrame // input frame of other size or subsampling, converted by scaler
+}
+
+// SetFrameSize func
+func (encoder *VideoEncoder) SetFrameSize(width, height int) (err error) {
+	encoder.Width = width
+	encoder.Height = height
+	return
+}
+
+// SetFrameRate func
+func (encoder *VideoEncoder) SetFrameRate(num, den int) (err error) {
+	if num <= 0 || den <= 0 {
+		err = fmt.Errorf("ffmpeg: frame rate %d/%d invalid", num, den)
+		return
+	}
+	encoder.FrameRateNum = num
+	encoder.FrameRateDen = den
+	return
+}
+
+// SetBitrate func
+func (encoder *VideoEncoder) SetBitrate(bitrate int) (err error) {
+	encoder.Bitrate = bitrate
+	return
+}
+
+// SetGOP func
+func (encoder *VideoEncoder) SetGOP(gop int) (err error) {
+	encoder.GOP = gop
+	return
+}
+
+// SetOption func
+func (encoder *VideoEncoder) SetOption(key string, val interface{}) (err error) {
+	ff := &encoder.ff.ff
+
+	sval := fmt.Sprint(val)
+	if key == "profile" {
+		ff.profile = C.avcodec_profile_name_to_int(ff.codec, C.CString(sval))
+		if ff.profile == C.FF_PROFILE_UNKNOWN {
+			err = fmt.Errorf("ffmpeg: profile `%s` invalid", sval)
+			return
+		}
+		return
+	}
+
+	C.av_dict_set(&ff.options, C.CString(key), C.CString(sval), 0)
+	return
+}
+
+// GetOption func
+func (encoder *VideoEncoder) GetOption(key string, val interface{}) (err error) {
+	ff := &encoder.ff.ff
+	entry := C.av_dict_get(ff.options, C.CString(key), nil, 0)
+	if entry == nil {
+		err = fmt.Errorf("ffmpeg: GetOption failed: `%s` not exists", key)
+		return
+	}
+	switch p := val.(type) {
+	case *string:
+		*p = C.GoString(entry.value)
+	case *int:
+		fmt.Sscanf(C.GoString(entry.value), "%d", p)
+	default:
+		err = fmt.Errorf("ffmpeg: GetOption failed: val must be *string or *int receiver")
+		return
+	}
+	return
+}
+
+// pixelFormatAV2FF maps chroma subsampling to planar pixel format, full range (JPEG) format if jpeg is set
+func pixelFormatAV2FF(ratio image.YCbCrSubsampleRatio, jpeg bool) (format int32) {
+	format = C.AV_PIX_FMT_NONE
+	switch ratio {
+	case image.YCbCrSubsampleRatio420:
+		format = C.AV_PIX_FMT_YUV420P
+		if jpeg {
+			format = C.AV_PIX_FMT_YUVJ420P
+		}
+	case image.YCbCrSubsampleRatio422:
+		format = C.AV_PIX_FMT_YUV422P
+		if jpeg {
+			format = C.AV_PIX_FMT_YUVJ422P
+		}
+	case image.YCbCrSubsampleRatio444:
+		format = C.AV_PIX_FMT_YUV444P
+		if jpeg {
+			format = C.AV_PIX_FMT_YUVJ444P
+		}
+	case image.YCbCrSubsampleRatio440:
+		format = C.AV_PIX_FMT_YUV440P
+		if jpeg {
+			format = C.AV_PIX_FMT_YUVJ440P
+		}
+	case image.YCbCrSubsampleRatio411:
+		format = C.AV_PIX_FMT_YUV411P
+		if jpeg {
+			format = C.AV_PIX_FMT_YUVJ411P
+		}
+	case image.YCbCrSubsampleRatio410:
+		if !jpeg {
+			format = C.AV_PIX_FMT_YUV410P
+		}
+	}
+	return
+}
+
+// encoderPixelFormat returns format of ratio which codec accepts, encoders of JPEG family only accept full range formats
+func encoderPixelFormat(codec *C.AVCodec, ratio image.YCbCrSubsampleRatio) (format int32) {
+	for _, jpeg := range []bool{false, true} {
+		if format = pixelFormatAV2FF(ratio, jpeg); format != C.AV_PIX_FMT_NONE && C.codec_has_pix_fmt(codec, C.int(format)) != 0 {
+			return
+		}
+	}
+	format = C.AV_PIX_FMT_NONE
+	return
+}
+
+// Setup func
+func (encoder *VideoEncoder) Setup() (err error) {
+	ff := &encoder.ff.ff
+
+	if encoder.Width <= 0 || encoder.Height <= 0 {
+		err = fmt.Errorf("ffmpeg: encoder: frame size %dx%d invalid", encoder.Width, encoder.Height)
+		return
+	}
+	if encoder.FrameRateNum == 0 || encoder.FrameRateDen == 0 {
+		encoder.FrameRateNum, encoder.FrameRateDen = 25, 1
+	}
+	if encoder.GOP == 0 {
+		encoder.GOP = 12
+	}
+
+	// input of other subsampling is converted into 4:2:0 if encoder does not support it
+	format := encoderPixelFormat(ff.codec, encoder.SubsampleRatio)
+	if format == C.AV_PIX_FMT_NONE {
+		encoder.SubsampleRatio = image.YCbCrSubsampleRatio420
+		format = encoderPixelFormat(ff.codec, encoder.SubsampleRatio)
+	}
+	if format == C.AV_PIX_FMT_NONE {
+		err = fmt.Errorf("ffmpeg: encoder: subsample ratio %v not supported", encoder.SubsampleRatio)
+		return
+	}
+
+	ff.frame = C.av_frame_alloc()
+	ff.frame.format = C.int(format)
+	ff.frame.width = C.int(encoder.Width)
+	ff.frame.height = C.int(encoder.Height)
+	if C.av_frame_get_buffer(ff.frame, 32) < 0 {
+		err = fmt.Errorf("ffmpeg: encoder: av_frame_get_buffer failed")
+		return
+	}
+
+	ff.codecCtx.width = C.int(encoder.Width)
+	ff.codecCtx.height = C.int(encoder.Height)
+	ff.codecCtx.pix_fmt = format
+	ff.codecCtx.time_base = C.AVRational{num: C.int(encoder.FrameRateDen), den: C.int(encoder.FrameRateNum)}
+	ff.codecCtx.framerate = C.AVRational{num: C.int(encoder.FrameRateNum), den: C.int(encoder.FrameRateDen)}
+	ff.codecCtx.gop_size = C.int(encoder.GOP)
+	ff.codecCtx.bit_rate = C.int64_t(encoder.Bitrate)
+	ff.codecCtx.flags = C.AV_CODEC_FLAG_GLOBAL_HEADER
+	ff.codecCtx.profile = ff.profile
+
+	if cerr := C.open_video_encoder(ff.codecCtx, ff.codec, ff.options); cerr != 0 {
+		err = fmt.Errorf("ffmpeg: encoder: avcodec_open2 failed: %s", GetFFErrorMessage(int(cerr)))
+		return
+	}
+	encoder.lastPTS = -1
+
+	extradata := C.GoBytes(unsafe.Pointer(ff.codecCtx.extradata), ff.codecCtx.extradata_size)
+
+	switch ff.codecCtx.codec_id {
+	case C.AV_CODEC_ID_H264:
+		var sps, pps []byte
+		nalus, _ := h264parser.SplitNALUs(extradata)
+		for _, nalu := range nalus {
+			if len(nalu) == 0 {
+				continue
+			}
+			switch nalu[0] & 0x1f {
+			case 7:
+				sps = nalu
+			case 8:
+				pps = nalu
+			}
+		}
+		if encoder.codecData, err = h264parser.NewCodecDataFromSPSAndPPS(sps, pps); err != nil {
+			return
+		}
+
+	case C.AV_CODEC_ID_MPEG4:
+		// extradata holds VOS, VO and VOL headers with global header flag
+		if encoder.codecData, err = mpeg4parser.NewCodecDataFromConfig(extradata); err != nil {
+			return
+		}
+
+	case C.AV_CODEC_ID_FLV1:
+		encoder.codecData = h263parser.NewCodecData(encoder.Width, encoder.Height)
+
+	default:
+		encoder.codecData = videoCodecData{
+			codecID:   ff.codecCtx.codec_id,
+			width:     encoder.Width,
+			height:    encoder.Height,
+			extradata: extradata,
+		}
+	}
+
+	return
+}
+
+func (encoder *VideoEncoder) prepare(frame *av.VideoFrame) (err error) {
+	ff := &encoder.ff.ff
+
+	if ff.frame == nil {
+		encoder.SubsampleRatio = image.YCbCrSubsampleRatio420
+		if frame != nil {
+			if encoder.Width == 0 && encoder.Height == 0 {
+				encoder.Width = frame.Image.Rect.Dx()
+				encoder.Height = frame.Image.Rect.Dy()
+			}
+			encoder.SubsampleRatio = frame.Image.SubsampleRatio
+		}
+		if err = encoder.Setup(); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// CodecData func, frame size must be set before first frame is encoded
+func (encoder *VideoEncoder) CodecData() (codec av.VideoCodecData, err error) {
+	if err = encoder.prepare(nil); err != nil {
+		return
+	}
+	codec = encoder.codecData
+	return
+}
+
+// chromaSize returns size of chroma planes
+func chromaSize(ratio image.YCbCrSubsampleRatio, w, h int) (cw, ch int) {
+	switch ratio {
+	case image.YCbCrSubsampleRatio422:
+		return (w + 1) / 2, h
+	case image.YCbCrSubsampleRatio444:
+		return w, h
+	case image.YCbCrSubsampleRatio440:
+		return w, (h + 1) / 2
+	case image.YCbCrSubsampleRatio411:
+		return (w + 3) / 4, h
+	case image.YCbCrSubsampleRatio410:
+		return (w + 3) / 4, (h + 1) / 2
+	default:
+		return (w + 1) / 2, (h + 1) / 2
+	}
+}
+
+// copyPlane copies rows of src into plane i of frame
+func copyPlane(f *C.AVFrame, i int, src []byte, stride, w, h int) {
+	linesize := int(f.linesize[i])
+	dst := fromCPtr(unsafe.Pointer(f.data[i]), linesize*h)
+	for y := 0; y < h; y++ {
+		copy(dst[y*linesize:y*linesize+w], src[y*stride:y*stride+w])
+	}
+}
+
+// ycbcrToFF copies img into buffers of f, size and subsampling must be same
+func ycbcrToFF(img *image.YCbCr, f *C.AVFrame) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	cw, ch := chromaSize(img.SubsampleRatio, w, h)
+	copyPlane(f, 0, img.Y, img.YStride, w, h)
+	copyPlane(f, 1, img.Cb, img.CStride, cw, ch)
+	copyPlane(f, 2, img.Cr, img.CStride, cw, ch)
+}
+
+// scale converts img of other size or subsampling into frame of encoder
+func (encoder *VideoEncoder) scale(img *image.YCbCr) (err error) {
+	ff := &encoder.ff.ff
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	format := pixelFormatAV2FF(img.SubsampleRatio, false)
+	if format == C.AV_PIX_FMT_NONE {
+		err = fmt.Errorf("ffmpeg: encoder: subsample ratio %v not supported", img.SubsampleRatio)
+		return
+	}
+
+	f := encoder.scaleFrame
+	if f == nil || int(f.width) != w || int(f.height) != h || int32(f.format) != format {
+		C.av_frame_free(&encoder.scaleFrame)
+		f = C.av_frame_alloc()
+		encoder.scaleFrame = f
+		f.format = C.int(format)
+		f.width = C.int(w)
+		f.height = C.int(h)
+		if C.av_frame_get_buffer(f, 32) < 0 {
+			err = fmt.Errorf("ffmpeg: encoder: av_frame_get_buffer failed")
+			return
+		}
+	}
+	ycbcrToFF(img, f)
+
+	if encoder.scaler == nil {
+		encoder.scaler = &Scaler{}
+	}
+	return encoder.scaler.scale(f, ff.frame)
+}
+
+// frameToFF fills frame of encoder, ok is false if frame is dropped because its time slot
+// of encoder frame rate is already used, so encoder frame rate lower than input drops frames
+func (encoder *VideoEncoder) frameToFF(frame av.VideoFrame) (ok bool, err error) {
+	ff := &encoder.ff.ff
+	img := &frame.Image
+
+	// time base is one frame
+	pts := int64((frame.Time*time.Duration(encoder.FrameRateNum) + time.Duration(encoder.FrameRateDen)*time.Second/2) /
+		(time.Duration(encoder.FrameRateDen) * time.Second))
+	if pts <= encoder.lastPTS {
+		return
+	}
+
+	// encoder may still reference previous frame
+	if C.av_frame_make_writable(ff.frame) < 0 {
+		err = fmt.Errorf("ffmpeg: encoder: av_frame_make_writable failed")
+		return
+	}
+	if img.Rect.Dx() == encoder.Width && img.Rect.Dy() == encoder.Height && img.SubsampleRatio == encoder.SubsampleRatio {
+		ycbcrToFF(img, ff.frame)
+	} else if err = encoder.scale(img); err != nil {
+		return
+	}
+
+	encoder.lastPTS = pts
+	ff.frame.pts = C.int64_t(pts)
+	ok = true
+	return
+}
+
+func (encoder *VideoEncoder) tsToTime(ts C.int64_t) time.Duration {
+	return time.Duration(ts) * time.Duration(encoder.FrameRateDen) * time.Second / time.Duration(encoder.FrameRateNum)
+}
+
+// toAVCC converts Annex B packet of libx264 into AVCC, which is used by mp4 and flv
+func toAVCC(data []byte) []byte {
+	nalus, typ := h264parser.SplitNALUs(data)
+	if typ != h264parser.NaluAnnexb {
+		return data
+	}
+	size := 0
+	for _, nalu := range nalus {
+		size += 4 + len(nalu)
+	}
+	b := make([]byte, size)
+	n := 0
+	for _, nalu := range nalus {
+		pio.PutU32BE(b[n:], uint32(len(nalu)))
+		n += 4
+		n += copy(b[n:], nalu)
+	}
+	return b
+}
+
+// Encode func, Time of packets is DTS and CompositionTime is PTS-DTS.
+// Frames of other size or subsampling are scaled into size of encoder.
+func (encoder *VideoEncoder) Encode(frame av.VideoFrame) (pkts []av.Packet, err error) {
+	var ok bool
+	if err = encoder.prepare(&frame); err != nil {
+		return
+	}
+	if ok, err = encoder.frameToFF(frame); err != nil || !ok {
+		return
+	}
+
+	ff := &encoder.ff.ff
+	cerr := C.avcodec_send_frame(ff.codecCtx, ff.frame)
+	if cerr < C.int(0) {
+		err = fmt.Errorf("ffmpeg: avcodec_send_frame failed: %s", GetFFErrorMessage(int(cerr)))
+		return
+	}
+	return encoder.receivePackets()
+}
+
+// receivePackets receives all packets encoded from sent frames
+func (encoder *VideoEncoder) receivePackets() (pkts []av.Packet, err error) {
+	ff := &encoder.ff.ff
+	for {
+		cpkt := C.AVPacket{}
+		cerr := C.avcodec_receive_packet(ff.codecCtx, &cpkt)
+		if cerr == (-C.EAGAIN) || cerr == C.AVERROR_EOF {
+			break
+		} else if cerr < C.int(0) {
+			err = fmt.Errorf("ffmpeg: avcodec_receive_packet failed: %s", GetFFErrorMessage(int(cerr)))
+			return
+		}
+
+		pkt := av.Packet{
+			IsKeyFrame:      cpkt.flags&C.AV_PKT_FLAG_KEY != 0,
+			Time:            encoder.tsToTime(cpkt.dts),
+			CompositionTime: encoder.tsToTime(cpkt.pts - cpkt.dts),
+			Data:            C.GoBytes(unsafe.Pointer(cpkt.data), cpkt.size),
+		}
+		C.av_packet_unref(&cpkt)
+
+		if ff.codecCtx.codec_id == C.AV_CODEC_ID_H264 {
+			pkt.Data = toAVCC(pkt.Data)
+		}
+		pkts = append(pkts, pkt)
+	}
+
+	return
+}
+
+// Flush returns packets buffered in encoder at end of stream, such as delayed B-frames,
+// encoder can not be used after it
+func (encoder *VideoEncoder) Flush() (pkts []av.Packet, err error) {
+	ff := &encoder.ff.ff
+	if ff.frame == nil {
+		return
+	}
+
+	cerr := C.avcodec_send_frame(ff.codecCtx, nil)
+	if cerr < C.int(0) && cerr != C.AVERROR_EOF {
+		err = fmt.Errorf("ffmpeg: avcodec_send_frame failed: %s", GetFFErrorMessage(int(cerr)))
+		return
+	}
+	return encoder.receivePackets()
+}
+
+// Close func
+func (encoder *VideoEncoder) Close() {
+	freeFFCtx(encoder.ff)
+	if encoder.scaleFrame != nil {
+		C.av_frame_free(&encoder.scaleFrame)
+	}
+	if encoder.scaler != nil {
+		encoder.scaler.Close()
+		encoder.scaler = nil
+	}
+}
+
+// videoCodecData is codec data of encoders other than H.264, MPEG-4 and Sorenson H.263.
+// MJPEG is av.JPEG and others, such as h263, are MakeVideoCodecType of codec id.
+// mp4, flv and ts muxers do not support these types and fail on WriteHeader.
+type videoCodecData struct {
+	codecID   uint32
+	width     int
+	height    int
+	extradata []byte
+}
+
+// Type func
+func (instance videoCodecData) Type() av.CodecType {
+	if instance.codecID == C.AV_CODEC_ID_MJPEG {
+		return av.JPEG
+	}
+	return av.MakeVideoCodecType(instance.codecID)
+}
+
+// Width func
+func (instance videoCodecData) Width() int {
+	return instance.width
+}
+
+// Height func
+func (instance videoCodecData) Height() int {
+	return instance.height
+}
+
+// Extradata func, decoder specific info such as MPEG-4 VOL header
+func (instance videoCodecData) Extradata() []byte {
+	return instance.extradata
+}
+
+// VideoCodecHandler func
+func VideoCodecHandler(h *avutil.RegisterHandler) {
+	h.VideoEncoder = func(typ av.CodecType) (av.VideoEncoder, error) {
+		var enc av.VideoEncoder
+		var err error
+		if enc, err = NewVideoEncoderByCodecType(typ); err != nil {
+			return nil, nil
+		}
+		return enc, err
+	}
+
+	h.VideoDecoder = func(codec av.VideoCodecData) (av.VideoDecoder, error) {
+		var dec av.VideoDecoder
+		var err error
+		if dec, err = NewVideoDecoder(codec); err != nil {
+			return nil, nil
+		}
+		return dec, err
+	}
+}
+
+// NewVideoEncoderByCodecType func, typ is av.H264, av.MPEG4, av.H263 or av.JPEG.
+// H.264 needs ffmpeg built with libx264, its packets are AVCC and can be muxed by mp4, flv and ts.
+// MPEG4 is muxed by mp4 and H263, the Sorenson H.263 of flv encoder, by flv.
+// JPEG packets are MJPEG frames, which are not muxed by any muxer of this package.
+func NewVideoEncoderByCodecType(typ av.CodecType) (enc *VideoEncoder, err error) {
+	var id uint32
+
+	switch typ {
+	case av.H264:
+		id = C.AV_CODEC_ID_H264
+	case av.MPEG4:
+		id = C.AV_CODEC_ID_MPEG4
+	case av.H263:
+		id = C.AV_CODEC_ID_FLV1
+	case av.JPEG:
+		id = C.AV_CODEC_ID_MJPEG
+
+	default:
+		err = fmt.Errorf("ffmpeg: cannot find encoder codecType=%d", typ)
+		return
+	}
+
+	codec := C.avcodec_find_encoder(id)
+	if codec == nil && typ == av.H264 {
+		err = fmt.Errorf("ffmpeg: cannot find h264 encoder, ffmpeg is not built with libx264")
+		return
+	}
+	if codec == nil || C.avcodec_get_type(id) != C.AVMEDIA_TYPE_VIDEO {
+		err = fmt.Errorf("ffmpeg: cannot find video encoder codecID=%d", id)
+		return
+	}
+
+	_enc := &VideoEncoder{}
+	if _enc.ff, err = newFFCtxByCodec(codec); err != nil {
+		return
+	}
+	enc = _enc
+	return
+}
+
+// NewVideoEncoderByName func, name is mpeg4, flv, h263, mjpeg, libx264, ...
+// Output of H.264, mpeg4 and flv encoders can be muxed, see NewVideoEncoderByCodecType.
+func NewVideoEncoderByName(name string) (enc *VideoEncoder, err error) {
+	_enc := &VideoEncoder{}
+
+	codec := C.avcodec_find_encoder_by_name(C.CString(name))
+	if codec == nil || C.avcodec_get_type(codec.id) != C.AVMEDIA_TYPE_VIDEO {
+		err = fmt.Errorf("ffmpeg: cannot find video encoder name=%s", name)
+		return
+	}
+
+	if _enc.ff, err = newFFCtxByCodec(codec); err != nil {
+		return
+	}
+	enc = _enc
+	return
+}
@@ -0,0 +1,151 @@
+package ffmpeg
+
+/*
+#cgo CFLAGS: -I../../../deps/include
+#include "ffmpeg.h"
+
+// swscale takes range from details, not from deprecated JPEG formats
+static int scaler_pix_fmt(int format, int *full_range) {
+	switch (format) {
+	case AV_PIX_FMT_YUVJ420P: *full_range = 1; return AV_PIX_FMT_YUV420P;
+	case AV_PIX_FMT_YUVJ422P: *full_range = 1; return AV_PIX_FMT_YUV422P;
+	case AV_PIX_FMT_YUVJ444P: *full_range = 1; return AV_PIX_FMT_YUV444P;
+	case AV_PIX_FMT_YUVJ440P: *full_range = 1; return AV_PIX_FMT_YUV440P;
+	case AV_PIX_FMT_YUVJ411P: *full_range = 1; return AV_PIX_FMT_YUV411P;
+	}
+	return format;
+}
+
+static struct SwsContext *scaler_context(struct SwsContext *ctx, AVFrame *src, AVFrame *dst, int flags) {
+	int src_range = src->color_range == AVCOL_RANGE_JPEG, dst_range = 0;
+	int src_format = scaler_pix_fmt(src->format, &src_range);
+	int dst_format = scaler_pix_fmt(dst->format, &dst_range);
+
+	ctx = sws_getCachedContext(ctx, src->width, src->height, src_format,
+		dst->width, dst->height, dst_format, flags, NULL, NULL, NULL);
+	if (ctx == NULL)
+		return NULL;
+	sws_setColorspaceDetails(ctx, sws_getCoefficients(SWS_CS_DEFAULT), src_range,
+		sws_getCoefficients(SWS_CS_DEFAULT), dst_range, 0, 1 << 16, 1 << 16);
+	return ctx;
+}
+
+static int scale_frame(struct SwsContext *ctx, AVFrame *src, AVFrame *dst) {
+	return sws_scale(ctx, (const uint8_t * const *)src->data, src->linesize, 0, src->height, dst->data, dst->linesize);
+}
+*/
+import "C"
+import (
+	"fmt"
+)
+
+// define scaling algorithms of Scaler
+const (
+	ScaleFastBilinear = int(C.SWS_FAST_BILINEAR)
+	ScaleBilinear     = int(C.SWS_BILINEAR)
+	ScaleBicubic      = int(C.SWS_BICUBIC)
+	ScalePoint        = int(C.SWS_POINT)
+	ScaleArea         = int(C.SWS_AREA)
+	ScaleLanczos      = int(C.SWS_LANCZOS)
+)
+
+// Scaler converts VideoFrame to other size and pixel format
+type Scaler struct {
+	OutWidth       int         // 0 keeps width of input
+	OutHeight      int         // 0 keeps height of input
+	OutPixelFormat PixelFormat // PixelFormatNone keeps format of input
+	Algorithm      int         // ScaleBicubic if 0
+	ctx            *C.struct_SwsContext
+}
+
+// NewScaler create new video scaler, format is one of YUV420P, NV12, RGBA, BGR24, ...
+func NewScaler(width, height int, format PixelFormat) (*Scaler, error) {
+	if width < 0 || height < 0 {
+		return nil, fmt.Errorf("ffmpeg: scaler size %dx%d invalid", width, height)
+	}
+	return &Scaler{
+		OutWidth:       width,
+		OutHeight:      height,
+		OutPixelFormat: format,
+	}, nil
+}
+
+// Scale converts in into new frame, context is reused while input size and format are same
+func (scaler *Scaler) Scale(in *VideoFrame) (out *VideoFrame, err error) {
+	width := scaler.OutWidth
+	if width == 0 {
+		width = in.Width()
+	}
+	height := scaler.OutHeight
+	if height == 0 {
+		height = in.Height()
+	}
+	format := scaler.OutPixelFormat
+	if format == PixelFormatNone {
+		format = in.PixelFormat()
+	}
+	var dst *C.AVFrame
+	if dst, err = allocVideoFrame(width, height, format); err != nil {
+		return
+	}
+	C.av_frame_copy_props(dst, in.frame)
+	setColorRange(dst)
+
+	if err = scaler.scale(in.frame, dst); err != nil {
+		C.av_frame_free(&dst)
+		return
+	}
+
+	out = newVideoFrame(dst)
+	return
+}
+
+// allocVideoFrame allocates frame with buffers of size and format
+func allocVideoFrame(width, height int, format PixelFormat) (frame *C.AVFrame, err error) {
+	frame = C.av_frame_alloc()
+	frame.width = C.int(width)
+	frame.height = C.int(height)
+	frame.format = C.int(format)
+	if C.av_frame_get_buffer(frame, 32) < 0 {
+		C.av_frame_free(&frame)
+		err = fmt.Errorf("ffmpeg: scaler: av_frame_get_buffer failed")
+		return
+	}
+	setColorRange(frame)
+	return
+}
+
+// setColorRange sets color range of frame by its pixel format
+func setColorRange(frame *C.AVFrame) {
+	if PixelFormat(frame.format).IsFullRange() {
+		frame.color_range = C.AVCOL_RANGE_JPEG
+	} else {
+		frame.color_range = C.AVCOL_RANGE_MPEG
+	}
+}
+
+// scale converts src into buffers of dst, size and format of dst are set
+func (scaler *Scaler) scale(src, dst *C.AVFrame) (err error) {
+	algorithm := scaler.Algorithm
+	if algorithm == 0 {
+		algorithm = ScaleBicubic
+	}
+	if scaler.ctx = C.scaler_context(scaler.ctx, src, dst, C.int(algorithm)); scaler.ctx == nil {
+		err = fmt.Errorf("ffmpeg: scaler: cannot convert %v %dx%d to %v %dx%d",
+			PixelFormat(src.format), int(src.width), int(src.height), PixelFormat(dst.format), int(dst.width), int(dst.height))
+		return
+	}
+	if C.scale_frame(scaler.ctx, src, dst) < 0 {
+		err = fmt.Errorf("ffmpeg: scaler: sws_scale failed")
+		return
+	}
+	return
+}
+
+// Close func
+func (scaler *Scaler) Close() {
+	if scaler.ctx != nil {
+		C.sws_freeContext(scaler.ctx)
+		scaler.ctx = nil
+	}
+}
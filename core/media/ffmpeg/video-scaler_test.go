@@ -0,0 +1,107 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testFill makes rows of plane filled with v
+func testFill(n, rows int, v byte) (b [][]byte) {
+	for y := 0; y < rows; y++ {
+		b = append(b, bytes.Repeat([]byte{v}, n))
+	}
+	return
+}
+
+// testNear allows rounding error of conversion
+func testNear(a, b byte) bool {
+	d := int(a) - int(b)
+	return d >= -2 && d <= 2
+}
+
+func TestScalerRange(t *testing.T) {
+	const w, h = 16, 16
+	for _, test := range []struct {
+		name   string
+		format PixelFormat
+		y      byte
+		rgb    byte
+	}{
+		// limited range, 16 is black and 235 is white
+		{"yuv420p black", YUV420P, 16, 0},
+		{"yuv420p white", YUV420P, 235, 255},
+		{"yuvj420p black", YUVJ420P, 0, 0},
+		{"yuvj420p 16", YUVJ420P, 16, 16},
+		{"yuvj420p 235", YUVJ420P, 235, 235},
+		{"yuvj420p white", YUVJ420P, 255, 255},
+	} {
+		in := testVideoFrame(t, w, h, test.format, testFill(w, h, test.y), testFill(w/2, h/2, 128), testFill(w/2, h/2, 128))
+		scaler, _ := NewScaler(0, 0, RGB24)
+		scaler.Algorithm = ScalePoint
+		out, err := scaler.Scale(in)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		b, _ := out.plane(0, w*3, h)
+		if !testNear(b[0], test.rgb) || !testNear(b[1], test.rgb) || !testNear(b[2], test.rgb) {
+			t.Errorf("%s: rgb=% x, want %x", test.name, b[:3], test.rgb)
+		}
+		out.Free()
+		in.Free()
+		scaler.Close()
+	}
+
+	// output range follows format
+	white := testVideoFrame(t, w, h, RGB24, testFill(w*3, h, 0xff))
+	for _, test := range []struct {
+		format PixelFormat
+		y      byte
+	}{
+		{YUV420P, 235},
+		{YUVJ420P, 255},
+	} {
+		scaler, _ := NewScaler(0, 0, test.format)
+		out, err := scaler.Scale(white)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if y := out.Image.Y[0]; !testNear(y, test.y) {
+			t.Errorf("%v: y=%d, want %d", test.format, y, test.y)
+		}
+		if out.IsFullRange() != (test.format == YUVJ420P) {
+			t.Errorf("%v: full range=%v", test.format, out.IsFullRange())
+		}
+		out.Free()
+		scaler.Close()
+	}
+	white.Free()
+}
+
+func TestScalerSize(t *testing.T) {
+	in := testVideoFrame(t, 8, 4, RGB24, testFill(8*3, 4, 0x80))
+	defer in.Free()
+	scaler, err := NewScaler(16, 0, NV12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scaler.Close()
+	out, err := scaler.Scale(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Free()
+	if out.Width() != 16 || out.Height() != 4 || out.PixelFormat() != NV12 {
+		t.Errorf("out %dx%d %v, want 16x4 nv12", out.Width(), out.Height(), out.PixelFormat())
+	}
+	img, err := out.ToImage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 16 || img.Bounds().Dy() != 4 {
+		t.Errorf("image bounds=%v", img.Bounds())
+	}
+
+	if _, err = NewScaler(-1, 0, NV12); err == nil {
+		t.Error("negative width accepted")
+	}
+}
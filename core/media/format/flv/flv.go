@@ -4,11 +4,16 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/Youngju-Heo/gomedia/core/media/av"
 	"github.com/Youngju-Heo/gomedia/core/media/av/avutil"
+	"github.com/Youngju-Heo/gomedia/core/media/codec"
 	"github.com/Youngju-Heo/gomedia/core/media/codec/aacparser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/h263parser"
 	"github.com/Youngju-Heo/gomedia/core/media/codec/h264parser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/h265parser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/mp3parser"
 	"github.com/Youngju-Heo/gomedia/core/media/format/flv/flvio"
 	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
 )
@@ -29,6 +34,12 @@ func NewMetadataByStreams(streams []av.CodecData) (metadata flvio.AMFMap, err er
 			case av.H264:
 				metadata["videocodecid"] = flvio.VideoH264
 
+			case av.H263:
+				metadata["videocodecid"] = flvio.VideoH263
+
+			case av.HEVC:
+				metadata["videocodecid"] = flvio.FourCCHEVC
+
 			default:
 				err = fmt.Errorf("flv: metadata: unsupported video codecType=%v", stream.Type())
 				return
@@ -45,8 +56,17 @@ func NewMetadataByStreams(streams []av.CodecData) (metadata flvio.AMFMap, err er
 			case av.AAC:
 				metadata["audiocodecid"] = flvio.SoundAAC
 
-			// case av.SPEEX:
-			// 	metadata["audiocodecid"] = flvio.SoundSpeex
+			case av.MP3:
+				metadata["audiocodecid"] = flvio.SoundMP3
+
+			case av.PCMA:
+				metadata["audiocodecid"] = flvio.SoundAlaw
+
+			case av.PCMU:
+				metadata["audiocodecid"] = flvio.SoundMulaw
+
+			case av.SPEEX:
+				metadata["audiocodecid"] = flvio.SoundSpeex
 
 			default:
 				err = fmt.Errorf("flv: metadata: unsupported audio codecType=%v", stream.Type())
@@ -87,20 +107,36 @@ func (inst *Prober) PushTag(tag flvio.Tag, timestamp int32) (err error) {
 
 	switch tag.Type {
 	case flvio.TagVideo:
-		switch tag.AVCPacketType {
-		case flvio.AvcSeqhdr:
+		if tag.IsExHeader {
+			return inst.pushExVideoTag(tag, timestamp)
+		}
+		switch tag.CodecID {
+		case flvio.VideoH264:
+			switch tag.AVCPacketType {
+			case flvio.AvcSeqhdr:
+				if !inst.GotVideo {
+					var stream h264parser.CodecData
+					if stream, err = h264parser.NewCodecDataFromAVCDecoderConfRecord(tag.Data); err != nil {
+						err = fmt.Errorf("flv: h264 seqhdr invalid")
+						return
+					}
+					inst.addVideoStream(stream)
+				}
+
+			case flvio.AvcNalu:
+				inst.CacheTag(tag, timestamp)
+			}
+
+		case flvio.VideoH263:
+			// no sequence header, size is of first picture
 			if !inst.GotVideo {
-				var stream h264parser.CodecData
-				if stream, err = h264parser.NewCodecDataFromAVCDecoderConfRecord(tag.Data); err != nil {
-					err = fmt.Errorf("flv: h264 seqhdr invalid")
+				var stream h263parser.CodecData
+				if stream, err = h263parser.NewCodecDataFromPicture(tag.Data); err != nil {
+					err = fmt.Errorf("flv: h263 picture header invalid")
 					return
 				}
-				inst.VideoStreamIdx = len(inst.Streams)
-				inst.Streams = append(inst.Streams, stream)
-				inst.GotVideo = true
+				inst.addVideoStream(stream)
 			}
-
-		case flvio.AvcNalu:
 			inst.CacheTag(tag, timestamp)
 		}
 
@@ -124,14 +160,35 @@ func (inst *Prober) PushTag(tag flvio.Tag, timestamp int32) (err error) {
 				inst.CacheTag(tag, timestamp)
 			}
 
-			// case flvio.SoundSpeex:
-			// 	if !inst.GotAudio {
-			// 		stream := codec.NewSpeexCodecData(16000, tag.ChannelLayout())
-			// 		inst.AudioStreamIdx = len(inst.Streams)
-			// 		inst.Streams = append(inst.Streams, stream)
-			// 		inst.GotAudio = true
-			// 		inst.CacheTag(tag, timestamp)
-			// 	}
+		case flvio.SoundMP3, flvio.SoundMP38Khz:
+			if !inst.GotAudio {
+				var stream mp3parser.CodecData
+				if stream, err = mp3parser.NewCodecDataFromFrame(tag.Data); err != nil {
+					err = fmt.Errorf("flv: mp3 frame header invalid")
+					return
+				}
+				inst.addAudioStream(stream)
+			}
+			inst.CacheTag(tag, timestamp)
+
+		case flvio.SoundAlaw:
+			if !inst.GotAudio {
+				inst.addAudioStream(codec.NewPCMAlawCodecData())
+			}
+			inst.CacheTag(tag, timestamp)
+
+		case flvio.SoundMulaw:
+			if !inst.GotAudio {
+				inst.addAudioStream(codec.NewPCMMulawCodecData())
+			}
+			inst.CacheTag(tag, timestamp)
+
+		case flvio.SoundSpeex:
+			if !inst.GotAudio {
+				// speex in flv is always 16khz mono
+				inst.addAudioStream(codec.NewSpeexCodecData(16000, av.ChMono))
+			}
+			inst.CacheTag(tag, timestamp)
 
 			// case flvio.SoundNellymoser:
 			// 	if !inst.GotAudio {
@@ -153,6 +210,42 @@ func (inst *Prober) PushTag(tag flvio.Tag, timestamp int32) (err error) {
 	return
 }
 
+func (inst *Prober) addVideoStream(stream av.VideoCodecData) {
+	inst.VideoStreamIdx = len(inst.Streams)
+	inst.Streams = append(inst.Streams, stream)
+	inst.GotVideo = true
+}
+
+func (inst *Prober) addAudioStream(stream av.AudioCodecData) {
+	inst.AudioStreamIdx = len(inst.Streams)
+	inst.Streams = append(inst.Streams, stream)
+	inst.GotAudio = true
+}
+
+// pushExVideoTag handles enhanced rtmp video, tags of FourCC without parser are ignored
+func (inst *Prober) pushExVideoTag(tag flvio.Tag, timestamp int32) (err error) {
+	if tag.FourCC != flvio.FourCCHEVC {
+		return
+	}
+
+	switch tag.PacketType {
+	case flvio.PacketTypeSequenceStart:
+		if !inst.GotVideo {
+			var stream h265parser.CodecData
+			if stream, err = h265parser.NewCodecDataFromHEVCDecoderConfRecord(tag.Data); err != nil {
+				err = fmt.Errorf("flv: hevc seqhdr invalid")
+				return
+			}
+			inst.addVideoStream(stream)
+		}
+
+	case flvio.PacketTypeCodedFrames, flvio.PacketTypeCodedFramesX:
+		inst.CacheTag(tag, timestamp)
+	}
+
+	return
+}
+
 // Probed type
 func (inst *Prober) Probed() (ok bool) {
 	if inst.HasAudio || inst.HasVideo {
@@ -172,11 +265,29 @@ func (inst *Prober) TagToPacket(tag flvio.Tag, timestamp int32) (pkt av.Packet,
 	switch tag.Type {
 	case flvio.TagVideo:
 		pkt.Idx = int8(inst.VideoStreamIdx)
-		switch tag.AVCPacketType {
-		case flvio.AvcNalu:
+		if tag.IsExHeader {
+			switch tag.PacketType {
+			case flvio.PacketTypeCodedFrames, flvio.PacketTypeCodedFramesX:
+				ok = tag.FourCC == flvio.FourCCHEVC
+				pkt.Data = tag.Data
+				pkt.CompositionTime = flvio.TsToTime(tag.CompositionTime)
+				pkt.IsKeyFrame = tag.FrameType == flvio.FrameKey
+			}
+			break
+		}
+		switch tag.CodecID {
+		case flvio.VideoH264:
+			switch tag.AVCPacketType {
+			case flvio.AvcNalu:
+				ok = true
+				pkt.Data = tag.Data
+				pkt.CompositionTime = flvio.TsToTime(tag.CompositionTime)
+				pkt.IsKeyFrame = tag.FrameType == flvio.FrameKey
+			}
+
+		case flvio.VideoH263:
 			ok = true
 			pkt.Data = tag.Data
-			pkt.CompositionTime = flvio.TsToTime(tag.CompositionTime)
 			pkt.IsKeyFrame = tag.FrameType == flvio.FrameKey
 		}
 
@@ -190,6 +301,10 @@ func (inst *Prober) TagToPacket(tag flvio.Tag, timestamp int32) (pkt av.Packet,
 				pkt.Data = tag.Data
 			}
 
+		case flvio.SoundMP3, flvio.SoundMP38Khz, flvio.SoundAlaw, flvio.SoundMulaw:
+			ok = true
+			pkt.Data = tag.Data
+
 		case flvio.SoundSpeex:
 			ok = true
 			pkt.Data = tag.Data
@@ -231,8 +346,23 @@ func CodecDataToTag(stream av.CodecData) (_tag flvio.Tag, ok bool, err error) {
 		ok = true
 		_tag = tag
 
+	case av.HEVC:
+		hevc := stream.(h265parser.CodecData)
+		tag := flvio.Tag{
+			Type:       flvio.TagVideo,
+			IsExHeader: true,
+			PacketType: flvio.PacketTypeSequenceStart,
+			FourCC:     flvio.FourCCHEVC,
+			Data:       hevc.HEVCDecoderConfRecordBytes(),
+			FrameType:  flvio.FrameKey,
+		}
+		ok = true
+		_tag = tag
+
 	// case av.NELLYMOSER:
-	// case av.SPEEX:
+
+	case av.H263, av.MP3, av.PCMA, av.PCMU, av.SPEEX:
+		// no sequence header, codec is known from each tag
 
 	case av.AAC:
 		aac := stream.(aacparser.CodecData)
@@ -282,6 +412,33 @@ func PacketToTag(pkt av.Packet, stream av.CodecData) (tag flvio.Tag, timestamp i
 			tag.FrameType = flvio.FrameInter
 		}
 
+	case av.HEVC:
+		tag = flvio.Tag{
+			Type:            flvio.TagVideo,
+			IsExHeader:      true,
+			PacketType:      flvio.PacketTypeCodedFrames,
+			FourCC:          flvio.FourCCHEVC,
+			Data:            pkt.Data,
+			CompositionTime: flvio.TimeToTs(pkt.CompositionTime),
+		}
+		if pkt.IsKeyFrame {
+			tag.FrameType = flvio.FrameKey
+		} else {
+			tag.FrameType = flvio.FrameInter
+		}
+
+	case av.H263:
+		tag = flvio.Tag{
+			Type:    flvio.TagVideo,
+			CodecID: flvio.VideoH263,
+			Data:    pkt.Data,
+		}
+		if pkt.IsKeyFrame {
+			tag.FrameType = flvio.FrameKey
+		} else {
+			tag.FrameType = flvio.FrameInter
+		}
+
 	case av.AAC:
 		tag = flvio.Tag{
 			Type:          flvio.TagAudio,
@@ -304,12 +461,51 @@ func PacketToTag(pkt av.Packet, stream av.CodecData) (tag flvio.Tag, timestamp i
 			tag.SoundType = flvio.SoundStereo
 		}
 
-		// case av.SPEEX:
-		// 	tag = flvio.Tag{
-		// 		Type:        flvio.TagAudio,
-		// 		SoundFormat: flvio.SoundSpeex,
-		// 		Data:        pkt.Data,
-		// 	}
+	case av.MP3:
+		tag = flvio.Tag{
+			Type:        flvio.TagAudio,
+			SoundFormat: flvio.SoundMP3,
+			SoundSize:   flvio.Sound16Bit,
+			Data:        pkt.Data,
+		}
+		astream := stream.(av.AudioCodecData)
+		switch astream.SampleRate() {
+		case 8000:
+			tag.SoundFormat = flvio.SoundMP38Khz
+		case 11025, 12000:
+			tag.SoundRate = flvio.Sound11Khz
+		case 22050, 24000, 16000:
+			tag.SoundRate = flvio.Sound22Khz
+		default:
+			tag.SoundRate = flvio.Sound44Khz
+		}
+		if astream.ChannelLayout().Count() == 2 {
+			tag.SoundType = flvio.SoundStereo
+		}
+
+	case av.PCMA, av.PCMU:
+		// rate bits are ignored, g711 is always 8khz mono
+		tag = flvio.Tag{
+			Type:        flvio.TagAudio,
+			SoundFormat: flvio.SoundAlaw,
+			SoundRate:   flvio.Sound5Dot5Khz,
+			SoundSize:   flvio.Sound16Bit,
+			SoundType:   flvio.SoundMono,
+			Data:        pkt.Data,
+		}
+		if stream.Type() == av.PCMU {
+			tag.SoundFormat = flvio.SoundMulaw
+		}
+
+	case av.SPEEX:
+		tag = flvio.Tag{
+			Type:        flvio.TagAudio,
+			SoundFormat: flvio.SoundSpeex,
+			SoundRate:   flvio.Sound11Khz,
+			SoundSize:   flvio.Sound16Bit,
+			SoundType:   flvio.SoundMono,
+			Data:        pkt.Data,
+		}
 
 		// case av.NELLYMOSER:
 		// 	tag = flvio.Tag{
@@ -325,9 +521,22 @@ func PacketToTag(pkt av.Packet, stream av.CodecData) (tag flvio.Tag, timestamp i
 
 // Muxer type
 type Muxer struct {
+	// KeyframeIndex writes onMetaData with duration and keyframes index on WriteTrailer,
+	// writer passed to NewMuxer must be io.ReadWriteSeeker such as os.File
+	KeyframeIndex bool
+
 	bufw    writeFlusher
+	cw      *countWriter
+	rws     io.ReadWriteSeeker
 	b       []byte
 	streams []av.CodecData
+
+	hasVideo bool
+	metaPos  int64
+	metaLen  int64
+	index    []IndexEntry
+	indexed  bool
+	duration time.Duration
 }
 
 type writeFlusher interface {
@@ -339,34 +548,69 @@ type writeFlusher interface {
 func NewMuxerWriteFlusher(w writeFlusher) *Muxer {
 	return &Muxer{
 		bufw: w,
+		cw:   &countWriter{w: w},
 		b:    make([]byte, 256),
 	}
 }
 
 // NewMuxer type
 func NewMuxer(w io.Writer) *Muxer {
-	return NewMuxerWriteFlusher(bufio.NewWriterSize(w, pio.RecommendBufioSize))
+	inst := NewMuxerWriteFlusher(bufio.NewWriterSize(w, pio.RecommendBufioSize))
+	inst.rws, _ = w.(io.ReadWriteSeeker)
+	return inst
 }
 
 // CodecTypes var
-var CodecTypes = []av.CodecType{av.H264, av.AAC} //, av.SPEEX}
+var CodecTypes = []av.CodecType{av.H264, av.HEVC, av.H263, av.AAC, av.MP3, av.PCMA, av.PCMU, av.SPEEX}
+
+func isCodecTypeSupported(typ av.CodecType) bool {
+	for _, t := range CodecTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
 
 // WriteHeader type
 func (inst *Muxer) WriteHeader(streams []av.CodecData) (err error) {
 	var flags uint8
 	for _, stream := range streams {
+		if !isCodecTypeSupported(stream.Type()) {
+			err = fmt.Errorf("flv: codec type=%v is not supported", stream.Type())
+			return
+		}
 		if stream.Type().IsVideo() {
 			flags |= flvio.FileHasVideo
+			inst.hasVideo = true
 		} else if stream.Type().IsAudio() {
 			flags |= flvio.FileHasAudio
 		}
 	}
+	inst.streams = streams
 
 	n := flvio.FillFileHeader(inst.b, flags)
-	if _, err = inst.bufw.Write(inst.b[:n]); err != nil {
+	if _, err = inst.cw.Write(inst.b[:n]); err != nil {
 		return
 	}
 
+	if inst.KeyframeIndex {
+		if inst.rws == nil {
+			err = fmt.Errorf("flv: KeyframeIndex needs io.ReadWriteSeeker")
+			return
+		}
+		// placeholder, replaced with index on WriteTrailer
+		var tag flvio.Tag
+		if tag, err = inst.metadataTag(0, 0, 0); err != nil {
+			return
+		}
+		inst.metaPos = inst.cw.n
+		if err = flvio.WriteTag(inst.cw, tag, 0, inst.b); err != nil {
+			return
+		}
+		inst.metaLen = inst.cw.n - inst.metaPos
+	}
+
 	for _, stream := range streams {
 		var tag flvio.Tag
 		var ok bool
@@ -374,13 +618,11 @@ func (inst *Muxer) WriteHeader(streams []av.CodecData) (err error) {
 			return
 		}
 		if ok {
-			if err = flvio.WriteTag(inst.bufw, tag, 0, inst.b); err != nil {
+			if err = flvio.WriteTag(inst.cw, tag, 0, inst.b); err != nil {
 				return
 			}
 		}
 	}
-
-	inst.streams = streams
 	return
 }
 
@@ -389,7 +631,10 @@ func (inst *Muxer) WritePacket(pkt av.Packet) (err error) {
 	stream := inst.streams[pkt.Idx]
 	tag, timestamp := PacketToTag(pkt, stream)
 
-	if err = flvio.WriteTag(inst.bufw, tag, timestamp, inst.b); err != nil {
+	if inst.KeyframeIndex {
+		inst.addIndex(pkt, stream)
+	}
+	if err = flvio.WriteTag(inst.cw, tag, timestamp, inst.b); err != nil {
 		return
 	}
 	return
@@ -400,6 +645,11 @@ func (inst *Muxer) WriteTrailer() (err error) {
 	if err = inst.bufw.Flush(); err != nil {
 		return
 	}
+	if inst.KeyframeIndex {
+		if err = inst.writeIndex(); err != nil {
+			return
+		}
+	}
 	return
 }
 
@@ -409,15 +659,25 @@ type Demuxer struct {
 	bufr   *bufio.Reader
 	b      []byte
 	stage  int
+
+	cr       *countReader
+	rs       io.ReadSeeker
+	dataPos  int64
+	duration time.Duration
+	index    []IndexEntry
 }
 
-// NewDemuxer type
+// NewDemuxer type, SeekToTime is supported when r is io.ReadSeeker
 func NewDemuxer(r io.Reader) *Demuxer {
-	return &Demuxer{
-		bufr:   bufio.NewReaderSize(r, pio.RecommendBufioSize),
+	cr := &countReader{r: r}
+	inst := &Demuxer{
+		bufr:   bufio.NewReaderSize(cr, pio.RecommendBufioSize),
 		prober: &Prober{},
 		b:      make([]byte, 256),
+		cr:     cr,
 	}
+	inst.rs, _ = r.(io.ReadSeeker)
+	return inst
 }
 
 func (inst *Demuxer) prepare() (err error) {
@@ -441,6 +701,7 @@ func (inst *Demuxer) prepare() (err error) {
 			if flags&flvio.FileHasVideo != 0 {
 				inst.prober.HasVideo = true
 			}
+			inst.dataPos = inst.pos()
 			inst.stage++
 
 		case 1:
@@ -450,6 +711,9 @@ func (inst *Demuxer) prepare() (err error) {
 				if tag, timestamp, err = flvio.ReadTag(inst.bufr, inst.b); err != nil {
 					return
 				}
+				if tag.Type == flvio.TagScriptdata {
+					inst.parseMetadata(tag.Data)
+				}
 				if err = inst.prober.PushTag(tag, timestamp); err != nil {
 					return
 				}
@@ -0,0 +1,89 @@
+package flv
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/h263parser"
+)
+
+type testCodecData struct {
+	typ av.CodecType
+}
+
+func (codec testCodecData) Type() av.CodecType {
+	return codec.typ
+}
+
+func TestMuxerUnsupportedCodec(t *testing.T) {
+	// such as mjpeg of ffmpeg video encoder, mpeg4 is muxed by mp4 only
+	for _, typ := range []av.CodecType{av.JPEG, av.MPEG4, av.KLV} {
+		muxer := NewMuxer(&bytes.Buffer{})
+		if err := muxer.WriteHeader([]av.CodecData{testCodecData{typ}}); err == nil {
+			t.Errorf("codec type=%d accepted", typ)
+		}
+	}
+}
+
+// testH263Picture makes picture of 320x240 with header of version 0
+func testH263Picture(i int, key bool) []byte {
+	data := make([]byte, 50)
+	// start code, version, temporal reference and size 5
+	copy(data, []byte{0x00, 0x00, 0x80, 0x02, 0x80})
+	if !key {
+		data[4] |= byte(h263parser.PictureTypeInter) << 5
+	}
+	for j := 5; j < len(data); j++ {
+		data[j] = byte(i + j)
+	}
+	return data
+}
+
+func TestMuxerH263(t *testing.T) {
+	var pkts []av.Packet
+	for i := 0; i < 30; i++ {
+		pkts = append(pkts, av.Packet{
+			IsKeyFrame: i%10 == 0,
+			Time:       time.Duration(i) * 40 * time.Millisecond,
+			Data:       testH263Picture(i, i%10 == 0),
+		})
+	}
+
+	buf := &bytes.Buffer{}
+	muxer := NewMuxer(buf)
+	if err := muxer.WriteHeader([]av.CodecData{h263parser.NewCodecData(320, 240)}); err != nil {
+		t.Fatal(err)
+	}
+	for _, pkt := range pkts {
+		if err := muxer.WritePacket(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+
+	demuxer := NewDemuxer(buf)
+	streams, err := demuxer.Streams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 1 || streams[0].Type() != av.H263 {
+		t.Fatalf("streams=%v", streams)
+	}
+	if stream := streams[0].(av.VideoCodecData); stream.Width() != 320 || stream.Height() != 240 {
+		t.Errorf("size=%dx%d", stream.Width(), stream.Height())
+	}
+	for i, want := range pkts {
+		pkt, err := demuxer.ReadPacket()
+		if err != nil {
+			t.Fatal(i, err)
+		}
+		if pkt.Idx != 0 || pkt.Time != want.Time || pkt.IsKeyFrame != want.IsKeyFrame || !bytes.Equal(pkt.Data, want.Data) {
+			t.Fatalf("packet#%d time=%v key=%v len=%d, want time=%v key=%v len=%d", i,
+				pkt.Time, pkt.IsKeyFrame, len(pkt.Data), want.Time, want.IsKeyFrame, len(want.Data))
+		}
+	}
+}
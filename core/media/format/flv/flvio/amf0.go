@@ -468,6 +468,15 @@ func parseAMF0Val(b []byte, offset int) (val interface{}, n int, err error) {
 		val = string(b[n : n+length])
 		n += length
 
+	case avmplusobjectmarker:
+		// switch to amf3 for one value
+		var nval int
+		if val, nval, err = parseAMF3Val(b[n:], offset+n); err != nil {
+			err = amf0ParseErr("avmplusobject", offset+n, err)
+			return
+		}
+		n += nval
+
 	default:
 		err = amf0ParseErr(fmt.Sprintf("invalidmarker=%d", marker), offset+n, err)
 		return
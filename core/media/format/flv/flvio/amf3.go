@@ -0,0 +1,740 @@
+package flvio
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
+)
+
+// AMF3ParseError struct
+type AMF3ParseError struct {
+	Offset  int
+	Message string
+	Next    *AMF3ParseError
+}
+
+// Error func
+func (inst *AMF3ParseError) Error() string {
+	s := []string{}
+	for p := inst; p != nil; p = p.Next {
+		s = append(s, fmt.Sprintf("%s:%d", p.Message, p.Offset))
+	}
+	return "amf3 parse error: " + strings.Join(s, ",")
+}
+
+func amf3ParseErr(message string, offset int, err error) error {
+	next, _ := err.(*AMF3ParseError)
+	return &AMF3ParseError{
+		Offset:  offset,
+		Message: message,
+		Next:    next,
+	}
+}
+
+// AMFTypedObject is object with class name.
+// In AMF3 its members are written as sealed members in key order.
+type AMFTypedObject struct {
+	ClassName string
+	Object    AMFMap
+}
+
+// integer range of amf3 U29 signed integer
+const (
+	amf3IntMin = -1 << 28
+	amf3IntMax = 1<<28 - 1
+)
+
+// traits of amf3 object
+type amf3Traits struct {
+	className   string
+	dynamic     bool
+	sealedNames []string
+}
+
+// amf3Parser holds reference tables, which start empty for each top level value
+type amf3Parser struct {
+	b       []byte
+	offset  int
+	strings []string
+	objects []interface{}
+	traits  []*amf3Traits
+}
+
+// ParseAMF3Val func
+func ParseAMF3Val(b []byte) (val interface{}, n int, err error) {
+	return parseAMF3Val(b, 0)
+}
+
+func parseAMF3Val(b []byte, offset int) (val interface{}, n int, err error) {
+	parser := &amf3Parser{b: b, offset: offset}
+	return parser.parseVal(0)
+}
+
+func (inst *amf3Parser) parseU29(n int) (u uint32, size int, err error) {
+	for i := 0; i < 4; i++ {
+		if len(inst.b) < n+i+1 {
+			err = amf3ParseErr("u29", inst.offset+n+i, err)
+			return
+		}
+		c := inst.b[n+i]
+		size++
+		if i == 3 {
+			u = u<<8 | uint32(c)
+			return
+		}
+		u = u<<7 | uint32(c&0x7f)
+		if c&0x80 == 0 {
+			return
+		}
+	}
+	return
+}
+
+func (inst *amf3Parser) parseString(n int) (s string, size int, err error) {
+	var u uint32
+	if u, size, err = inst.parseU29(n); err != nil {
+		err = amf3ParseErr("string.length", inst.offset+n, err)
+		return
+	}
+	if u&1 == 0 {
+		idx := int(u >> 1)
+		if idx >= len(inst.strings) {
+			err = amf3ParseErr("string.ref", inst.offset+n, err)
+			return
+		}
+		s = inst.strings[idx]
+		return
+	}
+	length := int(u >> 1)
+	if len(inst.b) < n+size+length {
+		err = amf3ParseErr("string.body", inst.offset+n+size, err)
+		return
+	}
+	s = string(inst.b[n+size : n+size+length])
+	size += length
+	if length > 0 {
+		inst.strings = append(inst.strings, s)
+	}
+	return
+}
+
+// parseRef parses U29 header of object types, ok is false when value is reference
+func (inst *amf3Parser) parseRef(n int) (u uint32, ref interface{}, ok bool, size int, err error) {
+	if u, size, err = inst.parseU29(n); err != nil {
+		return
+	}
+	if u&1 == 0 {
+		idx := int(u >> 1)
+		if idx >= len(inst.objects) {
+			err = amf3ParseErr("object.ref", inst.offset+n, err)
+			return
+		}
+		ref = inst.objects[idx]
+		return
+	}
+	ok = true
+	u >>= 1
+	return
+}
+
+func (inst *amf3Parser) parseVal(n int) (val interface{}, size int, err error) {
+	start := n
+	if len(inst.b) < n+1 {
+		err = amf3ParseErr("marker", inst.offset+n, err)
+		return
+	}
+	marker := inst.b[n]
+	n++
+
+	var u uint32
+	var inline bool
+	var nval int
+
+	switch marker {
+	case amf3undefinedmarker, amf3nullmarker:
+
+	case amf3falsemarker:
+		val = false
+
+	case amf3truemarker:
+		val = true
+
+	case amf3integermarker:
+		if u, nval, err = inst.parseU29(n); err != nil {
+			err = amf3ParseErr("integer", inst.offset+n, err)
+			return
+		}
+		n += nval
+		i := int32(u)
+		if u&0x10000000 != 0 {
+			i -= 0x20000000
+		}
+		val = float64(i)
+
+	case amf3doublemarker:
+		if len(inst.b) < n+8 {
+			err = amf3ParseErr("double", inst.offset+n, err)
+			return
+		}
+		val = parseBEFloat64(inst.b[n:])
+		n += 8
+
+	case amf3stringmarker:
+		if val, nval, err = inst.parseString(n); err != nil {
+			return
+		}
+		n += nval
+
+	case amf3xmldocmarker, amf3xmlmarker, amf3bytearraymarker:
+		if u, val, inline, nval, err = inst.parseRef(n); err != nil || !inline {
+			n += nval
+			break
+		}
+		n += nval
+		length := int(u)
+		if len(inst.b) < n+length {
+			err = amf3ParseErr("bytes.body", inst.offset+n, err)
+			return
+		}
+		if marker == amf3bytearraymarker {
+			val = append([]byte{}, inst.b[n:n+length]...)
+		} else {
+			val = string(inst.b[n : n+length])
+		}
+		n += length
+		inst.objects = append(inst.objects, val)
+
+	case amf3datemarker:
+		if _, val, inline, nval, err = inst.parseRef(n); err != nil || !inline {
+			n += nval
+			break
+		}
+		n += nval
+		if len(inst.b) < n+8 {
+			err = amf3ParseErr("date", inst.offset+n, err)
+			return
+		}
+		ts := parseBEFloat64(inst.b[n:])
+		n += 8
+		val = time.Unix(int64(ts/1000), (int64(ts)%1000)*1000000)
+		inst.objects = append(inst.objects, val)
+
+	case amf3arraymarker:
+		if u, val, inline, nval, err = inst.parseRef(n); err != nil || !inline {
+			n += nval
+			break
+		}
+		n += nval
+		if val, nval, err = inst.parseArray(n, int(u)); err != nil {
+			return
+		}
+		n += nval
+
+	case amf3objectmarker:
+		if u, val, inline, nval, err = inst.parseRef(n); err != nil || !inline {
+			n += nval
+			break
+		}
+		n += nval
+		if val, nval, err = inst.parseObject(n, u); err != nil {
+			return
+		}
+		n += nval
+
+	case amf3vectorintmarker, amf3vectoruintmarker, amf3vectordoublemarker, amf3vectorobjectmarker:
+		if u, val, inline, nval, err = inst.parseRef(n); err != nil || !inline {
+			n += nval
+			break
+		}
+		n += nval
+		if val, nval, err = inst.parseVector(n, marker, int(u)); err != nil {
+			return
+		}
+		n += nval
+
+	default:
+		err = amf3ParseErr(fmt.Sprintf("invalidmarker=%d", marker), inst.offset+n, err)
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	size = n - start
+	return
+}
+
+// parseArray returns AMFArray, or AMFECMAArray with dense values keyed by index when array has associative part
+func (inst *amf3Parser) parseArray(n int, count int) (val interface{}, size int, err error) {
+	start := n
+	var nval int
+	var assoc AMFECMAArray
+	idx := len(inst.objects)
+	inst.objects = append(inst.objects, nil)
+
+	for {
+		var key string
+		if key, nval, err = inst.parseString(n); err != nil {
+			err = amf3ParseErr("array.key", inst.offset+n, err)
+			return
+		}
+		n += nval
+		if key == "" {
+			break
+		}
+		if assoc == nil {
+			assoc = AMFECMAArray{}
+			inst.objects[idx] = assoc
+		}
+		if assoc[key], nval, err = inst.parseVal(n); err != nil {
+			err = amf3ParseErr("array.val", inst.offset+n, err)
+			return
+		}
+		n += nval
+	}
+
+	if len(inst.b) < n+count {
+		err = amf3ParseErr("array.count", inst.offset+n, err)
+		return
+	}
+	dense := make(AMFArray, count)
+	if assoc == nil {
+		inst.objects[idx] = dense
+	}
+	for i := range dense {
+		if dense[i], nval, err = inst.parseVal(n); err != nil {
+			err = amf3ParseErr("array.val", inst.offset+n, err)
+			return
+		}
+		n += nval
+	}
+
+	if assoc != nil {
+		for i, v := range dense {
+			assoc[strconv.Itoa(i)] = v
+		}
+		val = assoc
+	} else {
+		val = dense
+	}
+	size = n - start
+	return
+}
+
+// parseObject returns AMFMap for anonymous object and AMFTypedObject for typed one
+func (inst *amf3Parser) parseObject(n int, u uint32) (val interface{}, size int, err error) {
+	start := n
+	var nval int
+	var traits *amf3Traits
+
+	if u&1 == 0 {
+		idx := int(u >> 1)
+		if idx >= len(inst.traits) {
+			err = amf3ParseErr("object.traits.ref", inst.offset+n, err)
+			return
+		}
+		traits = inst.traits[idx]
+	} else {
+		if u&2 != 0 {
+			err = amf3ParseErr("object.externalizable", inst.offset+n, err)
+			return
+		}
+		traits = &amf3Traits{dynamic: u&4 != 0}
+		if traits.className, nval, err = inst.parseString(n); err != nil {
+			err = amf3ParseErr("object.classname", inst.offset+n, err)
+			return
+		}
+		n += nval
+		count := int(u >> 3)
+		if len(inst.b) < n+count {
+			err = amf3ParseErr("object.sealed.count", inst.offset+n, err)
+			return
+		}
+		traits.sealedNames = make([]string, count)
+		for i := range traits.sealedNames {
+			if traits.sealedNames[i], nval, err = inst.parseString(n); err != nil {
+				err = amf3ParseErr("object.sealed.name", inst.offset+n, err)
+				return
+			}
+			n += nval
+		}
+		inst.traits = append(inst.traits, traits)
+	}
+
+	obj := AMFMap{}
+	if traits.className != "" {
+		inst.objects = append(inst.objects, AMFTypedObject{ClassName: traits.className, Object: obj})
+	} else {
+		inst.objects = append(inst.objects, obj)
+	}
+
+	for _, name := range traits.sealedNames {
+		if obj[name], nval, err = inst.parseVal(n); err != nil {
+			err = amf3ParseErr("object.sealed.val", inst.offset+n, err)
+			return
+		}
+		n += nval
+	}
+	if traits.dynamic {
+		for {
+			var key string
+			if key, nval, err = inst.parseString(n); err != nil {
+				err = amf3ParseErr("object.key", inst.offset+n, err)
+				return
+			}
+			n += nval
+			if key == "" {
+				break
+			}
+			if obj[key], nval, err = inst.parseVal(n); err != nil {
+				err = amf3ParseErr("object.val", inst.offset+n, err)
+				return
+			}
+			n += nval
+		}
+	}
+
+	if traits.className != "" {
+		val = AMFTypedObject{ClassName: traits.className, Object: obj}
+	} else {
+		val = obj
+	}
+	size = n - start
+	return
+}
+
+// parseVector returns []int32, []uint32, []float64 or AMFArray
+func (inst *amf3Parser) parseVector(n int, marker uint8, count int) (val interface{}, size int, err error) {
+	start := n
+	if len(inst.b) < n+1 {
+		err = amf3ParseErr("vector.fixed", inst.offset+n, err)
+		return
+	}
+	n++
+
+	idx := len(inst.objects)
+	inst.objects = append(inst.objects, nil)
+
+	itemSize := 4
+	if marker == amf3vectordoublemarker {
+		itemSize = 8
+	} else if marker == amf3vectorobjectmarker {
+		itemSize = 1
+	}
+	if len(inst.b) < n+count*itemSize {
+		err = amf3ParseErr("vector.body", inst.offset+n, err)
+		return
+	}
+
+	switch marker {
+	case amf3vectorintmarker:
+		vec := make([]int32, count)
+		for i := range vec {
+			vec[i] = pio.I32BE(inst.b[n:])
+			n += 4
+		}
+		val = vec
+	case amf3vectoruintmarker:
+		vec := make([]uint32, count)
+		for i := range vec {
+			vec[i] = pio.U32BE(inst.b[n:])
+			n += 4
+		}
+		val = vec
+	case amf3vectordoublemarker:
+		vec := make([]float64, count)
+		for i := range vec {
+			vec[i] = parseBEFloat64(inst.b[n:])
+			n += 8
+		}
+		val = vec
+	case amf3vectorobjectmarker:
+		var nval int
+		if _, nval, err = inst.parseString(n); err != nil {
+			err = amf3ParseErr("vector.typename", inst.offset+n, err)
+			return
+		}
+		n += nval
+		vec := make(AMFArray, count)
+		for i := range vec {
+			if vec[i], nval, err = inst.parseVal(n); err != nil {
+				err = amf3ParseErr("vector.val", inst.offset+n, err)
+				return
+			}
+			n += nval
+		}
+		val = vec
+	}
+	inst.objects[idx] = val
+
+	size = n - start
+	return
+}
+
+func lenAMF3U29(u uint32) int {
+	switch {
+	case u < 0x80:
+		return 1
+	case u < 0x4000:
+		return 2
+	case u < 0x200000:
+		return 3
+	}
+	return 4
+}
+
+func fillAMF3U29(b []byte, u uint32) int {
+	switch {
+	case u < 0x80:
+		b[0] = byte(u)
+		return 1
+	case u < 0x4000:
+		b[0] = byte(u>>7) | 0x80
+		b[1] = byte(u & 0x7f)
+		return 2
+	case u < 0x200000:
+		b[0] = byte(u>>14) | 0x80
+		b[1] = byte(u>>7) | 0x80
+		b[2] = byte(u & 0x7f)
+		return 3
+	}
+	b[0] = byte(u>>22) | 0x80
+	b[1] = byte(u>>15) | 0x80
+	b[2] = byte(u>>8) | 0x80
+	b[3] = byte(u)
+	return 4
+}
+
+func lenAMF3String(s string) int {
+	return lenAMF3U29(uint32(len(s))<<1|1) + len(s)
+}
+
+// fillAMF3String writes string inline, references are never written
+func fillAMF3String(b []byte, s string) (n int) {
+	n += fillAMF3U29(b, uint32(len(s))<<1|1)
+	n += copy(b[n:], s)
+	return
+}
+
+// amf3Number returns integer when value fits in U29 signed integer
+func amf3Number(_val interface{}) (i int64, f float64, isint bool, ok bool) {
+	ok = true
+	switch val := _val.(type) {
+	case int8:
+		i, isint = int64(val), true
+	case int16:
+		i, isint = int64(val), true
+	case int32:
+		i, isint = int64(val), true
+	case int64:
+		i, isint = val, true
+	case int:
+		i, isint = int64(val), true
+	case uint8:
+		i, isint = int64(val), true
+	case uint16:
+		i, isint = int64(val), true
+	case uint32:
+		i, isint = int64(val), true
+	case uint64:
+		if val > amf3IntMax {
+			return 0, float64(val), false, true
+		}
+		i, isint = int64(val), true
+	case uint:
+		if uint64(val) > amf3IntMax {
+			return 0, float64(val), false, true
+		}
+		i, isint = int64(val), true
+	case float32:
+		f = float64(val)
+	case float64:
+		f = val
+	default:
+		ok = false
+		return
+	}
+	if isint && (i < amf3IntMin || i > amf3IntMax) {
+		f, isint = float64(i), false
+	}
+	return
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// LenAMF3Val func
+func LenAMF3Val(_val interface{}) (n int) {
+	if i, _, isint, ok := amf3Number(_val); ok {
+		if isint {
+			return 1 + lenAMF3U29(uint32(i)&0x1fffffff)
+		}
+		return 1 + 8
+	}
+
+	switch val := _val.(type) {
+	case string:
+		n += 1 + lenAMF3String(val)
+
+	case []byte:
+		n += 1 + lenAMF3U29(uint32(len(val))<<1|1) + len(val)
+
+	case time.Time:
+		n += 1 + 1 + 8
+
+	case AMFArray:
+		n += 1 + lenAMF3U29(uint32(len(val))<<1|1) + 1
+		for _, v := range val {
+			n += LenAMF3Val(v)
+		}
+
+	case AMFECMAArray:
+		n += 1 + 1
+		for k, v := range val {
+			if len(k) > 0 {
+				n += lenAMF3String(k) + LenAMF3Val(v)
+			}
+		}
+		n++
+
+	case AMFMap:
+		n += 1 + 1 + 1
+		for k, v := range val {
+			if len(k) > 0 {
+				n += lenAMF3String(k) + LenAMF3Val(v)
+			}
+		}
+		n++
+
+	case AMFTypedObject:
+		n += 1 + lenAMF3U29(uint32(len(val.Object))<<4|3) + lenAMF3String(val.ClassName)
+		for k, v := range val.Object {
+			n += lenAMF3String(k) + LenAMF3Val(v)
+		}
+
+	case bool:
+		n++
+
+	case nil:
+		n++
+	}
+
+	return
+}
+
+// FillAMF3Val func
+func FillAMF3Val(b []byte, _val interface{}) (n int) {
+	if i, f, isint, ok := amf3Number(_val); ok {
+		if isint {
+			b[n] = amf3integermarker
+			n++
+			n += fillAMF3U29(b[n:], uint32(i)&0x1fffffff)
+		} else {
+			b[n] = amf3doublemarker
+			n++
+			n += fillBEFloat64(b[n:], f)
+		}
+		return
+	}
+
+	switch val := _val.(type) {
+	case string:
+		b[n] = amf3stringmarker
+		n++
+		n += fillAMF3String(b[n:], val)
+
+	case []byte:
+		b[n] = amf3bytearraymarker
+		n++
+		n += fillAMF3U29(b[n:], uint32(len(val))<<1|1)
+		n += copy(b[n:], val)
+
+	case time.Time:
+		b[n] = amf3datemarker
+		n++
+		b[n] = 1
+		n++
+		n += fillBEFloat64(b[n:], float64(val.UnixNano()/1000000))
+
+	case AMFArray:
+		b[n] = amf3arraymarker
+		n++
+		n += fillAMF3U29(b[n:], uint32(len(val))<<1|1)
+		// no associative part
+		b[n] = 1
+		n++
+		for _, v := range val {
+			n += FillAMF3Val(b[n:], v)
+		}
+
+	case AMFECMAArray:
+		b[n] = amf3arraymarker
+		n++
+		// no dense part
+		b[n] = 1
+		n++
+		for k, v := range val {
+			if len(k) > 0 {
+				n += fillAMF3String(b[n:], k)
+				n += FillAMF3Val(b[n:], v)
+			}
+		}
+		b[n] = 1
+		n++
+
+	case AMFMap:
+		b[n] = amf3objectmarker
+		n++
+		// inline traits, dynamic, no sealed members, anonymous class
+		b[n] = 0x0b
+		n++
+		b[n] = 1
+		n++
+		for k, v := range val {
+			if len(k) > 0 {
+				n += fillAMF3String(b[n:], k)
+				n += FillAMF3Val(b[n:], v)
+			}
+		}
+		b[n] = 1
+		n++
+
+	case AMFTypedObject:
+		b[n] = amf3objectmarker
+		n++
+		// inline traits, sealed members
+		n += fillAMF3U29(b[n:], uint32(len(val.Object))<<4|3)
+		n += fillAMF3String(b[n:], val.ClassName)
+		keys := sortedKeys(val.Object)
+		for _, k := range keys {
+			n += fillAMF3String(b[n:], k)
+		}
+		for _, k := range keys {
+			n += FillAMF3Val(b[n:], val.Object[k])
+		}
+
+	case bool:
+		if val {
+			b[n] = amf3truemarker
+		} else {
+			b[n] = amf3falsemarker
+		}
+		n++
+
+	case nil:
+		b[n] = amf3nullmarker
+		n++
+	}
+
+	return
+}
@@ -0,0 +1,227 @@
+package flvio
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testFillAMF3(val interface{}) []byte {
+	b := make([]byte, LenAMF3Val(val))
+	return b[:FillAMF3Val(b, val)]
+}
+
+func TestAMF3Integer(t *testing.T) {
+	for _, test := range []struct {
+		val    int64
+		marker uint8
+		size   int
+	}{
+		{0, amf3integermarker, 1},
+		{0x7f, amf3integermarker, 1},
+		{0x80, amf3integermarker, 2},
+		{0x3fff, amf3integermarker, 2},
+		{0x4000, amf3integermarker, 3},
+		{0x1fffff, amf3integermarker, 3},
+		{0x200000, amf3integermarker, 4},
+		{amf3IntMax, amf3integermarker, 4},
+		{-1, amf3integermarker, 4},
+		{amf3IntMin, amf3integermarker, 4},
+		// out of U29 range falls back to double
+		{amf3IntMax + 1, amf3doublemarker, 8},
+		{amf3IntMin - 1, amf3doublemarker, 8},
+	} {
+		b := testFillAMF3(test.val)
+		if len(b) != 1+test.size || b[0] != test.marker {
+			t.Errorf("%d: encoded % x", test.val, b)
+			continue
+		}
+		val, n, err := ParseAMF3Val(b)
+		if err != nil {
+			t.Errorf("%d: %v", test.val, err)
+			continue
+		}
+		if n != len(b) || val != float64(test.val) {
+			t.Errorf("%d: parsed %v n=%d", test.val, val, n)
+		}
+	}
+}
+
+func TestAMF3RoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		val  interface{}
+	}{
+		{"null", nil},
+		{"true", true},
+		{"false", false},
+		{"double", 1.5},
+		{"string", "hello"},
+		{"empty string", ""},
+		{"bytes", []byte{1, 2, 3}},
+		{"array", AMFArray{1.5, "a", AMFArray{"b", nil}}},
+		{"ecma array", AMFECMAArray{"a": 1.5, "b": "c"}},
+		{"object", AMFMap{"a": 1.5, "b": AMFMap{"c": "d"}, "e": AMFArray{"f", "f"}}},
+		{"typed object", AMFTypedObject{ClassName: "Foo", Object: AMFMap{"x": 1.5, "y": "z", "w": AMFMap{"v": true}}}},
+	} {
+		b := testFillAMF3(test.val)
+		val, n, err := ParseAMF3Val(b)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if n != len(b) {
+			t.Errorf("%s: n=%d, want %d", test.name, n, len(b))
+		}
+		if !reflect.DeepEqual(val, test.val) {
+			t.Errorf("%s: parsed %#v, want %#v", test.name, val, test.val)
+		}
+	}
+
+	tm := time.Unix(1600000000, 123000000)
+	val, _, err := ParseAMF3Val(testFillAMF3(tm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if date, _ := val.(time.Time); !date.Equal(tm) {
+		t.Errorf("date=%v, want %v", val, tm)
+	}
+}
+
+func TestAMF3Parse(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		b    []byte
+		val  interface{}
+	}{
+		{
+			"string reference",
+			[]byte{
+				amf3arraymarker, 0x07, 0x01,
+				amf3stringmarker, 0x07, 'a', 'b', 'c',
+				amf3stringmarker, 0x00,
+				// empty string is never added to reference table
+				amf3stringmarker, 0x01,
+			},
+			AMFArray{"abc", "abc", ""},
+		},
+		{
+			"object reference",
+			[]byte{
+				amf3arraymarker, 0x05, 0x01,
+				amf3objectmarker, 0x0b, 0x01, 0x03, 'a', amf3integermarker, 0x01, 0x01,
+				// index 0 is outer array
+				amf3objectmarker, 0x02,
+			},
+			AMFArray{AMFMap{"a": 1.0}, AMFMap{"a": 1.0}},
+		},
+		{
+			"array reference",
+			[]byte{
+				amf3arraymarker, 0x05, 0x01,
+				amf3arraymarker, 0x03, 0x01, amf3truemarker,
+				amf3arraymarker, 0x02,
+			},
+			AMFArray{AMFArray{true}, AMFArray{true}},
+		},
+		{
+			"traits reference",
+			[]byte{
+				amf3arraymarker, 0x05, 0x01,
+				amf3objectmarker, 0x13, 0x07, 'F', 'o', 'o', 0x03, 'x', amf3integermarker, 0x05,
+				amf3objectmarker, 0x01, amf3integermarker, 0x06,
+			},
+			AMFArray{
+				AMFTypedObject{ClassName: "Foo", Object: AMFMap{"x": 5.0}},
+				AMFTypedObject{ClassName: "Foo", Object: AMFMap{"x": 6.0}},
+			},
+		},
+		{
+			"dynamic typed object",
+			[]byte{
+				amf3objectmarker, 0x1b, 0x07, 'F', 'o', 'o', 0x03, 'x', amf3integermarker, 0x01,
+				0x03, 'y', amf3stringmarker, 0x05, 'h', 'i',
+				// sealed name "x" referenced as dynamic key
+				0x02, amf3falsemarker,
+				0x01,
+			},
+			AMFTypedObject{ClassName: "Foo", Object: AMFMap{"x": false, "y": "hi"}},
+		},
+		{
+			"mixed array",
+			[]byte{
+				amf3arraymarker, 0x05, 0x03, 'k', amf3truemarker, 0x01,
+				amf3integermarker, 0x01, amf3integermarker, 0x02,
+			},
+			AMFECMAArray{"k": true, "0": 1.0, "1": 2.0},
+		},
+		{
+			"vector int",
+			[]byte{amf3vectorintmarker, 0x05, 0x00, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 2},
+			[]int32{-1, 2},
+		},
+	} {
+		val, n, err := ParseAMF3Val(test.b)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if n != len(test.b) {
+			t.Errorf("%s: n=%d, want %d", test.name, n, len(test.b))
+		}
+		if !reflect.DeepEqual(val, test.val) {
+			t.Errorf("%s: parsed %#v, want %#v", test.name, val, test.val)
+		}
+	}
+}
+
+func TestAMF3ParseInvalid(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		b    []byte
+	}{
+		{"externalizable object", []byte{amf3objectmarker, 0x07, 0x07, 'F', 'o', 'o'}},
+		{"string reference out of table", []byte{amf3stringmarker, 0x00}},
+		{"object reference out of table", []byte{amf3objectmarker, 0x00}},
+		{"traits reference out of table", []byte{amf3objectmarker, 0x01}},
+		{"truncated u29", []byte{amf3integermarker, 0x80, 0x80}},
+		{"truncated string", []byte{amf3stringmarker, 0x07, 'a'}},
+		{"invalid marker", []byte{0x20}},
+	} {
+		if _, _, err := ParseAMF3Val(test.b); err == nil {
+			t.Errorf("%s: parsed without error", test.name)
+		} else if _, ok := err.(*AMF3ParseError); !ok {
+			t.Errorf("%s: error %T", test.name, err)
+		}
+	}
+}
+
+func TestAMF0AvmPlus(t *testing.T) {
+	obj := AMFMap{"a": "b", "c": AMFArray{1.5, "b"}}
+	amf3 := testFillAMF3(obj)
+	b := append([]byte{avmplusobjectmarker}, amf3...)
+	val, n, err := ParseAMF0Val(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(b) || !reflect.DeepEqual(val, obj) {
+		t.Errorf("parsed %#v n=%d", val, n)
+	}
+
+	// reference tables start empty for each avmplus value
+	arr := []byte{strictarraymarker, 0, 0, 0, 2,
+		avmplusobjectmarker, amf3stringmarker, 0x03, 'a',
+		avmplusobjectmarker, amf3stringmarker, 0x00,
+	}
+	if _, _, err = ParseAMF0Val(arr); err == nil {
+		t.Error("string reference resolved across avmplus values")
+	}
+	arr[len(arr)-1] = 0x01
+	if val, _, err = ParseAMF0Val(arr); err != nil || !reflect.DeepEqual(val, AMFArray{"a", ""}) {
+		t.Errorf("parsed %#v err=%v", val, err)
+	}
+
+	if _, _, err = ParseAMF0Val(b[:len(b)-1]); err == nil {
+		t.Error("truncated avmplus value parsed without error")
+	}
+}
@@ -48,6 +48,8 @@ const (
 	SoundAAC = 10
 	// SoundSpeex const
 	SoundSpeex = 11
+	// SoundMP38Khz const
+	SoundMP38Khz = 14
 
 	// Sound5Dot5Khz const
 	Sound5Dot5Khz = 0
@@ -87,11 +89,41 @@ const (
 	FrameKey = 1
 	// FrameInter const
 	FrameInter = 2
+	// FrameDisposable const, disposable inter frame of H.263 only
+	FrameDisposable = 3
 
+	// VideoH263 const, Sorenson H.263
+	VideoH263 = 2
 	// VideoH264 const
 	VideoH264 = 7
 )
 
+// Enhanced RTMP video, codec is identified by FourCC when IsExHeader bit is set
+const (
+	// VideoIsExHeader const
+	VideoIsExHeader = 0x80
+
+	// PacketTypeSequenceStart const
+	PacketTypeSequenceStart = 0
+	// PacketTypeCodedFrames const
+	PacketTypeCodedFrames = 1
+	// PacketTypeSequenceEnd const
+	PacketTypeSequenceEnd = 2
+	// PacketTypeCodedFramesX const, coded frames without composition time
+	PacketTypeCodedFramesX = 3
+	// PacketTypeMetadata const
+	PacketTypeMetadata = 4
+	// PacketTypeMPEG2TSSequenceStart const
+	PacketTypeMPEG2TSSequenceStart = 5
+
+	// FourCCHEVC const 'hvc1'
+	FourCCHEVC = 0x68766331
+	// FourCCAV1 const 'av01'
+	FourCCAV1 = 0x61763031
+	// FourCCVP9 const 'vp09'
+	FourCCVP9 = 0x76703039
+)
+
 // Tag struct
 type Tag struct {
 	Type uint8
@@ -180,6 +212,16 @@ type Tag struct {
 	*/
 	AVCPacketType uint8
 
+	/*
+		Enhanced RTMP video header, FrameType is 3 bits and CodecID is not used
+		IsExHeader: UB[1]
+		PacketType: UB[4]
+		FourCC: UI32
+	*/
+	IsExHeader bool
+	PacketType uint8
+	FourCC     uint32
+
 	CompositionTime int32
 
 	Data []byte
@@ -243,18 +285,49 @@ func (inst *Tag) videoParseHeader(b []byte) (n int, err error) {
 		return
 	}
 	flags := b[n]
+	if flags&VideoIsExHeader != 0 {
+		return inst.videoParseExHeader(b)
+	}
 	inst.FrameType = flags >> 4
 	inst.CodecID = flags & 0xf
 	n++
 
-	if inst.FrameType == FrameInter || inst.FrameType == FrameKey {
-		if len(b) < n+4 {
+	switch inst.CodecID {
+	case VideoH264:
+		if inst.FrameType == FrameInter || inst.FrameType == FrameKey {
+			if len(b) < n+4 {
+				err = fmt.Errorf("videodata: parse invalid")
+				return
+			}
+			inst.AVCPacketType = b[n]
+			n++
+
+			inst.CompositionTime = pio.I24BE(b[n:])
+			n += 3
+		}
+	}
+
+	return
+}
+
+func (inst *Tag) videoParseExHeader(b []byte) (n int, err error) {
+	if len(b) < n+5 {
+		err = fmt.Errorf("videodata: parse invalid")
+		return
+	}
+	flags := b[n]
+	inst.IsExHeader = true
+	inst.FrameType = (flags >> 4) & 0x7
+	inst.PacketType = flags & 0xf
+	n++
+	inst.FourCC = pio.U32BE(b[n:])
+	n += 4
+
+	if inst.PacketType == PacketTypeCodedFrames && inst.FourCC == FourCCHEVC {
+		if len(b) < n+3 {
 			err = fmt.Errorf("videodata: parse invalid")
 			return
 		}
-		inst.AVCPacketType = b[n]
-		n++
-
 		inst.CompositionTime = pio.I24BE(b[n:])
 		n += 3
 	}
@@ -262,14 +335,33 @@ func (inst *Tag) videoParseHeader(b []byte) (n int, err error) {
 	return
 }
 
+func (inst Tag) videoFillExHeader(b []byte) (n int) {
+	b[n] = VideoIsExHeader | (inst.FrameType&0x7)<<4 | inst.PacketType&0xf
+	n++
+	pio.PutU32BE(b[n:], inst.FourCC)
+	n += 4
+	if inst.PacketType == PacketTypeCodedFrames && inst.FourCC == FourCCHEVC {
+		pio.PutI24BE(b[n:], inst.CompositionTime)
+		n += 3
+	}
+	return
+}
+
 func (inst Tag) videoFillHeader(b []byte) (n int) {
+	if inst.IsExHeader {
+		return inst.videoFillExHeader(b)
+	}
 	flags := inst.FrameType<<4 | inst.CodecID
 	b[n] = flags
 	n++
-	b[n] = inst.AVCPacketType
-	n++
-	pio.PutI24BE(b[n:], inst.CompositionTime)
-	n += 3
+
+	switch inst.CodecID {
+	case VideoH264:
+		b[n] = inst.AVCPacketType
+		n++
+		pio.PutI24BE(b[n:], inst.CompositionTime)
+		n += 3
+	}
 	return
 }
 
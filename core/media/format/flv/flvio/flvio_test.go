@@ -0,0 +1,91 @@
+package flvio
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestVideoTagRoundTrip(t *testing.T) {
+	data := []byte{0, 0, 0, 2, 0x26, 0x01}
+	for _, test := range []struct {
+		name   string
+		tag    Tag
+		header []byte
+	}{
+		{
+			"hevc sequence start",
+			Tag{Type: TagVideo, IsExHeader: true, FrameType: FrameKey, PacketType: PacketTypeSequenceStart, FourCC: FourCCHEVC},
+			[]byte{0x90, 'h', 'v', 'c', '1'},
+		},
+		{
+			"hevc coded frames",
+			Tag{Type: TagVideo, IsExHeader: true, FrameType: FrameKey, PacketType: PacketTypeCodedFrames, FourCC: FourCCHEVC, CompositionTime: 80},
+			[]byte{0x91, 'h', 'v', 'c', '1', 0, 0, 80},
+		},
+		{
+			"hevc coded frames negative composition time",
+			Tag{Type: TagVideo, IsExHeader: true, FrameType: FrameInter, PacketType: PacketTypeCodedFrames, FourCC: FourCCHEVC, CompositionTime: -40},
+			[]byte{0xa1, 'h', 'v', 'c', '1', 0xff, 0xff, 0xd8},
+		},
+		{
+			"hevc coded frames x",
+			Tag{Type: TagVideo, IsExHeader: true, FrameType: FrameInter, PacketType: PacketTypeCodedFramesX, FourCC: FourCCHEVC},
+			[]byte{0xa3, 'h', 'v', 'c', '1'},
+		},
+		{
+			"hevc sequence end",
+			Tag{Type: TagVideo, IsExHeader: true, FrameType: FrameKey, PacketType: PacketTypeSequenceEnd, FourCC: FourCCHEVC},
+			[]byte{0x92, 'h', 'v', 'c', '1'},
+		},
+		{
+			"av1 coded frames has no composition time",
+			Tag{Type: TagVideo, IsExHeader: true, FrameType: FrameKey, PacketType: PacketTypeCodedFrames, FourCC: FourCCAV1},
+			[]byte{0x91, 'a', 'v', '0', '1'},
+		},
+		{
+			"avc nalu",
+			Tag{Type: TagVideo, FrameType: FrameInter, CodecID: VideoH264, AVCPacketType: AvcNalu, CompositionTime: 40},
+			[]byte{0x27, 1, 0, 0, 40},
+		},
+		{
+			"h263 has no avc header",
+			Tag{Type: TagVideo, FrameType: FrameKey, CodecID: VideoH263},
+			[]byte{0x12, 0, 0, 0, 2},
+		},
+	} {
+		test.tag.Data = data
+		var buf bytes.Buffer
+		b := make([]byte, 256)
+		if err := WriteTag(&buf, test.tag, 1000, b); err != nil {
+			t.Fatal(test.name, err)
+		}
+		raw := buf.Bytes()
+		if got := raw[TagHeaderLength : TagHeaderLength+len(test.header)]; !bytes.Equal(got, test.header) {
+			t.Errorf("%s: header=%x, want %x", test.name, got, test.header)
+		}
+
+		tag, ts, err := ReadTag(bytes.NewReader(raw), b)
+		if err != nil {
+			t.Fatal(test.name, err)
+		}
+		if ts != 1000 || !bytes.Equal(tag.Data, data) {
+			t.Errorf("%s: ts=%d data=%x", test.name, ts, tag.Data)
+		}
+		if !reflect.DeepEqual(tag, test.tag) {
+			t.Errorf("%s: tag=%+v, want %+v", test.name, tag, test.tag)
+		}
+	}
+}
+
+func TestVideoExHeaderParseInvalid(t *testing.T) {
+	for _, b := range [][]byte{
+		{0x91, 'h', 'v', 'c'},
+		{0x91, 'h', 'v', 'c', '1', 0},
+	} {
+		tag := Tag{Type: TagVideo}
+		if _, err := tag.ParseHeader(b); err == nil {
+			t.Errorf("%x: parsed", b)
+		}
+	}
+}
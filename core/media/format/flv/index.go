@@ -0,0 +1,336 @@
+package flv
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/format/flv/flvio"
+)
+
+// IndexEntry is seek point, Pos is file offset of tag
+type IndexEntry struct {
+	Time time.Duration
+	Pos  int64
+}
+
+// audio only files are indexed at this interval
+const audioIndexInterval = time.Second
+
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read func
+func (inst *countReader) Read(p []byte) (n int, err error) {
+	n, err = inst.r.Read(p)
+	inst.n += int64(n)
+	return
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write func
+func (inst *countWriter) Write(p []byte) (n int, err error) {
+	n, err = inst.w.Write(p)
+	inst.n += int64(n)
+	return
+}
+
+// parseMetadata reads duration and keyframes index from onMetaData
+func (inst *Demuxer) parseMetadata(data []byte) {
+	name, n, err := flvio.ParseAMF0Val(data)
+	if err != nil || name != "onMetaData" {
+		return
+	}
+	val, _, err := flvio.ParseAMF0Val(data[n:])
+	if err != nil {
+		return
+	}
+	metadata, _ := val.(flvio.AMFMap)
+	if metadata == nil {
+		return
+	}
+
+	if duration, ok := metadata["duration"].(float64); ok {
+		inst.duration = time.Duration(duration * float64(time.Second))
+	}
+
+	keyframes, _ := metadata["keyframes"].(flvio.AMFMap)
+	if keyframes == nil {
+		return
+	}
+	times, _ := keyframes["times"].(flvio.AMFArray)
+	positions, _ := keyframes["filepositions"].(flvio.AMFArray)
+	if len(times) == 0 || len(times) != len(positions) {
+		return
+	}
+	index := make([]IndexEntry, 0, len(times))
+	for i := range times {
+		tm, ok1 := times[i].(float64)
+		pos, ok2 := positions[i].(float64)
+		if !ok1 || !ok2 {
+			return
+		}
+		index = append(index, IndexEntry{Time: time.Duration(tm * float64(time.Second)), Pos: int64(pos)})
+	}
+	inst.index = index
+}
+
+// Duration returns duration of onMetaData, 0 if unknown
+func (inst *Demuxer) Duration() (dur time.Duration, err error) {
+	if err = inst.prepare(); err != nil {
+		return
+	}
+	dur = inst.duration
+	return
+}
+
+// Index returns seek points, from onMetaData keyframes or by scanning tags
+func (inst *Demuxer) Index() (index []IndexEntry, err error) {
+	if err = inst.prepare(); err != nil {
+		return
+	}
+	if inst.index == nil {
+		if err = inst.buildIndex(); err != nil {
+			return
+		}
+	}
+	index = inst.index
+	return
+}
+
+// buildIndex scans tag headers for video keyframes, or audio tags when there is no video
+func (inst *Demuxer) buildIndex() (err error) {
+	if inst.rs == nil {
+		err = fmt.Errorf("flv: seek needs io.ReadSeeker")
+		return
+	}
+	savePos := inst.pos()
+	defer func() {
+		if serr := inst.seek(savePos); err == nil {
+			err = serr
+		}
+	}()
+
+	hasVideo := false
+	for _, stream := range inst.prober.Streams {
+		if stream.Type().IsVideo() {
+			hasVideo = true
+		}
+	}
+
+	index := []IndexEntry{}
+	b := make([]byte, flvio.TagHeaderLength+2)
+	pos := inst.dataPos
+	for {
+		if _, err = inst.rs.Seek(pos, io.SeekStart); err != nil {
+			return
+		}
+		if _, err = io.ReadFull(inst.rs, b); err != nil {
+			break
+		}
+		var tag flvio.Tag
+		var ts int32
+		var datalen int
+		if tag, ts, datalen, err = flvio.ParseTagHeader(b); err != nil {
+			break
+		}
+		tm := flvio.TsToTime(ts)
+
+		switch {
+		case hasVideo && tag.Type == flvio.TagVideo:
+			if isKeyFrameTag(b[flvio.TagHeaderLength:]) {
+				index = append(index, IndexEntry{Time: tm, Pos: pos})
+			}
+		case !hasVideo && tag.Type == flvio.TagAudio:
+			if len(index) == 0 || tm-index[len(index)-1].Time >= audioIndexInterval {
+				index = append(index, IndexEntry{Time: tm, Pos: pos})
+			}
+		}
+		pos += int64(flvio.TagHeaderLength + datalen + flvio.TagTrailerLength)
+	}
+	err = nil
+
+	inst.index = index
+	return
+}
+
+// isKeyFrameTag checks first two bytes of video tag data, sequence headers of h264 and hevc are not keyframes
+func isKeyFrameTag(b []byte) bool {
+	// frame type is in same bits for legacy and enhanced video tag
+	if (b[0]>>4)&0x7 != flvio.FrameKey {
+		return false
+	}
+	if b[0]&flvio.VideoIsExHeader != 0 {
+		packetType := b[0] & 0xf
+		return packetType == flvio.PacketTypeCodedFrames || packetType == flvio.PacketTypeCodedFramesX
+	}
+	if b[0]&0xf == flvio.VideoH264 {
+		return b[1] == flvio.AvcNalu
+	}
+	return true
+}
+
+func (inst *Demuxer) pos() int64 {
+	return inst.cr.n - int64(inst.bufr.Buffered())
+}
+
+func (inst *Demuxer) seek(pos int64) (err error) {
+	if _, err = inst.rs.Seek(pos, io.SeekStart); err != nil {
+		return
+	}
+	inst.cr.n = pos
+	inst.bufr.Reset(inst.cr)
+	return
+}
+
+// SeekToTime seeks to last seek point at or before tm, reader must be io.ReadSeeker
+func (inst *Demuxer) SeekToTime(tm time.Duration) (err error) {
+	var index []IndexEntry
+	if index, err = inst.Index(); err != nil {
+		return
+	}
+	if len(index) == 0 {
+		err = fmt.Errorf("flv: no seek point found")
+		return
+	}
+
+	entry := index[0]
+	for _, e := range index {
+		if e.Time > tm {
+			break
+		}
+		entry = e
+	}
+
+	if err = inst.seek(entry.Pos); err != nil {
+		return
+	}
+	inst.prober.CachedPkts = nil
+	return
+}
+
+// metadataTag makes onMetaData tag for keyframe index of muxer
+func (inst *Muxer) metadataTag(duration time.Duration, filesize int64, delta int64) (tag flvio.Tag, err error) {
+	var metadata flvio.AMFMap
+	if metadata, err = NewMetadataByStreams(inst.streams); err != nil {
+		return
+	}
+	metadata["duration"] = duration.Seconds()
+	metadata["filesize"] = float64(filesize)
+
+	if inst.indexed {
+		times := make(flvio.AMFArray, len(inst.index))
+		positions := make(flvio.AMFArray, len(inst.index))
+		for i, entry := range inst.index {
+			times[i] = entry.Time.Seconds()
+			positions[i] = float64(entry.Pos + delta)
+		}
+		metadata["keyframes"] = flvio.AMFMap{
+			"times":         times,
+			"filepositions": positions,
+		}
+	}
+
+	name := "onMetaData"
+	value := flvio.AMFECMAArray(metadata)
+	data := make([]byte, flvio.LenAMF0Val(name)+flvio.LenAMF0Val(value))
+	n := flvio.FillAMF0Val(data, name)
+	flvio.FillAMF0Val(data[n:], value)
+
+	tag = flvio.Tag{
+		Type: flvio.TagScriptdata,
+		Data: data,
+	}
+	return
+}
+
+// addIndex records seek point of packet which will be written at current position
+func (inst *Muxer) addIndex(pkt av.Packet, stream av.CodecData) {
+	typ := stream.Type()
+	if typ.IsAudio() {
+		if astream, ok := stream.(av.AudioCodecData); ok {
+			if dur, err := astream.PacketDuration(pkt.Data); err == nil && pkt.Time+dur > inst.duration {
+				inst.duration = pkt.Time + dur
+			}
+		}
+	}
+	if pkt.Time > inst.duration {
+		inst.duration = pkt.Time
+	}
+
+	var ok bool
+	if inst.hasVideo {
+		ok = typ.IsVideo() && pkt.IsKeyFrame
+	} else {
+		ok = len(inst.index) == 0 || pkt.Time-inst.index[len(inst.index)-1].Time >= audioIndexInterval
+	}
+	if ok {
+		inst.index = append(inst.index, IndexEntry{Time: pkt.Time, Pos: inst.cw.n})
+	}
+}
+
+// writeIndex replaces onMetaData written by WriteHeader, following tags are moved to make room for index
+func (inst *Muxer) writeIndex() (err error) {
+	inst.indexed = true
+	end := inst.cw.n
+	dataPos := inst.metaPos + inst.metaLen
+
+	var tag flvio.Tag
+	if tag, err = inst.metadataTag(0, 0, 0); err != nil {
+		return
+	}
+	// number values have fixed length, size is known before filling positions
+	delta := int64(flvio.TagHeaderLength+len(tag.Data)+flvio.TagTrailerLength) - inst.metaLen
+	if tag, err = inst.metadataTag(inst.duration, end+delta, delta); err != nil {
+		return
+	}
+
+	if err = shiftData(inst.rws, dataPos, end, delta); err != nil {
+		return
+	}
+	if _, err = inst.rws.Seek(inst.metaPos, io.SeekStart); err != nil {
+		return
+	}
+	if err = flvio.WriteTag(inst.rws, tag, 0, inst.b); err != nil {
+		return
+	}
+	if _, err = inst.rws.Seek(end+delta, io.SeekStart); err != nil {
+		return
+	}
+	return
+}
+
+// shiftData moves bytes in [start, end) forward by delta
+func shiftData(rws io.ReadWriteSeeker, start, end, delta int64) (err error) {
+	if delta == 0 {
+		return
+	}
+	buf := make([]byte, 64*1024)
+	for pos := end; pos > start; {
+		n := int64(len(buf))
+		if pos-start < n {
+			n = pos - start
+		}
+		pos -= n
+		if _, err = rws.Seek(pos, io.SeekStart); err != nil {
+			return
+		}
+		if _, err = io.ReadFull(rws, buf[:n]); err != nil {
+			return
+		}
+		if _, err = rws.Seek(pos+delta, io.SeekStart); err != nil {
+			return
+		}
+		if _, err = rws.Write(buf[:n]); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,248 @@
+package flv
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/aacparser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/h264parser"
+	"github.com/Youngju-Heo/gomedia/core/media/format/flv/flvio"
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
+)
+
+func testStreams(t *testing.T, video bool) (streams []av.CodecData) {
+	if video {
+		sps, _ := base64.StdEncoding.DecodeString("Z00AHpWoKA9k")
+		pps, _ := base64.StdEncoding.DecodeString("aO48gA==")
+		h264, err := h264parser.NewCodecDataFromSPSAndPPS(sps, pps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		streams = append(streams, h264)
+	}
+	aac, err := aacparser.NewCodecDataFromMPEG4AudioConfig(aacparser.MPEG4AudioConfig{
+		ObjectType:      aacparser.AotAACLc,
+		SampleRateIndex: 4,
+		ChannelConfig:   2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(streams, aac)
+}
+
+// testPackets makes 4 seconds of 25fps video with keyframe every second and 20ms audio,
+// audio only when video is false
+func testPackets(video bool) (pkts []av.Packet) {
+	audioIdx := int8(0)
+	if video {
+		audioIdx = 1
+	}
+	for i := 0; i < 200; i++ {
+		tm := time.Duration(i) * 20 * time.Millisecond
+		if video && i%2 == 0 {
+			data := make([]byte, 4+100)
+			pio.PutU32BE(data, 100)
+			data[4] = 0x41
+			keyframe := i%50 == 0
+			if keyframe {
+				data[4] = 0x65
+			}
+			pkts = append(pkts, av.Packet{Idx: 0, IsKeyFrame: keyframe, Time: tm, Data: data})
+		}
+		data := make([]byte, 50)
+		for j := range data {
+			data[j] = byte(i + j)
+		}
+		pkts = append(pkts, av.Packet{Idx: audioIdx, Time: tm, Data: data})
+	}
+	return
+}
+
+func testWriteFile(t *testing.T, video, index bool) string {
+	f, err := ioutil.TempFile("", "flvtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	muxer := NewMuxer(f)
+	muxer.KeyframeIndex = index
+	if err = muxer.WriteHeader(testStreams(t, video)); err != nil {
+		t.Fatal(err)
+	}
+	for _, pkt := range testPackets(video) {
+		if err = muxer.WritePacket(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func testIndexTimes() (times []time.Duration) {
+	for tm := time.Duration(0); tm < 4*time.Second; tm += time.Second {
+		times = append(times, tm)
+	}
+	return
+}
+
+func TestIndex(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		video bool
+		index bool
+	}{
+		{"metadata index", true, true},
+		{"tag scan", true, false},
+		{"audio only metadata index", false, true},
+		{"audio only tag scan", false, false},
+	} {
+		name := testWriteFile(t, test.video, test.index)
+		defer os.Remove(name)
+		testIndex(t, test.name, name, test.video, test.index)
+	}
+}
+
+func testIndex(t *testing.T, name, filename string, video, indexed bool) {
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	demuxer := NewDemuxer(f)
+	streams, err := demuxer.Streams()
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	if len(streams) != len(testStreams(t, video)) {
+		t.Fatalf("%s: streams=%d", name, len(streams))
+	}
+	if indexed != (demuxer.index != nil) {
+		t.Errorf("%s: onMetaData index=%v", name, demuxer.index != nil)
+	}
+
+	// all packets are readable after tags were moved for index
+	pkts := testPackets(video)
+	for i, want := range pkts {
+		pkt, err := demuxer.ReadPacket()
+		if err != nil {
+			t.Fatalf("%s: packet#%d: %v", name, i, err)
+		}
+		if pkt.Idx != want.Idx || pkt.Time != want.Time || !bytes.Equal(pkt.Data, want.Data) {
+			t.Fatalf("%s: packet#%d idx=%d time=%v", name, i, pkt.Idx, pkt.Time)
+		}
+	}
+	if _, err = demuxer.ReadPacket(); err != io.EOF {
+		t.Errorf("%s: read after last packet err=%v", name, err)
+	}
+
+	if indexed {
+		dur, _ := demuxer.Duration()
+		last := pkts[len(pkts)-1].Time + 1024*time.Second/44100
+		if diff := dur - last; diff < -time.Millisecond || diff > time.Millisecond {
+			t.Errorf("%s: duration=%v, want %v", name, dur, last)
+		}
+	}
+
+	index, err := demuxer.Index()
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	times := testIndexTimes()
+	if len(index) != len(times) {
+		t.Fatalf("%s: index=%v", name, index)
+	}
+	b := make([]byte, flvio.TagHeaderLength+2)
+	for i, entry := range index {
+		if diff := entry.Time - times[i]; diff < -time.Millisecond || diff > time.Millisecond {
+			t.Errorf("%s: index#%d time=%v, want %v", name, i, entry.Time, times[i])
+		}
+		if _, err = f.ReadAt(b, entry.Pos); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		tag, _, _, err := flvio.ParseTagHeader(b)
+		if err != nil {
+			t.Fatalf("%s: index#%d pos=%d: %v", name, i, entry.Pos, err)
+		}
+		if video && (tag.Type != flvio.TagVideo || !isKeyFrameTag(b[flvio.TagHeaderLength:])) {
+			t.Errorf("%s: index#%d is not keyframe tag", name, i)
+		}
+		if !video && tag.Type != flvio.TagAudio {
+			t.Errorf("%s: index#%d is not audio tag", name, i)
+		}
+	}
+
+	for _, test := range []struct {
+		seek time.Duration
+		want time.Duration
+	}{
+		{2500 * time.Millisecond, 2 * time.Second},
+		{time.Second, time.Second},
+		{0, 0},
+		{10 * time.Second, 3 * time.Second},
+	} {
+		if err = demuxer.SeekToTime(test.seek); err != nil {
+			t.Fatalf("%s: seek %v: %v", name, test.seek, err)
+		}
+		pkt, err := demuxer.ReadPacket()
+		if err != nil {
+			t.Fatalf("%s: seek %v: %v", name, test.seek, err)
+		}
+		if pkt.Time != test.want || (video && (pkt.Idx != 0 || !pkt.IsKeyFrame)) {
+			t.Errorf("%s: seek %v got idx=%d time=%v keyframe=%v", name, test.seek, pkt.Idx, pkt.Time, pkt.IsKeyFrame)
+		}
+	}
+}
+
+func TestShiftData(t *testing.T) {
+	for _, test := range []struct {
+		size       int
+		start, end int64
+		delta      int64
+	}{
+		{100, 10, 100, 7},
+		{100, 0, 50, 0},
+		// larger than copy buffer
+		{200 * 1024, 13, 200 * 1024, 1000},
+	} {
+		f, err := ioutil.TempFile("", "flvtest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := make([]byte, test.size)
+		for i := range data {
+			data[i] = byte(i * 7)
+		}
+		if _, err = f.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err = shiftData(f, test.start, test.end, test.delta); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadFile(f.Name())
+		f.Close()
+		os.Remove(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := append([]byte{}, data...)
+		if int(test.end+test.delta) > len(want) {
+			want = append(want, make([]byte, int(test.end+test.delta)-len(want))...)
+		}
+		copy(want[test.start+test.delta:], data[test.start:test.end])
+		if !bytes.Equal(got, want) {
+			t.Errorf("shift [%d,%d) by %d: mismatch", test.start, test.end, test.delta)
+		}
+	}
+}
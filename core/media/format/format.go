@@ -4,6 +4,7 @@ import (
 	"github.com/Youngju-Heo/gomedia/core/media/av/avutil"
 	"github.com/Youngju-Heo/gomedia/core/media/format/aac"
 	"github.com/Youngju-Heo/gomedia/core/media/format/flv"
+	"github.com/Youngju-Heo/gomedia/core/media/format/hls"
 	"github.com/Youngju-Heo/gomedia/core/media/format/mp4"
 	"github.com/Youngju-Heo/gomedia/core/media/format/rtmp"
 	"github.com/Youngju-Heo/gomedia/core/media/format/rtsp"
@@ -18,4 +19,5 @@ func RegisterAll() {
 	avutil.DefaultHandlers.Add(rtsp.Handler)
 	avutil.DefaultHandlers.Add(flv.Handler)
 	avutil.DefaultHandlers.Add(aac.Handler)
+	avutil.DefaultHandlers.Add(hls.Handler)
 }
@@ -0,0 +1,391 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/av/avutil"
+	"github.com/Youngju-Heo/gomedia/core/media/format/mp4"
+	"github.com/Youngju-Heo/gomedia/core/media/format/ts"
+)
+
+// Client reads hls stream as demuxer.
+// Segments are read sequentially and packet time starts from 0, continuing across segments.
+type Client struct {
+	// MaxBandwidth selects variant of master playlist, 0 selects highest bandwidth
+	MaxBandwidth int
+	HTTPClient   *http.Client
+
+	uri      *url.URL
+	playlist *MediaPlaylist
+	loadTime time.Time
+	changed  bool
+	seqnum   int
+	started  bool
+	streams  []av.CodecData
+
+	segment    av.Demuxer
+	body       io.Closer
+	segFirst   bool
+	rebased    bool
+	segStart   time.Duration
+	segDisc    bool
+	segEnd     time.Duration
+	timeOffset time.Duration
+
+	initURI  string
+	initData []byte
+
+	// ctx is canceled by Close, which interrupts http requests and playlist reload wait
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewClient func, playlist is loaded on first Streams or ReadPacket
+func NewClient(uri string) (client *Client, err error) {
+	client = &Client{
+		HTTPClient: http.DefaultClient,
+		changed:    true,
+	}
+	client.ctx, client.cancel = context.WithCancel(context.Background())
+	if client.uri, err = url.Parse(uri); err != nil {
+		return
+	}
+	return
+}
+
+// Dial opens master or media playlist of uri
+func Dial(uri string) (client *Client, err error) {
+	if client, err = NewClient(uri); err != nil {
+		return
+	}
+	err = client.prepare()
+	return
+}
+
+func (client *Client) prepare() (err error) {
+	if client.playlist == nil {
+		err = client.loadPlaylist()
+	}
+	return
+}
+
+func (client *Client) get(u *url.URL) (body io.ReadCloser, err error) {
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(client.ctx, "GET", u.String(), nil); err != nil {
+		return
+	}
+	var res *http.Response
+	if res, err = client.HTTPClient.Do(req); err != nil {
+		return
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		err = fmt.Errorf("hls: get %s failed: %s", u, res.Status)
+		return
+	}
+	body = res.Body
+	return
+}
+
+func (client *Client) resolve(ref string) (u *url.URL, err error) {
+	if u, err = url.Parse(ref); err != nil {
+		return
+	}
+	u = client.uri.ResolveReference(u)
+	return
+}
+
+// loadPlaylist loads media playlist, master playlist is followed to selected variant
+func (client *Client) loadPlaylist() (err error) {
+	for {
+		var body io.ReadCloser
+		if body, err = client.get(client.uri); err != nil {
+			return
+		}
+		var master *MasterPlaylist
+		var media *MediaPlaylist
+		master, media, err = ParsePlaylist(body)
+		body.Close()
+		if err != nil {
+			return
+		}
+		client.loadTime = time.Now()
+
+		if media != nil {
+			client.playlist = media
+			return
+		}
+
+		variant, ok := client.selectVariant(master)
+		if !ok {
+			err = fmt.Errorf("hls: no variant found in %s", client.uri)
+			return
+		}
+		if client.uri, err = client.resolve(variant.URI); err != nil {
+			return
+		}
+	}
+}
+
+func (client *Client) selectVariant(master *MasterPlaylist) (variant Variant, ok bool) {
+	for _, v := range master.Variants {
+		if client.MaxBandwidth > 0 && v.Bandwidth > client.MaxBandwidth {
+			continue
+		}
+		if !ok || v.Bandwidth > variant.Bandwidth {
+			variant, ok = v, true
+		}
+	}
+	if !ok && len(master.Variants) > 0 {
+		// nothing fits, use lowest one
+		variant, ok = master.Variants[0], true
+		for _, v := range master.Variants {
+			if v.Bandwidth < variant.Bandwidth {
+				variant = v
+			}
+		}
+	}
+	return
+}
+
+// nextSegment waits for next segment in playlist, live playlist is reloaded when needed
+func (client *Client) nextSegment() (seg Segment, err error) {
+	for {
+		pl := client.playlist
+		if !client.started {
+			client.started = true
+			client.seqnum = pl.MediaSequence
+			if !pl.Ended && len(pl.Segments) > 3 {
+				// live stream starts from third last segment
+				client.seqnum = pl.MediaSequence + len(pl.Segments) - 3
+			}
+		}
+		if client.seqnum < pl.MediaSequence {
+			// segments expired while reading
+			client.seqnum = pl.MediaSequence
+			client.segDisc = true
+		}
+
+		if i := client.seqnum - pl.MediaSequence; i < len(pl.Segments) {
+			seg = pl.Segments[i]
+			client.seqnum++
+			return
+		}
+		if pl.Ended {
+			err = io.EOF
+			return
+		}
+		if client.isClosed() {
+			err = io.EOF
+			return
+		}
+
+		// reload after target duration, or half of it when last reload got nothing new
+		wait := pl.TargetDuration
+		if !client.changed {
+			wait /= 2
+		}
+		if elapsed := time.Since(client.loadTime); elapsed < wait {
+			timer := time.NewTimer(wait - elapsed)
+			select {
+			case <-timer.C:
+			case <-client.ctx.Done():
+				timer.Stop()
+				err = io.EOF
+				return
+			}
+		}
+		if err = client.loadPlaylist(); err != nil {
+			return
+		}
+		client.changed = client.playlist.MediaSequence+len(client.playlist.Segments) > client.seqnum
+	}
+}
+
+func isFragmentedSegment(seg Segment) bool {
+	if seg.MapURI != "" {
+		return true
+	}
+	u, err := url.Parse(seg.URI)
+	if err != nil {
+		return false
+	}
+	ext := strings.ToLower(path.Ext(u.Path))
+	return ext == ".mp4" || ext == ".m4s"
+}
+
+func (client *Client) openSegment() (err error) {
+	if err = client.prepare(); err != nil {
+		return
+	}
+	var seg Segment
+	if seg, err = client.nextSegment(); err != nil {
+		return
+	}
+
+	var u *url.URL
+	if u, err = client.resolve(seg.URI); err != nil {
+		return
+	}
+	var body io.ReadCloser
+	if body, err = client.get(u); err != nil {
+		return
+	}
+
+	if isFragmentedSegment(seg) {
+		// mp4 demuxer needs init section and seekable reader
+		defer body.Close()
+		if seg.MapURI != client.initURI {
+			if err = client.loadInit(seg.MapURI); err != nil {
+				return
+			}
+		}
+		var data []byte
+		if data, err = ioutil.ReadAll(body); err != nil {
+			return
+		}
+		data = append(append([]byte{}, client.initData...), data...)
+		client.segment = mp4.NewDemuxer(bytes.NewReader(data))
+	} else {
+		client.segment = ts.NewDemuxer(body)
+		client.body = body
+	}
+
+	if client.streams == nil {
+		if client.streams, err = client.segment.Streams(); err != nil {
+			return
+		}
+	}
+
+	client.segFirst = true
+	client.segDisc = client.segDisc || seg.Discontinuity
+	client.segStart = client.segEnd
+	client.segEnd += seg.Duration
+	return
+}
+
+func (client *Client) loadInit(ref string) (err error) {
+	client.initURI = ref
+	client.initData = nil
+	if ref == "" {
+		return
+	}
+	var u *url.URL
+	if u, err = client.resolve(ref); err != nil {
+		return
+	}
+	var body io.ReadCloser
+	if body, err = client.get(u); err != nil {
+		return
+	}
+	defer body.Close()
+	client.initData, err = ioutil.ReadAll(body)
+	return
+}
+
+func (client *Client) closeSegment() {
+	if client.body != nil {
+		client.body.Close()
+		client.body = nil
+	}
+	client.segment = nil
+}
+
+// Streams func
+func (client *Client) Streams() (streams []av.CodecData, err error) {
+	if client.streams == nil {
+		if err = client.openSegment(); err != nil {
+			return
+		}
+	}
+	streams = client.streams
+	return
+}
+
+// ReadPacket func, it returns io.EOF after Close
+func (client *Client) ReadPacket() (pkt av.Packet, err error) {
+	for {
+		if client.isClosed() {
+			client.closeSegment()
+			err = io.EOF
+			return
+		}
+		if client.segment == nil {
+			if err = client.openSegment(); err != nil {
+				if client.isClosed() {
+					err = io.EOF
+				}
+				return
+			}
+		}
+		if pkt, err = client.segment.ReadPacket(); err != nil {
+			client.closeSegment()
+			if err == io.EOF || client.isClosed() {
+				continue
+			}
+			return
+		}
+
+		if client.segFirst {
+			client.segFirst = false
+			client.rebase(pkt.Time)
+		}
+		pkt.Time += client.timeOffset
+		if pkt.Time < 0 {
+			pkt.Time = 0
+		}
+		return
+	}
+}
+
+// rebase maps first packet time of segment to playlist time,
+// offset is kept unless stream is discontinuous
+func (client *Client) rebase(tm time.Duration) {
+	tolerance := client.playlist.TargetDuration
+	if tolerance < time.Second {
+		tolerance = time.Second
+	}
+	diff := tm + client.timeOffset - client.segStart
+	if !client.rebased || client.segDisc || diff > tolerance || diff < -tolerance {
+		client.timeOffset = client.segStart - tm
+	}
+	client.rebased = true
+	client.segDisc = false
+}
+
+func (client *Client) isClosed() bool {
+	return client.ctx.Err() != nil
+}
+
+// Close func, it may be called from another goroutine to stop blocked ReadPacket,
+// segment being read is then released by ReadPacket
+func (client *Client) Close() (err error) {
+	client.cancel()
+	return
+}
+
+// Handler func
+func Handler(h *avutil.RegisterHandler) {
+	h.URLDemuxer = func(uri string) (ok bool, demuxer av.DemuxCloser, err error) {
+		if !strings.HasPrefix(uri, "http://") && !strings.HasPrefix(uri, "https://") {
+			return
+		}
+		u, _ := url.Parse(uri)
+		if u == nil || path.Ext(u.Path) != ".m3u8" {
+			return
+		}
+		ok = true
+		demuxer, err = Dial(uri)
+		return
+	}
+}
@@ -0,0 +1,242 @@
+package hls
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/format/mp4"
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
+)
+
+func readAllPackets(t *testing.T, client *Client) (nvideo, naudio int, last time.Duration) {
+	streams, err := client.Streams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 2 {
+		t.Fatalf("streams=%d", len(streams))
+	}
+	lastTimes := make([]time.Duration, len(streams))
+	for {
+		pkt, err := client.ReadPacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pkt.Time < lastTimes[pkt.Idx] {
+			t.Fatalf("stream#%d time=%v < last=%v", pkt.Idx, pkt.Time, lastTimes[pkt.Idx])
+		}
+		lastTimes[pkt.Idx] = pkt.Time
+		if streams[pkt.Idx].Type().IsVideo() {
+			if nvideo == 0 && (!pkt.IsKeyFrame || pkt.Time > 100*time.Millisecond) {
+				t.Fatalf("first video packet time=%v keyframe=%v", pkt.Time, pkt.IsKeyFrame)
+			}
+			nvideo++
+			last = pkt.Time
+		} else {
+			naudio++
+		}
+	}
+	return
+}
+
+func TestClientTS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	seg := NewSegmenter(dir)
+	seg.TargetDuration = 2 * time.Second
+	seg.PlaylistSize = 0
+	writeTestPackets(t, seg)
+
+	// high bandwidth variant does not exist, so only selecting low one works
+	master := "#EXTM3U\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=800000,CODECS=\"avc1.4d401e,mp4a.40.2\"\nhigh/index.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=200000\nindex.m3u8\n"
+	ioutil.WriteFile(filepath.Join(dir, "master.m3u8"), []byte(master), 0644)
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	client, err := NewClient(server.URL + "/master.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.MaxBandwidth = 500000
+	defer client.Close()
+
+	nvideo, naudio, last := readAllPackets(t, client)
+	if nvideo != 250 || naudio < 200 {
+		t.Fatalf("video=%d audio=%d", nvideo, naudio)
+	}
+	if last != 249*40*time.Millisecond {
+		t.Fatalf("last video time=%v", last)
+	}
+}
+
+func TestClientLive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	seg := NewSegmenter(dir)
+	seg.TargetDuration = time.Second
+	seg.PlaylistSize = 0
+	writeTestPackets(t, seg)
+
+	// first request gets part of segments, second one gets all
+	var lock sync.Mutex
+	reloads := 0
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.Dir(dir)))
+	mux.HandleFunc("/live.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		reloads++
+		n := reloads
+		lock.Unlock()
+
+		pl := MediaPlaylist{TargetDuration: time.Second, Ended: n > 1}
+		for i := 0; i < 10 && (i < 3 || pl.Ended); i++ {
+			pl.Segments = append(pl.Segments, Segment{URI: fmt.Sprintf("segment%d.ts", i), Duration: time.Second})
+		}
+		w.Write(pl.Marshal())
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := Dial(server.URL + "/live.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	nvideo, _, last := readAllPackets(t, client)
+	if nvideo != 250 || last != 249*40*time.Millisecond {
+		t.Fatalf("video=%d last=%v", nvideo, last)
+	}
+	if reloads != 2 {
+		t.Fatalf("reloads=%d", reloads)
+	}
+}
+
+func TestClientFragmentedMP4(t *testing.T) {
+	buf := &bytes.Buffer{}
+	muxer := mp4.NewFragMuxer(buf)
+	writeTestPackets(t, muxer)
+
+	// split into init section and one segment per moof+mdat
+	files := map[string][]byte{}
+	pl := MediaPlaylist{TargetDuration: time.Second, Ended: true}
+	b := buf.Bytes()
+	start := 0
+	for pos := 0; pos < len(b); {
+		size := int(pio.U32BE(b[pos:]))
+		tag := string(b[pos+4 : pos+8])
+		pos += size
+		switch tag {
+		case "moov":
+			files["/init.mp4"] = b[start:pos]
+			start = pos
+		case "mdat":
+			name := fmt.Sprintf("frag%d.m4s", len(pl.Segments))
+			files["/"+name] = b[start:pos]
+			pl.Segments = append(pl.Segments, Segment{URI: name, Duration: time.Second, MapURI: "init.mp4"})
+			start = pos
+		}
+	}
+	files["/index.m3u8"] = pl.Marshal()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	client, err := Dial(server.URL + "/index.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	nvideo, naudio, last := readAllPackets(t, client)
+	if len(pl.Segments) != 10 || nvideo != 250 || naudio < 200 || last != 249*40*time.Millisecond {
+		t.Fatalf("segments=%d video=%d audio=%d last=%v", len(pl.Segments), nvideo, naudio, last)
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	seg := NewSegmenter(dir)
+	seg.TargetDuration = time.Second
+	seg.PlaylistSize = 0
+	writeTestPackets(t, seg)
+
+	// live playlist never grows, reader waits for reload
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.Dir(dir)))
+	mux.HandleFunc("/live.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		pl := MediaPlaylist{TargetDuration: 30 * time.Second}
+		for i := 0; i < 3; i++ {
+			pl.Segments = append(pl.Segments, Segment{URI: fmt.Sprintf("segment%d.ts", i), Duration: time.Second})
+		}
+		w.Write(pl.Marshal())
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := Dial(server.URL + "/live.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Streams(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		for {
+			if _, err := client.ReadPacket(); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+	time.Sleep(200 * time.Millisecond)
+	client.Close()
+
+	select {
+	case err = <-done:
+		if err != io.EOF {
+			t.Errorf("err=%v, want io.EOF", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ReadPacket not interrupted by Close")
+	}
+	if _, err = client.ReadPacket(); err != io.EOF {
+		t.Errorf("err=%v after close", err)
+	}
+}
@@ -0,0 +1,244 @@
+package hls
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PlaylistType values of EXT-X-PLAYLIST-TYPE
+const (
+	PlaylistTypeVOD   = "VOD"
+	PlaylistTypeEvent = "EVENT"
+)
+
+// Segment type
+type Segment struct {
+	URI           string
+	Duration      time.Duration
+	Sequence      int
+	Discontinuity bool
+	// MapURI is EXT-X-MAP initialization section, used by fmp4 segments
+	MapURI string
+}
+
+// MediaPlaylist type
+type MediaPlaylist struct {
+	Version        int
+	TargetDuration time.Duration
+	MediaSequence  int
+	PlaylistType   string
+	Segments       []Segment
+	Ended          bool
+}
+
+// Duration returns total duration of segments in playlist
+func (pl *MediaPlaylist) Duration() (dur time.Duration) {
+	for _, seg := range pl.Segments {
+		dur += seg.Duration
+	}
+	return
+}
+
+// Marshal writes playlist as m3u8 text
+func (pl *MediaPlaylist) Marshal() []byte {
+	b := &bytes.Buffer{}
+	version := pl.Version
+	if version == 0 {
+		version = 3
+	}
+
+	// target duration must not be less than any segment duration rounded to nearest integer,
+	// writer of live playlist keeps it in TargetDuration as it must not change
+	target := int(math.Ceil(pl.TargetDuration.Seconds()))
+	for _, seg := range pl.Segments {
+		if n := roundSeconds(seg.Duration); n > target {
+			target = n
+		}
+	}
+
+	fmt.Fprintf(b, "#EXTM3U\n")
+	fmt.Fprintf(b, "#EXT-X-VERSION:%d\n", version)
+	fmt.Fprintf(b, "#EXT-X-TARGETDURATION:%d\n", target)
+	fmt.Fprintf(b, "#EXT-X-MEDIA-SEQUENCE:%d\n", pl.MediaSequence)
+	if pl.PlaylistType != "" {
+		fmt.Fprintf(b, "#EXT-X-PLAYLIST-TYPE:%s\n", pl.PlaylistType)
+	}
+	mapURI := ""
+	for _, seg := range pl.Segments {
+		if seg.MapURI != mapURI {
+			mapURI = seg.MapURI
+			fmt.Fprintf(b, "#EXT-X-MAP:URI=\"%s\"\n", mapURI)
+		}
+		if seg.Discontinuity {
+			fmt.Fprintf(b, "#EXT-X-DISCONTINUITY\n")
+		}
+		fmt.Fprintf(b, "#EXTINF:%.3f,\n", seg.Duration.Seconds())
+		fmt.Fprintf(b, "%s\n", seg.URI)
+	}
+	if pl.Ended {
+		fmt.Fprintf(b, "#EXT-X-ENDLIST\n")
+	}
+	return b.Bytes()
+}
+
+// roundSeconds rounds segment duration to nearest integer as EXT-X-TARGETDURATION is compared with it
+func roundSeconds(dur time.Duration) int {
+	return int(math.Floor(dur.Seconds() + 0.5))
+}
+
+// Variant is one EXT-X-STREAM-INF entry of master playlist
+type Variant struct {
+	URI        string
+	Bandwidth  int
+	Codecs     string
+	Resolution string
+}
+
+// MasterPlaylist type
+type MasterPlaylist struct {
+	Variants []Variant
+}
+
+// ParsePlaylist parses m3u8, either master or media playlist is returned
+func ParsePlaylist(r io.Reader) (master *MasterPlaylist, media *MediaPlaylist, err error) {
+	scanner := bufio.NewScanner(r)
+	first := true
+	var seg Segment
+	var variant *Variant
+	mapURI := ""
+	pl := &MediaPlaylist{}
+	mpl := &MasterPlaylist{}
+	isMaster := false
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if first {
+			if line != "#EXTM3U" {
+				err = fmt.Errorf("hls: #EXTM3U not found")
+				return
+			}
+			first = false
+			continue
+		}
+		if line == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "#") {
+			if variant != nil {
+				variant.URI = line
+				mpl.Variants = append(mpl.Variants, *variant)
+				variant = nil
+			} else {
+				seg.URI = line
+				seg.MapURI = mapURI
+				seg.Sequence = pl.MediaSequence + len(pl.Segments)
+				pl.Segments = append(pl.Segments, seg)
+				seg = Segment{}
+			}
+			continue
+		}
+
+		tag, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			tag, value = line[:i], line[i+1:]
+		}
+
+		switch tag {
+		case "#EXT-X-VERSION":
+			pl.Version, _ = strconv.Atoi(value)
+		case "#EXT-X-TARGETDURATION":
+			var n int
+			if n, err = strconv.Atoi(value); err != nil {
+				err = fmt.Errorf("hls: invalid #EXT-X-TARGETDURATION: %s", value)
+				return
+			}
+			pl.TargetDuration = time.Duration(n) * time.Second
+		case "#EXT-X-MEDIA-SEQUENCE":
+			if pl.MediaSequence, err = strconv.Atoi(value); err != nil {
+				err = fmt.Errorf("hls: invalid #EXT-X-MEDIA-SEQUENCE: %s", value)
+				return
+			}
+		case "#EXT-X-PLAYLIST-TYPE":
+			pl.PlaylistType = value
+		case "#EXT-X-ENDLIST":
+			pl.Ended = true
+		case "#EXT-X-DISCONTINUITY":
+			seg.Discontinuity = true
+		case "#EXT-X-MAP":
+			mapURI = parseAttributes(value)["URI"]
+		case "#EXTINF":
+			if i := strings.Index(value, ","); i >= 0 {
+				value = value[:i]
+			}
+			var f float64
+			if f, err = strconv.ParseFloat(value, 64); err != nil {
+				err = fmt.Errorf("hls: invalid #EXTINF: %s", value)
+				return
+			}
+			seg.Duration = time.Duration(f * float64(time.Second))
+		case "#EXT-X-STREAM-INF":
+			isMaster = true
+			attrs := parseAttributes(value)
+			variant = &Variant{
+				Codecs:     attrs["CODECS"],
+				Resolution: attrs["RESOLUTION"],
+			}
+			variant.Bandwidth, _ = strconv.Atoi(attrs["BANDWIDTH"])
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	if first {
+		err = fmt.Errorf("hls: empty playlist")
+		return
+	}
+
+	if isMaster {
+		master = mpl
+	} else {
+		media = pl
+	}
+	return
+}
+
+// parseAttributes parses attribute list like BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2"
+func parseAttributes(s string) map[string]string {
+	attrs := map[string]string{}
+	for len(s) > 0 {
+		i := strings.Index(s, "=")
+		if i < 0 {
+			break
+		}
+		key := strings.TrimSpace(s[:i])
+		s = s[i+1:]
+
+		var value string
+		if strings.HasPrefix(s, "\"") {
+			end := strings.Index(s[1:], "\"")
+			if end < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:end+1], s[end+2:]
+			}
+			if i = strings.Index(s, ","); i >= 0 {
+				s = s[i+1:]
+			} else {
+				s = ""
+			}
+		} else if i = strings.Index(s, ","); i >= 0 {
+			value, s = s[:i], s[i+1:]
+		} else {
+			value, s = s, ""
+		}
+		attrs[key] = value
+	}
+	return attrs
+}
@@ -0,0 +1,230 @@
+package hls
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/av/avutil"
+	"github.com/Youngju-Heo/gomedia/core/media/format/ts"
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
+)
+
+// Segmenter writes mpeg-ts segments and m3u8 playlist into directory.
+// Segments are cut on keyframes of first video stream once TargetDuration is reached,
+// or on any packet when there is no video.
+type Segmenter struct {
+	TargetDuration time.Duration
+	// PlaylistSize is number of segments in live playlist, 0 keeps all segments and writes VOD playlist
+	PlaylistSize int
+	PlaylistName string
+	// SegmentName is printf format of segment file name taking sequence number
+	SegmentName string
+
+	dir      string
+	muxer    *ts.Muxer
+	file     *os.File
+	bufw     *bufio.Writer
+	playlist MediaPlaylist
+	expired  []Segment
+	videoIdx int
+	seqnum   int
+
+	started   bool
+	segStart  time.Duration
+	endTime   time.Duration
+	lastTimes []time.Duration
+	lastDurs  []time.Duration
+}
+
+// NewSegmenter func
+func NewSegmenter(dir string) *Segmenter {
+	return &Segmenter{
+		TargetDuration: 6 * time.Second,
+		PlaylistSize:   5,
+		PlaylistName:   "index.m3u8",
+		SegmentName:    "segment%d.ts",
+		dir:            dir,
+	}
+}
+
+// Segment reads all packets from demuxer, such as pubsub.QueueCursor, and segments them
+func (inst *Segmenter) Segment(demuxer av.Demuxer) (err error) {
+	return avutil.CopyFile(inst, demuxer)
+}
+
+// WriteHeader func
+func (inst *Segmenter) WriteHeader(streams []av.CodecData) (err error) {
+	inst.muxer = ts.NewMuxer(ioutil.Discard)
+	if err = inst.muxer.WriteHeader(streams); err != nil {
+		return
+	}
+
+	inst.videoIdx = -1
+	for i, stream := range streams {
+		if stream.Type().IsVideo() {
+			inst.videoIdx = i
+			break
+		}
+	}
+	inst.lastTimes = make([]time.Duration, len(streams))
+	inst.lastDurs = make([]time.Duration, len(streams))
+	for i := range inst.lastTimes {
+		inst.lastTimes[i] = -1
+	}
+
+	inst.playlist = MediaPlaylist{
+		TargetDuration: inst.TargetDuration,
+	}
+	if inst.PlaylistSize == 0 {
+		inst.playlist.PlaylistType = PlaylistTypeEvent
+	}
+	return
+}
+
+func (inst *Segmenter) isSegmentStart(pkt av.Packet) bool {
+	if pkt.Time-inst.segStart < inst.TargetDuration {
+		return false
+	}
+	if inst.videoIdx >= 0 {
+		return int(pkt.Idx) == inst.videoIdx && pkt.IsKeyFrame
+	}
+	return true
+}
+
+// WritePacket func
+func (inst *Segmenter) WritePacket(pkt av.Packet) (err error) {
+	if int(pkt.Idx) >= len(inst.lastTimes) {
+		err = fmt.Errorf("hls: stream#%d not found", pkt.Idx)
+		return
+	}
+
+	if !inst.started {
+		if inst.videoIdx >= 0 && (int(pkt.Idx) != inst.videoIdx || !pkt.IsKeyFrame) {
+			// segment must start with keyframe
+			return
+		}
+		if err = inst.openSegment(pkt.Time); err != nil {
+			return
+		}
+		inst.started = true
+	} else if inst.isSegmentStart(pkt) {
+		if err = inst.closeSegment(pkt.Time); err != nil {
+			return
+		}
+		if err = inst.openSegment(pkt.Time); err != nil {
+			return
+		}
+	}
+
+	if err = inst.muxer.WritePacket(pkt); err != nil {
+		return
+	}
+
+	if last := inst.lastTimes[pkt.Idx]; last >= 0 && pkt.Time > last {
+		inst.lastDurs[pkt.Idx] = pkt.Time - last
+	}
+	inst.lastTimes[pkt.Idx] = pkt.Time
+	if end := pkt.Time + inst.lastDurs[pkt.Idx]; end > inst.endTime {
+		inst.endTime = end
+	}
+	return
+}
+
+// WriteTrailer closes last segment and ends playlist
+func (inst *Segmenter) WriteTrailer() (err error) {
+	inst.playlist.Ended = true
+	if inst.PlaylistSize == 0 {
+		inst.playlist.PlaylistType = PlaylistTypeVOD
+	}
+	if inst.file != nil {
+		if err = inst.closeSegment(inst.endTime); err != nil {
+			return
+		}
+	} else {
+		err = inst.writePlaylist()
+	}
+	return
+}
+
+func (inst *Segmenter) openSegment(tm time.Duration) (err error) {
+	name := fmt.Sprintf(inst.SegmentName, inst.seqnum)
+	if inst.file, err = os.Create(filepath.Join(inst.dir, name)); err != nil {
+		return
+	}
+	if inst.bufw == nil {
+		inst.bufw = bufio.NewWriterSize(inst.file, pio.RecommendBufioSize)
+	} else {
+		inst.bufw.Reset(inst.file)
+	}
+	inst.muxer.SetWriter(inst.bufw)
+	if err = inst.muxer.WritePATPMT(); err != nil {
+		return
+	}
+	inst.segStart = tm
+	return
+}
+
+func (inst *Segmenter) closeSegment(tm time.Duration) (err error) {
+	if err = inst.bufw.Flush(); err != nil {
+		return
+	}
+	if err = inst.file.Close(); err != nil {
+		return
+	}
+	inst.file = nil
+
+	dur := tm - inst.segStart
+	inst.playlist.Segments = append(inst.playlist.Segments, Segment{
+		URI:      fmt.Sprintf(inst.SegmentName, inst.seqnum),
+		Duration: dur,
+		Sequence: inst.seqnum,
+	})
+	// target duration must not shrink when long segment leaves playlist
+	if target := time.Duration(roundSeconds(dur)) * time.Second; target > inst.playlist.TargetDuration {
+		inst.playlist.TargetDuration = target
+	}
+	inst.seqnum++
+
+	if inst.PlaylistSize > 0 && len(inst.playlist.Segments) > inst.PlaylistSize {
+		n := len(inst.playlist.Segments) - inst.PlaylistSize
+		inst.expired = append(inst.expired, inst.playlist.Segments[:n]...)
+		inst.playlist.Segments = append([]Segment{}, inst.playlist.Segments[n:]...)
+		inst.playlist.MediaSequence += n
+	}
+
+	if err = inst.writePlaylist(); err != nil {
+		return
+	}
+	err = inst.removeExpired()
+	return
+}
+
+// removeExpired deletes segments removed from playlist,
+// the latest PlaylistSize of them are kept for clients still loading previous playlist
+func (inst *Segmenter) removeExpired() (err error) {
+	for len(inst.expired) > inst.PlaylistSize {
+		seg := inst.expired[0]
+		if err = os.Remove(filepath.Join(inst.dir, seg.URI)); err != nil && !os.IsNotExist(err) {
+			return
+		}
+		err = nil
+		inst.expired = inst.expired[1:]
+	}
+	return
+}
+
+// writePlaylist replaces playlist file atomically
+func (inst *Segmenter) writePlaylist() (err error) {
+	name := filepath.Join(inst.dir, inst.PlaylistName)
+	tmp := name + ".tmp"
+	if err = ioutil.WriteFile(tmp, inst.playlist.Marshal(), 0644); err != nil {
+		return
+	}
+	err = os.Rename(tmp, name)
+	return
+}
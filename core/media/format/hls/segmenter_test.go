@@ -0,0 +1,168 @@
+package hls
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/aacparser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/h264parser"
+)
+
+func testStreams(t *testing.T) []av.CodecData {
+	sps, _ := base64.StdEncoding.DecodeString("Z00AHpWoKA9k")
+	pps, _ := base64.StdEncoding.DecodeString("aO48gA==")
+	h264, err := h264parser.NewCodecDataFromSPSAndPPS(sps, pps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aac, err := aacparser.NewCodecDataFromMPEG4AudioConfig(aacparser.MPEG4AudioConfig{
+		ObjectType:      aacparser.AotAACLc,
+		SampleRateIndex: 4,
+		ChannelConfig:   2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []av.CodecData{h264, aac}
+}
+
+// writeTestPackets writes 25fps video with keyframe every 1s and audio for 10s
+func writeTestPackets(t *testing.T, muxer av.Muxer) {
+	if err := muxer.WriteHeader(testStreams(t)); err != nil {
+		t.Fatal(err)
+	}
+	audioDur := 1024 * time.Second / 44100
+	var atime time.Duration
+	for i := 0; i < 250; i++ {
+		vtime := time.Duration(i) * 40 * time.Millisecond
+		for ; atime < vtime; atime += audioDur {
+			if err := muxer.WritePacket(av.Packet{Idx: 1, Time: atime, Data: make([]byte, 100)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		nalu := []byte{0, 0, 0, 2, 0x41, 0}
+		if i%25 == 0 {
+			nalu = []byte{0, 0, 0, 2, 0x65, 0}
+		}
+		if err := muxer.WritePacket(av.Packet{Idx: 0, Time: vtime, IsKeyFrame: i%25 == 0, Data: nalu}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSegmenter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	seg := NewSegmenter(dir)
+	seg.TargetDuration = 2 * time.Second
+	seg.PlaylistSize = 2
+	writeTestPackets(t, seg)
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "index.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	playlist := string(b)
+	for _, line := range []string{
+		"#EXT-X-TARGETDURATION:2\n",
+		"#EXT-X-MEDIA-SEQUENCE:3\n",
+		"#EXTINF:2.000,\nsegment3.ts\n#EXTINF:2.000,\nsegment4.ts\n#EXT-X-ENDLIST\n",
+	} {
+		if !strings.Contains(playlist, line) {
+			t.Fatalf("playlist missing %q:\n%s", line, playlist)
+		}
+	}
+
+	for i, exist := range []bool{false, true, true, true, true} {
+		_, err := os.Stat(filepath.Join(dir, "segment"+string('0'+byte(i))+".ts"))
+		if (err == nil) != exist {
+			t.Errorf("segment%d.ts exist=%v want %v", i, err == nil, exist)
+		}
+	}
+}
+
+func TestSegmenterVOD(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	seg := NewSegmenter(dir)
+	seg.TargetDuration = 3 * time.Second
+	seg.PlaylistSize = 0
+	writeTestPackets(t, seg)
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "index.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	playlist := string(b)
+	for _, line := range []string{
+		"#EXT-X-TARGETDURATION:3\n",
+		"#EXT-X-MEDIA-SEQUENCE:0\n",
+		"#EXT-X-PLAYLIST-TYPE:VOD\n",
+		"#EXTINF:3.000,\nsegment2.ts\n#EXTINF:1.000,\nsegment3.ts\n#EXT-X-ENDLIST\n",
+	} {
+		if !strings.Contains(playlist, line) {
+			t.Fatalf("playlist missing %q:\n%s", line, playlist)
+		}
+	}
+}
+
+func TestSegmenterTargetDuration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	seg := NewSegmenter(dir)
+	seg.TargetDuration = time.Second
+	seg.PlaylistSize = 2
+	if err = seg.WriteHeader(testStreams(t)[:1]); err != nil {
+		t.Fatal(err)
+	}
+	// first keyframe interval is 5s, then 1s
+	for i := 0; i < 250; i++ {
+		key := i == 0 || i >= 125 && i%25 == 0
+		nalu := []byte{0, 0, 0, 2, 0x41, 0}
+		if key {
+			nalu = []byte{0, 0, 0, 2, 0x65, 0}
+		}
+		if err = seg.WritePacket(av.Packet{Time: time.Duration(i) * 40 * time.Millisecond, IsKeyFrame: key, Data: nalu}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = seg.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "index.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	playlist := string(b)
+	// long segment left playlist, but target duration must not change
+	for _, line := range []string{
+		"#EXT-X-TARGETDURATION:5\n",
+		"#EXTINF:1.000,\nsegment4.ts\n#EXTINF:1.000,\nsegment5.ts\n#EXT-X-ENDLIST\n",
+	} {
+		if !strings.Contains(playlist, line) {
+			t.Fatalf("playlist missing %q:\n%s", line, playlist)
+		}
+	}
+}
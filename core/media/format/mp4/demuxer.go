@@ -9,6 +9,8 @@ import (
 	"github.com/Youngju-Heo/gomedia/core/media/av"
 	"github.com/Youngju-Heo/gomedia/core/media/codec/aacparser"
 	"github.com/Youngju-Heo/gomedia/core/media/codec/h264parser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/h265parser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/mpeg4parser"
 	"github.com/Youngju-Heo/gomedia/core/media/format/mp4/mp4io"
 )
 
@@ -17,6 +19,15 @@ type Demuxer struct {
 	r         io.ReadSeeker
 	streams   []*Stream
 	movieAtom *mp4io.Movie
+
+	// fragmented mp4
+	fragmented   bool
+	firstFragPos int64
+	fragPos      int64
+	fragEOF      bool
+	sidx         *mp4io.SegmentIndex
+	sidxEnd      int64
+	mfra         *mp4io.MovieFragRandomAccess
 }
 
 // NewDemuxer type
@@ -53,21 +64,10 @@ func (demuxer *Demuxer) probe() (err error) {
 	}
 
 	var moov *mp4io.Movie
-	var atoms []mp4io.Atom
-
-	if atoms, err = mp4io.ReadFileAtoms(demuxer.r); err != nil {
-		return
-	}
-	if _, err = demuxer.r.Seek(0, 0); err != nil {
+	if moov, err = demuxer.readMovie(); err != nil {
 		return
 	}
 
-	for _, atom := range atoms {
-		if atom.Tag() == mp4io.MOOV {
-			moov = atom.(*mp4io.Movie)
-		}
-	}
-
 	if moov == nil {
 		err = fmt.Errorf("mp4: 'moov' atom not found")
 		return
@@ -93,6 +93,16 @@ func (demuxer *Demuxer) probe() (err error) {
 				return
 			}
 			demuxer.streams = append(demuxer.streams, stream)
+		} else if hvc1 := atrack.GetHVC1Conf(); hvc1 != nil {
+			if stream.CodecData, err = h265parser.NewCodecDataFromHEVCDecoderConfRecord(hvc1.Data); err != nil {
+				return
+			}
+			demuxer.streams = append(demuxer.streams, stream)
+		} else if mp4v := atrack.GetMP4VDesc(); mp4v != nil && mp4v.Conf != nil {
+			if stream.CodecData, err = mpeg4parser.NewCodecDataFromConfig(mp4v.Conf.DecConfig); err != nil {
+				return
+			}
+			demuxer.streams = append(demuxer.streams, stream)
 		} else if esds := atrack.GetElemStreamDesc(); esds != nil {
 			if stream.CodecData, err = aacparser.NewCodecDataFromMPEG4AudioConfigBytes(esds.DecConfig); err != nil {
 				return
@@ -102,6 +112,10 @@ func (demuxer *Demuxer) probe() (err error) {
 	}
 
 	demuxer.movieAtom = moov
+
+	if moov.MovieExtend != nil {
+		err = demuxer.probeFragments()
+	}
 	return
 }
 
@@ -309,6 +323,9 @@ func (demuxer *Demuxer) ReadPacket() (pkt av.Packet, err error) {
 		err = errors.New("mp4: no streams available while trying to read a packet")
 		return
 	}
+	if demuxer.fragmented {
+		return demuxer.readFragPacket()
+	}
 
 	var chosen *Stream
 	var chosenidx int
@@ -341,6 +358,10 @@ func (demuxer *Demuxer) CurrentTime() (tm time.Duration) {
 
 // SeekToTime type
 func (demuxer *Demuxer) SeekToTime(tm time.Duration) (err error) {
+	if demuxer.fragmented {
+		return demuxer.seekFragToTime(tm)
+	}
+
 	for _, stream := range demuxer.streams {
 		if stream.Type().IsVideo() {
 			if err = stream.seekToTime(tm); err != nil {
@@ -0,0 +1,564 @@
+package mp4
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/format/mp4/mp4io"
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
+)
+
+const fragSampleIsNonSync = 0x10000
+
+type fragSample struct {
+	pos      int64
+	size     uint32
+	dts      int64
+	cts      int64
+	nonSync  bool
+	duration int64
+}
+
+// readAtomHeader reads box header at pos, size is 0 when box extends to end of file
+func (demuxer *Demuxer) readAtomHeader(pos int64) (size int64, tag mp4io.Tag, hdrlen int64, err error) {
+	b := make([]byte, 16)
+	if err = demuxer.readat(pos, b[:8]); err != nil {
+		return
+	}
+	size = int64(pio.U32BE(b[0:]))
+	tag = mp4io.Tag(pio.U32BE(b[4:]))
+	hdrlen = 8
+	if size == 1 {
+		if _, err = io.ReadFull(demuxer.r, b[8:16]); err != nil {
+			return
+		}
+		size = int64(pio.U64BE(b[8:]))
+		hdrlen = 16
+	}
+	if size != 0 && size < hdrlen {
+		err = fmt.Errorf("mp4: atom '%s' size=%d invalid at %d", tag, size, pos)
+	}
+	return
+}
+
+func (demuxer *Demuxer) readAtom(pos int64, size int64, atom mp4io.Atom) (err error) {
+	b := make([]byte, size)
+	if err = demuxer.readat(pos, b); err != nil {
+		return
+	}
+	_, err = atom.Unmarshal(b, int(pos))
+	return
+}
+
+// readMovie walks top level atoms until moov, and for fragmented file until first moof
+func (demuxer *Demuxer) readMovie() (moov *mp4io.Movie, err error) {
+	var pos int64
+	for {
+		var size, hdrlen int64
+		var tag mp4io.Tag
+		if size, tag, hdrlen, err = demuxer.readAtomHeader(pos); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = nil
+			}
+			break
+		}
+
+		switch tag {
+		case mp4io.MOOV:
+			if hdrlen != 8 || size == 0 {
+				err = fmt.Errorf("mp4: 'moov' atom size invalid")
+				return
+			}
+			moov = &mp4io.Movie{}
+			if err = demuxer.readAtom(pos, size, moov); err != nil {
+				return
+			}
+			if moov.MovieExtend == nil {
+				return
+			}
+
+		case mp4io.SIDX:
+			if demuxer.sidx == nil && hdrlen == 8 && size > 0 {
+				sidx := &mp4io.SegmentIndex{}
+				if err = demuxer.readAtom(pos, size, sidx); err != nil {
+					return
+				}
+				demuxer.sidx = sidx
+				demuxer.sidxEnd = pos + size
+			}
+
+		case mp4io.MOOF:
+			if moov != nil {
+				demuxer.firstFragPos = pos
+				return
+			}
+		}
+
+		if size == 0 {
+			break
+		}
+		pos += size
+	}
+
+	demuxer.firstFragPos = pos
+	return
+}
+
+func (demuxer *Demuxer) probeFragments() (err error) {
+	demuxer.fragmented = true
+	demuxer.fragPos = demuxer.firstFragPos
+
+	// random access index is optional, ignore if broken
+	demuxer.readMovieFragRandomAccess()
+
+	for _, stream := range demuxer.streams {
+		if len(stream.sample.ChunkOffset.Entries) > 0 {
+			if err = stream.loadSampleTable(); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// readMovieFragRandomAccess locates mfra by mfro at end of file
+func (demuxer *Demuxer) readMovieFragRandomAccess() (err error) {
+	var end int64
+	if end, err = demuxer.r.Seek(0, 2); err != nil {
+		return
+	}
+	if end < 16 {
+		return
+	}
+	b := make([]byte, 16)
+	if err = demuxer.readat(end-16, b); err != nil {
+		return
+	}
+	if mp4io.Tag(pio.U32BE(b[4:])) != mp4io.MFRO {
+		return
+	}
+	size := int64(pio.U32BE(b[12:]))
+	if size < 16 || size > end {
+		return
+	}
+	mfra := &mp4io.MovieFragRandomAccess{}
+	if err = demuxer.readAtom(end-size, size, mfra); err != nil {
+		return
+	}
+	if mfra.Tag() == mp4io.MFRA {
+		demuxer.mfra = mfra
+	}
+	return
+}
+
+// loadSampleTable turns samples in moov into fragment samples, they precede all fragments
+func (stream *Stream) loadSampleTable() (err error) {
+	if err = stream.setSampleIndex(0); err != nil {
+		return
+	}
+	for stream.isSampleValid() {
+		sample := fragSample{
+			pos: int64(stream.sample.ChunkOffset.Entries[stream.chunkIndex]) + stream.sampleOffsetInChunk,
+			dts: stream.dts,
+		}
+		if stream.sample.SampleSize.SampleSize != 0 {
+			sample.size = stream.sample.SampleSize.SampleSize
+		} else {
+			sample.size = stream.sample.SampleSize.Entries[stream.sampleIndex]
+		}
+		if stream.sample.SyncSample != nil {
+			sample.nonSync = stream.sample.SyncSample.Entries[stream.syncSampleIndex]-1 != uint32(stream.sampleIndex)
+		}
+		if stream.sample.CompositionOffset != nil && len(stream.sample.CompositionOffset.Entries) > 0 {
+			sample.cts = int64(stream.sample.CompositionOffset.Entries[stream.cttsEntryIndex].Offset)
+		}
+		sample.duration = stream.incSampleIndex()
+		stream.fragSamples = append(stream.fragSamples, sample)
+	}
+	stream.fragDts = stream.dts
+	return
+}
+
+func (demuxer *Demuxer) streamByTrackID(trackID uint32) (stream *Stream, idx int) {
+	for i, stream := range demuxer.streams {
+		if uint32(stream.trackAtom.Header.TrackID) == trackID {
+			return stream, i
+		}
+	}
+	return nil, -1
+}
+
+func (demuxer *Demuxer) trackExtend(trackID uint32) *mp4io.TrackExtend {
+	for _, trex := range demuxer.movieAtom.MovieExtend.Tracks {
+		if trex.TrackID == trackID {
+			return trex
+		}
+	}
+	return &mp4io.TrackExtend{}
+}
+
+// readFragment reads next moof and queues its samples, returns io.EOF at end of file
+func (demuxer *Demuxer) readFragment() (err error) {
+	for {
+		var size, hdrlen int64
+		var tag mp4io.Tag
+		if size, tag, hdrlen, err = demuxer.readAtomHeader(demuxer.fragPos); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return
+		}
+
+		if tag == mp4io.MOOF && hdrlen == 8 && size > 0 {
+			moof := &mp4io.MovieFrag{}
+			if err = demuxer.readAtom(demuxer.fragPos, size, moof); err != nil {
+				return
+			}
+			demuxer.addFragment(moof, demuxer.fragPos)
+			demuxer.fragPos += size
+			return
+		}
+
+		if size == 0 {
+			err = io.EOF
+			return
+		}
+		demuxer.fragPos += size
+	}
+}
+
+func (demuxer *Demuxer) addFragment(moof *mp4io.MovieFrag, moofPos int64) {
+	dataEnd := moofPos
+	for i, traf := range moof.Tracks {
+		if traf.Header == nil {
+			continue
+		}
+		header := traf.Header
+		trex := demuxer.trackExtend(header.TrackID)
+
+		base := dataEnd
+		if header.Flags&mp4io.TFHD_BASE_DATA_OFFSET != 0 {
+			base = int64(header.BaseDataOffset)
+		} else if header.Flags&mp4io.TFHD_DEFAULT_BASE_IS_MOOF != 0 || i == 0 {
+			base = moofPos
+		}
+
+		defaultDuration := trex.DefaultSampleDuration
+		if header.Flags&mp4io.TFHD_DEFAULT_DURATION != 0 {
+			defaultDuration = header.DefaultDuration
+		}
+		defaultSize := trex.DefaultSampleSize
+		if header.Flags&mp4io.TFHD_DEFAULT_SIZE != 0 {
+			defaultSize = header.DefaultSize
+		}
+		defaultFlags := trex.DefaultSampleFlags
+		if header.Flags&mp4io.TFHD_DEFAULT_FLAGS != 0 {
+			defaultFlags = header.DefaultFlags
+		}
+
+		stream, _ := demuxer.streamByTrackID(header.TrackID)
+		var dts int64
+		if traf.DecodeTime != nil {
+			dts = int64(traf.DecodeTime.Time)
+		} else if stream != nil {
+			dts = stream.fragDts
+		}
+
+		run := traf.Run
+		if run == nil {
+			continue
+		}
+		pos := base
+		if run.Flags&mp4io.TRUN_DATA_OFFSET != 0 {
+			pos = base + int64(int32(run.DataOffset))
+		}
+
+		for j, entry := range run.Entries {
+			sample := fragSample{
+				pos:      pos,
+				size:     defaultSize,
+				dts:      dts,
+				duration: int64(defaultDuration),
+			}
+			if run.Flags&mp4io.TRUN_SAMPLE_DURATION != 0 {
+				sample.duration = int64(entry.Duration)
+			}
+			if run.Flags&mp4io.TRUN_SAMPLE_SIZE != 0 {
+				sample.size = entry.Size
+			}
+			flags := defaultFlags
+			if j == 0 && run.Flags&mp4io.TRUN_FIRST_SAMPLE_FLAGS != 0 {
+				flags = run.FirstSampleFlags
+			} else if run.Flags&mp4io.TRUN_SAMPLE_FLAGS != 0 {
+				flags = entry.Flags
+			}
+			sample.nonSync = flags&fragSampleIsNonSync != 0
+			if run.Flags&mp4io.TRUN_SAMPLE_CTS != 0 {
+				if run.Version == 0 {
+					sample.cts = int64(entry.Cts)
+				} else {
+					sample.cts = int64(int32(entry.Cts))
+				}
+			}
+
+			if stream != nil {
+				stream.fragSamples = append(stream.fragSamples, sample)
+			}
+			pos += int64(sample.size)
+			dts += sample.duration
+		}
+
+		dataEnd = pos
+		if stream != nil {
+			stream.fragDts = dts
+		}
+	}
+}
+
+// fillFragments reads fragments until every stream has queued sample
+func (demuxer *Demuxer) fillFragments() (err error) {
+	for !demuxer.fragEOF {
+		empty := false
+		for _, stream := range demuxer.streams {
+			if len(stream.fragSamples) == 0 {
+				empty = true
+				break
+			}
+		}
+		if !empty {
+			return
+		}
+		if err = demuxer.readFragment(); err != nil {
+			if err != io.EOF {
+				return
+			}
+			err = nil
+			demuxer.fragEOF = true
+		}
+	}
+	return
+}
+
+func (demuxer *Demuxer) readFragPacket() (pkt av.Packet, err error) {
+	if err = demuxer.fillFragments(); err != nil {
+		return
+	}
+
+	var chosen *Stream
+	var chosenidx int
+	for i, stream := range demuxer.streams {
+		if len(stream.fragSamples) == 0 {
+			continue
+		}
+		if chosen == nil || stream.tsToTime(stream.fragSamples[0].dts) < chosen.tsToTime(chosen.fragSamples[0].dts) {
+			chosen = stream
+			chosenidx = i
+		}
+	}
+	if chosen == nil {
+		err = io.EOF
+		return
+	}
+
+	sample := chosen.fragSamples[0]
+	chosen.fragSamples = chosen.fragSamples[1:]
+
+	pkt.Data = make([]byte, sample.size)
+	if err = demuxer.readat(sample.pos, pkt.Data); err != nil {
+		return
+	}
+	pkt.Idx = int8(chosenidx)
+	pkt.Time = chosen.tsToTime(sample.dts)
+	pkt.CompositionTime = chosen.tsToTime(sample.cts)
+	pkt.IsKeyFrame = chosen.Type().IsVideo() && !sample.nonSync
+	chosen.dts = sample.dts + sample.duration
+	return
+}
+
+// fragSeekPos finds fragment position at or before tm by mfra or sidx, else first fragment
+func (demuxer *Demuxer) fragSeekPos(stream *Stream, tm time.Duration) (pos int64, start time.Duration, found bool) {
+	pos = demuxer.firstFragPos
+
+	if demuxer.mfra != nil {
+		for _, tfra := range demuxer.mfra.Tracks {
+			if tfra.TrackID != uint32(stream.trackAtom.Header.TrackID) {
+				continue
+			}
+			for _, entry := range tfra.Entries {
+				t := stream.tsToTime(int64(entry.Time))
+				if t > tm {
+					break
+				}
+				pos, start, found = int64(entry.MoofOffset), t, true
+			}
+			if found {
+				return
+			}
+		}
+	}
+
+	if sidx := demuxer.sidx; sidx != nil && sidx.TimeScale > 0 {
+		offset := demuxer.sidxEnd + int64(sidx.FirstOffset)
+		ts := int64(sidx.EarliestPresentationTime)
+		for _, entry := range sidx.Entries {
+			t := tsToTime(ts, int64(sidx.TimeScale))
+			if t > tm {
+				break
+			}
+			if entry.ReferenceType == 0 {
+				pos, start, found = offset, t, true
+			}
+			offset += int64(entry.ReferencedSize)
+			ts += int64(entry.SubsegmentDuration)
+		}
+	}
+	return
+}
+
+// scanFragments walks moof headers for last fragment with sync sample of ref not after tm,
+// only samples of one fragment are kept at a time.
+// Streams are set to start of found fragment, or left as they are if tm is before fragments.
+func (demuxer *Demuxer) scanFragments(ref *Stream, tm time.Duration) (pos int64, err error) {
+	pos = demuxer.firstFragPos
+
+	saved := make([][]fragSample, len(demuxer.streams))
+	startDts := make([]int64, len(demuxer.streams))
+	foundDts := []int64{}
+	for i, stream := range demuxer.streams {
+		saved[i] = stream.fragSamples
+		startDts[i] = stream.fragDts
+	}
+
+	for p := demuxer.firstFragPos; ; {
+		var size, hdrlen int64
+		var tag mp4io.Tag
+		if size, tag, hdrlen, err = demuxer.readAtomHeader(p); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = nil
+			}
+			break
+		}
+
+		if tag == mp4io.MOOF && hdrlen == 8 && size > 0 {
+			moof := &mp4io.MovieFrag{}
+			if err = demuxer.readAtom(p, size, moof); err != nil {
+				return
+			}
+			dts := make([]int64, len(demuxer.streams))
+			for i, stream := range demuxer.streams {
+				dts[i] = stream.fragDts
+				stream.fragSamples = nil
+			}
+			demuxer.addFragment(moof, p)
+
+			if len(ref.fragSamples) > 0 && ref.tsToTime(ref.fragSamples[0].dts) > tm {
+				break
+			}
+			for _, sample := range ref.fragSamples {
+				if ref.tsToTime(sample.dts) > tm {
+					break
+				}
+				if !sample.nonSync {
+					pos, foundDts = p, dts
+					break
+				}
+			}
+		}
+
+		if size == 0 {
+			break
+		}
+		p += size
+	}
+
+	for i, stream := range demuxer.streams {
+		if len(foundDts) > 0 {
+			stream.fragSamples = nil
+			stream.fragDts = foundDts[i]
+		} else {
+			stream.fragSamples = saved[i]
+			stream.fragDts = startDts[i]
+		}
+	}
+	return
+}
+
+func (demuxer *Demuxer) seekFragToTime(tm time.Duration) (err error) {
+	if len(demuxer.streams) == 0 {
+		return
+	}
+	ref := demuxer.streams[0]
+	for _, stream := range demuxer.streams {
+		if stream.Type().IsVideo() {
+			ref = stream
+			break
+		}
+	}
+
+	pos, start, found := demuxer.fragSeekPos(ref, tm)
+	demuxer.fragEOF = false
+	for _, stream := range demuxer.streams {
+		stream.fragSamples = nil
+		stream.fragDts = 0
+		if found {
+			stream.fragDts = stream.timeToTs(start)
+		} else if len(stream.sample.ChunkOffset.Entries) > 0 {
+			// samples in moov come before fragments
+			if err = stream.loadSampleTable(); err != nil {
+				return
+			}
+		}
+	}
+	if !found {
+		if pos, err = demuxer.scanFragments(ref, tm); err != nil {
+			return
+		}
+	}
+	demuxer.fragPos = pos
+
+	// load until reference stream passes tm
+	for {
+		n := len(ref.fragSamples)
+		if n > 0 && ref.tsToTime(ref.fragSamples[n-1].dts) > tm {
+			break
+		}
+		if err = demuxer.readFragment(); err != nil {
+			if err != io.EOF {
+				return
+			}
+			err = nil
+			demuxer.fragEOF = true
+			break
+		}
+	}
+
+	// start from last sync sample not after tm
+	keyIndex := 0
+	for i, sample := range ref.fragSamples {
+		if ref.tsToTime(sample.dts) > tm {
+			break
+		}
+		if !sample.nonSync {
+			keyIndex = i
+		}
+	}
+	ref.fragSamples = ref.fragSamples[keyIndex:]
+	if len(ref.fragSamples) == 0 {
+		return
+	}
+	keyTime := ref.tsToTime(ref.fragSamples[0].dts)
+
+	for _, stream := range demuxer.streams {
+		if stream != ref {
+			for len(stream.fragSamples) > 0 && stream.tsToTime(stream.fragSamples[0].dts) < keyTime {
+				stream.fragSamples = stream.fragSamples[1:]
+			}
+		}
+		if len(stream.fragSamples) > 0 {
+			stream.dts = stream.fragSamples[0].dts
+		}
+	}
+	return
+}
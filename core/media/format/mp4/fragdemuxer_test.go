@@ -0,0 +1,285 @@
+package mp4
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/format/mp4/mp4io"
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
+)
+
+func testFragFile(t *testing.T, pkts []av.Packet) []byte {
+	var buf bytes.Buffer
+	muxer := NewFragMuxer(&buf)
+	if err := muxer.WriteHeader([]av.CodecData{testHEVCCodecData(t), testAACCodecData(t)}); err != nil {
+		t.Fatal(err)
+	}
+	for _, pkt := range pkts {
+		if err := muxer.WritePacket(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// audio time may be truncated to timescale
+const testAudioTimeError = 2 * time.Second / 44100
+
+func testCompareFragPackets(t *testing.T, got, want []av.Packet) {
+	if len(got) != len(want) {
+		t.Fatalf("packets=%d, want %d", len(got), len(want))
+	}
+	for i := range want {
+		diff := got[i].Time - want[i].Time
+		if got[i].Idx != want[i].Idx || diff < -testAudioTimeError || diff > 0 ||
+			got[i].IsKeyFrame != want[i].IsKeyFrame || !bytes.Equal(got[i].Data, want[i].Data) {
+			t.Fatalf("packet#%d idx=%d time=%v key=%v len=%d, want idx=%d time=%v key=%v len=%d", i,
+				got[i].Idx, got[i].Time, got[i].IsKeyFrame, len(got[i].Data),
+				want[i].Idx, want[i].Time, want[i].IsKeyFrame, len(want[i].Data))
+		}
+	}
+}
+
+func TestFragDemuxer(t *testing.T) {
+	const gops, gop = 4, 10
+	pkts := testFragPackets(gops, gop)
+	b := testFragFile(t, pkts)
+
+	demuxer := NewDemuxer(bytes.NewReader(b))
+	streams, err := demuxer.Streams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 2 || streams[0].Type() != av.HEVC || streams[1].Type() != av.AAC {
+		t.Fatalf("streams=%v", streams)
+	}
+	testCompareFragPackets(t, testReadPackets(t, demuxer), pkts)
+
+	// no sidx or mfra, moof headers are walked
+	testFragSeek(t, "moof headers", b, pkts, gop, false)
+}
+
+// testFragSeek checks SeekToTime starts from key frame not after seek time,
+// indexed file must find fragment by sidx or mfra without walking moof headers
+func testFragSeek(t *testing.T, name string, b []byte, pkts []av.Packet, gop int, indexed bool) {
+	demuxer := NewDemuxer(bytes.NewReader(b))
+	if _, err := demuxer.Streams(); err != nil {
+		t.Fatal(err)
+	}
+	testCompareFragPackets(t, testReadPackets(t, demuxer), pkts)
+
+	for _, test := range []struct {
+		seek, key time.Duration
+	}{
+		{500 * time.Millisecond, 400 * time.Millisecond},
+		{1200 * time.Millisecond, 1200 * time.Millisecond},
+		{1100 * time.Millisecond, 800 * time.Millisecond},
+		{0, 0},
+		{10 * time.Second, 1200 * time.Millisecond},
+	} {
+		if indexed {
+			if _, start, found := demuxer.fragSeekPos(demuxer.streams[0], test.seek); !found || start != test.key {
+				t.Errorf("%s: seek %v: index found=%v start=%v", name, test.seek, found, start)
+			}
+		}
+		if err := demuxer.SeekToTime(test.seek); err != nil {
+			t.Fatal(err)
+		}
+		// only fragment of key frame is loaded
+		if n := len(demuxer.streams[0].fragSamples); n > gop {
+			t.Errorf("%s: seek %v: video samples queued=%d", name, test.seek, n)
+		}
+
+		var want []av.Packet
+		for _, pkt := range pkts {
+			if pkt.Idx == 0 && pkt.Time >= test.key || pkt.Idx == 1 && pkt.Time+testAudioTimeError > test.key {
+				want = append(want, pkt)
+			}
+		}
+		got := testReadPackets(t, demuxer)
+		if len(got) == 0 || got[0].Idx != 0 || got[0].Time != test.key || !got[0].IsKeyFrame {
+			t.Fatalf("%s: seek %v: first packet=%+v, want key frame at %v", name, test.seek, got[0], test.key)
+		}
+		testCompareFragPackets(t, got, want)
+	}
+}
+
+// testSplitFragFile splits file of FragMuxer into init segment and moof+mdat fragments
+func testSplitFragFile(b []byte) (init []byte, frags [][]byte) {
+	for pos := 0; pos+8 <= len(b); {
+		size := int(pio.U32BE(b[pos:]))
+		switch mp4io.Tag(pio.U32BE(b[pos+4:])) {
+		case mp4io.MOOF:
+			frags = append(frags, b[pos:pos+size])
+		case mp4io.MDAT:
+			last := len(frags) - 1
+			frags[last] = b[pos-len(frags[last]) : pos+size]
+		default:
+			init = b[:pos+size]
+		}
+		pos += size
+	}
+	return
+}
+
+func testParseMoof(t *testing.T, frag []byte) (moof *mp4io.MovieFrag, mdat []byte) {
+	size := int(pio.U32BE(frag))
+	moof = &mp4io.MovieFrag{}
+	if _, err := moof.Unmarshal(frag[:size], 0); err != nil {
+		t.Fatal(err)
+	}
+	return moof, frag[size:]
+}
+
+// testVideoFragTimes returns decode time of video track in each fragment and time scale
+func testVideoFragTimes(t *testing.T, init []byte, frags [][]byte) (times []uint64, timeScale uint32) {
+	moov := testParseMoov(t, init)
+	timeScale = uint32(moov.Tracks[0].Media.Header.TimeScale)
+	for _, frag := range frags {
+		moof, _ := testParseMoof(t, frag)
+		times = append(times, moof.Tracks[0].DecodeTime.Time)
+	}
+	return
+}
+
+func testParseMoov(t *testing.T, init []byte) *mp4io.Movie {
+	for pos := 0; pos+8 <= len(init); pos += int(pio.U32BE(init[pos:])) {
+		if mp4io.Tag(pio.U32BE(init[pos+4:])) == mp4io.MOOV {
+			moov := &mp4io.Movie{}
+			if _, err := moov.Unmarshal(init[pos:], pos); err != nil {
+				t.Fatal(err)
+			}
+			return moov
+		}
+	}
+	t.Fatal("moov not found")
+	return nil
+}
+
+// testSidxFile puts sidx of video track, one subsegment per fragment, before fragments
+func testSidxFile(t *testing.T, b []byte) []byte {
+	init, frags := testSplitFragFile(b)
+	times, timeScale := testVideoFragTimes(t, init, frags)
+	sidx := mp4io.SegmentIndex{
+		Version:                  1,
+		ReferenceID:              1,
+		TimeScale:                timeScale,
+		EarliestPresentationTime: times[0],
+	}
+	for i, frag := range frags {
+		// last fragment lasts as long as previous one
+		var dur uint64
+		if i+1 < len(times) {
+			dur = times[i+1] - times[i]
+		} else if i > 0 {
+			dur = times[i] - times[i-1]
+		}
+		sidx.Entries = append(sidx.Entries, mp4io.SegmentIndexEntry{
+			ReferencedSize:     uint32(len(frag)),
+			SubsegmentDuration: uint32(dur),
+			StartsWithSAP:      1,
+			SAPType:            1,
+		})
+	}
+	out := append([]byte{}, init...)
+	buf := make([]byte, sidx.Len())
+	sidx.Marshal(buf)
+	out = append(out, buf...)
+	for _, frag := range frags {
+		out = append(out, frag...)
+	}
+	return out
+}
+
+// testMfraFile appends mfra with tfra of video track pointing at each fragment
+func testMfraFile(t *testing.T, b []byte) []byte {
+	init, frags := testSplitFragFile(b)
+	times, _ := testVideoFragTimes(t, init, frags)
+	tfra := &mp4io.TrackFragRandomAccess{Version: 1, TrackID: 1}
+	pos := len(init)
+	for i, frag := range frags {
+		tfra.Entries = append(tfra.Entries, mp4io.TrackFragRandomAccessEntry{
+			Time:         times[i],
+			MoofOffset:   uint64(pos),
+			TrafNumber:   1,
+			TrunNumber:   1,
+			SampleNumber: 1,
+		})
+		pos += len(frag)
+	}
+
+	// mfro is last child of mfra and holds its size
+	mfro := make([]byte, 16)
+	pio.PutU32BE(mfro, 16)
+	pio.PutU32BE(mfro[4:], uint32(mp4io.MFRO))
+	mfra := mp4io.MovieFragRandomAccess{
+		Tracks:   []*mp4io.TrackFragRandomAccess{tfra},
+		Unknowns: []mp4io.Atom{&mp4io.Dummy{TagItem: mp4io.MFRO, Data: mfro}},
+	}
+	pio.PutU32BE(mfro[12:], uint32(mfra.Len()))
+	buf := make([]byte, mfra.Len())
+	mfra.Marshal(buf)
+	return append(append([]byte{}, b...), buf...)
+}
+
+// testDefaultFlagsFile rewrites video traf of each fragment into two trafs whose truns have
+// no sample flags, key frame takes flags of tfhd and others those of trex
+func testDefaultFlagsFile(t *testing.T, b []byte) []byte {
+	init, frags := testSplitFragFile(b)
+	moov := testParseMoov(t, init)
+	moov.MovieExtend.Tracks[0].DefaultSampleFlags = fragSampleFlagsNonSync
+	ftypLen := int(pio.U32BE(init))
+	out := append([]byte{}, init[:ftypLen]...)
+	buf := make([]byte, moov.Len())
+	moov.Marshal(buf)
+	out = append(out, buf...)
+
+	for _, frag := range frags {
+		moof, mdat := testParseMoof(t, frag)
+		oldLen := moof.Len()
+		video := moof.Tracks[0]
+		run := video.Run
+		flags := mp4io.TRUN_DATA_OFFSET | run.Flags&(mp4io.TRUN_SAMPLE_DURATION|mp4io.TRUN_SAMPLE_SIZE|mp4io.TRUN_SAMPLE_CTS)
+		tracks := []*mp4io.TrackFrag{{
+			Header: &mp4io.TrackFragHeader{
+				Flags:        mp4io.TFHD_DEFAULT_BASE_IS_MOOF | mp4io.TFHD_DEFAULT_FLAGS,
+				TrackID:      1,
+				DefaultFlags: fragSampleFlagsSync,
+			},
+			DecodeTime: video.DecodeTime,
+			Run:        &mp4io.TrackFragRun{Flags: flags, DataOffset: run.DataOffset, Entries: run.Entries[:1]},
+		}}
+		if len(run.Entries) > 1 {
+			// decode time continues from previous traf of track
+			tracks = append(tracks, &mp4io.TrackFrag{
+				Header: &mp4io.TrackFragHeader{Flags: mp4io.TFHD_DEFAULT_BASE_IS_MOOF, TrackID: 1},
+				Run:    &mp4io.TrackFragRun{Flags: flags, DataOffset: run.DataOffset + run.Entries[0].Size, Entries: run.Entries[1:]},
+			})
+		}
+		moof.Tracks = append(tracks, moof.Tracks[1:]...)
+
+		delta := uint32(moof.Len() - oldLen)
+		for _, traf := range moof.Tracks {
+			traf.Run.DataOffset += delta
+		}
+		buf := make([]byte, moof.Len())
+		moof.Marshal(buf)
+		out = append(append(out, buf...), mdat...)
+	}
+	return out
+}
+
+func TestFragDemuxerIndex(t *testing.T) {
+	const gops, gop = 4, 10
+	pkts := testFragPackets(gops, gop)
+	b := testFragFile(t, pkts)
+
+	testFragSeek(t, "sidx", testSidxFile(t, b), pkts, gop, true)
+	testFragSeek(t, "mfra", testMfraFile(t, b), pkts, gop, true)
+	testFragSeek(t, "default flags", testDefaultFlagsFile(t, b), pkts, gop, false)
+}
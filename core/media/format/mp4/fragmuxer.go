@@ -0,0 +1,251 @@
+package mp4
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/format/mp4/mp4io"
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
+)
+
+const (
+	fragSampleFlagsSync    = 0x02000000 // sample_depends_on=2
+	fragSampleFlagsNonSync = 0x01010000 // sample_depends_on=1, sample_is_non_sync_sample=1
+)
+
+// FragMuxer writes fragmented mp4 to plain writer.
+// WriteHeader writes init segment (ftyp+moov), then each fragment (moof+mdat)
+// holds one GOP of first video stream, or FragmentDuration of audio when there is no video.
+type FragMuxer struct {
+	FragmentDuration time.Duration
+
+	w        io.Writer
+	bufw     *bufio.Writer
+	streams  []*fragStream
+	videoIdx int
+	seqnum   uint32
+
+	fragStart   time.Duration
+	fragStarted bool
+}
+
+type fragStream struct {
+	*Stream
+
+	dts          int64
+	basetime     int64
+	lastDuration int64
+	entries      []mp4io.TrackFragRunEntry
+	data         []byte
+}
+
+// NewFragMuxer func
+func NewFragMuxer(w io.Writer) *FragMuxer {
+	return &FragMuxer{
+		FragmentDuration: time.Second,
+		w:                w,
+		bufw:             bufio.NewWriterSize(w, pio.RecommendBufioSize),
+	}
+}
+
+func makeFileType(major string, compatible ...string) []byte {
+	b := make([]byte, 16+4*len(compatible))
+	pio.PutU32BE(b[0:], uint32(len(b)))
+	copy(b[4:], "ftyp")
+	copy(b[8:], major)
+	pio.PutU32BE(b[12:], 0x200)
+	for i, brand := range compatible {
+		copy(b[16+4*i:], brand)
+	}
+	return b
+}
+
+// WriteHeader writes init segment
+func (init *FragMuxer) WriteHeader(streams []av.CodecData) (err error) {
+	init.streams = []*fragStream{}
+	init.videoIdx = -1
+
+	moov := &mp4io.Movie{
+		Header: &mp4io.MovieHeader{
+			PreferredRate:   1,
+			PreferredVolume: 1,
+			Matrix:          [9]int32{0x10000, 0, 0, 0, 0x10000, 0, 0, 0, 0x40000000},
+			NextTrackID:     int32(len(streams) + 1),
+			TimeScale:       1000,
+		},
+		MovieExtend: &mp4io.MovieExtend{},
+	}
+
+	for i, codec := range streams {
+		var stream *Stream
+		if stream, err = newTrackStream(codec, i+1); err != nil {
+			return
+		}
+		if codec.Type().IsVideo() {
+			if init.videoIdx < 0 {
+				init.videoIdx = i
+			}
+		} else if audio, ok := codec.(av.AudioCodecData); ok {
+			stream.timeScale = int64(audio.SampleRate())
+		}
+		// sample tables stay empty, samples are described by trun of each fragment
+		stream.sample.SyncSample = nil
+		stream.sample.SampleToChunk.Entries = nil
+		if err = stream.fillTrackAtom(); err != nil {
+			return
+		}
+		moov.Tracks = append(moov.Tracks, stream.trackAtom)
+		moov.MovieExtend.Tracks = append(moov.MovieExtend.Tracks, &mp4io.TrackExtend{
+			TrackID:              uint32(i + 1),
+			DefaultSampleDescIdx: 1,
+		})
+		init.streams = append(init.streams, &fragStream{Stream: stream, dts: -1})
+	}
+
+	if _, err = init.bufw.Write(makeFileType("iso5", "iso5", "iso6", "mp41")); err != nil {
+		return
+	}
+	b := make([]byte, moov.Len())
+	moov.Marshal(b)
+	if _, err = init.bufw.Write(b); err != nil {
+		return
+	}
+	err = init.bufw.Flush()
+	return
+}
+
+// WritePacket func
+func (init *FragMuxer) WritePacket(pkt av.Packet) (err error) {
+	if int(pkt.Idx) >= len(init.streams) {
+		err = fmt.Errorf("mp4: stream#%d not found", pkt.Idx)
+		return
+	}
+	stream := init.streams[pkt.Idx]
+
+	if stream.dts < 0 {
+		stream.dts = stream.timeToTs(pkt.Time)
+	}
+	if stream.lastpkt != nil {
+		if pkt.Time < stream.lastpkt.Time {
+			err = fmt.Errorf("mp4: stream#%d time=%v < lasttime=%v", pkt.Idx, pkt.Time, stream.lastpkt.Time)
+			return
+		}
+		stream.addSample(*stream.lastpkt, stream.timeToTs(pkt.Time)-stream.dts)
+	}
+
+	if init.isFragmentStart(pkt) {
+		if err = init.Flush(); err != nil {
+			return
+		}
+		init.fragStart = pkt.Time
+	}
+	if !init.fragStarted {
+		init.fragStarted = true
+		init.fragStart = pkt.Time
+	}
+
+	stream.lastpkt = &pkt
+	return
+}
+
+func (init *FragMuxer) isFragmentStart(pkt av.Packet) bool {
+	if init.videoIdx >= 0 {
+		return int(pkt.Idx) == init.videoIdx && pkt.IsKeyFrame
+	}
+	return init.fragStarted && pkt.Time-init.fragStart >= init.FragmentDuration
+}
+
+func (init *fragStream) addSample(pkt av.Packet, duration int64) {
+	if len(init.entries) == 0 {
+		init.basetime = init.dts
+	}
+
+	entry := mp4io.TrackFragRunEntry{
+		Duration: uint32(duration),
+		Size:     uint32(len(pkt.Data)),
+		Flags:    fragSampleFlagsSync,
+		Cts:      uint32(init.timeToTs(pkt.CompositionTime)),
+	}
+	if init.Type().IsVideo() && !pkt.IsKeyFrame {
+		entry.Flags = fragSampleFlagsNonSync
+	}
+	init.entries = append(init.entries, entry)
+	init.data = append(init.data, pkt.Data...)
+	init.dts += duration
+	init.lastDuration = duration
+}
+
+// Flush writes samples pending in all streams as one moof+mdat fragment
+func (init *FragMuxer) Flush() (err error) {
+	moof := &mp4io.MovieFrag{}
+	pending := []*fragStream{}
+	for _, stream := range init.streams {
+		if len(stream.entries) == 0 {
+			continue
+		}
+		run := &mp4io.TrackFragRun{
+			Flags:   mp4io.TRUN_DATA_OFFSET | mp4io.TRUN_SAMPLE_DURATION | mp4io.TRUN_SAMPLE_SIZE | mp4io.TRUN_SAMPLE_FLAGS,
+			Entries: stream.entries,
+		}
+		if stream.Type().IsVideo() {
+			run.Flags |= mp4io.TRUN_SAMPLE_CTS
+		}
+		moof.Tracks = append(moof.Tracks, &mp4io.TrackFrag{
+			Header: &mp4io.TrackFragHeader{
+				Flags:   mp4io.TFHD_DEFAULT_BASE_IS_MOOF,
+				TrackID: uint32(stream.trackAtom.Header.TrackID),
+			},
+			DecodeTime: &mp4io.TrackFragDecodeTime{
+				Version: 1,
+				Time:    uint64(stream.basetime),
+			},
+			Run: run,
+		})
+		pending = append(pending, stream)
+	}
+	if len(pending) == 0 {
+		return
+	}
+	init.seqnum++
+	moof.Header = &mp4io.MovieFragHeader{Seqnum: init.seqnum}
+
+	// data offset is relative to moof start, data of tracks follow mdat header in order
+	moofLen := moof.Len()
+	offset := moofLen + 8
+	for i, traf := range moof.Tracks {
+		traf.Run.DataOffset = uint32(offset)
+		offset += len(pending[i].data)
+	}
+
+	b := make([]byte, moofLen+8)
+	moof.Marshal(b)
+	pio.PutU32BE(b[moofLen:], uint32(offset-moofLen))
+	pio.PutU32BE(b[moofLen+4:], uint32(mp4io.MDAT))
+	if _, err = init.bufw.Write(b); err != nil {
+		return
+	}
+	for _, stream := range pending {
+		if _, err = init.bufw.Write(stream.data); err != nil {
+			return
+		}
+		stream.entries = nil
+		stream.data = nil
+	}
+	err = init.bufw.Flush()
+	return
+}
+
+// WriteTrailer writes last fragment, last sample of each stream repeats previous sample duration
+func (init *FragMuxer) WriteTrailer() (err error) {
+	for _, stream := range init.streams {
+		if stream.lastpkt != nil {
+			stream.addSample(*stream.lastpkt, stream.lastDuration)
+			stream.lastpkt = nil
+		}
+	}
+	err = init.Flush()
+	return
+}
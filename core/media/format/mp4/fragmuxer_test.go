@@ -0,0 +1,151 @@
+package mp4
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/aacparser"
+	"github.com/Youngju-Heo/gomedia/core/media/format/mp4/mp4io"
+)
+
+func testAACCodecData(t *testing.T) av.CodecData {
+	codec, err := aacparser.NewCodecDataFromMPEG4AudioConfig(aacparser.MPEG4AudioConfig{
+		ObjectType:      aacparser.AotAACLc,
+		SampleRateIndex: 4,
+		ChannelConfig:   2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return codec
+}
+
+// testFragPackets interleaves gops*gop video packets with 44.1kHz aac packets by time
+func testFragPackets(gops, gop int) (pkts []av.Packet) {
+	video := testVideoPackets(gops*gop, gop)
+	end := video[len(video)-1].Time
+	a := 0
+	for _, pkt := range video {
+		for ; time.Duration(a)*1024*time.Second/44100 < pkt.Time; a++ {
+			pkts = append(pkts, testAudioPacket(a))
+		}
+		pkts = append(pkts, pkt)
+	}
+	for ; time.Duration(a)*1024*time.Second/44100 <= end; a++ {
+		pkts = append(pkts, testAudioPacket(a))
+	}
+	return
+}
+
+func testAudioPacket(i int) av.Packet {
+	data := make([]byte, 50+i%7)
+	for j := range data {
+		data[j] = byte(i * j)
+	}
+	return av.Packet{Idx: 1, Time: time.Duration(i) * 1024 * time.Second / 44100, Data: data}
+}
+
+func TestFragMuxer(t *testing.T) {
+	const gops, gop = 3, 10
+	pkts := testFragPackets(gops, gop)
+
+	var buf bytes.Buffer
+	muxer := NewFragMuxer(&buf)
+	if err := muxer.WriteHeader([]av.CodecData{testHEVCCodecData(t), testAACCodecData(t)}); err != nil {
+		t.Fatal(err)
+	}
+	for _, pkt := range pkts {
+		if err := muxer.WritePacket(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+	atoms, err := mp4io.ReadFileAtoms(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var moofs []*mp4io.MovieFrag
+	for _, atom := range atoms {
+		if moof, ok := atom.(*mp4io.MovieFrag); ok {
+			moofs = append(moofs, moof)
+		}
+	}
+	if len(moofs) != gops {
+		t.Fatalf("moofs=%d, want %d", len(moofs), gops)
+	}
+
+	var videoPkts, audioPkts []av.Packet
+	for _, pkt := range pkts {
+		if pkt.Idx == 0 {
+			videoPkts = append(videoPkts, pkt)
+		} else {
+			audioPkts = append(audioPkts, pkt)
+		}
+	}
+
+	audioTime := uint64(0)
+	audioIdx := 0
+	for i, moof := range moofs {
+		if moof.Header.Seqnum != uint32(i+1) {
+			t.Errorf("moof#%d seqnum=%d", i, moof.Header.Seqnum)
+		}
+		if len(moof.Tracks) != 2 {
+			t.Fatalf("moof#%d trafs=%d", i, len(moof.Tracks))
+		}
+		moofPos, _ := moof.Pos()
+
+		video := moof.Tracks[0]
+		if video.Header.TrackID != 1 || video.Header.Flags&mp4io.TFHD_DEFAULT_BASE_IS_MOOF == 0 {
+			t.Errorf("moof#%d tfhd=%+v", i, video.Header)
+		}
+		if want := uint64(i * gop * 3600); video.DecodeTime.Time != want {
+			t.Errorf("moof#%d video tfdt=%d, want %d", i, video.DecodeTime.Time, want)
+		}
+		if len(video.Run.Entries) != gop {
+			t.Fatalf("moof#%d video samples=%d", i, len(video.Run.Entries))
+		}
+		offset := moofPos + int(video.Run.DataOffset)
+		for j, entry := range video.Run.Entries {
+			pkt := videoPkts[i*gop+j]
+			flags := uint32(fragSampleFlagsNonSync)
+			if pkt.IsKeyFrame {
+				flags = fragSampleFlagsSync
+			}
+			if entry.Duration != 3600 || entry.Size != uint32(len(pkt.Data)) || entry.Flags != flags {
+				t.Errorf("moof#%d video sample#%d %+v", i, j, entry)
+			}
+			if !bytes.Equal(b[offset:offset+int(entry.Size)], pkt.Data) {
+				t.Errorf("moof#%d video sample#%d data differs", i, j)
+			}
+			offset += int(entry.Size)
+		}
+
+		// audio follows video in mdat, samples are continuous across fragments
+		audio := moof.Tracks[1]
+		if audio.Header.TrackID != 2 || audio.DecodeTime.Time != audioTime {
+			t.Errorf("moof#%d audio trackid=%d tfdt=%d, want %d", i, audio.Header.TrackID, audio.DecodeTime.Time, audioTime)
+		}
+		if int(audio.Run.DataOffset) != offset-moofPos {
+			t.Errorf("moof#%d audio data offset=%d, want %d", i, audio.Run.DataOffset, offset-moofPos)
+		}
+		for _, entry := range audio.Run.Entries {
+			pkt := audioPkts[audioIdx]
+			// pkt.Time truncated to timescale
+			if entry.Duration < 1023 || entry.Duration > 1024 || !bytes.Equal(b[offset:offset+int(entry.Size)], pkt.Data) {
+				t.Errorf("moof#%d audio sample#%d %+v", i, audioIdx, entry)
+			}
+			offset += int(entry.Size)
+			audioTime += uint64(entry.Duration)
+			audioIdx++
+		}
+	}
+	if audioIdx != len(audioPkts) {
+		t.Errorf("audio samples=%d, want %d", audioIdx, len(audioPkts))
+	}
+}
@@ -8,7 +8,7 @@ import (
 )
 
 // CodecTypes var
-var CodecTypes = []av.CodecType{av.H264, av.AAC}
+var CodecTypes = []av.CodecType{av.H264, av.HEVC, av.MPEG4, av.AAC}
 
 // Handler type
 func Handler(h *avutil.RegisterHandler) {
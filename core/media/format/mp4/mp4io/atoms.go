@@ -27,6 +27,25 @@ func (inst AVC1Desc) Tag() Tag {
 	return AVC1
 }
 
+// HVC1 const
+const HVC1 = Tag(0x68766331)
+
+// HEV1 const, parsed into HVC1Desc as well
+const HEV1 = Tag(0x68657631)
+
+// Tag func
+func (inst HVC1Desc) Tag() Tag {
+	return HVC1
+}
+
+// HVCC const
+const HVCC = Tag(0x68766343)
+
+// Tag func
+func (inst HVC1Conf) Tag() Tag {
+	return HVCC
+}
+
 // URL const
 const URL = Tag(0x75726c20)
 
@@ -118,6 +137,14 @@ func (inst MovieExtend) Tag() Tag {
 // STSD const
 const STSD = Tag(0x73747364)
 
+// MP4V const
+const MP4V = Tag(0x6d703476)
+
+// Tag func
+func (inst MP4VDesc) Tag() Tag {
+	return MP4V
+}
+
 //Tag func
 func (inst SampleDesc) Tag() Tag {
 	return STSD
@@ -1863,6 +1890,8 @@ func (inst SampleTable) Children() (r []Atom) {
 type SampleDesc struct {
 	Version  uint8
 	AVC1Desc *AVC1Desc
+	HVC1Desc *HVC1Desc
+	MP4VDesc *MP4VDesc
 	MP4ADesc *MP4ADesc
 	Unknowns []Atom
 	AtomPos
@@ -1883,6 +1912,12 @@ func (inst SampleDesc) marshal(b []byte) (n int) {
 	if inst.AVC1Desc != nil {
 		_childrenNR++
 	}
+	if inst.HVC1Desc != nil {
+		_childrenNR++
+	}
+	if inst.MP4VDesc != nil {
+		_childrenNR++
+	}
 	if inst.MP4ADesc != nil {
 		_childrenNR++
 	}
@@ -1892,6 +1927,12 @@ func (inst SampleDesc) marshal(b []byte) (n int) {
 	if inst.AVC1Desc != nil {
 		n += inst.AVC1Desc.Marshal(b[n:])
 	}
+	if inst.HVC1Desc != nil {
+		n += inst.HVC1Desc.Marshal(b[n:])
+	}
+	if inst.MP4VDesc != nil {
+		n += inst.MP4VDesc.Marshal(b[n:])
+	}
 	if inst.MP4ADesc != nil {
 		n += inst.MP4ADesc.Marshal(b[n:])
 	}
@@ -1910,6 +1951,12 @@ func (inst SampleDesc) Len() (n int) {
 	if inst.AVC1Desc != nil {
 		n += inst.AVC1Desc.Len()
 	}
+	if inst.HVC1Desc != nil {
+		n += inst.HVC1Desc.Len()
+	}
+	if inst.MP4VDesc != nil {
+		n += inst.MP4VDesc.Len()
+	}
 	if inst.MP4ADesc != nil {
 		n += inst.MP4ADesc.Len()
 	}
@@ -1948,6 +1995,24 @@ func (inst *SampleDesc) Unmarshal(b []byte, offset int) (n int, err error) {
 				}
 				inst.AVC1Desc = atom
 			}
+		case HVC1, HEV1:
+			{
+				atom := &HVC1Desc{}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("hvc1", n+offset, err)
+					return
+				}
+				inst.HVC1Desc = atom
+			}
+		case MP4V:
+			{
+				atom := &MP4VDesc{}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("mp4v", n+offset, err)
+					return
+				}
+				inst.MP4VDesc = atom
+			}
 		case MP4A:
 			{
 				atom := &MP4ADesc{}
@@ -1977,6 +2042,12 @@ func (inst SampleDesc) Children() (r []Atom) {
 	if inst.AVC1Desc != nil {
 		r = append(r, inst.AVC1Desc)
 	}
+	if inst.HVC1Desc != nil {
+		r = append(r, inst.HVC1Desc)
+	}
+	if inst.MP4VDesc != nil {
+		r = append(r, inst.MP4VDesc)
+	}
 	if inst.MP4ADesc != nil {
 		r = append(r, inst.MP4ADesc)
 	}
@@ -2418,164 +2489,658 @@ func (inst AVC1Conf) Children() (r []Atom) {
 	return
 }
 
-// TimeToSample struct
-type TimeToSample struct {
-	Version uint8
-	Flags   uint32
-	Entries []TimeToSampleEntry
+// HVC1Desc struct
+type HVC1Desc struct {
+	DataRefIdx           int16
+	Version              int16
+	Revision             int16
+	Vendor               int32
+	TemporalQuality      int32
+	SpatialQuality       int32
+	Width                int16
+	Height               int16
+	HorizontalResolution float64
+	VorizontalResolution float64
+	FrameCount           int16
+	CompressorName       [32]byte
+	Depth                int16
+	ColorTableID         int16
+	Conf                 *HVC1Conf
+	Unknowns             []Atom
 	AtomPos
 }
 
 // Marshal func
-func (inst TimeToSample) Marshal(b []byte) (n int) {
-	pio.PutU32BE(b[4:], uint32(STTS))
+func (inst HVC1Desc) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(HVC1))
 	n += inst.marshal(b[8:]) + 8
 	pio.PutU32BE(b[0:], uint32(n))
 	return
 }
-func (inst TimeToSample) marshal(b []byte) (n int) {
-	pio.PutU8(b[n:], inst.Version)
-	n++
-	pio.PutU24BE(b[n:], inst.Flags)
-	n += 3
-	pio.PutU32BE(b[n:], uint32(len(inst.Entries)))
+func (inst HVC1Desc) marshal(b []byte) (n int) {
+	n += 6
+	pio.PutI16BE(b[n:], inst.DataRefIdx)
+	n += 2
+	pio.PutI16BE(b[n:], inst.Version)
+	n += 2
+	pio.PutI16BE(b[n:], inst.Revision)
+	n += 2
+	pio.PutI32BE(b[n:], inst.Vendor)
 	n += 4
-	for _, entry := range inst.Entries {
-		PutTimeToSampleEntry(b[n:], entry)
-		n += LenTimeToSampleEntry
+	pio.PutI32BE(b[n:], inst.TemporalQuality)
+	n += 4
+	pio.PutI32BE(b[n:], inst.SpatialQuality)
+	n += 4
+	pio.PutI16BE(b[n:], inst.Width)
+	n += 2
+	pio.PutI16BE(b[n:], inst.Height)
+	n += 2
+	PutFixed32(b[n:], inst.HorizontalResolution)
+	n += 4
+	PutFixed32(b[n:], inst.VorizontalResolution)
+	n += 4
+	n += 4
+	pio.PutI16BE(b[n:], inst.FrameCount)
+	n += 2
+	copy(b[n:], inst.CompressorName[:])
+	n += len(inst.CompressorName[:])
+	pio.PutI16BE(b[n:], inst.Depth)
+	n += 2
+	pio.PutI16BE(b[n:], inst.ColorTableID)
+	n += 2
+	if inst.Conf != nil {
+		n += inst.Conf.Marshal(b[n:])
+	}
+	for _, atom := range inst.Unknowns {
+		n += atom.Marshal(b[n:])
 	}
 	return
 }
 
 // Len func
-func (inst TimeToSample) Len() (n int) {
+func (inst HVC1Desc) Len() (n int) {
 	n += 8
-	n++
-	n += 3
+	n += 6
+	n += 2
+	n += 2
+	n += 2
 	n += 4
-	n += LenTimeToSampleEntry * len(inst.Entries)
+	n += 4
+	n += 4
+	n += 2
+	n += 2
+	n += 4
+	n += 4
+	n += 4
+	n += 2
+	n += len(inst.CompressorName[:])
+	n += 2
+	n += 2
+	if inst.Conf != nil {
+		n += inst.Conf.Len()
+	}
+	for _, atom := range inst.Unknowns {
+		n += atom.Len()
+	}
 	return
 }
 
 // Unmarshal func
-func (inst *TimeToSample) Unmarshal(b []byte, offset int) (n int, err error) {
+func (inst *HVC1Desc) Unmarshal(b []byte, offset int) (n int, err error) {
 	(&inst.AtomPos).setPos(offset, len(b))
 	n += 8
-	if len(b) < n+1 {
-		err = parseErr("Version", n+offset, err)
+	n += 6
+	if len(b) < n+2 {
+		err = parseErr("DataRefIdx", n+offset, err)
 		return
 	}
-	inst.Version = pio.U8(b[n:])
-	n++
-	if len(b) < n+3 {
-		err = parseErr("Flags", n+offset, err)
+	inst.DataRefIdx = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("Version", n+offset, err)
 		return
 	}
-	inst.Flags = pio.U24BE(b[n:])
-	n += 3
-	var lenEntries uint32
-	lenEntries = pio.U32BE(b[n:])
-	n += 4
-	inst.Entries = make([]TimeToSampleEntry, lenEntries)
-	if len(b) < n+LenTimeToSampleEntry*len(inst.Entries) {
-		err = parseErr("TimeToSampleEntry", n+offset, err)
+	inst.Version = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("Revision", n+offset, err)
 		return
 	}
-	for i := range inst.Entries {
-		inst.Entries[i] = GetTimeToSampleEntry(b[n:])
-		n += LenTimeToSampleEntry
+	inst.Revision = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+4 {
+		err = parseErr("Vendor", n+offset, err)
+		return
 	}
-	return
-}
-
-// Children func
-func (inst TimeToSample) Children() (r []Atom) {
-	return
-}
-
-// TimeToSampleEntry struct
-type TimeToSampleEntry struct {
-	Count    uint32
-	Duration uint32
-}
-
-// GetTimeToSampleEntry func
-func GetTimeToSampleEntry(b []byte) (inst TimeToSampleEntry) {
-	inst.Count = pio.U32BE(b[0:])
-	inst.Duration = pio.U32BE(b[4:])
-	return
-}
-
-// PutTimeToSampleEntry func
-func PutTimeToSampleEntry(b []byte, inst TimeToSampleEntry) {
-	pio.PutU32BE(b[0:], inst.Count)
-	pio.PutU32BE(b[4:], inst.Duration)
-}
-
-// LenTimeToSampleEntry const
-const LenTimeToSampleEntry = 8
-
-// SampleToChunk struct
-type SampleToChunk struct {
-	Version uint8
-	Flags   uint32
-	Entries []SampleToChunkEntry
-	AtomPos
-}
-
-// Marshal func
-func (inst SampleToChunk) Marshal(b []byte) (n int) {
-	pio.PutU32BE(b[4:], uint32(STSC))
-	n += inst.marshal(b[8:]) + 8
-	pio.PutU32BE(b[0:], uint32(n))
-	return
-}
-func (inst SampleToChunk) marshal(b []byte) (n int) {
-	pio.PutU8(b[n:], inst.Version)
-	n++
-	pio.PutU24BE(b[n:], inst.Flags)
-	n += 3
-	pio.PutU32BE(b[n:], uint32(len(inst.Entries)))
+	inst.Vendor = pio.I32BE(b[n:])
 	n += 4
-	for _, entry := range inst.Entries {
-		PutSampleToChunkEntry(b[n:], entry)
-		n += LenSampleToChunkEntry
+	if len(b) < n+4 {
+		err = parseErr("TemporalQuality", n+offset, err)
+		return
 	}
-	return
-}
-
-// Len func
-func (inst SampleToChunk) Len() (n int) {
-	n += 8
-	n++
-	n += 3
+	inst.TemporalQuality = pio.I32BE(b[n:])
 	n += 4
-	n += LenSampleToChunkEntry * len(inst.Entries)
-	return
-}
-
-// Unmarshal func
-func (inst *SampleToChunk) Unmarshal(b []byte, offset int) (n int, err error) {
-	(&inst.AtomPos).setPos(offset, len(b))
-	n += 8
-	if len(b) < n+1 {
-		err = parseErr("Version", n+offset, err)
+	if len(b) < n+4 {
+		err = parseErr("SpatialQuality", n+offset, err)
 		return
 	}
-	inst.Version = pio.U8(b[n:])
-	n++
-	if len(b) < n+3 {
-		err = parseErr("Flags", n+offset, err)
+	inst.SpatialQuality = pio.I32BE(b[n:])
+	n += 4
+	if len(b) < n+2 {
+		err = parseErr("Width", n+offset, err)
 		return
 	}
-	inst.Flags = pio.U24BE(b[n:])
-	n += 3
-	var lenEntries uint32
-	lenEntries = pio.U32BE(b[n:])
-	n += 4
-	inst.Entries = make([]SampleToChunkEntry, lenEntries)
-	if len(b) < n+LenSampleToChunkEntry*len(inst.Entries) {
-		err = parseErr("SampleToChunkEntry", n+offset, err)
+	inst.Width = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("Height", n+offset, err)
+		return
+	}
+	inst.Height = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+4 {
+		err = parseErr("HorizontalResolution", n+offset, err)
+		return
+	}
+	inst.HorizontalResolution = GetFixed32(b[n:])
+	n += 4
+	if len(b) < n+4 {
+		err = parseErr("VorizontalResolution", n+offset, err)
+		return
+	}
+	inst.VorizontalResolution = GetFixed32(b[n:])
+	n += 4
+	n += 4
+	if len(b) < n+2 {
+		err = parseErr("FrameCount", n+offset, err)
+		return
+	}
+	inst.FrameCount = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+len(inst.CompressorName) {
+		err = parseErr("CompressorName", n+offset, err)
+		return
+	}
+	copy(inst.CompressorName[:], b[n:])
+	n += len(inst.CompressorName)
+	if len(b) < n+2 {
+		err = parseErr("Depth", n+offset, err)
+		return
+	}
+	inst.Depth = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("ColorTableID", n+offset, err)
+		return
+	}
+	inst.ColorTableID = pio.I16BE(b[n:])
+	n += 2
+	for n+8 < len(b) {
+		tag := Tag(pio.U32BE(b[n+4:]))
+		size := int(pio.U32BE(b[n:]))
+		if len(b) < n+size {
+			err = parseErr("TagSizeInvalid", n+offset, err)
+			return
+		}
+		switch tag {
+		case HVCC:
+			{
+				atom := &HVC1Conf{}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("hvcC", n+offset, err)
+					return
+				}
+				inst.Conf = atom
+			}
+		default:
+			{
+				atom := &Dummy{TagItem: tag, Data: b[n : n+size]}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("", n+offset, err)
+					return
+				}
+				inst.Unknowns = append(inst.Unknowns, atom)
+			}
+		}
+		n += size
+	}
+	return
+}
+
+// Children func
+func (inst HVC1Desc) Children() (r []Atom) {
+	if inst.Conf != nil {
+		r = append(r, inst.Conf)
+	}
+	r = append(r, inst.Unknowns...)
+	return
+}
+
+// MP4VDesc struct, MPEG-4 Part 2 visual sample entry
+type MP4VDesc struct {
+	DataRefIdx           int16
+	Version              int16
+	Revision             int16
+	Vendor               int32
+	TemporalQuality      int32
+	SpatialQuality       int32
+	Width                int16
+	Height               int16
+	HorizontalResolution float64
+	VorizontalResolution float64
+	FrameCount           int16
+	CompressorName       [32]byte
+	Depth                int16
+	ColorTableID         int16
+	Conf                 *ElemStreamDesc
+	Unknowns             []Atom
+	AtomPos
+}
+
+// Marshal func
+func (inst MP4VDesc) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(MP4V))
+	n += inst.marshal(b[8:]) + 8
+	pio.PutU32BE(b[0:], uint32(n))
+	return
+}
+func (inst MP4VDesc) marshal(b []byte) (n int) {
+	n += 6
+	pio.PutI16BE(b[n:], inst.DataRefIdx)
+	n += 2
+	pio.PutI16BE(b[n:], inst.Version)
+	n += 2
+	pio.PutI16BE(b[n:], inst.Revision)
+	n += 2
+	pio.PutI32BE(b[n:], inst.Vendor)
+	n += 4
+	pio.PutI32BE(b[n:], inst.TemporalQuality)
+	n += 4
+	pio.PutI32BE(b[n:], inst.SpatialQuality)
+	n += 4
+	pio.PutI16BE(b[n:], inst.Width)
+	n += 2
+	pio.PutI16BE(b[n:], inst.Height)
+	n += 2
+	PutFixed32(b[n:], inst.HorizontalResolution)
+	n += 4
+	PutFixed32(b[n:], inst.VorizontalResolution)
+	n += 4
+	n += 4
+	pio.PutI16BE(b[n:], inst.FrameCount)
+	n += 2
+	copy(b[n:], inst.CompressorName[:])
+	n += len(inst.CompressorName[:])
+	pio.PutI16BE(b[n:], inst.Depth)
+	n += 2
+	pio.PutI16BE(b[n:], inst.ColorTableID)
+	n += 2
+	if inst.Conf != nil {
+		n += inst.Conf.Marshal(b[n:])
+	}
+	for _, atom := range inst.Unknowns {
+		n += atom.Marshal(b[n:])
+	}
+	return
+}
+
+// Len func
+func (inst MP4VDesc) Len() (n int) {
+	n += 8
+	n += 6
+	n += 2
+	n += 2
+	n += 2
+	n += 4
+	n += 4
+	n += 4
+	n += 2
+	n += 2
+	n += 4
+	n += 4
+	n += 4
+	n += 2
+	n += len(inst.CompressorName[:])
+	n += 2
+	n += 2
+	if inst.Conf != nil {
+		n += inst.Conf.Len()
+	}
+	for _, atom := range inst.Unknowns {
+		n += atom.Len()
+	}
+	return
+}
+
+// Unmarshal func
+func (inst *MP4VDesc) Unmarshal(b []byte, offset int) (n int, err error) {
+	(&inst.AtomPos).setPos(offset, len(b))
+	n += 8
+	n += 6
+	if len(b) < n+2 {
+		err = parseErr("DataRefIdx", n+offset, err)
+		return
+	}
+	inst.DataRefIdx = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("Version", n+offset, err)
+		return
+	}
+	inst.Version = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("Revision", n+offset, err)
+		return
+	}
+	inst.Revision = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+4 {
+		err = parseErr("Vendor", n+offset, err)
+		return
+	}
+	inst.Vendor = pio.I32BE(b[n:])
+	n += 4
+	if len(b) < n+4 {
+		err = parseErr("TemporalQuality", n+offset, err)
+		return
+	}
+	inst.TemporalQuality = pio.I32BE(b[n:])
+	n += 4
+	if len(b) < n+4 {
+		err = parseErr("SpatialQuality", n+offset, err)
+		return
+	}
+	inst.SpatialQuality = pio.I32BE(b[n:])
+	n += 4
+	if len(b) < n+2 {
+		err = parseErr("Width", n+offset, err)
+		return
+	}
+	inst.Width = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("Height", n+offset, err)
+		return
+	}
+	inst.Height = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+4 {
+		err = parseErr("HorizontalResolution", n+offset, err)
+		return
+	}
+	inst.HorizontalResolution = GetFixed32(b[n:])
+	n += 4
+	if len(b) < n+4 {
+		err = parseErr("VorizontalResolution", n+offset, err)
+		return
+	}
+	inst.VorizontalResolution = GetFixed32(b[n:])
+	n += 4
+	n += 4
+	if len(b) < n+2 {
+		err = parseErr("FrameCount", n+offset, err)
+		return
+	}
+	inst.FrameCount = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+len(inst.CompressorName) {
+		err = parseErr("CompressorName", n+offset, err)
+		return
+	}
+	copy(inst.CompressorName[:], b[n:])
+	n += len(inst.CompressorName)
+	if len(b) < n+2 {
+		err = parseErr("Depth", n+offset, err)
+		return
+	}
+	inst.Depth = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("ColorTableID", n+offset, err)
+		return
+	}
+	inst.ColorTableID = pio.I16BE(b[n:])
+	n += 2
+	for n+8 < len(b) {
+		tag := Tag(pio.U32BE(b[n+4:]))
+		size := int(pio.U32BE(b[n:]))
+		if len(b) < n+size {
+			err = parseErr("TagSizeInvalid", n+offset, err)
+			return
+		}
+		switch tag {
+		case ESDS:
+			{
+				atom := &ElemStreamDesc{}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("esds", n+offset, err)
+					return
+				}
+				inst.Conf = atom
+			}
+		default:
+			{
+				atom := &Dummy{TagItem: tag, Data: b[n : n+size]}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("", n+offset, err)
+					return
+				}
+				inst.Unknowns = append(inst.Unknowns, atom)
+			}
+		}
+		n += size
+	}
+	return
+}
+
+// Children func
+func (inst MP4VDesc) Children() (r []Atom) {
+	if inst.Conf != nil {
+		r = append(r, inst.Conf)
+	}
+	r = append(r, inst.Unknowns...)
+	return
+}
+
+// HVC1Conf struct
+type HVC1Conf struct {
+	Data []byte
+	AtomPos
+}
+
+// Marshal func
+func (inst HVC1Conf) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(HVCC))
+	n += inst.marshal(b[8:]) + 8
+	pio.PutU32BE(b[0:], uint32(n))
+	return
+}
+func (inst HVC1Conf) marshal(b []byte) (n int) {
+	copy(b[n:], inst.Data[:])
+	n += len(inst.Data[:])
+	return
+}
+
+// Len func
+func (inst HVC1Conf) Len() (n int) {
+	n += 8
+	n += len(inst.Data[:])
+	return
+}
+
+// Unmarshal func
+func (inst *HVC1Conf) Unmarshal(b []byte, offset int) (n int, err error) {
+	(&inst.AtomPos).setPos(offset, len(b))
+	n += 8
+	inst.Data = b[n:]
+	n += len(b[n:])
+	return
+}
+
+// Children func
+func (inst HVC1Conf) Children() (r []Atom) {
+	return
+}
+
+// TimeToSample struct
+type TimeToSample struct {
+	Version uint8
+	Flags   uint32
+	Entries []TimeToSampleEntry
+	AtomPos
+}
+
+// Marshal func
+func (inst TimeToSample) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(STTS))
+	n += inst.marshal(b[8:]) + 8
+	pio.PutU32BE(b[0:], uint32(n))
+	return
+}
+func (inst TimeToSample) marshal(b []byte) (n int) {
+	pio.PutU8(b[n:], inst.Version)
+	n++
+	pio.PutU24BE(b[n:], inst.Flags)
+	n += 3
+	pio.PutU32BE(b[n:], uint32(len(inst.Entries)))
+	n += 4
+	for _, entry := range inst.Entries {
+		PutTimeToSampleEntry(b[n:], entry)
+		n += LenTimeToSampleEntry
+	}
+	return
+}
+
+// Len func
+func (inst TimeToSample) Len() (n int) {
+	n += 8
+	n++
+	n += 3
+	n += 4
+	n += LenTimeToSampleEntry * len(inst.Entries)
+	return
+}
+
+// Unmarshal func
+func (inst *TimeToSample) Unmarshal(b []byte, offset int) (n int, err error) {
+	(&inst.AtomPos).setPos(offset, len(b))
+	n += 8
+	if len(b) < n+1 {
+		err = parseErr("Version", n+offset, err)
+		return
+	}
+	inst.Version = pio.U8(b[n:])
+	n++
+	if len(b) < n+3 {
+		err = parseErr("Flags", n+offset, err)
+		return
+	}
+	inst.Flags = pio.U24BE(b[n:])
+	n += 3
+	var lenEntries uint32
+	lenEntries = pio.U32BE(b[n:])
+	n += 4
+	inst.Entries = make([]TimeToSampleEntry, lenEntries)
+	if len(b) < n+LenTimeToSampleEntry*len(inst.Entries) {
+		err = parseErr("TimeToSampleEntry", n+offset, err)
+		return
+	}
+	for i := range inst.Entries {
+		inst.Entries[i] = GetTimeToSampleEntry(b[n:])
+		n += LenTimeToSampleEntry
+	}
+	return
+}
+
+// Children func
+func (inst TimeToSample) Children() (r []Atom) {
+	return
+}
+
+// TimeToSampleEntry struct
+type TimeToSampleEntry struct {
+	Count    uint32
+	Duration uint32
+}
+
+// GetTimeToSampleEntry func
+func GetTimeToSampleEntry(b []byte) (inst TimeToSampleEntry) {
+	inst.Count = pio.U32BE(b[0:])
+	inst.Duration = pio.U32BE(b[4:])
+	return
+}
+
+// PutTimeToSampleEntry func
+func PutTimeToSampleEntry(b []byte, inst TimeToSampleEntry) {
+	pio.PutU32BE(b[0:], inst.Count)
+	pio.PutU32BE(b[4:], inst.Duration)
+}
+
+// LenTimeToSampleEntry const
+const LenTimeToSampleEntry = 8
+
+// SampleToChunk struct
+type SampleToChunk struct {
+	Version uint8
+	Flags   uint32
+	Entries []SampleToChunkEntry
+	AtomPos
+}
+
+// Marshal func
+func (inst SampleToChunk) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(STSC))
+	n += inst.marshal(b[8:]) + 8
+	pio.PutU32BE(b[0:], uint32(n))
+	return
+}
+func (inst SampleToChunk) marshal(b []byte) (n int) {
+	pio.PutU8(b[n:], inst.Version)
+	n++
+	pio.PutU24BE(b[n:], inst.Flags)
+	n += 3
+	pio.PutU32BE(b[n:], uint32(len(inst.Entries)))
+	n += 4
+	for _, entry := range inst.Entries {
+		PutSampleToChunkEntry(b[n:], entry)
+		n += LenSampleToChunkEntry
+	}
+	return
+}
+
+// Len func
+func (inst SampleToChunk) Len() (n int) {
+	n += 8
+	n++
+	n += 3
+	n += 4
+	n += LenSampleToChunkEntry * len(inst.Entries)
+	return
+}
+
+// Unmarshal func
+func (inst *SampleToChunk) Unmarshal(b []byte, offset int) (n int, err error) {
+	(&inst.AtomPos).setPos(offset, len(b))
+	n += 8
+	if len(b) < n+1 {
+		err = parseErr("Version", n+offset, err)
+		return
+	}
+	inst.Version = pio.U8(b[n:])
+	n++
+	if len(b) < n+3 {
+		err = parseErr("Flags", n+offset, err)
+		return
+	}
+	inst.Flags = pio.U24BE(b[n:])
+	n += 3
+	var lenEntries uint32
+	lenEntries = pio.U32BE(b[n:])
+	n += 4
+	inst.Entries = make([]SampleToChunkEntry, lenEntries)
+	if len(b) < n+LenSampleToChunkEntry*len(inst.Entries) {
+		err = parseErr("SampleToChunkEntry", n+offset, err)
 		return
 	}
 	for i := range inst.Entries {
@@ -3461,13 +4026,8 @@ func (inst TrackFragRun) marshal(b []byte) (n int) {
 		}
 	}
 
-	for i, entry := range inst.Entries {
-		var flags uint32
-		if i > 0 {
-			flags = inst.Flags
-		} else {
-			flags = inst.FirstSampleFlags
-		}
+	for _, entry := range inst.Entries {
+		flags := inst.Flags
 		if flags&TRUN_SAMPLE_DURATION != 0 {
 			pio.PutU32BE(b[n:], entry.Duration)
 			n += 4
@@ -3505,13 +4065,8 @@ func (inst TrackFragRun) Len() (n int) {
 		}
 	}
 
-	for i := range inst.Entries {
-		var flags uint32
-		if i > 0 {
-			flags = inst.Flags
-		} else {
-			flags = inst.FirstSampleFlags
-		}
+	for range inst.Entries {
+		flags := inst.Flags
 		if flags&TRUN_SAMPLE_DURATION != 0 {
 			n += 4
 		}
@@ -3545,8 +4100,16 @@ func (inst *TrackFragRun) Unmarshal(b []byte, offset int) (n int, err error) {
 	inst.Flags = pio.U24BE(b[n:])
 	n += 3
 	var lenEntries uint32
+	if len(b) < n+4 {
+		err = parseErr("len:Entries", n+offset, err)
+		return
+	}
 	lenEntries = pio.U32BE(b[n:])
 	n += 4
+	if uint64(lenEntries)*uint64(trunEntryLen(inst.Flags)) > uint64(len(b)) {
+		err = parseErr("TrackFragRunEntry", n+offset, err)
+		return
+	}
 	inst.Entries = make([]TrackFragRunEntry, lenEntries)
 	if inst.Flags&TRUN_DATA_OFFSET != 0 {
 		{
@@ -3570,13 +4133,12 @@ func (inst *TrackFragRun) Unmarshal(b []byte, offset int) (n int, err error) {
 	}
 
 	for i := 0; i < int(lenEntries); i++ {
-		var flags uint32
-		if i > 0 {
-			flags = inst.Flags
-		} else {
-			flags = inst.FirstSampleFlags
-		}
+		flags := inst.Flags
 		entry := &inst.Entries[i]
+		if len(b) < n+trunEntryLen(flags) {
+			err = parseErr("TrackFragRunEntry", n+offset, err)
+			return
+		}
 		if flags&TRUN_SAMPLE_DURATION != 0 {
 			entry.Duration = pio.U32BE(b[n:])
 			n += 4
@@ -3634,6 +4196,7 @@ const LenTrackFragRunEntry = 16
 type TrackFragHeader struct {
 	Version         uint8
 	Flags           uint32
+	TrackID         uint32
 	BaseDataOffset  uint64
 	StsdID          uint32
 	DefaultDuration uint32
@@ -3654,6 +4217,8 @@ func (inst TrackFragHeader) marshal(b []byte) (n int) {
 	n++
 	pio.PutU24BE(b[n:], inst.Flags)
 	n += 3
+	pio.PutU32BE(b[n:], inst.TrackID)
+	n += 4
 	if inst.Flags&TFHD_BASE_DATA_OFFSET != 0 {
 		{
 			pio.PutU64BE(b[n:], inst.BaseDataOffset)
@@ -3692,6 +4257,7 @@ func (inst TrackFragHeader) Len() (n int) {
 	n += 8
 	n++
 	n += 3
+	n += 4
 	if inst.Flags&TFHD_BASE_DATA_OFFSET != 0 {
 		{
 			n += 8
@@ -3736,6 +4302,12 @@ func (inst *TrackFragHeader) Unmarshal(b []byte, offset int) (n int, err error)
 	}
 	inst.Flags = pio.U24BE(b[n:])
 	n += 3
+	if len(b) < n+4 {
+		err = parseErr("TrackID", n+offset, err)
+		return
+	}
+	inst.TrackID = pio.U32BE(b[n:])
+	n += 4
 	if inst.Flags&TFHD_BASE_DATA_OFFSET != 0 {
 		{
 			if len(b) < n+8 {
@@ -3798,7 +4370,7 @@ func (inst TrackFragHeader) Children() (r []Atom) {
 type TrackFragDecodeTime struct {
 	Version uint8
 	Flags   uint32
-	Time    time.Time
+	Time    uint64
 	AtomPos
 }
 
@@ -3815,11 +4387,10 @@ func (inst TrackFragDecodeTime) marshal(b []byte) (n int) {
 	pio.PutU24BE(b[n:], inst.Flags)
 	n += 3
 	if inst.Version != 0 {
-		PutTime64(b[n:], inst.Time)
+		pio.PutU64BE(b[n:], inst.Time)
 		n += 8
 	} else {
-
-		PutTime32(b[n:], inst.Time)
+		pio.PutU32BE(b[n:], uint32(inst.Time))
 		n += 4
 	}
 	return
@@ -3833,7 +4404,6 @@ func (inst TrackFragDecodeTime) Len() (n int) {
 	if inst.Version != 0 {
 		n += 8
 	} else {
-
 		n += 4
 	}
 	return
@@ -3856,11 +4426,18 @@ func (inst *TrackFragDecodeTime) Unmarshal(b []byte, offset int) (n int, err err
 	inst.Flags = pio.U24BE(b[n:])
 	n += 3
 	if inst.Version != 0 {
-		inst.Time = GetTime64(b[n:])
+		if len(b) < n+8 {
+			err = parseErr("Time", n+offset, err)
+			return
+		}
+		inst.Time = pio.U64BE(b[n:])
 		n += 8
 	} else {
-
-		inst.Time = GetTime32(b[n:])
+		if len(b) < n+4 {
+			err = parseErr("Time", n+offset, err)
+			return
+		}
+		inst.Time = uint64(pio.U32BE(b[n:]))
 		n += 4
 	}
 	return
@@ -0,0 +1,382 @@
+package mp4io
+
+import (
+	"fmt"
+
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
+)
+
+// SIDX const
+const SIDX = Tag(0x73696478)
+
+// MFRA const
+const MFRA = Tag(0x6d667261)
+
+// TFRA const
+const TFRA = Tag(0x74667261)
+
+// MFRO const
+const MFRO = Tag(0x6d66726f)
+
+// SegmentIndexEntry struct
+type SegmentIndexEntry struct {
+	ReferenceType      uint8 // 1 when entry refers another sidx
+	ReferencedSize     uint32
+	SubsegmentDuration uint32
+	StartsWithSAP      uint8
+	SAPType            uint8
+	SAPDeltaTime       uint32
+}
+
+// SegmentIndex is sidx, offsets of entries start from first byte after this atom plus FirstOffset
+type SegmentIndex struct {
+	Version                  uint8
+	Flags                    uint32
+	ReferenceID              uint32
+	TimeScale                uint32
+	EarliestPresentationTime uint64
+	FirstOffset              uint64
+	Entries                  []SegmentIndexEntry
+	AtomPos
+}
+
+// Tag func
+func (inst SegmentIndex) Tag() Tag {
+	return SIDX
+}
+
+// Marshal func
+func (inst SegmentIndex) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(SIDX))
+	n += 8
+	pio.PutU8(b[n:], inst.Version)
+	n++
+	pio.PutU24BE(b[n:], inst.Flags)
+	n += 3
+	pio.PutU32BE(b[n:], inst.ReferenceID)
+	n += 4
+	pio.PutU32BE(b[n:], inst.TimeScale)
+	n += 4
+	if inst.Version != 0 {
+		pio.PutU64BE(b[n:], inst.EarliestPresentationTime)
+		n += 8
+		pio.PutU64BE(b[n:], inst.FirstOffset)
+		n += 8
+	} else {
+		pio.PutU32BE(b[n:], uint32(inst.EarliestPresentationTime))
+		n += 4
+		pio.PutU32BE(b[n:], uint32(inst.FirstOffset))
+		n += 4
+	}
+	pio.PutU16BE(b[n:], 0)
+	n += 2
+	pio.PutU16BE(b[n:], uint16(len(inst.Entries)))
+	n += 2
+	for _, entry := range inst.Entries {
+		pio.PutU32BE(b[n:], uint32(entry.ReferenceType)<<31|entry.ReferencedSize&0x7fffffff)
+		n += 4
+		pio.PutU32BE(b[n:], entry.SubsegmentDuration)
+		n += 4
+		pio.PutU32BE(b[n:], uint32(entry.StartsWithSAP)<<31|uint32(entry.SAPType&0x7)<<28|entry.SAPDeltaTime&0x0fffffff)
+		n += 4
+	}
+	pio.PutU32BE(b[0:], uint32(n))
+	return
+}
+
+// Len func
+func (inst SegmentIndex) Len() (n int) {
+	n = 8 + 4 + 4 + 4 + 2 + 2 + 12*len(inst.Entries)
+	if inst.Version != 0 {
+		n += 16
+	} else {
+		n += 8
+	}
+	return
+}
+
+// Unmarshal func
+func (inst *SegmentIndex) Unmarshal(b []byte, offset int) (n int, err error) {
+	(&inst.AtomPos).setPos(offset, len(b))
+	n += 8
+	if len(b) < n+12 {
+		err = parseErr("SegmentIndex", n+offset, err)
+		return
+	}
+	inst.Version = pio.U8(b[n:])
+	n++
+	inst.Flags = pio.U24BE(b[n:])
+	n += 3
+	inst.ReferenceID = pio.U32BE(b[n:])
+	n += 4
+	inst.TimeScale = pio.U32BE(b[n:])
+	n += 4
+	if inst.Version != 0 {
+		if len(b) < n+16 {
+			err = parseErr("EarliestPresentationTime", n+offset, err)
+			return
+		}
+		inst.EarliestPresentationTime = pio.U64BE(b[n:])
+		n += 8
+		inst.FirstOffset = pio.U64BE(b[n:])
+		n += 8
+	} else {
+		if len(b) < n+8 {
+			err = parseErr("EarliestPresentationTime", n+offset, err)
+			return
+		}
+		inst.EarliestPresentationTime = uint64(pio.U32BE(b[n:]))
+		n += 4
+		inst.FirstOffset = uint64(pio.U32BE(b[n:]))
+		n += 4
+	}
+	if len(b) < n+4 {
+		err = parseErr("ReferenceCount", n+offset, err)
+		return
+	}
+	n += 2
+	count := int(pio.U16BE(b[n:]))
+	n += 2
+	if len(b) < n+12*count {
+		err = parseErr("SegmentIndexEntry", n+offset, err)
+		return
+	}
+	inst.Entries = make([]SegmentIndexEntry, count)
+	for i := range inst.Entries {
+		entry := &inst.Entries[i]
+		u := pio.U32BE(b[n:])
+		entry.ReferenceType = uint8(u >> 31)
+		entry.ReferencedSize = u & 0x7fffffff
+		entry.SubsegmentDuration = pio.U32BE(b[n+4:])
+		u = pio.U32BE(b[n+8:])
+		entry.StartsWithSAP = uint8(u >> 31)
+		entry.SAPType = uint8(u>>28) & 0x7
+		entry.SAPDeltaTime = u & 0x0fffffff
+		n += 12
+	}
+	return
+}
+
+// Children func
+func (inst SegmentIndex) Children() (r []Atom) {
+	return
+}
+
+func (inst SegmentIndex) String() string {
+	return fmt.Sprintf("trackid=%d entries=%d", inst.ReferenceID, len(inst.Entries))
+}
+
+// MovieFragRandomAccess is mfra, placed at end of file and located by its last child mfro
+type MovieFragRandomAccess struct {
+	Tracks   []*TrackFragRandomAccess
+	Unknowns []Atom
+	AtomPos
+}
+
+// Tag func
+func (inst MovieFragRandomAccess) Tag() Tag {
+	return MFRA
+}
+
+// Marshal func
+func (inst MovieFragRandomAccess) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(MFRA))
+	n += 8
+	for _, atom := range inst.Tracks {
+		n += atom.Marshal(b[n:])
+	}
+	for _, atom := range inst.Unknowns {
+		n += atom.Marshal(b[n:])
+	}
+	pio.PutU32BE(b[0:], uint32(n))
+	return
+}
+
+// Len func
+func (inst MovieFragRandomAccess) Len() (n int) {
+	n += 8
+	for _, atom := range inst.Tracks {
+		n += atom.Len()
+	}
+	for _, atom := range inst.Unknowns {
+		n += atom.Len()
+	}
+	return
+}
+
+// Unmarshal func
+func (inst *MovieFragRandomAccess) Unmarshal(b []byte, offset int) (n int, err error) {
+	(&inst.AtomPos).setPos(offset, len(b))
+	n += 8
+	for n+8 <= len(b) {
+		tag := Tag(pio.U32BE(b[n+4:]))
+		size := int(pio.U32BE(b[n:]))
+		if size < 8 || len(b) < n+size {
+			err = parseErr("TagSizeInvalid", n+offset, err)
+			return
+		}
+		switch tag {
+		case TFRA:
+			atom := &TrackFragRandomAccess{}
+			if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+				err = parseErr("tfra", n+offset, err)
+				return
+			}
+			inst.Tracks = append(inst.Tracks, atom)
+		default:
+			atom := &Dummy{TagItem: tag, Data: b[n : n+size]}
+			if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+				err = parseErr("", n+offset, err)
+				return
+			}
+			inst.Unknowns = append(inst.Unknowns, atom)
+		}
+		n += size
+	}
+	return
+}
+
+// Children func
+func (inst MovieFragRandomAccess) Children() (r []Atom) {
+	for _, atom := range inst.Tracks {
+		r = append(r, atom)
+	}
+	r = append(r, inst.Unknowns...)
+	return
+}
+
+// TrackFragRandomAccessEntry struct
+type TrackFragRandomAccessEntry struct {
+	Time         uint64
+	MoofOffset   uint64
+	TrafNumber   uint32
+	TrunNumber   uint32
+	SampleNumber uint32
+}
+
+// TrackFragRandomAccess is tfra, sync samples of one track
+type TrackFragRandomAccess struct {
+	Version uint8
+	Flags   uint32
+	TrackID uint32
+	Entries []TrackFragRandomAccessEntry
+	AtomPos
+}
+
+// Tag func
+func (inst TrackFragRandomAccess) Tag() Tag {
+	return TFRA
+}
+
+// Marshal func, traf/trun/sample numbers are written in 4 bytes
+func (inst TrackFragRandomAccess) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(TFRA))
+	n += 8
+	pio.PutU8(b[n:], inst.Version)
+	n++
+	pio.PutU24BE(b[n:], inst.Flags)
+	n += 3
+	pio.PutU32BE(b[n:], inst.TrackID)
+	n += 4
+	pio.PutU32BE(b[n:], 0x3f)
+	n += 4
+	pio.PutU32BE(b[n:], uint32(len(inst.Entries)))
+	n += 4
+	for _, entry := range inst.Entries {
+		if inst.Version != 0 {
+			pio.PutU64BE(b[n:], entry.Time)
+			n += 8
+			pio.PutU64BE(b[n:], entry.MoofOffset)
+			n += 8
+		} else {
+			pio.PutU32BE(b[n:], uint32(entry.Time))
+			n += 4
+			pio.PutU32BE(b[n:], uint32(entry.MoofOffset))
+			n += 4
+		}
+		pio.PutU32BE(b[n:], entry.TrafNumber)
+		n += 4
+		pio.PutU32BE(b[n:], entry.TrunNumber)
+		n += 4
+		pio.PutU32BE(b[n:], entry.SampleNumber)
+		n += 4
+	}
+	pio.PutU32BE(b[0:], uint32(n))
+	return
+}
+
+// Len func
+func (inst TrackFragRandomAccess) Len() (n int) {
+	entryLen := 8 + 12
+	if inst.Version != 0 {
+		entryLen = 16 + 12
+	}
+	return 8 + 4 + 4 + 4 + 4 + entryLen*len(inst.Entries)
+}
+
+// Unmarshal func
+func (inst *TrackFragRandomAccess) Unmarshal(b []byte, offset int) (n int, err error) {
+	(&inst.AtomPos).setPos(offset, len(b))
+	n += 8
+	if len(b) < n+16 {
+		err = parseErr("TrackFragRandomAccess", n+offset, err)
+		return
+	}
+	inst.Version = pio.U8(b[n:])
+	n++
+	inst.Flags = pio.U24BE(b[n:])
+	n += 3
+	inst.TrackID = pio.U32BE(b[n:])
+	n += 4
+	sizes := pio.U32BE(b[n:])
+	n += 4
+	count := int(pio.U32BE(b[n:]))
+	n += 4
+
+	trafLen := int(sizes>>4&0x3) + 1
+	trunLen := int(sizes>>2&0x3) + 1
+	sampleLen := int(sizes&0x3) + 1
+	entryLen := 8 + trafLen + trunLen + sampleLen
+	if inst.Version != 0 {
+		entryLen += 8
+	}
+	if count < 0 || len(b) < n+entryLen*count {
+		err = parseErr("TrackFragRandomAccessEntry", n+offset, err)
+		return
+	}
+
+	getUint := func(size int) (u uint32) {
+		for i := 0; i < size; i++ {
+			u = u<<8 | uint32(b[n+i])
+		}
+		n += size
+		return
+	}
+
+	inst.Entries = make([]TrackFragRandomAccessEntry, count)
+	for i := range inst.Entries {
+		entry := &inst.Entries[i]
+		if inst.Version != 0 {
+			entry.Time = pio.U64BE(b[n:])
+			entry.MoofOffset = pio.U64BE(b[n+8:])
+			n += 16
+		} else {
+			entry.Time = uint64(pio.U32BE(b[n:]))
+			entry.MoofOffset = uint64(pio.U32BE(b[n+4:]))
+			n += 8
+		}
+		entry.TrafNumber = getUint(trafLen)
+		entry.TrunNumber = getUint(trunLen)
+		entry.SampleNumber = getUint(sampleLen)
+	}
+	return
+}
+
+// Children func
+func (inst TrackFragRandomAccess) Children() (r []Atom) {
+	return
+}
+
+func (inst TrackFragRandomAccess) String() string {
+	return fmt.Sprintf("trackid=%d entries=%d", inst.TrackID, len(inst.Entries))
+}
@@ -131,6 +131,7 @@ func stsdSampleDesc() {
 	_skip(3)
 	int32(_childrenNR)
 	atom(AVC1Desc, AVC1Desc)
+	atom(HVC1Desc, HVC1Desc)
 	atom(MP4ADesc, MP4ADesc)
 	_unknowns()
 }
@@ -175,6 +176,31 @@ func avcCAVC1Conf() {
 	bytesleft(Data)
 }
 
+func hvc1HVC1Desc() {
+	_skip(6)
+	int16(DataRefIdx)
+	int16(Version)
+	int16(Revision)
+	int32(Vendor)
+	int32(TemporalQuality)
+	int32(SpatialQuality)
+	int16(Width)
+	int16(Height)
+	fixed32(HorizontalResolution)
+	fixed32(VorizontalResolution)
+	_skip(4)
+	int16(FrameCount)
+	bytes(CompressorName, 32)
+	int16(Depth)
+	int16(ColorTableID)
+	atom(Conf, HVC1Conf)
+	_unknowns()
+}
+
+func hvcCHVC1Conf() {
+	bytesleft(Data)
+}
+
 func sttsTimeToSample() {
 	uint8(Version)
 	uint24(Flags)
@@ -291,13 +317,8 @@ func trunTrackFragRun() {
 	}))
 
 	slice(Entries, TrackFragRunEntry, _code(func() {
-		for i, entry := range self.Entries {
-			var flags uint32
-			if i > 0 {
-				flags = self.Flags
-			} else {
-				flags = self.FirstSampleFlags
-			}
+		for _, entry := range self.Entries {
+			flags := self.Flags
 			if flags&TRUN_SAMPLE_DURATION != 0 {
 				pio.PutU32BE(b[n:], entry.Duration)
 				n += 4
@@ -316,13 +337,8 @@ func trunTrackFragRun() {
 			}
 		}
 	}, func() {
-		for i := range self.Entries {
-			var flags uint32
-			if i > 0 {
-				flags = self.Flags
-			} else {
-				flags = self.FirstSampleFlags
-			}
+		for range self.Entries {
+			flags := self.Flags
 			if flags&TRUN_SAMPLE_DURATION != 0 {
 				n += 4
 			}
@@ -338,13 +354,12 @@ func trunTrackFragRun() {
 		}
 	}, func() {
 		for i := 0; i < int(_len_Entries); i++ {
-			var flags uint32
-			if i > 0 {
-				flags = self.Flags
-			} else {
-				flags = self.FirstSampleFlags
-			}
+			flags := self.Flags
 			entry := &self.Entries[i]
+			if len(b) < n+trunEntryLen(flags) {
+				err = parseErr("TrackFragRunEntry", n+offset, err)
+				return
+			}
 			if flags&TRUN_SAMPLE_DURATION != 0 {
 				entry.Duration = pio.U32BE(b[n:])
 				n += 4
@@ -375,6 +390,7 @@ func TrackFragRunEntry() {
 func tfhdTrackFragHeader() {
 	uint8(Version)
 	uint24(Flags)
+	uint32(TrackID)
 
 	uint64(BaseDataOffset, _code(func() {
 		if self.Flags&TFHD_BASE_DATA_OFFSET != 0 {
@@ -410,12 +426,12 @@ func tfhdTrackFragHeader() {
 func tfdtTrackFragDecodeTime() {
 	uint8(Version)
 	uint24(Flags)
-	time64(Time, _code(func() {
+	uint64(Time, _code(func() {
 		if self.Version != 0 {
-			PutTime64(b[n:], self.Time)
+			pio.PutU64BE(b[n:], self.Time)
 			n += 8
 		} else {
-			PutTime32(b[n:], self.Time)
+			pio.PutU32BE(b[n:], uint32(self.Time))
 			n += 4
 		}
 	}, func() {
@@ -426,10 +442,10 @@ func tfdtTrackFragDecodeTime() {
 		}
 	}, func() {
 		if self.Version != 0 {
-			self.Time = GetTime64(b[n:])
+			self.Time = pio.U64BE(b[n:])
 			n += 8
 		} else {
-			self.Time = GetTime32(b[n:])
+			self.Time = uint64(pio.U32BE(b[n:]))
 			n += 4
 		}
 	}))
@@ -206,16 +206,36 @@ const (
 	TRUN_SAMPLE_CTS         = 0x800
 )
 
+// trunEntryLen returns size of one trun sample entry with given trun flags
+func trunEntryLen(flags uint32) (n int) {
+	for _, flag := range []uint32{TRUN_SAMPLE_DURATION, TRUN_SAMPLE_SIZE, TRUN_SAMPLE_FLAGS, TRUN_SAMPLE_CTS} {
+		if flags&flag != 0 {
+			n += 4
+		}
+	}
+	return
+}
+
 const (
 	MP4ESDescrTag          = 3
 	MP4DecConfigDescrTag   = 4
 	MP4DecSpecificDescrTag = 5
 )
 
-// ElemStreamDesc struct
+// object type indication and stream type of DecoderConfigDescriptor
+const (
+	MP4ObjectTypeVisual = 0x20 // ISO/IEC 14496-2 visual
+	MP4ObjectTypeAudio  = 0x40 // ISO/IEC 14496-3 audio
+	MP4StreamTypeVisual = 0x04
+	MP4StreamTypeAudio  = 0x05
+)
+
+// ElemStreamDesc struct, ObjectType and StreamType are of audio if 0
 type ElemStreamDesc struct {
-	DecConfig []byte
-	TrackID   uint16
+	DecConfig  []byte
+	TrackID    uint16
+	ObjectType uint8
+	StreamType uint8
 	AtomPos
 }
 
@@ -264,9 +284,16 @@ func (inst ElemStreamDesc) lenDecConfigDescHdr() (n int) {
 
 func (inst ElemStreamDesc) fillDecConfigDescHdr(b []byte, datalen int) (n int) {
 	n += inst.fillDescHdr(b[n:], MP4DecConfigDescrTag, datalen)
-	b[n] = 0x40 // objectid
+	objectType, streamType := inst.ObjectType, inst.StreamType
+	if objectType == 0 {
+		objectType = MP4ObjectTypeAudio
+	}
+	if streamType == 0 {
+		streamType = MP4StreamTypeAudio
+	}
+	b[n] = objectType
 	n++
-	b[n] = 0x15 // streamtype
+	b[n] = streamType<<2 | 1 // upstream 0, reserved 1
 	n++
 	// buffer size db
 	pio.PutU24BE(b[n:], 0)
@@ -309,8 +336,8 @@ func (inst ElemStreamDesc) Marshal(b []byte) (n int) {
 	pio.PutU32BE(b[n:], 0) // Version
 	n += 4
 	datalen := inst.Len()
-	n += inst.fillESDescHdr(b[n:], datalen-n-inst.lenESDescHdr())
-	n += inst.fillDecConfigDescHdr(b[n:], datalen-n-inst.lenDescHdr()-1)
+	n += inst.fillESDescHdr(b[n:], datalen-n-inst.lenDescHdr())
+	n += inst.fillDecConfigDescHdr(b[n:], datalen-n-inst.lenDescHdr()-inst.lenDescHdr()-1)
 	copy(b[n:], inst.DecConfig)
 	n += len(inst.DecConfig)
 	n += inst.fillDescHdr(b[n:], 0x06, datalen-n-inst.lenDescHdr())
@@ -362,12 +389,14 @@ func (inst *ElemStreamDesc) parseDesc(b []byte, offset int) (n int, err error) {
 			err = parseErr("MP4DecSpecificDescrTag", offset+n, err)
 			return
 		}
+		inst.ObjectType = b[n]
+		inst.StreamType = b[n+1] >> 2
 		if _, err = inst.parseDesc(b[n+size:], offset+n+size); err != nil {
 			return
 		}
 
 	case MP4DecSpecificDescrTag:
-		inst.DecConfig = b[n:]
+		inst.DecConfig = b[n : n+datalen]
 	}
 
 	n += datalen
@@ -425,6 +454,10 @@ func ReadFileAtoms(r io.ReadSeeker) (atoms []Atom, err error) {
 			atom = &Movie{}
 		case MOOF:
 			atom = &MovieFrag{}
+		case SIDX:
+			atom = &SegmentIndex{}
+		case MFRA:
+			atom = &MovieFragRandomAccess{}
 		}
 
 		if atom != nil {
@@ -528,6 +561,20 @@ func (inst *Track) GetAVC1Conf() (conf *AVC1Conf) {
 	return
 }
 
+// GetHVC1Conf func
+func (inst *Track) GetHVC1Conf() (conf *HVC1Conf) {
+	atom := FindChildren(inst, HVCC)
+	conf, _ = atom.(*HVC1Conf)
+	return
+}
+
+// GetMP4VDesc func
+func (inst *Track) GetMP4VDesc() (desc *MP4VDesc) {
+	atom := FindChildren(inst, MP4V)
+	desc, _ = atom.(*MP4VDesc)
+	return
+}
+
 // GetElemStreamDesc func
 func (inst *Track) GetElemStreamDesc() (esds *ElemStreamDesc) {
 	atom := FindChildren(inst, ESDS)
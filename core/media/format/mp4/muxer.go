@@ -9,6 +9,8 @@ import (
 	"github.com/Youngju-Heo/gomedia/core/media/av"
 	"github.com/Youngju-Heo/gomedia/core/media/codec/aacparser"
 	"github.com/Youngju-Heo/gomedia/core/media/codec/h264parser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/h265parser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/mpeg4parser"
 	"github.com/Youngju-Heo/gomedia/core/media/format/mp4/mp4io"
 	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
 )
@@ -30,14 +32,25 @@ func NewMuxer(w io.WriteSeeker) *Muxer {
 }
 
 func (init *Muxer) newStream(codec av.CodecData) (err error) {
+	var stream *Stream
+	if stream, err = newTrackStream(codec, len(init.streams)+1); err != nil {
+		return
+	}
+	stream.muxer = init
+	init.streams = append(init.streams, stream)
+	return
+}
+
+// newTrackStream makes stream with empty sample table, shared by Muxer and FragMuxer
+func newTrackStream(codec av.CodecData, trackID int) (stream *Stream, err error) {
 	switch codec.Type() {
-	case av.H264, av.AAC:
+	case av.H264, av.HEVC, av.MPEG4, av.AAC:
 
 	default:
 		err = fmt.Errorf("mp4: codec type=%v is not supported", codec.Type())
 		return
 	}
-	stream := &Stream{CodecData: codec}
+	stream = &Stream{CodecData: codec}
 
 	stream.sample = &mp4io.SampleTable{
 		SampleDesc:   &mp4io.SampleDesc{},
@@ -57,7 +70,7 @@ func (init *Muxer) newStream(codec av.CodecData) (err error) {
 
 	stream.trackAtom = &mp4io.Track{
 		Header: &mp4io.TrackHeader{
-			TrackID:  int32(len(init.streams) + 1),
+			TrackID:  int32(trackID),
 			Flags:    0x0003, // Track enabled | Track in movie
 			Duration: 0,      // fill later
 			Matrix:   [9]int32{0x10000, 0, 0, 0, 0x10000, 0, 0, 0, 0x40000000},
@@ -82,14 +95,11 @@ func (init *Muxer) newStream(codec av.CodecData) (err error) {
 	}
 
 	switch codec.Type() {
-	case av.H264:
+	case av.H264, av.HEVC, av.MPEG4:
 		stream.sample.SyncSample = &mp4io.SyncSample{}
 	}
 
 	stream.timeScale = 90000
-	stream.muxer = init
-	init.streams = append(init.streams, stream)
-
 	return
 }
 
@@ -121,6 +131,58 @@ func (init *Stream) fillTrackAtom() (err error) {
 		init.trackAtom.Header.TrackWidth = float64(width)
 		init.trackAtom.Header.TrackHeight = float64(height)
 
+	} else if init.Type() == av.HEVC {
+		codec := init.CodecData.(h265parser.CodecData)
+		width, height := codec.Width(), codec.Height()
+		init.sample.SampleDesc.HVC1Desc = &mp4io.HVC1Desc{
+			DataRefIdx:           1,
+			HorizontalResolution: 72,
+			VorizontalResolution: 72,
+			Width:                int16(width),
+			Height:               int16(height),
+			FrameCount:           1,
+			Depth:                24,
+			ColorTableID:         -1,
+			Conf:                 &mp4io.HVC1Conf{Data: codec.HEVCDecoderConfRecordBytes()},
+		}
+		init.trackAtom.Media.Handler = &mp4io.HandlerRefer{
+			SubType: [4]byte{'v', 'i', 'd', 'e'},
+			Name:    []byte("Video Media Handler"),
+		}
+		init.trackAtom.Media.Info.Video = &mp4io.VideoMediaInfo{
+			Flags: 0x000001,
+		}
+		init.trackAtom.Header.TrackWidth = float64(width)
+		init.trackAtom.Header.TrackHeight = float64(height)
+
+	} else if init.Type() == av.MPEG4 {
+		codec := init.CodecData.(mpeg4parser.CodecData)
+		width, height := codec.Width(), codec.Height()
+		init.sample.SampleDesc.MP4VDesc = &mp4io.MP4VDesc{
+			DataRefIdx:           1,
+			HorizontalResolution: 72,
+			VorizontalResolution: 72,
+			Width:                int16(width),
+			Height:               int16(height),
+			FrameCount:           1,
+			Depth:                24,
+			ColorTableID:         -1,
+			Conf: &mp4io.ElemStreamDesc{
+				DecConfig:  codec.ConfigBytes(),
+				ObjectType: mp4io.MP4ObjectTypeVisual,
+				StreamType: mp4io.MP4StreamTypeVisual,
+			},
+		}
+		init.trackAtom.Media.Handler = &mp4io.HandlerRefer{
+			SubType: [4]byte{'v', 'i', 'd', 'e'},
+			Name:    []byte("Video Media Handler"),
+		}
+		init.trackAtom.Media.Info.Video = &mp4io.VideoMediaInfo{
+			Flags: 0x000001,
+		}
+		init.trackAtom.Header.TrackWidth = float64(width)
+		init.trackAtom.Header.TrackHeight = float64(height)
+
 	} else if init.Type() == av.AAC {
 		codec := init.CodecData.(aacparser.CodecData)
 		init.sample.SampleDesc.MP4ADesc = &mp4io.MP4ADesc{
@@ -0,0 +1,204 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/h265parser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/mpeg4parser"
+	"github.com/Youngju-Heo/gomedia/core/media/format/mp4/mp4io"
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
+)
+
+func testHEVCCodecData(t *testing.T) av.CodecData {
+	vps, _ := hex.DecodeString("40010c01ffff016000000300900000030000030078999809")
+	sps, _ := hex.DecodeString("420101016000000300900000030000030078a003c08010e58dae4932b4dc0404040200000300020000030032")
+	pps, _ := hex.DecodeString("4401c172b46240")
+	codec, err := h265parser.NewCodecDataFromVPSAndSPSAndPPS(vps, sps, pps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return codec
+}
+
+// testVideoPackets makes n avcc packets of 25fps, every gop-th is keyframe
+func testVideoPackets(n, gop int) (pkts []av.Packet) {
+	for i := 0; i < n; i++ {
+		size := 100 + i
+		data := make([]byte, 4+size)
+		pio.PutU32BE(data, uint32(size))
+		for j := 4; j < len(data); j++ {
+			data[j] = byte(i + j)
+		}
+		pkts = append(pkts, av.Packet{
+			IsKeyFrame: i%gop == 0,
+			Time:       time.Duration(i) * 40 * time.Millisecond,
+			Data:       data,
+		})
+	}
+	return
+}
+
+func testTempFile(t *testing.T) *os.File {
+	f, err := ioutil.TempFile("", "mp4test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func testReadPackets(t *testing.T, demuxer av.Demuxer) (pkts []av.Packet) {
+	for {
+		pkt, err := demuxer.ReadPacket()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkts = append(pkts, pkt)
+	}
+}
+
+func testComparePackets(t *testing.T, got, want []av.Packet) {
+	if len(got) != len(want) {
+		t.Fatalf("packets=%d, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Idx != want[i].Idx || got[i].Time != want[i].Time ||
+			got[i].IsKeyFrame != want[i].IsKeyFrame || !bytes.Equal(got[i].Data, want[i].Data) {
+			t.Fatalf("packet#%d idx=%d time=%v key=%v len=%d, want idx=%d time=%v key=%v len=%d", i,
+				got[i].Idx, got[i].Time, got[i].IsKeyFrame, len(got[i].Data),
+				want[i].Idx, want[i].Time, want[i].IsKeyFrame, len(want[i].Data))
+		}
+	}
+}
+
+func TestMuxerHEVC(t *testing.T) {
+	f := testTempFile(t)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	codec := testHEVCCodecData(t)
+	pkts := testVideoPackets(30, 10)
+	muxer := NewMuxer(f)
+	if err := muxer.WriteHeader([]av.CodecData{codec}); err != nil {
+		t.Fatal(err)
+	}
+	for _, pkt := range pkts {
+		if err := muxer.WritePacket(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Count(b, []byte("hvc1")) != 1 || bytes.Count(b, []byte("hvcC")) != 1 {
+		t.Fatalf("hvc1/hvcC not written")
+	}
+
+	// hev1 sample entry is read same as hvc1
+	for _, tag := range []string{"hvc1", "hev1"} {
+		b = bytes.Replace(b, []byte("hvc1"), []byte(tag), 1)
+		demuxer := NewDemuxer(bytes.NewReader(b))
+		streams, err := demuxer.Streams()
+		if err != nil {
+			t.Fatal(tag, err)
+		}
+		if len(streams) != 1 || streams[0].Type() != av.HEVC {
+			t.Fatalf("%s: streams=%v", tag, streams)
+		}
+		got := streams[0].(h265parser.CodecData)
+		if !bytes.Equal(got.HEVCDecoderConfRecordBytes(), codec.(h265parser.CodecData).HEVCDecoderConfRecordBytes()) {
+			t.Errorf("%s: hvcC differs", tag)
+		}
+		testComparePackets(t, testReadPackets(t, demuxer), pkts)
+	}
+}
+
+func TestMuxerMPEG4(t *testing.T) {
+	f := testTempFile(t)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	// VOS, VO and VOL of 320x240 simple profile
+	config, _ := hex.DecodeString("000001b0f5000001b509" + "00000120" + "00844006685020f0a0")
+	codec, err := mpeg4parser.NewCodecDataFromConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkts := testFragPackets(3, 10)
+	muxer := NewMuxer(f)
+	if err = muxer.WriteHeader([]av.CodecData{codec, testAACCodecData(t)}); err != nil {
+		t.Fatal(err)
+	}
+	for _, pkt := range pkts {
+		if err = muxer.WritePacket(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	moov := testParseMoov(t, b)
+	mp4v := moov.Tracks[0].GetMP4VDesc()
+	if mp4v == nil || mp4v.Width != 320 || mp4v.Height != 240 || mp4v.Conf.ObjectType != mp4io.MP4ObjectTypeVisual ||
+		mp4v.Conf.StreamType != mp4io.MP4StreamTypeVisual {
+		t.Fatalf("mp4v=%+v", mp4v)
+	}
+	if esds := moov.Tracks[1].GetElemStreamDesc(); esds.ObjectType != mp4io.MP4ObjectTypeAudio || esds.StreamType != mp4io.MP4StreamTypeAudio {
+		t.Errorf("mp4a esds object type=%#x stream type=%#x", esds.ObjectType, esds.StreamType)
+	}
+
+	demuxer := NewDemuxer(bytes.NewReader(b))
+	streams, err := demuxer.Streams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 2 || streams[0].Type() != av.MPEG4 || streams[1].Type() != av.AAC {
+		t.Fatalf("streams=%v", streams)
+	}
+	if got := streams[0].(mpeg4parser.CodecData); !bytes.Equal(got.ConfigBytes(), config) || got.Width() != 320 || got.Height() != 240 {
+		t.Errorf("codec data=%x %dx%d", got.ConfigBytes(), got.Width(), got.Height())
+	}
+
+	// demuxer stops at end of either stream, so the tail of video is not read,
+	// audio time drifts by rounding to 90kHz and only its data is compared
+	var video, want []av.Packet
+	a := 0
+	for _, pkt := range testReadPackets(t, demuxer) {
+		if pkt.Idx == 1 {
+			if !bytes.Equal(pkt.Data, testAudioPacket(a).Data) {
+				t.Fatalf("audio packet#%d differs", a)
+			}
+			a++
+			continue
+		}
+		video = append(video, pkt)
+	}
+	for _, pkt := range pkts {
+		if pkt.Idx == 0 && len(want) < len(video) {
+			want = append(want, pkt)
+		}
+	}
+	if len(video) < 3*10-1 || a == 0 {
+		t.Fatalf("video packets=%d audio packets=%d", len(video), a)
+	}
+	testComparePackets(t, video, want)
+}
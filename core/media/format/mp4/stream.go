@@ -41,6 +41,10 @@ type Stream struct {
 
 	sttsEntry *mp4io.TimeToSampleEntry
 	cttsEntry *mp4io.CompositionOffsetEntry
+
+	// fragmented mp4
+	fragSamples []fragSample
+	fragDts     int64
 }
 
 func timeToTs(tm time.Duration, timeScale int64) int64 {
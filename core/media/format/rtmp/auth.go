@@ -0,0 +1,204 @@
+package rtmp
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/Youngju-Heo/gomedia/core/media/format/flv/flvio"
+)
+
+// onStatus codes used to reject connect, publish and play
+const (
+	CodeConnectRejected = "NetConnection.Connect.Rejected"
+	CodePublishBadName  = "NetStream.Publish.BadName"
+	CodePlayFailed      = "NetStream.Play.Failed"
+)
+
+// AuthRequest is passed to auth hooks on connect, publish and play commands
+type AuthRequest struct {
+	// Command is "connect", "publish" or "play"
+	Command string
+	App     string
+	// StreamName is stream key without query, empty on connect
+	StreamName string
+	// Query holds query params of app, tcUrl and stream name
+	Query      url.Values
+	TcURL      string
+	RemoteAddr net.Addr
+	// ConnectObject is command object of connect
+	ConnectObject flvio.AMFMap
+}
+
+// StatusError is error reported to client by onStatus or _error, auth hooks return it to choose status code
+type StatusError struct {
+	Code        string
+	Description string
+}
+
+func (inth *StatusError) Error() string {
+	return fmt.Sprintf("rtmp: %s: %s", inth.Code, inth.Description)
+}
+
+// ACL is set of stream keys, safe for concurrent use
+type ACL struct {
+	lock sync.RWMutex
+	keys map[string]bool
+}
+
+// NewACL func
+func NewACL(keys ...string) *ACL {
+	acl := &ACL{keys: map[string]bool{}}
+	for _, key := range keys {
+		acl.keys[key] = true
+	}
+	return acl
+}
+
+// Add func
+func (inth *ACL) Add(key string) {
+	inth.lock.Lock()
+	inth.keys[key] = true
+	inth.lock.Unlock()
+}
+
+// Remove func
+func (inth *ACL) Remove(key string) {
+	inth.lock.Lock()
+	delete(inth.keys, key)
+	inth.lock.Unlock()
+}
+
+// Allowed func
+func (inth *ACL) Allowed(key string) bool {
+	inth.lock.RLock()
+	defer inth.lock.RUnlock()
+	return inth.keys[key]
+}
+
+// splitQuery splits "name?a=b" into name and params, params are added to query
+func splitQuery(s string, query url.Values) string {
+	i := strings.Index(s, "?")
+	if i < 0 {
+		return s
+	}
+	if values, err := url.ParseQuery(s[i+1:]); err == nil {
+		for k, v := range values {
+			query[k] = append(query[k], v...)
+		}
+	}
+	return s[:i]
+}
+
+func newAuthRequest(app, tcurl string, remote net.Addr, obj flvio.AMFMap) *AuthRequest {
+	req := &AuthRequest{
+		Command:       "connect",
+		Query:         url.Values{},
+		TcURL:         tcurl,
+		RemoteAddr:    remote,
+		ConnectObject: obj,
+	}
+	req.App = splitQuery(app, req.Query)
+	if u, err := url.Parse(tcurl); err == nil {
+		for k, v := range u.Query() {
+			if _, ok := req.Query[k]; !ok {
+				req.Query[k] = v
+			}
+		}
+	}
+	return req
+}
+
+// streamRequest returns copy of connect request for publish or play of stream
+func (inth *AuthRequest) streamRequest(command, stream string) *AuthRequest {
+	req := *inth
+	req.Command = command
+	req.Query = url.Values{}
+	for k, v := range inth.Query {
+		req.Query[k] = append([]string{}, v...)
+	}
+	req.StreamName = splitQuery(stream, req.Query)
+	return &req
+}
+
+// authenticate runs OnAuth, and OnPlayOrPublish for publish
+func (inth *Conn) authenticate(req *AuthRequest) (err error) {
+	if req.Command == "publish" && inth.OnPlayOrPublish != nil {
+		if err = inth.OnPlayOrPublish(req.Command, req.ConnectObject); err != nil {
+			return
+		}
+	}
+	if inth.OnAuth != nil {
+		err = inth.OnAuth(req)
+	}
+	return
+}
+
+// writeAuthError reports auth error to client, code is used unless err is StatusError
+func (inth *Conn) writeAuthError(command string, code string, autherr error) (err error) {
+	status := &StatusError{Code: code, Description: autherr.Error()}
+	if serr, ok := autherr.(*StatusError); ok {
+		status = serr
+	}
+	info := flvio.AMFMap{
+		"level":       "error",
+		"code":        status.Code,
+		"description": status.Description,
+	}
+	if command == "connect" {
+		// > _error("NetConnection.Connect.Rejected")
+		err = inth.writeCommandMsg(3, 0, "_error", inth.commandtransid, nil, info)
+	} else {
+		// > onStatus()
+		err = inth.writeCommandMsg(5, inth.avmsgsid, "onStatus", inth.commandtransid, nil, info)
+	}
+	if err != nil {
+		return
+	}
+	return inth.flushWrite()
+}
+
+// checkStatusError returns StatusError when received command is _error or error level onStatus
+func (inth *Conn) checkStatusError() (err error) {
+	if inth.commandname != "_error" && inth.commandname != "onStatus" {
+		return
+	}
+	for _, param := range inth.commandparams {
+		obj, _ := param.(flvio.AMFMap)
+		if obj == nil {
+			continue
+		}
+		level, _ := obj["level"].(string)
+		if level != "error" && inth.commandname != "_error" {
+			continue
+		}
+		status := &StatusError{}
+		status.Code, _ = obj["code"].(string)
+		status.Description, _ = obj["description"].(string)
+		return status
+	}
+	if inth.commandname == "_error" {
+		err = &StatusError{Description: "_error received"}
+	}
+	return
+}
+
+// authenticate checks ACLs then Authenticate hook
+func (inth *Server) authenticate(req *AuthRequest) (err error) {
+	switch req.Command {
+	case "publish":
+		if inth.PublishACL != nil && !inth.PublishACL.Allowed(req.StreamName) {
+			return &StatusError{Code: CodePublishBadName, Description: "stream key not allowed to publish"}
+		}
+	case "play":
+		if inth.PlayACL != nil && !inth.PlayACL.Allowed(req.StreamName) {
+			return &StatusError{Code: CodePlayFailed, Description: "stream key not allowed to play"}
+		}
+	}
+	if inth.Authenticate != nil {
+		err = inth.Authenticate(req)
+	}
+	return
+}
@@ -0,0 +1,74 @@
+package rtmp
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAuth(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	requests := make(chan *AuthRequest, 16)
+	server := &Server{
+		PublishACL: NewACL("secret"),
+		PlayACL:    NewACL(),
+		Authenticate: func(req *AuthRequest) error {
+			requests <- req
+			if req.Query.Get("token") != "ok" {
+				return fmt.Errorf("bad token")
+			}
+			return nil
+		},
+		HandlePublish: func(conn *Conn) {},
+	}
+	go server.Serve(listener)
+	base := "rtmp://" + listener.Addr().String()
+
+	tests := []struct {
+		uri     string
+		publish bool
+		code    string
+	}{
+		{base + "/live/secret", true, CodeConnectRejected},
+		{base + "/live?token=ok/other", true, CodePublishBadName},
+		{base + "/live?token=ok/secret", false, CodePlayFailed},
+		{base + "/live/secret?token=ok", true, ""},
+	}
+	for _, test := range tests {
+		conn, err := DialTimeout(test.uri, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.publish {
+			err = conn.prepare(stageCommandDone, prepareWriting)
+		} else {
+			_, err = conn.Streams()
+		}
+		conn.Close()
+
+		if test.code == "" {
+			if err != nil {
+				t.Errorf("%s: %v", test.uri, err)
+			}
+			continue
+		}
+		serr, ok := err.(*StatusError)
+		if !ok || serr.Code != test.code {
+			t.Errorf("%s: err=%v, want %s", test.uri, err, test.code)
+		}
+	}
+
+	var last *AuthRequest
+	for len(requests) > 0 {
+		last = <-requests
+	}
+	if last == nil || last.Command != "publish" || last.App != "live" || last.StreamName != "secret" || last.Query.Get("token") != "ok" {
+		t.Errorf("last request=%+v", last)
+	}
+}
@@ -0,0 +1,168 @@
+package rtmp
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/av/avutil"
+	"github.com/Youngju-Heo/gomedia/core/media/av/pubsub"
+)
+
+// Hub relays published streams to players.
+// Each app/stream path has its own pubsub.Queue, players start from latest cached GOP.
+type Hub struct {
+	// MaxGopCount is number of GOPs cached in each queue
+	MaxGopCount int
+
+	lock     sync.Mutex
+	channels map[string]*pubsub.Queue
+}
+
+// NewHub func
+func NewHub() *Hub {
+	return &Hub{
+		MaxGopCount: 2,
+		channels:    map[string]*pubsub.Queue{},
+	}
+}
+
+// Attach sets publish and play handlers of server to hub.
+// Authenticate of server is chained to reject publishing to path already being published.
+func (inth *Hub) Attach(server *Server) {
+	server.HandlePublish = inth.HandlePublish
+	server.HandlePlay = inth.HandlePlay
+
+	authenticate := server.Authenticate
+	server.Authenticate = func(req *AuthRequest) (err error) {
+		if authenticate != nil {
+			if err = authenticate(req); err != nil {
+				return
+			}
+		}
+		return inth.authenticate(req)
+	}
+}
+
+// authenticate rejects publish before NetStream.Publish.Start is sent if path is being published
+func (inth *Hub) authenticate(req *AuthRequest) (err error) {
+	if req.Command != "publish" {
+		return
+	}
+	path := hubPath(createURL("", req.App, req.StreamName))
+	inth.lock.Lock()
+	_, exist := inth.channels[path]
+	inth.lock.Unlock()
+	if exist {
+		err = &StatusError{Code: CodePublishBadName, Description: "stream is already publishing"}
+	}
+	return
+}
+
+// Paths returns app/stream paths being published
+func (inth *Hub) Paths() (paths []string) {
+	inth.lock.Lock()
+	for path := range inth.channels {
+		paths = append(paths, path)
+	}
+	inth.lock.Unlock()
+	return
+}
+
+func hubPath(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	return strings.Trim(u.Path, "/")
+}
+
+// HandlePublish writes packets of conn to queue of its path until publisher leaves.
+// Publishing to path already being published is rejected.
+func (inth *Hub) HandlePublish(conn *Conn) {
+	defer conn.Close()
+
+	path := hubPath(conn.URL)
+	inth.lock.Lock()
+	if _, exist := inth.channels[path]; exist {
+		inth.lock.Unlock()
+		if Debug {
+			fmt.Println("rtmp: hub: publish rejected, already publishing:", path)
+		}
+		// publishers racing past authenticate
+		conn.writeAuthError("publish", CodePublishBadName, fmt.Errorf("stream is already publishing"))
+		return
+	}
+	que := pubsub.NewQueue()
+	que.SetMaxGopCount(inth.MaxGopCount)
+	inth.channels[path] = que
+	inth.lock.Unlock()
+
+	defer func() {
+		inth.lock.Lock()
+		delete(inth.channels, path)
+		inth.lock.Unlock()
+		que.Close()
+	}()
+
+	streams, err := conn.Streams()
+	if err != nil {
+		return
+	}
+	que.WriteHeader(streams)
+	err = avutil.CopyPackets(que, conn)
+	if Debug {
+		fmt.Println("rtmp: hub: publisher left:", path, err)
+	}
+}
+
+// HandlePlay writes packets of path being published to conn, player without publisher is closed
+func (inth *Hub) HandlePlay(conn *Conn) {
+	defer conn.Close()
+
+	path := hubPath(conn.URL)
+	inth.lock.Lock()
+	que := inth.channels[path]
+	inth.lock.Unlock()
+	if que == nil {
+		if Debug {
+			fmt.Println("rtmp: hub: play rejected, not publishing:", path)
+		}
+		return
+	}
+
+	err := inth.play(conn, que.LatestGop())
+	if Debug {
+		fmt.Println("rtmp: hub: player left:", path, err)
+	}
+}
+
+// play copies packets like avutil.CopyFile, flushing each packet to keep latency low
+func (inth *Hub) play(conn *Conn, cursor *pubsub.QueueCursor) (err error) {
+	var streams []av.CodecData
+	if streams, err = cursor.Streams(); err != nil {
+		return
+	}
+	if err = conn.WriteHeader(streams); err != nil {
+		return
+	}
+	for {
+		var pkt av.Packet
+		if pkt, err = cursor.ReadPacket(); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return
+		}
+		if err = conn.WritePacket(pkt); err != nil {
+			return
+		}
+		if err = conn.flushWrite(); err != nil {
+			return
+		}
+	}
+	err = conn.WriteTrailer()
+	return
+}
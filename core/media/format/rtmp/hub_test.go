@@ -0,0 +1,141 @@
+package rtmp
+
+import (
+	"encoding/base64"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/h264parser"
+)
+
+func TestHub(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	hub := NewHub()
+	server := &Server{}
+	hub.Attach(server)
+	go server.Serve(listener)
+
+	uri := "rtmp://" + listener.Addr().String() + "/live/test"
+	sps, _ := base64.StdEncoding.DecodeString("Z00AHpWoKA9k")
+	pps, _ := base64.StdEncoding.DecodeString("aO48gA==")
+	h264, err := h264parser.NewCodecDataFromSPSAndPPS(sps, pps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, err := DialTimeout(uri, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Close()
+	if err = pub.WriteHeader([]av.CodecData{h264}); err != nil {
+		t.Fatal(err)
+	}
+	writePacket := func(i int) error {
+		nalu := byte(0x41)
+		if i%10 == 0 {
+			nalu = 0x65
+		}
+		pkt := av.Packet{
+			Time:       time.Duration(i) * 40 * time.Millisecond,
+			IsKeyFrame: nalu == 0x65,
+			Data:       []byte{0, 0, 0, 3, nalu, byte(i >> 8), byte(i)},
+		}
+		if err := pub.WritePacket(pkt); err != nil {
+			return err
+		}
+		return pub.flushWrite()
+	}
+	if err = writePacket(0); err != nil {
+		t.Fatal(err)
+	}
+	for start := time.Now(); len(hub.Paths()) == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 3*time.Second {
+			t.Fatal("publisher not found in hub")
+		}
+	}
+
+	// second publisher to same path is told before publishing starts
+	pub2, err := DialTimeout(uri, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pub2.WriteHeader([]av.CodecData{h264})
+	pub2.Close()
+	if serr, ok := err.(*StatusError); !ok || serr.Code != CodePublishBadName {
+		t.Fatalf("second publish err=%v, want %s", err, CodePublishBadName)
+	}
+
+	stop := make(chan struct{})
+	published := make(chan error, 1)
+	go func() {
+		for i := 1; ; i++ {
+			select {
+			case <-stop:
+				published <- nil
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+			if err := writePacket(i); err != nil {
+				published <- err
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		if err := <-published; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	play, err := DialTimeout(uri, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer play.Close()
+
+	// player gets packets while publisher stays connected
+	done := make(chan error, 1)
+	go func() {
+		streams, err := play.Streams()
+		if err != nil {
+			done <- err
+			return
+		}
+		if len(streams) != 1 || streams[0].Type() != av.H264 {
+			t.Errorf("streams=%v", streams)
+		}
+		last := -1
+		for n := 0; n < 20; n++ {
+			pkt, err := play.ReadPacket()
+			if err != nil {
+				done <- err
+				return
+			}
+			i := int(pkt.Data[5])<<8 | int(pkt.Data[6])
+			if n == 0 && !pkt.IsKeyFrame {
+				t.Errorf("first packet#%d is not key frame", i)
+			}
+			if i <= last {
+				t.Errorf("packet#%d after #%d", i, last)
+			}
+			last = i
+		}
+		done <- nil
+	}()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("player stalled while publisher is connected")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/tls"
 	"encoding/hex"
 	"fmt"
 	"io"
@@ -24,13 +25,20 @@ import (
 // Debug var
 var Debug bool
 
+// TLSConfig var is used by Dial and DialTimeout for rtmps url, nil uses default config
+var TLSConfig *tls.Config
+
 // ParseURL type
 func ParseURL(uri string) (u *url.URL, err error) {
 	if u, err = url.Parse(uri); err != nil {
 		return
 	}
 	if _, _, serr := net.SplitHostPort(u.Host); serr != nil {
-		u.Host += ":1935"
+		if u.Scheme == "rtmps" {
+			u.Host += ":443"
+		} else {
+			u.Host += ":1935"
+		}
 	}
 	return
 }
@@ -46,6 +54,9 @@ func DialTimeout(uri string, timeout time.Duration) (conn *Conn, err error) {
 	if u, err = ParseURL(uri); err != nil {
 		return
 	}
+	if u.Scheme == "rtmps" {
+		return DialTLS(uri, timeout, TLSConfig)
+	}
 
 	dailer := net.Dialer{Timeout: timeout}
 	var netconn net.Conn
@@ -58,8 +69,35 @@ func DialTimeout(uri string, timeout time.Duration) (conn *Conn, err error) {
 	return
 }
 
+// DialTLS connects rtmp over tls, nil config uses default config
+func DialTLS(uri string, timeout time.Duration, config *tls.Config) (conn *Conn, err error) {
+	var u *url.URL
+	if u, err = ParseURL(uri); err != nil {
+		return
+	}
+	if config == nil {
+		config = &tls.Config{}
+	}
+
+	dailer := &net.Dialer{Timeout: timeout}
+	var netconn net.Conn
+	if netconn, err = tls.DialWithDialer(dailer, "tcp", u.Host, config); err != nil {
+		return
+	}
+
+	conn = NewConn(netconn)
+	conn.URL = u
+	return
+}
+
 type Server struct {
-	Addr          string
+	Addr      string
+	TLSConfig *tls.Config
+	// Authenticate checks connect, publish and play of each connection, error rejects the command
+	Authenticate func(*AuthRequest) error
+	// PublishACL and PlayACL restrict stream keys to publish and play when not nil
+	PublishACL    *ACL
+	PlayACL       *ACL
 	HandlePublish func(*Conn)
 	HandlePlay    func(*Conn)
 	HandleConn    func(*Conn)
@@ -108,6 +146,43 @@ func (inth *Server) ListenAndServe() (err error) {
 		fmt.Println("rtmp: server: listening on", addr)
 	}
 
+	return inth.Serve(listener)
+}
+
+// ListenAndServeTLS serves rtmps with certificate files, or with TLSConfig when files are empty
+func (inth *Server) ListenAndServeTLS(certFile, keyFile string) (err error) {
+	addr := inth.Addr
+	if addr == "" {
+		addr = ":443"
+	}
+
+	config := &tls.Config{}
+	if inth.TLSConfig != nil {
+		config = inth.TLSConfig.Clone()
+	}
+	if certFile != "" || keyFile != "" {
+		var cert tls.Certificate
+		if cert, err = tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			err = fmt.Errorf("rtmp: ListenAndServeTLS: %s", err)
+			return
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	var listener net.Listener
+	if listener, err = net.Listen("tcp", addr); err != nil {
+		return
+	}
+
+	if Debug {
+		fmt.Println("rtmp: server: listening tls on", addr)
+	}
+
+	return inth.Serve(tls.NewListener(listener, config))
+}
+
+// Serve accepts connections on listener
+func (inth *Server) Serve(listener net.Listener) (err error) {
 	for {
 		var netconn net.Conn
 		if netconn, err = listener.Accept(); err != nil {
@@ -120,6 +195,7 @@ func (inth *Server) ListenAndServe() (err error) {
 
 		conn := NewConn(netconn)
 		conn.isserver = true
+		conn.OnAuth = inth.authenticate
 		go func() {
 			err := inth.handleConn(conn)
 			if Debug {
@@ -143,6 +219,8 @@ const (
 type Conn struct {
 	URL             *url.URL
 	OnPlayOrPublish func(string, flvio.AMFMap) error
+	// OnAuth is called on connect, publish and play of server conn, error is reported to client
+	OnAuth func(*AuthRequest) error
 
 	prober  *flv.Prober
 	streams []av.CodecData
@@ -303,6 +381,11 @@ func (inth *Conn) pollAVTag() (tag flvio.Tag, err error) {
 			tag = inth.avtag
 			return
 		}
+		if inth.gotcommand {
+			if err = inth.checkStatusError(); err != nil {
+				return
+			}
+		}
 	}
 }
 
@@ -413,12 +496,20 @@ func (inth *Conn) readConnect() (err error) {
 	if ok {
 		tcurl, _ = _tcurl.(string)
 	}
-	connectparams := inth.commandobj
+	authreq := newAuthRequest(connectpath, tcurl, inth.netconn.RemoteAddr(), inth.commandobj)
 
 	if err = inth.writeBasicConf(); err != nil {
 		return
 	}
 
+	if autherr := inth.authenticate(authreq); autherr != nil {
+		if err = inth.writeAuthError("connect", CodeConnectRejected, autherr); err != nil {
+			return
+		}
+		err = autherr
+		return
+	}
+
 	// > _result("NetConnection.Connect.Success")
 	if err = inth.writeCommandMsg(3, 0, "_result", inth.commandtransid,
 		flvio.AMFMap{
@@ -469,9 +560,12 @@ func (inth *Conn) readConnect() (err error) {
 				}
 				publishpath, _ := inth.commandparams[0].(string)
 
-				var cberr error
-				if inth.OnPlayOrPublish != nil {
-					cberr = inth.OnPlayOrPublish(inth.commandname, connectparams)
+				if autherr := inth.authenticate(authreq.streamRequest("publish", publishpath)); autherr != nil {
+					if err = inth.writeAuthError("publish", CodePublishBadName, autherr); err != nil {
+						return
+					}
+					err = autherr
+					return
 				}
 
 				// > onStatus()
@@ -489,11 +583,6 @@ func (inth *Conn) readConnect() (err error) {
 					return
 				}
 
-				if cberr != nil {
-					err = fmt.Errorf("rtmp: OnPlayOrPublish check failed")
-					return
-				}
-
 				inth.URL = createURL(tcurl, connectpath, publishpath)
 				inth.publishing = true
 				inth.reading = true
@@ -512,6 +601,14 @@ func (inth *Conn) readConnect() (err error) {
 				}
 				playpath, _ := inth.commandparams[0].(string)
 
+				if autherr := inth.authenticate(authreq.streamRequest("play", playpath)); autherr != nil {
+					if err = inth.writeAuthError("play", CodePlayFailed, autherr); err != nil {
+						return
+					}
+					err = autherr
+					return
+				}
+
 				// > streamBegin(streamid)
 				if err = inth.writeStreamBegin(inth.avmsgsid); err != nil {
 					return
@@ -627,6 +724,7 @@ func (inth *Conn) writeConnect(path string) (err error) {
 			"audioCodecs":   4071,
 			"videoCodecs":   252,
 			"videoFunction": 1,
+			"fourCcList":    flvio.AMFArray{"hvc1"},
 		},
 	); err != nil {
 		return
@@ -654,6 +752,10 @@ func (inth *Conn) writeConnect(path string) (err error) {
 				}
 				break
 			}
+			// < _error("NetConnection.Connect.Rejected")
+			if err = inth.checkStatusError(); err != nil {
+				return
+			}
 		} else {
 			if inth.msgtypeid == msgtypeidWindowAckSize {
 				if len(inth.msgdata) == 4 {
@@ -721,6 +823,19 @@ func (inth *Conn) connectPublish() (err error) {
 		return
 	}
 
+	for {
+		if err = inth.pollMsg(); err != nil {
+			return
+		}
+		// < onStatus("NetStream.Publish.Start")
+		if inth.gotcommand && inth.commandname == "onStatus" {
+			if err = inth.checkStatusError(); err != nil {
+				return
+			}
+			break
+		}
+	}
+
 	inth.writing = true
 	inth.publishing = true
 	inth.stage++
@@ -1373,6 +1488,20 @@ func (inth *Conn) handleCommandMsgAMF0(b []byte) (n int, err error) {
 	return
 }
 
+func (inth *Conn) handleDataMsgAMF0(b []byte) (err error) {
+	n := 0
+	for n < len(b) {
+		var obj interface{}
+		var size int
+		if obj, size, err = flvio.ParseAMF0Val(b[n:]); err != nil {
+			return
+		}
+		n += size
+		inth.datamsgvals = append(inth.datamsgvals, obj)
+	}
+	return
+}
+
 func (inth *Conn) handleMsg(timestamp uint32, msgsid uint32, msgtypeid uint8, msgdata []byte) (err error) {
 	inth.msgdata = msgdata
 	inth.msgtypeid = msgtypeid
@@ -1389,7 +1518,7 @@ func (inth *Conn) handleMsg(timestamp uint32, msgsid uint32, msgtypeid uint8, ms
 			err = fmt.Errorf("rtmp: short packet of CommandMsgAMF3")
 			return
 		}
-		// skip first byte
+		// amf0 encoded after format byte, values are switched to amf3 by avmplus-object-marker
 		if _, err = inth.handleCommandMsgAMF0(msgdata[1:]); err != nil {
 			return
 		}
@@ -1402,19 +1531,17 @@ func (inth *Conn) handleMsg(timestamp uint32, msgsid uint32, msgtypeid uint8, ms
 		inth.eventtype = pio.U16BE(msgdata)
 
 	case msgtypeidDataMsgAMF0:
-		b := msgdata
-		n := 0
-		for n < len(b) {
-			var obj interface{}
-			var size int
-			if obj, size, err = flvio.ParseAMF0Val(b[n:]); err != nil {
-				return
-			}
-			n += size
-			inth.datamsgvals = append(inth.datamsgvals, obj)
+		if err = inth.handleDataMsgAMF0(msgdata); err != nil {
+			return
 		}
-		if n < len(b) {
-			err = fmt.Errorf("rtmp: DataMsgAMF0 left bytes=%d", len(b)-n)
+
+	case msgtypeidDataMsgAMF3:
+		if len(msgdata) < 1 {
+			err = fmt.Errorf("rtmp: short packet of DataMsgAMF3")
+			return
+		}
+		// same as CommandMsgAMF3
+		if err = inth.handleDataMsgAMF0(msgdata[1:]); err != nil {
 			return
 		}
 
@@ -1664,7 +1791,7 @@ func (inth closeConn) Close() error {
 // Handler type
 func Handler(h *avutil.RegisterHandler) {
 	h.URLDemuxer = func(uri string) (ok bool, demuxer av.DemuxCloser, err error) {
-		if !strings.HasPrefix(uri, "rtmp://") {
+		if !strings.HasPrefix(uri, "rtmp://") && !strings.HasPrefix(uri, "rtmps://") {
 			return
 		}
 		ok = true
@@ -1673,7 +1800,7 @@ func Handler(h *avutil.RegisterHandler) {
 	}
 
 	h.URLMuxer = func(uri string) (ok bool, muxer av.MuxCloser, err error) {
-		if !strings.HasPrefix(uri, "rtmp://") {
+		if !strings.HasPrefix(uri, "rtmp://") && !strings.HasPrefix(uri, "rtmps://") {
 			return
 		}
 		ok = true
@@ -0,0 +1,131 @@
+package rtmp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/av/avutil"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/h264parser"
+)
+
+func selfSignedCert(t *testing.T) (cert tls.Certificate, pool *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool = x509.NewCertPool()
+	pool.AddCert(parsed)
+	cert = tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return
+}
+
+func TestRTMPS(t *testing.T) {
+	cert, pool := selfSignedCert(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	hub := NewHub()
+	server := &Server{}
+	hub.Attach(server)
+	go server.Serve(tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{cert}}))
+
+	uri := "rtmps://" + listener.Addr().String() + "/live/test"
+
+	// certificate not trusted
+	conn, err := DialTLS(uri, time.Second, nil)
+	if err == nil {
+		conn.Close()
+		t.Fatal("dial with untrusted certificate should fail")
+	}
+	if conn, err = DialTLS(uri, time.Second, &tls.Config{RootCAs: pool}); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	sps, _ := base64.StdEncoding.DecodeString("Z00AHpWoKA9k")
+	pps, _ := base64.StdEncoding.DecodeString("aO48gA==")
+	h264, err := h264parser.NewCodecDataFromSPSAndPPS(sps, pps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	TLSConfig = &tls.Config{RootCAs: pool}
+	defer func() { TLSConfig = nil }()
+	handlers := &avutil.Handlers{}
+	handlers.Add(Handler)
+
+	pub, err := handlers.Create(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pub.WriteHeader([]av.CodecData{h264}); err != nil {
+		t.Fatal(err)
+	}
+	// enough packets for player to finish probing
+	for i := 0; i < 30; i++ {
+		pkt := av.Packet{Time: time.Duration(i) * 40 * time.Millisecond, IsKeyFrame: i == 0, Data: []byte{0, 0, 0, 2, 0x65, byte(i)}}
+		if err = pub.WritePacket(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = pub.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+
+	for start := time.Now(); len(hub.Paths()) == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 3*time.Second {
+			t.Fatal("publisher not found in hub")
+		}
+	}
+
+	play, err := handlers.Open(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer play.Close()
+	streams, err := play.Streams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 1 || streams[0].Type() != av.H264 {
+		t.Fatalf("streams=%v", streams)
+	}
+	pkt, err := play.ReadPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pkt.IsKeyFrame || pkt.Data[5] != 0 {
+		t.Fatalf("first packet keyframe=%v data=%v", pkt.IsKeyFrame, pkt.Data)
+	}
+	pub.Close()
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/Youngju-Heo/gomedia/core/media/codec"
 	"github.com/Youngju-Heo/gomedia/core/media/codec/aacparser"
 	"github.com/Youngju-Heo/gomedia/core/media/codec/h264parser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/h265parser"
 	"github.com/Youngju-Heo/gomedia/core/media/format/rtsp/sdp"
 	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
 )
@@ -37,6 +38,9 @@ var DebugRtsp = false
 // SkipErrRtpBlock var
 var SkipErrRtpBlock = false
 
+// JitterLatency var is default of Client.JitterLatency
+var JitterLatency = time.Millisecond * 150
+
 const (
 	stageDescribeDone = iota + 1
 	stageSetupDone
@@ -52,6 +56,12 @@ type Client struct {
 
 	SkipErrRtpBlock bool
 
+	// Transport is TransportTCP or TransportUDP, falls back to TCP when server answers 461
+	Transport int
+	// JitterLatency is how long a missing rtp packet is waited for before it is declared lost,
+	// 0 declares it lost as soon as a later packet arrives
+	JitterLatency time.Duration
+
 	RtspTimeout          time.Duration
 	RtpTimeout           time.Duration
 	RtpKeepAliveTimeout  time.Duration
@@ -74,6 +84,11 @@ type Client struct {
 	streamsintf []av.CodecData
 	session     string
 	body        io.Reader
+
+	ssrc      uint32
+	udpch     chan []byte
+	udpdone   chan struct{}
+	rtcpTimer time.Time
 }
 
 // Request type
@@ -81,6 +96,10 @@ type Request struct {
 	Header []string
 	URI    string
 	Method string
+
+	Headers       textproto.MIMEHeader
+	ContentLength int
+	Body          []byte
 }
 
 // Response type
@@ -123,6 +142,8 @@ func DialTimeout(uri string, timeout time.Duration) (client *Client, err error)
 		DebugRtp:        DebugRtp,
 		DebugRtsp:       DebugRtsp,
 		SkipErrRtpBlock: SkipErrRtpBlock,
+		JitterLatency:   JitterLatency,
+		ssrc:            randUint32(),
 	}
 	return
 }
@@ -211,6 +232,12 @@ func (client *Client) SendRtpKeepalive() (err error) {
 			if err = client.WriteRequest(req); err != nil {
 				return
 			}
+			if client.Transport == TransportUDP {
+				// nothing else is read from rtsp connection in udp mode
+				if _, err = client.ReadResponse(); err != nil {
+					return
+				}
+			}
 		}
 	}
 	return
@@ -601,27 +628,59 @@ func (client *Client) Setup(idx []int) (err error) {
 	}
 	client.setupIdx = idx
 
-	for i, si := range idx {
+	for i := 0; i < len(idx); i++ {
+		si := idx[i]
+		stream := client.streams[si]
 		client.setupMap[si] = i
 
 		uri := ""
-		control := client.streams[si].Sdp.Control
+		control := stream.Sdp.Control
 		if strings.HasPrefix(control, "rtsp://") {
 			uri = control
 		} else {
 			uri = client.requestURI + "/" + control
 		}
 		req := Request{Method: "SETUP", URI: uri}
-		req.Header = append(req.Header, fmt.Sprintf("Transport: RTP/AVP/TCP;unicast;interleaved=%d-%d", si*2, si*2+1))
+		if client.Transport == TransportUDP {
+			var transport string
+			if transport, err = stream.listenUDP(); err != nil {
+				return
+			}
+			req.Header = append(req.Header, transport)
+		} else {
+			req.Header = append(req.Header, fmt.Sprintf("Transport: RTP/AVP/TCP;unicast;interleaved=%d-%d", si*2, si*2+1))
+		}
 		if client.session != "" {
 			req.Header = append(req.Header, "Session: "+client.session)
 		}
 		if err = client.WriteRequest(req); err != nil {
 			return
 		}
-		if _, err = client.ReadResponse(); err != nil {
+		var res Response
+		if res, err = client.ReadResponse(); err != nil {
 			return
 		}
+
+		if client.Transport == TransportUDP {
+			if res.StatusCode == 461 {
+				// Unsupported Transport, setup all streams again interleaved
+				if client.DebugRtsp {
+					fmt.Println("rtsp: udp transport unsupported, fallback to tcp")
+				}
+				client.closeUDP()
+				client.Transport = TransportTCP
+				i = -1
+				continue
+			}
+			host, _, _ := net.SplitHostPort(client.conn.RemoteAddr().String())
+			if err = stream.setupUDP(host, res.Headers.Get("Transport")); err != nil {
+				return
+			}
+		}
+	}
+
+	if client.Transport == TransportUDP {
+		client.startUDP()
 	}
 
 	if client.stage == stageDescribeDone {
@@ -725,11 +784,16 @@ func (client *Client) HandleCodecDataChange() (_newcli *Client, err error) {
 }
 
 func (client *Stream) clearCodecDataChange() {
+	client.vpsChanged = false
 	client.spsChanged = false
 	client.ppsChanged = false
 }
 
 func (client *Stream) isCodecDataChange() bool {
+	if client.Sdp.Type == av.HEVC {
+		// any of vps, sps and pps may change, wait until all sets sent together are taken
+		return (client.vpsChanged || client.spsChanged || client.ppsChanged) && !client.inParamSet
+	}
 	if client.spsChanged && client.ppsChanged {
 		return true
 	}
@@ -777,6 +841,28 @@ func (client *Stream) makeCodecData() (err error) {
 				return
 			}
 
+		case av.HEVC:
+			// sets in sdp must not replace sets changed in-band
+			if len(client.vps) == 0 || len(client.sps) == 0 || len(client.pps) == 0 {
+				for _, sets := range [][][]byte{media.SpropVPS, media.SpropSPS, media.SpropPPS} {
+					for _, nalu := range sets {
+						if len(nalu) > 0 {
+							client.handleH265Payload(0, nalu)
+						}
+					}
+				}
+			}
+
+			if len(client.vps) > 0 && len(client.sps) > 0 && len(client.pps) > 0 {
+				if client.CodecData, err = h265parser.NewCodecDataFromVPSAndSPSAndPPS(client.vps, client.sps, client.pps); err != nil {
+					err = fmt.Errorf("rtsp: h265 vps/sps/pps invalid: %s", err)
+					return
+				}
+			} else {
+				err = fmt.Errorf("rtsp: missing h265 vps, sps or pps")
+				return
+			}
+
 		case av.AAC:
 			if len(media.Config) == 0 {
 				err = fmt.Errorf("rtsp: aac sdp config missing")
@@ -1009,6 +1095,139 @@ func (client *Stream) handleH264Payload(timestamp uint32, packet []byte) (err er
 	return
 }
 
+// setParamSet stores parameter set nalu, codec data is made on first arrival and change is flagged later
+func (client *Stream) setParamSet(name string, set *[]byte, changed *bool, packet []byte) {
+	if client.client != nil && client.client.DebugRtp {
+		fmt.Println("rtsp: got", name)
+	}
+	if len(*set) == 0 {
+		*set = packet
+		client.makeCodecData()
+	} else if bytes.Compare(*set, packet) != 0 {
+		*set = packet
+		*changed = true
+		if client.client != nil && client.client.DebugRtp {
+			fmt.Println("rtsp:", name, "changed")
+		}
+	}
+}
+
+func (client *Stream) handleH265Payload(timestamp uint32, packet []byte) (err error) {
+	if len(packet) < 3 {
+		err = fmt.Errorf("rtp: h265 packet too short")
+		return
+	}
+
+	naluType := h265parser.NALUType(packet)
+	client.inParamSet = naluType == h265parser.NaluVps || naluType == h265parser.NaluSps || naluType == h265parser.NaluPps
+
+	/*
+		https://tools.ietf.org/html/rfc7798#section-4.4
+		0-47     NAL unit  Single NAL unit packet             4.4.1
+		48       AP        Aggregation packet                 4.4.2
+		49       FU        Fragmentation unit                 4.4.3
+		50       PACI      PACI packet                        4.4.4
+
+		sprop-max-don-diff > 0 (DONL fields) is not supported
+	*/
+	switch {
+	case naluType < 32:
+		if h265parser.IsKeyFrameNALU(packet) {
+			client.pkt.IsKeyFrame = true
+		}
+		client.gotpkt = true
+		// raw nalu to avcc
+		b := make([]byte, 4+len(packet))
+		pio.PutU32BE(b[0:4], uint32(len(packet)))
+		copy(b[4:], packet)
+		client.pkt.Data = b
+		client.timestamp = timestamp
+
+	case naluType == h265parser.NaluVps:
+		client.setParamSet("vps", &client.vps, &client.vpsChanged, packet)
+
+	case naluType == h265parser.NaluSps:
+		client.setParamSet("sps", &client.sps, &client.spsChanged, packet)
+
+	case naluType == h265parser.NaluPps:
+		client.setParamSet("pps", &client.pps, &client.ppsChanged, packet)
+
+	case naluType == 48: // AP
+		/*
+			0                   1                   2                   3
+			0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+			+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+			|                          RTP Header                           |
+			+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+			|   PayloadHdr (Type=48)        |         NALU 1 Size           |
+			+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+			|          NALU 1 HDR           |                               |
+			+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+         NALU 1 Data           |
+			|                   . . .                                       |
+			+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+			|  . . .        | NALU 2 Size                   | NALU 2 HDR    |
+			+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		*/
+		packet = packet[2:]
+		for len(packet) >= 2 {
+			size := int(packet[0])<<8 | int(packet[1])
+			if size+2 > len(packet) {
+				break
+			}
+			if err = client.handleH265Payload(timestamp, packet[2:size+2]); err != nil {
+				return
+			}
+			packet = packet[size+2:]
+		}
+		return
+
+	case naluType == 49: // FU
+		/*
+			0                   1                   2                   3
+			0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+			+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+			|    PayloadHdr (Type=49)       |   FU header   |               |
+			+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+               |
+			|                         FU payload                            |
+			|                               +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+			|                               :...OPTIONAL RTP padding        |
+			+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+
+			The FU header has the following format:
+			+---------------+
+			|0|1|2|3|4|5|6|7|
+			+-+-+-+-+-+-+-+-+
+			|S|E|  FuType   |
+			+---------------+
+		*/
+		fuHeader := packet[2]
+		isStart := fuHeader&0x80 != 0
+		isEnd := fuHeader&0x40 != 0
+		if isStart {
+			client.fuStarted = true
+			client.fuBuffer = []byte{packet[0]&0x81 | (fuHeader&0x3f)<<1, packet[1]}
+		}
+		if client.fuStarted {
+			client.fuBuffer = append(client.fuBuffer, packet[3:]...)
+			if isEnd {
+				client.fuStarted = false
+				if err = client.handleH265Payload(timestamp, client.fuBuffer); err != nil {
+					return
+				}
+			}
+		}
+
+	case naluType >= 35 && naluType <= 47: // aud, sei, reserved
+	case naluType == 50: // PACI
+
+	default:
+		err = fmt.Errorf("rtsp: unsupported H265 naluType=%d", naluType)
+		return
+	}
+
+	return
+}
+
 func (client *Stream) handleRtpPacket(packet []byte) (err error) {
 	if client.isCodecDataChange() {
 		err = ErrCodecDataChange
@@ -1100,6 +1319,11 @@ func (client *Stream) handleRtpPacket(packet []byte) (err error) {
 			return
 		}
 
+	case av.HEVC:
+		if err = client.handleH265Payload(timestamp, payload); err != nil {
+			return
+		}
+
 	case av.AAC:
 		if len(payload) < 4 {
 			err = fmt.Errorf("rtp: aac packet too short")
@@ -1116,6 +1340,77 @@ func (client *Stream) handleRtpPacket(packet []byte) (err error) {
 		client.timestamp = timestamp
 	}
 
+	if client.gotpkt && client.waitKeyFrame {
+		if client.pkt.IsKeyFrame && timestamp != client.brokenTimestamp {
+			client.waitKeyFrame = false
+		} else {
+			client.gotpkt = false
+			client.pkt = av.Packet{}
+		}
+	}
+
+	return
+}
+
+// handleRtpLoss drops access unit being assembled, video waits for next keyframe
+func (client *Stream) handleRtpLoss(packet []byte) {
+	if client.client != nil && client.client.DebugRtp {
+		fmt.Println("rtp: packet lost before seq", pio.U16BE(packet[2:4]))
+	}
+
+	client.fuStarted = false
+	client.fuBuffer = nil
+	client.gotpkt = false
+	client.pkt = av.Packet{}
+
+	if (client.Sdp.Type == av.H264 || client.Sdp.Type == av.HEVC) && len(packet) >= 8 {
+		client.waitKeyFrame = true
+		client.brokenTimestamp = binary.BigEndian.Uint32(packet[4:8])
+	}
+}
+
+// handleJitter processes packets released by jitter buffer until one av packet is ready
+func (client *Stream) handleJitter(now time.Time, latency time.Duration) (err error) {
+	for !client.gotpkt {
+		packet, gap, ok := client.jitter.pop(now, latency)
+		if !ok {
+			return
+		}
+		if gap {
+			client.handleRtpLoss(packet)
+		}
+		if err = client.handleRtpPacket(packet); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (client *Stream) takePacket(idx int) (pkt av.Packet, err error) {
+	/*
+		TODO: sync AV by rtcp NTP timestamp
+		TODO: handle timestamp overflow
+		https://tools.ietf.org/html/rfc3550
+		A receiver can then synchronize presentation of the audio and video packets by relating
+		their RTP timestamps using the timestamp pairs in RTCP SR packets.
+	*/
+	if client.firsttimestamp == 0 {
+		client.firsttimestamp = client.timestamp
+	}
+	client.timestamp -= client.firsttimestamp
+
+	pkt = client.pkt
+	pkt.Time = time.Duration(client.timestamp) * time.Second / time.Duration(client.timeScale())
+	pkt.Idx = int8(idx)
+
+	client.pkt = av.Packet{}
+	client.gotpkt = false
+
+	if pkt.Time < client.lasttime || pkt.Time-client.lasttime > time.Minute*30 {
+		err = fmt.Errorf("rtp: time invalid stream#%d time=%v lasttime=%v", pkt.Idx, pkt.Time, client.lasttime)
+		return
+	}
+	client.lasttime = pkt.Time
 	return
 }
 
@@ -1129,6 +1424,11 @@ func (client *Client) Play() (err error) {
 	if err = client.WriteRequest(req); err != nil {
 		return
 	}
+	if client.Transport == TransportUDP {
+		if _, err = client.ReadResponse(); err != nil {
+			return
+		}
+	}
 
 	if client.allCodecDataReady() {
 		client.stage = stageCodecDataDone
@@ -1153,18 +1453,16 @@ func (client *Client) Teardown() (err error) {
 
 // Close type
 func (client *Client) Close() (err error) {
+	if client.udpdone != nil {
+		close(client.udpdone)
+		client.udpdone = nil
+	}
+	client.closeUDP()
 	return client.conn.Conn.Close()
 }
 
 func (client *Client) handleBlock(block []byte) (pkt av.Packet, ok bool, err error) {
 	_, blockno, _ := client.parseBlockHeader(block)
-	if blockno%2 != 0 {
-		if client.DebugRtp {
-			fmt.Println("rtsp: rtcp block len", len(block)-4)
-		}
-		return
-	}
-
 	i := blockno / 2
 	if i >= len(client.streams) {
 		err = fmt.Errorf("rtsp: block no=%d invalid", blockno)
@@ -1172,46 +1470,61 @@ func (client *Client) handleBlock(block []byte) (pkt av.Packet, ok bool, err err
 	}
 	stream := client.streams[i]
 
-	herr := stream.handleRtpPacket(block[4:])
-	if herr != nil {
-		if !client.SkipErrRtpBlock {
-			err = herr
-			return
+	if blockno%2 != 0 {
+		if client.DebugRtp {
+			fmt.Println("rtsp: rtcp block len", len(block)-4)
 		}
+		stream.stats.handleRtcp(block[4:])
+		return
 	}
+	stream.stats.update(block[4:], rtpClock(time.Duration(time.Now().UnixNano()), stream.timeScale()))
+	stream.jitter.push(block[4:], time.Now())
 
-	if stream.gotpkt {
-		/*
-			TODO: sync AV by rtcp NTP timestamp
-			TODO: handle timestamp overflow
-			https://tools.ietf.org/html/rfc3550
-			A receiver can then synchronize presentation of the audio and video packets by relating
-			their RTP timestamps using the timestamp pairs in RTCP SR packets.
-		*/
-		if stream.firsttimestamp == 0 {
-			stream.firsttimestamp = stream.timestamp
-		}
-		stream.timestamp -= stream.firsttimestamp
+	return client.popPacket()
+}
 
-		ok = true
-		pkt = stream.pkt
-		pkt.Time = time.Duration(stream.timestamp) * time.Second / time.Duration(stream.timeScale())
-		pkt.Idx = int8(client.setupMap[i])
+// popPacket returns packet completed from rtp packets released by jitter buffers
+func (client *Client) popPacket() (pkt av.Packet, ok bool, err error) {
+	now := time.Now()
+	for _, si := range client.setupIdx {
+		stream := client.streams[si]
+		for {
+			herr := stream.handleJitter(now, client.JitterLatency)
+			if herr != nil && !client.SkipErrRtpBlock {
+				err = herr
+				return
+			}
 
-		if pkt.Time < stream.lasttime || pkt.Time-stream.lasttime > time.Minute*30 {
-			err = fmt.Errorf("rtp: time invalid stream#%d time=%v lasttime=%v", pkt.Idx, pkt.Time, stream.lasttime)
-			return
-		}
-		stream.lasttime = pkt.Time
+			if stream.gotpkt {
+				ok = true
+				if pkt, err = stream.takePacket(client.setupMap[si]); err != nil {
+					return
+				}
 
-		if client.DebugRtp {
-			fmt.Println("rtp: pktout", pkt.Idx, pkt.Time, len(pkt.Data))
-		}
+				if client.DebugRtp {
+					fmt.Println("rtp: pktout", pkt.Idx, pkt.Time, len(pkt.Data))
+				}
+				return
+			}
 
-		stream.pkt = av.Packet{}
-		stream.gotpkt = false
+			if herr == nil {
+				break
+			}
+		}
 	}
+	return
+}
 
+// RtpCounters returns packet counters summed over setup streams,
+// counters are updated by ReadPacket and should be read from the same goroutine
+func (client *Client) RtpCounters() (counters RtpCounters) {
+	for _, si := range client.setupIdx {
+		stream := client.streams[si]
+		counters.Received += stream.jitter.Received
+		counters.Lost += stream.jitter.Lost
+		counters.Late += stream.jitter.Late
+		counters.Duplicate += stream.jitter.Duplicate
+	}
 	return
 }
 
@@ -1221,17 +1534,30 @@ func (client *Client) readPacket() (pkt av.Packet, err error) {
 	}
 
 	for {
+		var ok bool
+		if pkt, ok, err = client.popPacket(); err != nil {
+			return
+		}
+		if ok {
+			return
+		}
+
 		var res Response
-		for {
-			if res, err = client.poll(); err != nil {
+		if client.Transport == TransportUDP {
+			if res.Block, err = client.pollUDP(); err != nil {
 				return
 			}
-			if len(res.Block) > 0 {
-				break
+		} else {
+			for {
+				if res, err = client.poll(); err != nil {
+					return
+				}
+				if len(res.Block) > 0 {
+					break
+				}
 			}
 		}
 
-		var ok bool
 		if pkt, ok, err = client.handleBlock(res.Block); err != nil {
 			return
 		}
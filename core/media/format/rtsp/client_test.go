@@ -0,0 +1,292 @@
+package rtsp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/codec"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/h265parser"
+	"github.com/Youngju-Heo/gomedia/core/media/format/rtsp/sdp"
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
+)
+
+// serveUDP is a stand-in server streaming one PCMU track over udp
+func serveUDP(t *testing.T, listener net.Listener, pkts []av.Packet, report chan<- []byte) {
+	netconn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	conn := NewConn(netconn)
+	defer conn.Close()
+
+	p, _ := newPacketizer(0, codec.NewPCMMulawCodecData())
+	var rtp, rtcp *net.UDPConn
+	var clientRtp *net.UDPAddr
+
+	for {
+		req, block, err := conn.readRequest()
+		if err != nil {
+			return
+		}
+		if block != nil {
+			continue
+		}
+
+		switch req.Method {
+		case "DESCRIBE":
+			body := sdp.Marshal(sdp.Session{}, []sdp.Media{p.media})
+			conn.writeResponse(req, 200, []string{"Content-Type: application/sdp"}, []byte(body))
+
+		case "SETUP":
+			transport := req.Headers.Get("Transport")
+			pos := strings.Index(transport, "client_port=")
+			if strings.Contains(transport, "TCP") || pos < 0 {
+				t.Errorf("transport=%s", transport)
+				return
+			}
+			port, _ := strconv.Atoi(strings.SplitN(transport[pos+len("client_port="):], "-", 2)[0])
+			clientRtp = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}
+			if rtp, rtcp, err = listenUDPPair(); err != nil {
+				t.Error(err)
+				return
+			}
+			defer rtp.Close()
+			defer rtcp.Close()
+			serverPort := rtp.LocalAddr().(*net.UDPAddr).Port
+			conn.session = "12345678"
+			conn.writeResponse(req, 200, []string{
+				"Transport: " + transport + ";server_port=" + strconv.Itoa(serverPort) + "-" + strconv.Itoa(serverPort+1),
+			}, nil)
+
+		case "PLAY":
+			conn.writeResponse(req, 200, nil, nil)
+
+			rtcp.SetReadDeadline(time.Now().Add(time.Second * 5))
+			b := make([]byte, 1500)
+			n, _, err := rtcp.ReadFromUDP(b)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			report <- b[:n]
+
+			for _, pkt := range pkts {
+				p.packetize(pkt, func(packet []byte) error {
+					_, err := rtp.WriteToUDP(packet, clientRtp)
+					return err
+				})
+				time.Sleep(time.Millisecond)
+			}
+
+		default:
+			if err := conn.handleRequest(req); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func TestClientUDP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	pkts := []av.Packet{}
+	for i := 0; i < 5; i++ {
+		data := make([]byte, 160)
+		for j := range data {
+			data[j] = byte(i + j)
+		}
+		pkts = append(pkts, av.Packet{Time: time.Duration(i) * 20 * time.Millisecond, Data: data})
+	}
+	report := make(chan []byte, 1)
+	go serveUDP(t, listener, pkts, report)
+
+	client, err := DialTimeout("rtsp://"+listener.Addr().String()+"/live", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.RtspTimeout = time.Second * 5
+	client.RtpTimeout = time.Second * 5
+	client.Transport = TransportUDP
+
+	streams, err := client.Streams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 1 || streams[0].Type() != av.PCMU {
+		t.Fatalf("streams=%v", streams)
+	}
+
+	for _, want := range pkts {
+		pkt, err := client.ReadPacket()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(pkt.Data, want.Data) || pkt.Time != want.Time {
+			t.Fatalf("pkt time=%v len=%d, want time=%v len=%d", pkt.Time, len(pkt.Data), want.Time, len(want.Data))
+		}
+	}
+
+	select {
+	case rr := <-report:
+		if len(rr) < 8 || rr[1] != rtcpReceiverReport {
+			t.Errorf("rtcp=%x, want receiver report", rr)
+		}
+	case <-time.After(time.Second * 5):
+		t.Error("no receiver report")
+	}
+}
+
+func TestReadUDP(t *testing.T) {
+	rtp, rtcp, err := listenUDPPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rtcp.Close()
+	client := &Client{udpch: make(chan []byte, 4), udpdone: make(chan struct{})}
+	go client.readUDP(rtp, 2)
+
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: rtp.LocalAddr().(*net.UDPAddr).Port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	datagrams := [][]byte{bytes.Repeat([]byte{1}, 300), {2, 2, 2}}
+	for _, b := range datagrams {
+		conn.Write(b)
+	}
+
+	// blocks are not overwritten by later reads
+	var blocks [][]byte
+	for range datagrams {
+		select {
+		case block := <-client.udpch:
+			blocks = append(blocks, block)
+		case <-time.After(time.Second * 5):
+			t.Fatal("no block")
+		}
+	}
+	for i, block := range blocks {
+		want := append([]byte{'$', 2, byte(len(datagrams[i]) >> 8), byte(len(datagrams[i]))}, datagrams[i]...)
+		if !bytes.Equal(block, want) || cap(block) != len(want) {
+			t.Errorf("block#%d=% x cap=%d", i, block[:8], cap(block))
+		}
+	}
+	close(client.udpdone)
+	rtp.Close()
+}
+
+func TestClientUDPFallback(t *testing.T) {
+	testServerPlay(t, TransportUDP)
+}
+
+func TestStreamH265(t *testing.T) {
+	vps, _ := hex.DecodeString("40010c01ffff016000000300900000030000030078999809")
+	sps, _ := hex.DecodeString("420101016000000300900000030000030078a003c08010e58dae4932b4dc0404040200000300020000030032")
+	pps, _ := hex.DecodeString("4401c172b46240")
+	h265, err := h265parser.NewCodecDataFromVPSAndSPSAndPPS(vps, sps, pps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := newPacketizer(0, h265)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// parameter sets come in band as an aggregation packet, not in sdp
+	media := p.media
+	media.SpropVPS, media.SpropSPS, media.SpropPPS = nil, nil, nil
+	stream := &Stream{Sdp: media}
+	ap := []byte{48 << 1, 1}
+	for _, nalu := range [][]byte{vps, sps, pps} {
+		ap = append(ap, byte(len(nalu)>>8), byte(len(nalu)))
+		ap = append(ap, nalu...)
+	}
+	if err = stream.handleRtpPacket(p.makeRtpPacket(0, false, ap)); err != nil {
+		t.Fatal(err)
+	}
+	if stream.CodecData == nil || stream.CodecData.(av.H265VideoCodecData).Width() != 1920 {
+		t.Fatalf("codecData=%v", stream.CodecData)
+	}
+
+	// idr_w_radl split into fragments, then trail_r as single nalu
+	for i, size := range []int{5000, 300} {
+		data := make([]byte, 4+size)
+		pio.PutU32BE(data, uint32(size))
+		data[4], data[5] = 0x02, 0x01
+		if i == 0 {
+			data[4] = h265parser.NaluIdrWRadl << 1
+		}
+		for j := 6; j < len(data); j++ {
+			data[j] = byte(i + j)
+		}
+
+		n := 0
+		p.packetize(av.Packet{IsKeyFrame: i == 0, Data: data}, func(packet []byte) error {
+			n++
+			if err := stream.handleRtpPacket(packet); err != nil {
+				t.Fatal(err)
+			}
+			return nil
+		})
+		if !stream.gotpkt || !bytes.Equal(stream.pkt.Data, data) || stream.pkt.IsKeyFrame != (i == 0) {
+			t.Fatalf("nalu#%d packets=%d got=%v key=%v len=%d", i, n, stream.gotpkt, stream.pkt.IsKeyFrame, len(stream.pkt.Data))
+		}
+		stream.takePacket(0)
+	}
+}
+
+func TestStreamH265VPSChange(t *testing.T) {
+	vps, _ := hex.DecodeString("40010c01ffff016000000300900000030000030078999809")
+	sps, _ := hex.DecodeString("420101016000000300900000030000030078a003c08010e58dae4932b4dc0404040200000300020000030032")
+	pps, _ := hex.DecodeString("4401c172b46240")
+	h265, err := h265parser.NewCodecDataFromVPSAndSPSAndPPS(vps, sps, pps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := newPacketizer(0, h265)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := &Stream{Sdp: p.media}
+	if err = stream.makeCodecData(); err != nil {
+		t.Fatal(err)
+	}
+	trail := []byte{0x02, 0x01, 0xaa}
+	if err = stream.handleRtpPacket(p.makeRtpPacket(0, true, trail)); err != nil {
+		t.Fatal(err)
+	}
+	stream.takePacket(0)
+
+	// only vps changes, sent as single nalu followed by unchanged sps and pps
+	newvps := append([]byte{}, vps...)
+	newvps[len(newvps)-1] ^= 0x01
+	for _, nalu := range [][]byte{newvps, sps, pps} {
+		if err = stream.handleRtpPacket(p.makeRtpPacket(0, false, nalu)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = stream.handleRtpPacket(p.makeRtpPacket(0, true, trail)); err != nil {
+		t.Fatal(err)
+	}
+	if err = stream.handleRtpPacket(p.makeRtpPacket(0, true, trail)); err != ErrCodecDataChange {
+		t.Fatalf("err=%v, want ErrCodecDataChange", err)
+	}
+	if err = stream.makeCodecData(); err != nil {
+		t.Fatal(err)
+	}
+	stream.clearCodecDataChange()
+	if got := stream.CodecData.(av.H265VideoCodecData).VPS(); !bytes.Equal(got, newvps) {
+		t.Errorf("vps=%x, want %x", got, newvps)
+	}
+}
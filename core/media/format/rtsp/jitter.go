@@ -0,0 +1,133 @@
+package rtsp
+
+import (
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
+)
+
+const (
+	// see https://tools.ietf.org/html/rfc3550#appendix-A.1
+	jitterMaxDropout  = 3000
+	jitterMaxMisorder = 100
+	jitterMaxPackets  = 1024
+	jitterHistorySize = 512
+)
+
+// RtpCounters type
+type RtpCounters struct {
+	Received  uint64 // packets accepted into jitter buffer
+	Lost      uint64 // packets never arrived before their turn
+	Late      uint64 // packets arrived after their turn was skipped
+	Duplicate uint64 // packets arrived more than once
+}
+
+type jitterPacket struct {
+	seq     uint16
+	data    []byte
+	arrival time.Time
+}
+
+// jitterBuffer reorders rtp packets of one stream by sequence number
+type jitterBuffer struct {
+	RtpCounters
+
+	started bool
+	gap     bool
+	next    uint16
+	packets []jitterPacket
+
+	history [jitterHistorySize]uint16
+	played  [jitterHistorySize]bool
+}
+
+func (jitter *jitterBuffer) reset(seq uint16) {
+	jitter.started = true
+	jitter.next = seq
+	jitter.packets = nil
+	jitter.played = [jitterHistorySize]bool{}
+}
+
+func (jitter *jitterBuffer) wasPlayed(seq uint16) bool {
+	i := seq % jitterHistorySize
+	return jitter.played[i] && jitter.history[i] == seq
+}
+
+func (jitter *jitterBuffer) push(packet []byte, now time.Time) {
+	if len(packet) < 4 {
+		return
+	}
+	seq := pio.U16BE(packet[2:4])
+	if !jitter.started {
+		jitter.reset(seq)
+	}
+
+	diff := int16(seq - jitter.next)
+	if diff < -jitterMaxMisorder || diff > jitterMaxDropout {
+		// sender restarted or jumped, start over from this packet
+		jitter.reset(seq)
+		jitter.gap = true
+		diff = 0
+	}
+
+	if diff < 0 {
+		if jitter.wasPlayed(seq) {
+			jitter.Duplicate++
+		} else {
+			jitter.Late++
+		}
+		return
+	}
+
+	pos := len(jitter.packets)
+	for i, p := range jitter.packets {
+		pdiff := int16(p.seq - jitter.next)
+		if pdiff == diff {
+			jitter.Duplicate++
+			return
+		}
+		if pdiff > diff {
+			pos = i
+			break
+		}
+	}
+
+	jitter.Received++
+	jitter.packets = append(jitter.packets, jitterPacket{})
+	copy(jitter.packets[pos+1:], jitter.packets[pos:])
+	jitter.packets[pos] = jitterPacket{seq: seq, data: packet, arrival: now}
+}
+
+// pop returns next packet in sequence order, gap is set when packets before it were lost.
+// a missing packet is waited for until the oldest buffered packet is older than latency.
+func (jitter *jitterBuffer) pop(now time.Time, latency time.Duration) (packet []byte, gap bool, ok bool) {
+	if len(jitter.packets) == 0 {
+		return
+	}
+
+	first := jitter.packets[0]
+	if first.seq != jitter.next {
+		oldest := first.arrival
+		for _, p := range jitter.packets[1:] {
+			if p.arrival.Before(oldest) {
+				oldest = p.arrival
+			}
+		}
+		if now.Sub(oldest) < latency && len(jitter.packets) < jitterMaxPackets {
+			return
+		}
+		jitter.Lost += uint64(first.seq - jitter.next)
+		jitter.gap = true
+	}
+
+	jitter.packets = jitter.packets[1:]
+	jitter.next = first.seq + 1
+	jitter.history[first.seq%jitterHistorySize] = first.seq
+	jitter.played[first.seq%jitterHistorySize] = true
+
+	packet = first.data
+	gap = jitter.gap
+	jitter.gap = false
+	ok = true
+	return
+}
@@ -0,0 +1,187 @@
+package rtsp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/codec"
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
+)
+
+func makeTestRtp(seq uint16) []byte {
+	b := make([]byte, 12)
+	b[0] = 0x80
+	pio.PutU16BE(b[2:4], seq)
+	return b
+}
+
+func TestJitterBufferReorder(t *testing.T) {
+	jitter := &jitterBuffer{}
+	now := time.Now()
+	latency := time.Millisecond * 100
+
+	for _, seq := range []uint16{65534, 0, 65535, 0, 2} {
+		jitter.push(makeTestRtp(seq), now)
+	}
+
+	var got []uint16
+	for {
+		packet, gap, ok := jitter.pop(now, latency)
+		if !ok {
+			break
+		}
+		if gap {
+			t.Errorf("unexpected gap at seq=%d", pio.U16BE(packet[2:4]))
+		}
+		got = append(got, pio.U16BE(packet[2:4]))
+	}
+	if len(got) != 3 || got[0] != 65534 || got[1] != 65535 || got[2] != 0 {
+		t.Fatalf("got=%v", got)
+	}
+
+	// seq 1 missing, seq 2 waits until latency passed
+	if _, gap, ok := jitter.pop(now.Add(latency), latency); !ok || !gap {
+		t.Fatalf("ok=%v gap=%v, want seq 2 after gap", ok, gap)
+	}
+
+	jitter.push(makeTestRtp(1), now)
+	jitter.push(makeTestRtp(2), now)
+
+	want := RtpCounters{Received: 4, Lost: 1, Late: 1, Duplicate: 2}
+	if jitter.RtpCounters != want {
+		t.Errorf("counters=%+v, want %+v", jitter.RtpCounters, want)
+	}
+}
+
+func TestStreamLossWaitsKeyFrame(t *testing.T) {
+	streams := testStreams(t)
+	p, err := newPacketizer(0, streams[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := &Stream{Sdp: p.media}
+	if err = stream.makeCodecData(); err != nil {
+		t.Fatal(err)
+	}
+
+	// idr, p, idr (one fragment lost), p, idr
+	var rtps [][]byte
+	lost := -1
+	for i := 0; i < 5; i++ {
+		size, nalu := 100, byte(0x41)
+		if i%2 == 0 {
+			size, nalu = 4000, 0x65
+		}
+		data := make([]byte, 4+size)
+		pio.PutU32BE(data, uint32(size))
+		data[4] = nalu
+		pkt := av.Packet{IsKeyFrame: nalu == 0x65, Time: time.Duration(i) * 40 * time.Millisecond, Data: data}
+		p.packetize(pkt, func(packet []byte) error {
+			if i == 2 && lost < 0 && packet[12]&0x1f == 28 {
+				lost = len(rtps)
+			}
+			rtps = append(rtps, packet)
+			return nil
+		})
+	}
+
+	now := time.Now()
+	var keys []bool
+	for i, packet := range rtps {
+		if i == lost+1 {
+			continue
+		}
+		stream.jitter.push(packet, now)
+		for {
+			if err := stream.handleJitter(now, 0); err != nil {
+				t.Fatal(err)
+			}
+			if !stream.gotpkt {
+				break
+			}
+			pkt, _ := stream.takePacket(0)
+			keys = append(keys, pkt.IsKeyFrame)
+		}
+	}
+
+	if len(keys) != 3 || !keys[0] || keys[1] || !keys[2] {
+		t.Errorf("keyframes=%v, want [true false true]", keys)
+	}
+	if stream.jitter.Lost != 1 {
+		t.Errorf("lost=%d", stream.jitter.Lost)
+	}
+}
+
+func TestClientJitterLatencyDefault(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	client, err := DialTimeout("rtsp://"+listener.Addr().String()+"/live", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if client.JitterLatency != JitterLatency || JitterLatency == 0 {
+		t.Fatalf("latency=%v", client.JitterLatency)
+	}
+
+	p, err := newPacketizer(0, codec.NewPCMMulawCodecData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rtps [][]byte
+	for i := 0; i < 5; i++ {
+		pkt := av.Packet{Time: time.Duration(i) * 20 * time.Millisecond, Data: make([]byte, 160)}
+		p.packetize(pkt, func(packet []byte) error {
+			rtps = append(rtps, packet)
+			return nil
+		})
+	}
+
+	for _, test := range []struct {
+		latency time.Duration
+		lost    uint64
+	}{
+		// packet 1 arrives 10ms after 2, within default latency
+		{client.JitterLatency, 0},
+		// without latency it is declared lost as soon as 2 arrives
+		{0, 1},
+	} {
+		stream := &Stream{Sdp: p.media}
+		if err = stream.makeCodecData(); err != nil {
+			t.Fatal(err)
+		}
+		now := time.Now()
+		var times []time.Duration
+		for _, i := range []int{0, 2, 1, 3, 4} {
+			now = now.Add(10 * time.Millisecond)
+			stream.jitter.push(rtps[i], now)
+			for {
+				if err := stream.handleJitter(now, test.latency); err != nil {
+					t.Fatal(err)
+				}
+				if !stream.gotpkt {
+					break
+				}
+				pkt, _ := stream.takePacket(0)
+				times = append(times, pkt.Time)
+			}
+		}
+		if stream.jitter.Lost != test.lost {
+			t.Errorf("latency=%v: lost=%d, want %d", test.latency, stream.jitter.Lost, test.lost)
+		}
+		if test.lost == 0 && len(times) != len(rtps) {
+			t.Errorf("latency=%v: times=%v", test.latency, times)
+		}
+		for i := 1; i < len(times); i++ {
+			if times[i] <= times[i-1] {
+				t.Errorf("latency=%v: times=%v not in order", test.latency, times)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package rtsp
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/h264parser"
+	"github.com/Youngju-Heo/gomedia/core/media/format/rtsp/sdp"
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
+)
+
+// RtpMaxPayloadSize var
+var RtpMaxPayloadSize = 1400
+
+const rtpHeaderLength = 12
+
+// packetizer converts av.Packet into rtp packets of one stream
+type packetizer struct {
+	codecData av.CodecData
+	media     sdp.Media
+	channel   int
+	ssrc      uint32
+	seq       uint16
+	basetime  uint32
+}
+
+func randUint32() uint32 {
+	var b [4]byte
+	rand.Read(b[:])
+	return binary.BigEndian.Uint32(b[:])
+}
+
+func newPacketizer(idx int, codecData av.CodecData) (inst *packetizer, err error) {
+	media := sdp.Media{
+		Type:    codecData.Type(),
+		Control: fmt.Sprintf("streamid=%d", idx),
+	}
+
+	switch media.Type {
+	case av.H264:
+		h264 := codecData.(av.H264VideoCodecData)
+		media.AVType = "video"
+		media.PayloadType = 96 + idx
+		media.TimeScale = 90000
+		media.SpropParameterSets = [][]byte{h264.SPS(), h264.PPS()}
+
+	case av.HEVC:
+		h265 := codecData.(av.H265VideoCodecData)
+		media.AVType = "video"
+		media.PayloadType = 96 + idx
+		media.TimeScale = 90000
+		media.SpropVPS = [][]byte{h265.VPS()}
+		media.SpropSPS = [][]byte{h265.SPS()}
+		media.SpropPPS = [][]byte{h265.PPS()}
+
+	case av.AAC:
+		aac := codecData.(av.MPEG4AudioCodecData)
+		media.AVType = "audio"
+		media.PayloadType = 96 + idx
+		media.TimeScale = aac.SampleRate()
+		media.ChannelCount = aac.ChannelLayout().Count()
+		media.Config = aac.MPEG4AudioConfigBytes()
+		media.SizeLength = 13
+		media.IndexLength = 3
+
+	case av.PCMU, av.PCMA:
+		media.AVType = "audio"
+		if media.Type == av.PCMU {
+			media.PayloadType = 0
+		} else {
+			media.PayloadType = 8
+		}
+		media.TimeScale = 8000
+
+	default:
+		err = fmt.Errorf("rtsp: codec type=%v is not supported", media.Type)
+		return
+	}
+
+	inst = &packetizer{
+		codecData: codecData,
+		media:     media,
+		channel:   -1,
+		ssrc:      randUint32(),
+		seq:       uint16(randUint32()),
+		basetime:  randUint32(),
+	}
+	return
+}
+
+func (inst *packetizer) timestamp(t time.Duration) uint32 {
+	return inst.basetime + rtpClock(t, inst.media.TimeScale)
+}
+
+func (inst *packetizer) makeRtpPacket(timestamp uint32, marker bool, payload ...[]byte) []byte {
+	/*
+		0                   1                   2                   3
+		0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|V=2|P|X|  CC   |M|     PT      |       sequence number         |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|                           timestamp                           |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|           synchronization source (SSRC) identifier            |
+		+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+
+	*/
+	size := rtpHeaderLength
+	for _, b := range payload {
+		size += len(b)
+	}
+	packet := make([]byte, size)
+	packet[0] = 0x80
+	packet[1] = byte(inst.media.PayloadType) & 0x7f
+	if marker {
+		packet[1] |= 0x80
+	}
+	pio.PutU16BE(packet[2:4], inst.seq)
+	pio.PutU32BE(packet[4:8], timestamp)
+	pio.PutU32BE(packet[8:12], inst.ssrc)
+	n := rtpHeaderLength
+	for _, b := range payload {
+		n += copy(packet[n:], b)
+	}
+	inst.seq++
+	return packet
+}
+
+func (inst *packetizer) packetize(pkt av.Packet, emit func([]byte) error) (err error) {
+	timestamp := inst.timestamp(pkt.Time + pkt.CompositionTime)
+
+	switch inst.media.Type {
+	case av.H264:
+		nalus, _ := h264parser.SplitNALUs(pkt.Data)
+		if pkt.IsKeyFrame {
+			h264 := inst.codecData.(av.H264VideoCodecData)
+			nalus = append([][]byte{h264.SPS(), h264.PPS()}, nalus...)
+		}
+		for i, nalu := range nalus {
+			if err = inst.packetizeH264(timestamp, nalu, i == len(nalus)-1, emit); err != nil {
+				return
+			}
+		}
+
+	case av.HEVC:
+		nalus, _ := h264parser.SplitNALUs(pkt.Data)
+		if pkt.IsKeyFrame {
+			h265 := inst.codecData.(av.H265VideoCodecData)
+			nalus = append([][]byte{h265.VPS(), h265.SPS(), h265.PPS()}, nalus...)
+		}
+		for i, nalu := range nalus {
+			if err = inst.packetizeH265(timestamp, nalu, i == len(nalus)-1, emit); err != nil {
+				return
+			}
+		}
+
+	case av.AAC:
+		/*
+			AU-headers-length(16) | AU-size(13) AU-Index(3) | AU
+			https://tools.ietf.org/html/rfc3640#section-3.2.1
+		*/
+		header := make([]byte, 4)
+		pio.PutU16BE(header[0:2], 16)
+		pio.PutU16BE(header[2:4], uint16(len(pkt.Data)<<3))
+		err = emit(inst.makeRtpPacket(timestamp, true, header, pkt.Data))
+
+	default:
+		err = emit(inst.makeRtpPacket(timestamp, false, pkt.Data))
+	}
+
+	return
+}
+
+func (inst *packetizer) packetizeH264(timestamp uint32, nalu []byte, last bool, emit func([]byte) error) (err error) {
+	if len(nalu) == 0 {
+		return
+	}
+
+	if len(nalu) <= RtpMaxPayloadSize {
+		return emit(inst.makeRtpPacket(timestamp, last, nalu))
+	}
+
+	// FU-A, see handleH264Payload for the layout
+	fuIndicator := nalu[0]&0xe0 | 28
+	naluType := nalu[0] & 0x1f
+	payload := nalu[1:]
+	for start := true; len(payload) > 0; start = false {
+		size := RtpMaxPayloadSize - 2
+		if size > len(payload) {
+			size = len(payload)
+		}
+		fuHeader := naluType
+		if start {
+			fuHeader |= 0x80
+		}
+		end := size == len(payload)
+		if end {
+			fuHeader |= 0x40
+		}
+		if err = emit(inst.makeRtpPacket(timestamp, last && end, []byte{fuIndicator, fuHeader}, payload[:size])); err != nil {
+			return
+		}
+		payload = payload[size:]
+	}
+	return
+}
+
+func (inst *packetizer) packetizeH265(timestamp uint32, nalu []byte, last bool, emit func([]byte) error) (err error) {
+	if len(nalu) < 2 {
+		return
+	}
+
+	if len(nalu) <= RtpMaxPayloadSize {
+		return emit(inst.makeRtpPacket(timestamp, last, nalu))
+	}
+
+	// FU, see handleH265Payload for the layout
+	payloadHdr := []byte{nalu[0]&0x81 | 49<<1, nalu[1]}
+	naluType := nalu[0] >> 1 & 0x3f
+	payload := nalu[2:]
+	for start := true; len(payload) > 0; start = false {
+		size := RtpMaxPayloadSize - 3
+		if size > len(payload) {
+			size = len(payload)
+		}
+		fuHeader := naluType
+		if start {
+			fuHeader |= 0x80
+		}
+		end := size == len(payload)
+		if end {
+			fuHeader |= 0x40
+		}
+		if err = emit(inst.makeRtpPacket(timestamp, last && end, payloadHdr, []byte{fuHeader}, payload[:size])); err != nil {
+			return
+		}
+		payload = payload[size:]
+	}
+	return
+}
@@ -0,0 +1,173 @@
+package rtsp
+
+import (
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
+)
+
+const (
+	rtcpSenderReport   = 200
+	rtcpReceiverReport = 201
+	rtcpSourceDesc     = 202
+)
+
+// RtcpReportInterval var
+var RtcpReportInterval = time.Second * 5
+
+// rtpClock converts duration into rtp clock units without overflowing int64
+func rtpClock(t time.Duration, timeScale int) uint32 {
+	scale := time.Duration(timeScale)
+	sec := t / time.Second
+	rem := t % time.Second
+	return uint32(sec*scale + rem*scale/time.Second)
+}
+
+// rtpStats keeps reception statistics of one rtp source, https://tools.ietf.org/html/rfc3550#appendix-A.1
+type rtpStats struct {
+	started       bool
+	ssrc          uint32
+	baseSeq       uint16
+	maxSeq        uint16
+	cycles        uint32
+	received      uint32
+	expectedPrior uint32
+	receivedPrior uint32
+
+	hasTransit bool
+	transit    int32
+	jitter     float64
+
+	lsr     uint32
+	lsrTime time.Time
+}
+
+func (stats *rtpStats) update(packet []byte, arrival uint32) {
+	if len(packet) < 12 {
+		return
+	}
+	seq := pio.U16BE(packet[2:4])
+	timestamp := pio.U32BE(packet[4:8])
+	ssrc := pio.U32BE(packet[8:12])
+
+	if !stats.started || ssrc != stats.ssrc {
+		*stats = rtpStats{
+			started: true,
+			ssrc:    ssrc,
+			baseSeq: seq,
+			maxSeq:  seq,
+		}
+	} else if delta := seq - stats.maxSeq; delta < 0x8000 {
+		if seq < stats.maxSeq {
+			stats.cycles += 1 << 16
+		}
+		stats.maxSeq = seq
+	}
+	stats.received++
+
+	transit := int32(arrival - timestamp)
+	if stats.hasTransit {
+		d := transit - stats.transit
+		if d < 0 {
+			d = -d
+		}
+		stats.jitter += (float64(d) - stats.jitter) / 16
+	}
+	stats.transit = transit
+	stats.hasTransit = true
+}
+
+func (stats *rtpStats) handleRtcp(packet []byte) {
+	for len(packet) >= 4 {
+		length := (int(pio.U16BE(packet[2:4])) + 1) * 4
+		if length > len(packet) {
+			return
+		}
+		if packet[1] == rtcpSenderReport && length >= 20 {
+			// middle 32 bits of ntp timestamp
+			stats.lsr = pio.U32BE(packet[10:14])
+			stats.lsrTime = time.Now()
+		}
+		packet = packet[length:]
+	}
+}
+
+const rtcpReportBlockLength = 24
+
+func (stats *rtpStats) fillReportBlock(b []byte) {
+	/*
+		+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+
+		|                 SSRC_1 (SSRC of first source)                 |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		| fraction lost |       cumulative number of packets lost       |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|           extended highest sequence number received           |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|                      interarrival jitter                      |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|                         last SR (LSR)                         |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|                   delay since last SR (DLSR)                  |
+		+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+
+	*/
+	extmax := stats.cycles + uint32(stats.maxSeq)
+	expected := extmax - uint32(stats.baseSeq) + 1
+	lost := int64(expected) - int64(stats.received)
+	if lost > 0x7fffff {
+		lost = 0x7fffff
+	} else if lost < -0x800000 {
+		lost = -0x800000
+	}
+
+	expectedInterval := expected - stats.expectedPrior
+	receivedInterval := stats.received - stats.receivedPrior
+	stats.expectedPrior = expected
+	stats.receivedPrior = stats.received
+	var fraction int64
+	if lostInterval := int64(expectedInterval) - int64(receivedInterval); expectedInterval != 0 && lostInterval > 0 {
+		fraction = lostInterval << 8 / int64(expectedInterval)
+	}
+
+	var dlsr uint32
+	if stats.lsr != 0 {
+		dlsr = uint32(time.Since(stats.lsrTime) * 65536 / time.Second)
+	}
+
+	pio.PutU32BE(b[0:4], stats.ssrc)
+	b[4] = byte(fraction)
+	pio.PutU24BE(b[5:8], uint32(lost)&0xffffff)
+	pio.PutU32BE(b[8:12], extmax)
+	pio.PutU32BE(b[12:16], uint32(stats.jitter))
+	pio.PutU32BE(b[16:20], stats.lsr)
+	pio.PutU32BE(b[20:24], dlsr)
+}
+
+// makeReceiverReport builds compound RR + SDES(CNAME) rtcp packet
+func makeReceiverReport(ssrc uint32, cname string, stats *rtpStats) []byte {
+	count := 0
+	if stats != nil && stats.started {
+		count = 1
+	}
+
+	rrlen := 8 + count*rtcpReportBlockLength
+	sdeslen := (8 + 2 + len(cname) + 1 + 3) / 4 * 4
+	b := make([]byte, rrlen+sdeslen)
+
+	b[0] = 0x80 | byte(count)
+	b[1] = rtcpReceiverReport
+	pio.PutU16BE(b[2:4], uint16(rrlen/4-1))
+	pio.PutU32BE(b[4:8], ssrc)
+	if count > 0 {
+		stats.fillReportBlock(b[8:rrlen])
+	}
+
+	sdes := b[rrlen:]
+	sdes[0] = 0x81
+	sdes[1] = rtcpSourceDesc
+	pio.PutU16BE(sdes[2:4], uint16(sdeslen/4-1))
+	pio.PutU32BE(sdes[4:8], ssrc)
+	sdes[8] = 1 // CNAME
+	sdes[9] = byte(len(cname))
+	copy(sdes[10:], cname)
+	return b
+}
@@ -0,0 +1,96 @@
+package sdp
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+)
+
+// EncodingName returns rtpmap encoding name of codec type
+func EncodingName(typ av.CodecType) string {
+	switch typ {
+	case av.H264:
+		return "H264"
+	case av.HEVC:
+		return "H265"
+	case av.AAC:
+		return "MPEG4-GENERIC"
+	case av.PCMU:
+		return "PCMU"
+	case av.PCMA:
+		return "PCMA"
+	}
+	return ""
+}
+
+// Marshal builds session description text from session and medias
+func Marshal(sess Session, medias []Media) string {
+	buf := &strings.Builder{}
+
+	fmt.Fprintf(buf, "v=0\r\n")
+	fmt.Fprintf(buf, "o=- 0 0 IN IP4 0.0.0.0\r\n")
+	fmt.Fprintf(buf, "s=Media Server\r\n")
+	if sess.URI != "" {
+		fmt.Fprintf(buf, "u=%s\r\n", sess.URI)
+	}
+	fmt.Fprintf(buf, "c=IN IP4 0.0.0.0\r\n")
+	fmt.Fprintf(buf, "t=0 0\r\n")
+	fmt.Fprintf(buf, "a=control:*\r\n")
+
+	for _, media := range medias {
+		fmt.Fprintf(buf, "m=%s 0 RTP/AVP %d\r\n", media.AVType, media.PayloadType)
+
+		rtpmap := fmt.Sprintf("%s/%d", EncodingName(media.Type), media.TimeScale)
+		if media.ChannelCount > 0 {
+			rtpmap += fmt.Sprintf("/%d", media.ChannelCount)
+		}
+		fmt.Fprintf(buf, "a=rtpmap:%d %s\r\n", media.PayloadType, rtpmap)
+
+		switch media.Type {
+		case av.H264:
+			params := []string{"packetization-mode=1"}
+			if len(media.SpropParameterSets) > 0 && len(media.SpropParameterSets[0]) >= 4 {
+				params = append(params, "profile-level-id="+hex.EncodeToString(media.SpropParameterSets[0][1:4]))
+			}
+			sets := []string{}
+			for _, set := range media.SpropParameterSets {
+				sets = append(sets, base64.StdEncoding.EncodeToString(set))
+			}
+			if len(sets) > 0 {
+				params = append(params, "sprop-parameter-sets="+strings.Join(sets, ","))
+			}
+			fmt.Fprintf(buf, "a=fmtp:%d %s\r\n", media.PayloadType, strings.Join(params, ";"))
+
+		case av.HEVC:
+			params := []string{}
+			for _, sprop := range []struct {
+				name string
+				sets [][]byte
+			}{{"sprop-vps", media.SpropVPS}, {"sprop-sps", media.SpropSPS}, {"sprop-pps", media.SpropPPS}} {
+				sets := []string{}
+				for _, set := range sprop.sets {
+					sets = append(sets, base64.StdEncoding.EncodeToString(set))
+				}
+				if len(sets) > 0 {
+					params = append(params, sprop.name+"="+strings.Join(sets, ","))
+				}
+			}
+			if len(params) > 0 {
+				fmt.Fprintf(buf, "a=fmtp:%d %s\r\n", media.PayloadType, strings.Join(params, ";"))
+			}
+
+		case av.AAC:
+			fmt.Fprintf(buf, "a=fmtp:%d streamtype=5;profile-level-id=1;mode=AAC-hbr;sizelength=%d;indexlength=%d;indexdeltalength=%d;config=%s\r\n",
+				media.PayloadType, media.SizeLength, media.IndexLength, media.IndexLength, hex.EncodeToString(media.Config))
+		}
+
+		if media.Control != "" {
+			fmt.Fprintf(buf, "a=control:%s\r\n", media.Control)
+		}
+	}
+
+	return buf.String()
+}
@@ -22,8 +22,12 @@ type Media struct {
 	TimeScale          int
 	Control            string
 	Rtpmap             int
+	ChannelCount       int
 	Config             []byte
 	SpropParameterSets [][]byte
+	SpropVPS           [][]byte
+	SpropSPS           [][]byte
+	SpropPPS           [][]byte
 	PayloadType        int
 	SizeLength         int
 	IndexLength        int
@@ -71,17 +75,26 @@ func Parse(content string) (sess Session, medias []Media) {
 							}
 						}
 						keyval = strings.Split(field, "/")
-						if len(keyval) >= 2 {
+						if len(keyval) >= 2 && strings.HasPrefix(fields[0], "rtpmap:") {
 							key := keyval[0]
 							switch strings.ToUpper(key) {
 							case "MPEG4-GENERIC":
 								media.Type = av.AAC
 							case "H264":
 								media.Type = av.H264
+							case "H265":
+								media.Type = av.HEVC
+							case "PCMU":
+								media.Type = av.PCMU
+							case "PCMA":
+								media.Type = av.PCMA
 							}
 							if i, err := strconv.Atoi(keyval[1]); err == nil {
 								media.TimeScale = i
 							}
+							if len(keyval) >= 3 {
+								media.ChannelCount, _ = strconv.Atoi(keyval[2])
+							}
 							if false {
 								fmt.Println("sdp:", keyval[1], media.TimeScale)
 							}
@@ -106,6 +119,12 @@ func Parse(content string) (sess Session, medias []Media) {
 											val, _ := base64.StdEncoding.DecodeString(field)
 											media.SpropParameterSets = append(media.SpropParameterSets, val)
 										}
+									case "sprop-vps":
+										media.SpropVPS = decodeSprop(val)
+									case "sprop-sps":
+										media.SpropSPS = decodeSprop(val)
+									case "sprop-pps":
+										media.SpropPPS = decodeSprop(val)
 									}
 								}
 							}
@@ -118,3 +137,13 @@ func Parse(content string) (sess Session, medias []Media) {
 	}
 	return
 }
+
+// decodeSprop decodes comma separated base64 parameter sets
+func decodeSprop(val string) (sets [][]byte) {
+	for _, field := range strings.Split(val, ",") {
+		if set, err := base64.StdEncoding.DecodeString(strings.TrimSpace(field)); err == nil && len(set) > 0 {
+			sets = append(sets, set)
+		}
+	}
+	return
+}
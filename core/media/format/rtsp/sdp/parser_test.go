@@ -1,12 +1,15 @@
 package sdp
 
 import (
+	"bytes"
 	"testing"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
 )
 
 // TestParse type
 func TestParse(t *testing.T) {
-	infos := Decode(`
+	_, infos := Parse(`
 v=0
 o=- 1459325504777324 1 IN IP4 192.168.0.123
 s=RTSP/RTP stream from Network Video Server
@@ -43,3 +46,34 @@ a=appversion:1.0
 `)
 	t.Logf("%v", infos)
 }
+
+func TestParseH265(t *testing.T) {
+	_, medias := Parse(`
+v=0
+o=- 0 0 IN IP4 127.0.0.1
+s=No Name
+t=0 0
+m=video 0 RTP/AVP 96
+a=rtpmap:96 H265/90000
+a=fmtp:96 sprop-vps=QAEMAf//AWAAAAMAkAAAAwAAAwB4mZgJ; sprop-sps=QgEBAWAAAAMAkAAAAwAAAwB4oAPAgBDllmZpJMrgEAAAAwAQAAADAZYI; sprop-pps=RAHBcrRiQA==
+a=control:streamid=0
+`)
+	if len(medias) != 1 {
+		t.Fatalf("medias=%v", medias)
+	}
+	media := medias[0]
+	if media.Type != av.HEVC || media.TimeScale != 90000 || media.Control != "streamid=0" {
+		t.Errorf("media=%+v", media)
+	}
+	if len(media.SpropVPS) != 1 || len(media.SpropSPS) != 1 || len(media.SpropPPS) != 1 {
+		t.Fatalf("vps=%d sps=%d pps=%d", len(media.SpropVPS), len(media.SpropSPS), len(media.SpropPPS))
+	}
+	if media.SpropSPS[0][0]>>1 != 33 {
+		t.Errorf("sps=%x", media.SpropSPS[0])
+	}
+
+	_, medias = Parse(Marshal(Session{}, medias))
+	if len(medias) != 1 || !bytes.Equal(medias[0].SpropVPS[0], media.SpropVPS[0]) || !bytes.Equal(medias[0].SpropPPS[0], media.SpropPPS[0]) {
+		t.Errorf("marshal round trip=%+v", medias)
+	}
+}
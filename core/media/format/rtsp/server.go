@@ -0,0 +1,727 @@
+package rtsp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/format/rtsp/sdp"
+)
+
+// Debug var
+var Debug bool
+
+// Server type
+type Server struct {
+	Addr          string
+	HandlePublish func(*Conn)
+	HandlePlay    func(*Conn)
+	HandleConn    func(*Conn)
+}
+
+func (server *Server) handleConn(conn *Conn) (err error) {
+	defer conn.Close()
+
+	if server.HandleConn != nil {
+		server.HandleConn(conn)
+	} else {
+		if err = conn.prepare(serverStageCommandDone); err != nil {
+			return
+		}
+
+		if conn.playing {
+			if server.HandlePlay != nil {
+				server.HandlePlay(conn)
+			}
+		} else if conn.publishing {
+			if server.HandlePublish != nil {
+				server.HandlePublish(conn)
+			}
+		}
+	}
+
+	if conn.describe != nil {
+		// handler did not call WriteHeader(), nothing to play
+		err = conn.writeResponse(*conn.describe, 404, nil, nil)
+	}
+	return
+}
+
+// ListenAndServe type
+func (server *Server) ListenAndServe() (err error) {
+	addr := server.Addr
+	if addr == "" {
+		addr = ":554"
+	}
+	var tcpaddr *net.TCPAddr
+	if tcpaddr, err = net.ResolveTCPAddr("tcp", addr); err != nil {
+		err = fmt.Errorf("rtsp: ListenAndServe: %s", err)
+		return
+	}
+
+	var listener *net.TCPListener
+	if listener, err = net.ListenTCP("tcp", tcpaddr); err != nil {
+		return
+	}
+
+	if Debug {
+		fmt.Println("rtsp: server: listening on", addr)
+	}
+
+	return server.Serve(listener)
+}
+
+// Serve accepts connections on listener
+func (server *Server) Serve(listener net.Listener) (err error) {
+	for {
+		var netconn net.Conn
+		if netconn, err = listener.Accept(); err != nil {
+			return
+		}
+
+		if Debug {
+			fmt.Println("rtsp: server: accepted")
+		}
+
+		conn := NewConn(netconn)
+		go func() {
+			err := server.handleConn(conn)
+			if Debug {
+				fmt.Println("rtsp: server: client closed err:", err)
+			}
+		}()
+	}
+}
+
+const (
+	serverStageCommandDone = iota + 1
+	serverStageCodecDataDone
+)
+
+// Conn is server side rtsp connection, works as av.Muxer for players
+// and av.Demuxer for publishers
+type Conn struct {
+	URL         *url.URL
+	DebugRtsp   bool
+	DebugRtp    bool
+	RtspTimeout time.Duration
+
+	conn   *connWithTimeout
+	brconn *bufio.Reader
+	bufw   *bufio.Writer
+	wlock  sync.Mutex
+
+	stage      int
+	playing    bool
+	publishing bool
+	session    string
+	describe   *Request
+
+	// publishing
+	streams     []*Stream
+	streamsintf []av.CodecData
+	channels    map[int]int
+
+	// playing
+	packetizers []*packetizer
+}
+
+// NewConn type
+func NewConn(netconn net.Conn) *Conn {
+	connt := &connWithTimeout{Conn: netconn}
+	return &Conn{
+		conn:      connt,
+		brconn:    bufio.NewReaderSize(connt, 4096),
+		bufw:      bufio.NewWriterSize(connt, 4096),
+		channels:  map[int]int{},
+		DebugRtsp: DebugRtsp,
+		DebugRtp:  DebugRtp,
+	}
+}
+
+// NetConn type
+func (conn *Conn) NetConn() net.Conn {
+	return conn.conn.Conn
+}
+
+// Close type
+func (conn *Conn) Close() (err error) {
+	return conn.conn.Conn.Close()
+}
+
+func statusText(code int) string {
+	switch code {
+	case 200:
+		return "OK"
+	case 400:
+		return "Bad Request"
+	case 404:
+		return "Not Found"
+	case 405:
+		return "Method Not Allowed"
+	case 454:
+		return "Session Not Found"
+	case 455:
+		return "Method Not Valid in This State"
+	case 461:
+		return "Unsupported Transport"
+	}
+	return "Internal Server Error"
+}
+
+// readRequest reads either rtsp request or interleaved '$' block
+func (conn *Conn) readRequest() (req Request, block []byte, err error) {
+	var b byte
+	for {
+		if b, err = conn.brconn.ReadByte(); err != nil {
+			return
+		}
+		if b != '\r' && b != '\n' {
+			break
+		}
+	}
+
+	if b == '$' {
+		block = make([]byte, 4)
+		block[0] = b
+		if _, err = io.ReadFull(conn.brconn, block[1:4]); err != nil {
+			return
+		}
+		length := int(block[2])<<8 | int(block[3])
+		block = append(block, make([]byte, length)...)
+		if _, err = io.ReadFull(conn.brconn, block[4:]); err != nil {
+			return
+		}
+		return
+	}
+	conn.brconn.UnreadByte()
+
+	r := textproto.NewReader(conn.brconn)
+	var line string
+	if line, err = r.ReadLine(); err != nil {
+		return
+	}
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) < 3 || !strings.HasPrefix(fields[2], "RTSP/") {
+		err = fmt.Errorf("rtsp: request line invalid: %q", line)
+		return
+	}
+	req.Method = fields[0]
+	req.URI = fields[1]
+
+	if req.Headers, err = r.ReadMIMEHeader(); err != nil {
+		return
+	}
+	req.ContentLength, _ = strconv.Atoi(req.Headers.Get("Content-Length"))
+	if req.ContentLength > 0 {
+		req.Body = make([]byte, req.ContentLength)
+		if _, err = io.ReadFull(conn.brconn, req.Body); err != nil {
+			return
+		}
+	}
+
+	if conn.DebugRtsp {
+		fmt.Println("rtsp: <", line)
+	}
+	return
+}
+
+// setWriteDeadline is used while playing, when reads must not time out
+func (conn *Conn) setWriteDeadline() {
+	if conn.RtspTimeout > 0 {
+		conn.conn.Conn.SetWriteDeadline(time.Now().Add(conn.RtspTimeout))
+	}
+}
+
+func (conn *Conn) writeResponse(req Request, code int, headers []string, body []byte) (err error) {
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "RTSP/1.0 %d %s\r\n", code, statusText(code))
+	fmt.Fprintf(buf, "CSeq: %s\r\n", req.Headers.Get("CSeq"))
+	if conn.session != "" {
+		fmt.Fprintf(buf, "Session: %s;timeout=60\r\n", conn.session)
+	}
+	for _, s := range headers {
+		io.WriteString(buf, s)
+		io.WriteString(buf, "\r\n")
+	}
+	if len(body) > 0 {
+		fmt.Fprintf(buf, "Content-Length: %d\r\n", len(body))
+	}
+	io.WriteString(buf, "\r\n")
+	buf.Write(body)
+
+	if conn.DebugRtsp {
+		fmt.Print("> ", buf.String())
+	}
+
+	conn.wlock.Lock()
+	defer conn.wlock.Unlock()
+	conn.setWriteDeadline()
+	if _, err = conn.bufw.Write(buf.Bytes()); err != nil {
+		return
+	}
+	return conn.bufw.Flush()
+}
+
+// handleRequest answers requests valid in any state
+func (conn *Conn) handleRequest(req Request) (err error) {
+	switch req.Method {
+	case "OPTIONS":
+		return conn.writeResponse(req, 200, []string{
+			"Public: OPTIONS, DESCRIBE, ANNOUNCE, SETUP, PLAY, RECORD, TEARDOWN, GET_PARAMETER, SET_PARAMETER",
+		}, nil)
+
+	case "GET_PARAMETER", "SET_PARAMETER":
+		return conn.writeResponse(req, 200, nil, nil)
+
+	case "TEARDOWN":
+		conn.writeResponse(req, 200, nil, nil)
+		return io.EOF
+	}
+
+	return conn.writeResponse(req, 455, nil, nil)
+}
+
+// findControl returns index of media control which SETUP uri points to
+func findControl(uri string, controls []string) int {
+	for i, control := range controls {
+		if control != "" && (uri == control || strings.HasSuffix(uri, "/"+control)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseInterleaved returns rtp channel from Transport header
+func parseInterleaved(transport string) (channel int, ok bool) {
+	if !strings.Contains(transport, "RTP/AVP/TCP") {
+		return
+	}
+	for _, field := range strings.Split(transport, ";") {
+		keyval := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(keyval) == 2 && keyval[0] == "interleaved" {
+			var err error
+			if channel, err = strconv.Atoi(strings.SplitN(keyval[1], "-", 2)[0]); err != nil {
+				return
+			}
+			ok = true
+			return
+		}
+	}
+	return
+}
+
+func (conn *Conn) handleSetup(req Request, controls []string) (idx int, channel int, err error) {
+	if idx = findControl(req.URI, controls); idx < 0 {
+		err = conn.writeResponse(req, 404, nil, nil)
+		return
+	}
+
+	var ok bool
+
+	transport := req.Headers.Get("Transport")
+	if channel, ok = parseInterleaved(transport); !ok {
+		idx = -1
+		err = conn.writeResponse(req, 461, nil, nil)
+		return
+	}
+
+	if conn.session == "" {
+		conn.session = fmt.Sprintf("%08X", randUint32())
+	}
+
+	err = conn.writeResponse(req, 200, []string{
+		fmt.Sprintf("Transport: RTP/AVP/TCP;unicast;interleaved=%d-%d", channel, channel+1),
+	}, nil)
+	return
+}
+
+func (conn *Conn) handleAnnounce(req Request) (err error) {
+	_, medias := sdp.Parse(string(req.Body))
+	if len(medias) == 0 {
+		return conn.writeResponse(req, 400, nil, nil)
+	}
+
+	streams := []*Stream{}
+	for i, media := range medias {
+		if media.Control == "" {
+			media.Control = fmt.Sprintf("streamid=%d", i)
+		}
+		if !isMediaSupported(media) {
+			if Debug {
+				fmt.Println("rtsp: announce: unsupported media", media.Type, media.PayloadType)
+			}
+			return conn.writeResponse(req, 415, nil, nil)
+		}
+		stream := &Stream{Sdp: media}
+		if cerr := stream.makeCodecData(); cerr != nil && !stream.isParamSetMissing() {
+			if Debug {
+				fmt.Println("rtsp: announce:", cerr)
+			}
+			return conn.writeResponse(req, 400, nil, nil)
+		}
+		streams = append(streams, stream)
+	}
+	conn.streams = streams
+	conn.publishing = true
+	return conn.writeResponse(req, 200, nil, nil)
+}
+
+// isMediaSupported reports whether codec data of media can be made
+func isMediaSupported(media sdp.Media) bool {
+	if media.PayloadType >= 96 && media.PayloadType <= 127 {
+		switch media.Type {
+		case av.H264, av.HEVC, av.AAC:
+			return true
+		}
+		return false
+	}
+	return media.PayloadType == 0 || media.PayloadType == 8
+}
+
+// isParamSetMissing reports whether h264/h265 parameter sets are not in sdp, they may come in-band
+func (stream *Stream) isParamSetMissing() bool {
+	switch stream.Sdp.Type {
+	case av.H264:
+		return len(stream.sps) == 0 || len(stream.pps) == 0
+	case av.HEVC:
+		return len(stream.vps) == 0 || len(stream.sps) == 0 || len(stream.pps) == 0
+	}
+	return false
+}
+
+func (conn *Conn) readCommand() (err error) {
+	for {
+		var req Request
+		var block []byte
+		if req, block, err = conn.readRequest(); err != nil {
+			return
+		}
+		if block != nil {
+			continue
+		}
+
+		if conn.URL == nil {
+			if conn.URL, err = url.Parse(req.URI); err != nil {
+				return
+			}
+		}
+
+		switch req.Method {
+		case "DESCRIBE":
+			conn.playing = true
+			conn.describe = &req
+			conn.stage++
+			return
+
+		case "ANNOUNCE":
+			if err = conn.handleAnnounce(req); err != nil {
+				return
+			}
+
+		case "SETUP":
+			if !conn.publishing {
+				if err = conn.writeResponse(req, 455, nil, nil); err != nil {
+					return
+				}
+				continue
+			}
+			controls := []string{}
+			for _, stream := range conn.streams {
+				controls = append(controls, stream.Sdp.Control)
+			}
+			var idx, channel int
+			if idx, channel, err = conn.handleSetup(req, controls); err != nil {
+				return
+			}
+			if idx >= 0 {
+				conn.channels[channel] = idx
+			}
+
+		case "RECORD":
+			if !conn.publishing || len(conn.channels) == 0 {
+				if err = conn.writeResponse(req, 455, nil, nil); err != nil {
+					return
+				}
+				continue
+			}
+			if err = conn.writeResponse(req, 200, nil, nil); err != nil {
+				return
+			}
+			conn.stage++
+			return
+
+		default:
+			if err = conn.handleRequest(req); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (conn *Conn) prepare(stage int) (err error) {
+	for conn.stage < stage {
+		switch conn.stage {
+		case 0:
+			conn.conn.Timeout = conn.RtspTimeout
+			if err = conn.readCommand(); err != nil {
+				return
+			}
+
+		case serverStageCommandDone:
+			if conn.publishing {
+				if err = conn.probe(); err != nil {
+					return
+				}
+			} else {
+				err = fmt.Errorf("rtsp: call WriteHeader() before WritePacket()")
+				return
+			}
+		}
+	}
+	return
+}
+
+// Prepare reads requests until client starts playing or publishing
+func (conn *Conn) Prepare() (err error) {
+	return conn.prepare(serverStageCommandDone)
+}
+
+// IsPlaying type
+func (conn *Conn) IsPlaying() bool {
+	return conn.playing
+}
+
+// IsPublishing type
+func (conn *Conn) IsPublishing() bool {
+	return conn.publishing
+}
+
+func (conn *Conn) allCodecDataReady() bool {
+	for _, stream := range conn.streams {
+		if stream.CodecData == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (conn *Conn) probe() (err error) {
+	for !conn.allCodecDataReady() {
+		if _, err = conn.readPacket(); err != nil {
+			return
+		}
+	}
+
+	conn.streamsintf = nil
+	for _, stream := range conn.streams {
+		conn.streamsintf = append(conn.streamsintf, stream.CodecData)
+	}
+	conn.stage++
+	return
+}
+
+// Streams type
+func (conn *Conn) Streams() (streams []av.CodecData, err error) {
+	if err = conn.prepare(serverStageCodecDataDone); err != nil {
+		return
+	}
+	streams = conn.streamsintf
+	return
+}
+
+func (conn *Conn) handleBlock(block []byte) (pkt av.Packet, ok bool, err error) {
+	i, found := conn.channels[int(block[1])]
+	if !found {
+		if conn.DebugRtp {
+			fmt.Println("rtsp: rtcp block len", len(block)-4)
+		}
+		return
+	}
+	stream := conn.streams[i]
+
+	if err = stream.handleRtpPacket(block[4:]); err != nil {
+		return
+	}
+
+	if stream.gotpkt {
+		ok = true
+		if pkt, err = stream.takePacket(i); err != nil {
+			return
+		}
+
+		if conn.DebugRtp {
+			fmt.Println("rtp: pktin", pkt.Idx, pkt.Time, len(pkt.Data))
+		}
+	}
+	return
+}
+
+func (conn *Conn) readPacket() (pkt av.Packet, err error) {
+	for {
+		var req Request
+		var block []byte
+		if req, block, err = conn.readRequest(); err != nil {
+			return
+		}
+
+		if block == nil {
+			if err = conn.handleRequest(req); err != nil {
+				return
+			}
+			continue
+		}
+
+		var ok bool
+		if pkt, ok, err = conn.handleBlock(block); err != nil {
+			return
+		}
+		if ok {
+			return
+		}
+	}
+}
+
+// ReadPacket type
+func (conn *Conn) ReadPacket() (pkt av.Packet, err error) {
+	if err = conn.prepare(serverStageCodecDataDone); err != nil {
+		return
+	}
+	return conn.readPacket()
+}
+
+// WriteHeader answers DESCRIBE with sdp of streams and waits for PLAY
+func (conn *Conn) WriteHeader(streams []av.CodecData) (err error) {
+	if err = conn.prepare(serverStageCommandDone); err != nil {
+		return
+	}
+	if !conn.playing || conn.describe == nil {
+		err = fmt.Errorf("rtsp: WriteHeader() called on non playing connection")
+		return
+	}
+
+	conn.packetizers = []*packetizer{}
+	medias := []sdp.Media{}
+	for i, stream := range streams {
+		var p *packetizer
+		if p, err = newPacketizer(i, stream); err != nil {
+			return
+		}
+		conn.packetizers = append(conn.packetizers, p)
+		medias = append(medias, p.media)
+	}
+
+	describe := *conn.describe
+	conn.describe = nil
+	body := sdp.Marshal(sdp.Session{}, medias)
+	if err = conn.writeResponse(describe, 200, []string{
+		"Content-Type: application/sdp",
+		"Content-Base: " + describe.URI + "/",
+	}, []byte(body)); err != nil {
+		return
+	}
+
+	for {
+		var req Request
+		var block []byte
+		if req, block, err = conn.readRequest(); err != nil {
+			return
+		}
+		if block != nil {
+			continue
+		}
+
+		switch req.Method {
+		case "SETUP":
+			controls := []string{}
+			for _, p := range conn.packetizers {
+				controls = append(controls, p.media.Control)
+			}
+			var idx, channel int
+			if idx, channel, err = conn.handleSetup(req, controls); err != nil {
+				return
+			}
+			if idx >= 0 {
+				conn.packetizers[idx].channel = channel
+			}
+
+		case "PLAY":
+			if err = conn.writeResponse(req, 200, []string{"Range: npt=0.000-"}, nil); err != nil {
+				return
+			}
+			conn.stage++
+			// viewers may stay silent for a long time, keep write deadlines only
+			conn.conn.Timeout = 0
+			go conn.serveRequests()
+			return
+
+		default:
+			if err = conn.handleRequest(req); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// serveRequests answers keepalive requests and drains rtcp while playing
+func (conn *Conn) serveRequests() {
+	for {
+		req, block, err := conn.readRequest()
+		if err == nil && block == nil {
+			err = conn.handleRequest(req)
+		}
+		if err != nil {
+			if conn.DebugRtsp {
+				fmt.Println("rtsp: server: play session closed:", err)
+			}
+			conn.Close()
+			return
+		}
+	}
+}
+
+// WritePacket type
+func (conn *Conn) WritePacket(pkt av.Packet) (err error) {
+	if err = conn.prepare(serverStageCodecDataDone); err != nil {
+		return
+	}
+	if int(pkt.Idx) >= len(conn.packetizers) {
+		err = fmt.Errorf("rtsp: packet stream#%d invalid", pkt.Idx)
+		return
+	}
+	p := conn.packetizers[pkt.Idx]
+	if p.channel < 0 {
+		return
+	}
+
+	conn.wlock.Lock()
+	defer conn.wlock.Unlock()
+	conn.setWriteDeadline()
+
+	if err = p.packetize(pkt, func(packet []byte) (err error) {
+		header := []byte{'$', byte(p.channel), byte(len(packet) >> 8), byte(len(packet))}
+		if _, err = conn.bufw.Write(header); err != nil {
+			return
+		}
+		_, err = conn.bufw.Write(packet)
+		return
+	}); err != nil {
+		return
+	}
+	return conn.bufw.Flush()
+}
+
+// WriteTrailer type
+func (conn *Conn) WriteTrailer() (err error) {
+	return
+}
@@ -0,0 +1,313 @@
+package rtsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/aacparser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/h264parser"
+	"github.com/Youngju-Heo/gomedia/core/media/format/rtsp/sdp"
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
+)
+
+func testStreams(t *testing.T) []av.CodecData {
+	sps, _ := base64.StdEncoding.DecodeString("Z00AHpWoKA9k")
+	pps, _ := base64.StdEncoding.DecodeString("aO48gA==")
+	h264, err := h264parser.NewCodecDataFromSPSAndPPS(sps, pps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aac, err := aacparser.NewCodecDataFromMPEG4AudioConfig(aacparser.MPEG4AudioConfig{
+		ObjectType:      aacparser.AotAACLc,
+		SampleRateIndex: 4,
+		ChannelConfig:   2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []av.CodecData{h264, aac}
+}
+
+func testPackets() (pkts []av.Packet) {
+	for i := 0; i < 6; i++ {
+		// video: large idr to exercise FU-A, small non-idr as single nalu
+		size := 200
+		nalu := byte(0x41)
+		if i%3 == 0 {
+			size = 5000
+			nalu = 0x65
+		}
+		data := make([]byte, 4+size)
+		pio.PutU32BE(data, uint32(size))
+		data[4] = nalu
+		for j := 5; j < len(data); j++ {
+			data[j] = byte(i + j)
+		}
+		pkts = append(pkts, av.Packet{
+			Idx:        0,
+			IsKeyFrame: nalu == 0x65,
+			Time:       time.Duration(i) * 40 * time.Millisecond,
+			Data:       data,
+		})
+
+		audio := make([]byte, 300)
+		for j := range audio {
+			audio[j] = byte(i * j)
+		}
+		pkts = append(pkts, av.Packet{
+			Idx:  1,
+			Time: time.Duration(i) * 1024 * time.Second / 44100,
+			Data: audio,
+		})
+	}
+	return
+}
+
+func TestServerPlay(t *testing.T) {
+	testServerPlay(t, TransportTCP)
+}
+
+func testServerPlay(t *testing.T, transport int) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	streams := testStreams(t)
+	pkts := testPackets()
+	done := make(chan struct{})
+
+	server := &Server{
+		HandlePlay: func(conn *Conn) {
+			if conn.URL.Path != "/live" {
+				t.Errorf("play path=%s", conn.URL.Path)
+			}
+			if err := conn.WriteHeader(streams); err != nil {
+				t.Error(err)
+				return
+			}
+			for _, pkt := range pkts {
+				if err := conn.WritePacket(pkt); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+			<-done
+		},
+	}
+	go server.Serve(listener)
+
+	client, err := DialTimeout("rtsp://"+listener.Addr().String()+"/live", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer close(done)
+	client.RtspTimeout = time.Second * 5
+	client.Transport = transport
+
+	got, err := client.Streams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Type() != av.H264 || got[1].Type() != av.AAC {
+		t.Fatalf("streams=%v", got)
+	}
+	if video := got[0].(av.VideoCodecData); video.Width() != streams[0].(av.VideoCodecData).Width() {
+		t.Errorf("width=%d", video.Width())
+	}
+	if audio := got[1].(av.AudioCodecData); audio.SampleRate() != 44100 || audio.ChannelLayout().Count() != 2 {
+		t.Errorf("audio=%d %v", audio.SampleRate(), audio.ChannelLayout())
+	}
+
+	for _, want := range pkts {
+		pkt, err := client.ReadPacket()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pkt.Idx != want.Idx || !bytes.Equal(pkt.Data, want.Data) {
+			t.Fatalf("pkt idx=%d len=%d, want idx=%d len=%d", pkt.Idx, len(pkt.Data), want.Idx, len(want.Data))
+		}
+		if diff := pkt.Time - want.Time; diff < -time.Millisecond || diff > time.Millisecond {
+			t.Errorf("pkt#%d time=%v want %v", pkt.Idx, pkt.Time, want.Time)
+		}
+		if pkt.IsKeyFrame != want.IsKeyFrame {
+			t.Errorf("pkt#%d keyframe=%v", pkt.Idx, pkt.IsKeyFrame)
+		}
+	}
+	if client.Transport != TransportTCP {
+		t.Errorf("transport=%d, want tcp", client.Transport)
+	}
+}
+
+// testPublishRequest sends request of publishing client and checks response is 200
+func testPublishRequest(t *testing.T, netconn net.Conn, r *textproto.Reader, cseq int, method, uri string, headers []string, body string) {
+	req := fmt.Sprintf("%s %s RTSP/1.0\r\nCSeq: %d\r\n", method, uri, cseq)
+	for _, header := range headers {
+		req += header + "\r\n"
+	}
+	if body != "" {
+		req += "Content-Length: " + strconv.Itoa(len(body)) + "\r\n"
+	}
+	req += "\r\n" + body
+	if _, err := netconn.Write([]byte(req)); err != nil {
+		t.Fatal(err)
+	}
+	line, err := r.ReadLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.ReadMIMEHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(line, "RTSP/1.0 200") {
+		t.Fatalf("%s: response %q", method, line)
+	}
+}
+
+func TestServerPublish(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	streams := testStreams(t)
+	pkts := testPackets()
+	done := make(chan []av.Packet, 1)
+
+	server := &Server{
+		HandlePublish: func(conn *Conn) {
+			var got []av.Packet
+			defer func() { done <- got }()
+			if conn.URL.Path != "/live" {
+				t.Errorf("publish path=%s", conn.URL.Path)
+			}
+			codecs, err := conn.Streams()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if len(codecs) != 2 || codecs[0].Type() != av.H264 || codecs[1].Type() != av.AAC {
+				t.Errorf("streams=%v", codecs)
+				return
+			}
+			for range pkts {
+				pkt, err := conn.ReadPacket()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				got = append(got, pkt)
+			}
+		},
+	}
+	go server.Serve(listener)
+
+	netconn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer netconn.Close()
+	netconn.SetDeadline(time.Now().Add(time.Second * 5))
+	r := textproto.NewReader(bufio.NewReader(netconn))
+	uri := "rtsp://" + listener.Addr().String() + "/live"
+
+	var ps []*packetizer
+	var medias []sdp.Media
+	for i, stream := range streams {
+		p, err := newPacketizer(i, stream)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ps = append(ps, p)
+		medias = append(medias, p.media)
+	}
+	testPublishRequest(t, netconn, r, 1, "ANNOUNCE", uri, []string{"Content-Type: application/sdp"}, sdp.Marshal(sdp.Session{}, medias))
+	for i, p := range ps {
+		transport := fmt.Sprintf("Transport: RTP/AVP/TCP;unicast;interleaved=%d-%d", i*2, i*2+1)
+		testPublishRequest(t, netconn, r, 2+i, "SETUP", uri+"/"+p.media.Control, []string{transport}, "")
+	}
+	testPublishRequest(t, netconn, r, 4, "RECORD", uri, nil, "")
+
+	for _, pkt := range pkts {
+		channel := int(pkt.Idx) * 2
+		ps[pkt.Idx].packetize(pkt, func(packet []byte) error {
+			block := append([]byte{'$', byte(channel), byte(len(packet) >> 8), byte(len(packet))}, packet...)
+			_, err := netconn.Write(block)
+			return err
+		})
+	}
+
+	var got []av.Packet
+	select {
+	case got = <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("publish handler did not return")
+	}
+	if len(got) != len(pkts) {
+		t.Fatalf("got %d packets, want %d", len(got), len(pkts))
+	}
+	for i, want := range pkts {
+		pkt := got[i]
+		if pkt.Idx != want.Idx || !bytes.Equal(pkt.Data, want.Data) {
+			t.Fatalf("pkt idx=%d len=%d, want idx=%d len=%d", pkt.Idx, len(pkt.Data), want.Idx, len(want.Data))
+		}
+		if diff := pkt.Time - want.Time; diff < -time.Millisecond || diff > time.Millisecond {
+			t.Errorf("pkt#%d time=%v want %v", pkt.Idx, pkt.Time, want.Time)
+		}
+		if pkt.IsKeyFrame != want.IsKeyFrame {
+			t.Errorf("pkt#%d keyframe=%v", pkt.Idx, pkt.IsKeyFrame)
+		}
+	}
+}
+
+func TestServerAnnounce(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go (&Server{}).Serve(listener)
+
+	for _, test := range []struct {
+		media  string
+		status string
+	}{
+		// parameter sets may come in-band
+		{"m=video 0 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\n", "RTSP/1.0 200"},
+		{"m=video 0 RTP/AVP 96\r\na=rtpmap:96 VP8/90000\r\n", "RTSP/1.0 415"},
+		{"m=audio 0 RTP/AVP 14\r\n", "RTSP/1.0 415"},
+		{"m=audio 0 RTP/AVP 97\r\na=rtpmap:97 MPEG4-GENERIC/44100/2\r\n", "RTSP/1.0 400"},
+	} {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(time.Second * 5))
+		body := "v=0\r\n" + test.media
+		req := "ANNOUNCE rtsp://" + listener.Addr().String() + "/live RTSP/1.0\r\nCSeq: 1\r\n" +
+			"Content-Type: application/sdp\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body
+		if _, err = conn.Write([]byte(req)); err != nil {
+			t.Fatal(err)
+		}
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(line, test.status) {
+			t.Errorf("%q: response %q, want %s", test.media, line, test.status)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package rtsp
 
 import (
+	"net"
 	"time"
 
 	"github.com/Youngju-Heo/gomedia/core/media/av"
@@ -13,13 +14,16 @@ type Stream struct {
 	Sdp    sdp.Media
 	client *Client
 
-	// h264
+	// h264, h265
 	fuStarted  bool
 	fuBuffer   []byte
+	vps        []byte
 	sps        []byte
 	pps        []byte
+	vpsChanged bool
 	spsChanged bool
 	ppsChanged bool
+	inParamSet bool // h265 parameter sets are arriving, change is taken after them
 
 	gotpkt         bool
 	pkt            av.Packet
@@ -27,4 +31,15 @@ type Stream struct {
 	firsttimestamp uint32
 
 	lasttime time.Duration
+
+	// udp transport
+	rtpConn    *net.UDPConn
+	rtcpConn   *net.UDPConn
+	serverRtcp *net.UDPAddr
+	stats      rtpStats
+
+	// loss recovery
+	jitter          jitterBuffer
+	waitKeyFrame    bool
+	brokenTimestamp uint32
 }
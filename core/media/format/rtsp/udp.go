@@ -0,0 +1,181 @@
+package rtsp
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// TransportTCP rtp interleaved in rtsp connection
+	TransportTCP = iota
+	// TransportUDP rtp over unicast udp
+	TransportUDP
+)
+
+// listenUDPPair allocates even rtp port and following rtcp port
+func listenUDPPair() (rtp *net.UDPConn, rtcp *net.UDPConn, err error) {
+	for i := 0; i < 16; i++ {
+		if rtp, err = net.ListenUDP("udp", &net.UDPAddr{}); err != nil {
+			return
+		}
+		port := rtp.LocalAddr().(*net.UDPAddr).Port
+		if port%2 == 0 {
+			if rtcp, err = net.ListenUDP("udp", &net.UDPAddr{Port: port + 1}); err == nil {
+				return
+			}
+		}
+		rtp.Close()
+	}
+	err = fmt.Errorf("rtsp: allocate udp port pair failed")
+	return
+}
+
+func (client *Stream) listenUDP() (transport string, err error) {
+	client.closeUDP()
+	if client.rtpConn, client.rtcpConn, err = listenUDPPair(); err != nil {
+		return
+	}
+	port := client.rtpConn.LocalAddr().(*net.UDPAddr).Port
+	transport = fmt.Sprintf("Transport: RTP/AVP;unicast;client_port=%d-%d", port, port+1)
+	return
+}
+
+func (client *Stream) closeUDP() {
+	if client.rtpConn != nil {
+		client.rtpConn.Close()
+		client.rtpConn = nil
+	}
+	if client.rtcpConn != nil {
+		client.rtcpConn.Close()
+		client.rtcpConn = nil
+	}
+	client.serverRtcp = nil
+}
+
+// setupUDP finds server rtcp address from SETUP response Transport header
+func (client *Stream) setupUDP(host string, transport string) (err error) {
+	for _, field := range strings.Split(transport, ";") {
+		keyval := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(keyval) != 2 {
+			continue
+		}
+		switch keyval[0] {
+		case "source":
+			host = keyval[1]
+		case "server_port":
+			ports := strings.SplitN(keyval[1], "-", 2)
+			if len(ports) == 2 {
+				port, _ := strconv.Atoi(ports[1])
+				client.serverRtcp = &net.UDPAddr{Port: port}
+			}
+		}
+	}
+	if client.serverRtcp == nil {
+		err = fmt.Errorf("rtsp: server_port missing in transport %q", transport)
+		return
+	}
+	if client.serverRtcp.IP = net.ParseIP(host); client.serverRtcp.IP == nil {
+		var addr *net.IPAddr
+		if addr, err = net.ResolveIPAddr("ip", host); err != nil {
+			return
+		}
+		client.serverRtcp.IP = addr.IP
+	}
+	return
+}
+
+func (client *Client) closeUDP() {
+	for _, stream := range client.streams {
+		stream.closeUDP()
+	}
+}
+
+func (client *Client) startUDP() {
+	client.udpch = make(chan []byte, 256)
+	client.udpdone = make(chan struct{})
+	for _, si := range client.setupIdx {
+		stream := client.streams[si]
+		go client.readUDP(stream.rtpConn, si*2)
+		go client.readUDP(stream.rtcpConn, si*2+1)
+	}
+}
+
+// readUDP turns udp datagrams into interleaved blocks, so handleBlock works for both transports
+func (client *Client) readUDP(conn *net.UDPConn, channel int) {
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		// block outlives the read in handleBlock and jitter buffer, so only datagram is copied out
+		b := make([]byte, 4+n)
+		b[0] = '$'
+		b[1] = byte(channel)
+		b[2] = byte(n >> 8)
+		b[3] = byte(n)
+		copy(b[4:], buf[:n])
+		select {
+		case client.udpch <- b:
+		case <-client.udpdone:
+			return
+		}
+	}
+}
+
+func (client *Client) pollUDP() (block []byte, err error) {
+	var timeout <-chan time.Time
+	if client.RtpTimeout > 0 {
+		timer := time.NewTimer(client.RtpTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		if err = client.sendReceiverReports(); err != nil {
+			return
+		}
+		select {
+		case block = <-client.udpch:
+		case <-timeout:
+			err = fmt.Errorf("rtsp: rtp timeout")
+			return
+		}
+		if len(block) < 4+12 {
+			continue
+		}
+		if int(block[1])%2 != 0 {
+			return
+		}
+		// udp packets may be reordered, so timestamps are not checked here as parseBlockHeader does
+		stream := client.streams[int(block[1])/2]
+		if block[4]&0xc0 == 0x80 && int(block[5]&0x7f) == stream.Sdp.PayloadType {
+			return
+		}
+	}
+}
+
+func (client *Client) sendReceiverReports() (err error) {
+	if !client.rtcpTimer.IsZero() && time.Now().Sub(client.rtcpTimer) < RtcpReportInterval {
+		return
+	}
+	client.rtcpTimer = time.Now()
+
+	for _, si := range client.setupIdx {
+		stream := client.streams[si]
+		if stream.rtcpConn == nil || stream.serverRtcp == nil {
+			continue
+		}
+		if client.DebugRtp {
+			fmt.Println("rtcp: receiver report", si)
+		}
+		rr := makeReceiverReport(client.ssrc, "gomedia", &stream.stats)
+		if _, err = stream.rtcpConn.WriteToUDP(rr, stream.serverRtcp); err != nil {
+			return
+		}
+	}
+	return
+}
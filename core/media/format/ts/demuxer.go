@@ -2,27 +2,40 @@ package ts
 
 import (
 	"bufio"
-	"fmt"
+	"bytes"
 	"io"
+	"sync/atomic"
 	"time"
 
 	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/codec"
 	"github.com/Youngju-Heo/gomedia/core/media/codec/aacparser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/ac3parser"
 	"github.com/Youngju-Heo/gomedia/core/media/codec/h264parser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/h265parser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/mp3parser"
 	"github.com/Youngju-Heo/gomedia/core/media/format/ts/tsio"
 	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
 )
 
 // Demuxer type
 type Demuxer struct {
-	r *bufio.Reader
+	// first field for 64-bit alignment of atomic counters
+	stats Stats
+
+	r       *bufio.Reader
+	pktsize int
 
 	pkts []av.Packet
 
-	pat     *tsio.PAT
-	pmt     *tsio.PMT
-	streams []*Stream
-	tshdr   []byte
+	pat      *tsio.PAT
+	programs []*Program
+	selected []uint16
+	psi      map[uint16][]byte
+	streams  []*Stream
+
+	continuity map[uint16]continuity
+	tshdr      []byte
 
 	stage int
 }
@@ -30,8 +43,10 @@ type Demuxer struct {
 // NewDemuxer func
 func NewDemuxer(r io.Reader) *Demuxer {
 	return &Demuxer{
-		tshdr: make([]byte, 188),
-		r:     bufio.NewReaderSize(r, pio.RecommendBufioSize),
+		tshdr:      make([]byte, tsio.TSPacketSize),
+		psi:        map[uint16][]byte{},
+		continuity: map[uint16]continuity{},
+		r:          bufio.NewReaderSize(r, pio.RecommendBufioSize),
 	}
 }
 
@@ -48,18 +63,21 @@ func (demuxer *Demuxer) Streams() (streams []av.CodecData, err error) {
 
 func (demuxer *Demuxer) probe() (err error) {
 	if demuxer.stage == 0 {
-		for {
-			if demuxer.pmt != nil {
-				n := 0
-				for _, stream := range demuxer.streams {
-					if stream.CodecData != nil {
-						n++
-					}
-				}
-				if n == len(demuxer.streams) {
-					break
-				}
+		var programs []*Program
+		if programs, err = demuxer.selectedPrograms(); err != nil {
+			return
+		}
+
+		demuxer.streams = []*Stream{}
+		for _, program := range programs {
+			program.selected = true
+			for _, stream := range program.streams {
+				stream.idx = len(demuxer.streams)
+				demuxer.streams = append(demuxer.streams, stream)
 			}
+		}
+
+		for !probed(demuxer.streams) {
 			if err = demuxer.poll(); err != nil {
 				return
 			}
@@ -69,6 +87,15 @@ func (demuxer *Demuxer) probe() (err error) {
 	return
 }
 
+func probed(streams []*Stream) bool {
+	for _, stream := range streams {
+		if stream.CodecData == nil {
+			return false
+		}
+	}
+	return true
+}
+
 // ReadPacket func
 func (demuxer *Demuxer) ReadPacket() (pkt av.Packet, err error) {
 	if err = demuxer.probe(); err != nil {
@@ -99,41 +126,157 @@ func (demuxer *Demuxer) poll() (err error) {
 	return
 }
 
-func (demuxer *Demuxer) initPMT(payload []byte) (err error) {
+// handlePSI collects section of PAT or PMT which may span several TS packets
+func (demuxer *Demuxer) handlePSI(pid uint16, start bool, payload []byte) (err error) {
+	if start {
+		demuxer.psi[pid] = append(demuxer.psi[pid][:0], payload...)
+	} else if demuxer.psi[pid] != nil {
+		demuxer.psi[pid] = append(demuxer.psi[pid], payload...)
+	} else {
+		return
+	}
+
+	data := demuxer.psi[pid]
+	n := tsio.PSILength(data)
+	if n == 0 || n > len(data) {
+		return
+	}
+	delete(demuxer.psi, pid)
+
+	var tableid uint8
+	var tableext uint16
 	var psihdrlen int
 	var datalen int
-	if _, _, psihdrlen, datalen, err = tsio.ParsePSI(payload); err != nil {
+	if tableid, tableext, psihdrlen, datalen, err = tsio.ParsePSI(data[:n]); err != nil {
 		return
 	}
-	demuxer.pmt = &tsio.PMT{}
-	if _, err = demuxer.pmt.Unmarshal(payload[psihdrlen : psihdrlen+datalen]); err != nil {
+	data = data[psihdrlen : psihdrlen+datalen]
+
+	switch tableid {
+	case tsio.TableIDPAT:
+		if pid == tsio.PatPID {
+			err = demuxer.initPAT(data)
+		}
+	case tsio.TableIDPMT:
+		// table id extension of PMT is program number
+		err = demuxer.initPMT(pid, tableext, data)
+	}
+	return
+}
+
+func (demuxer *Demuxer) initPAT(data []byte) (err error) {
+	pat := &tsio.PAT{}
+	if _, err = pat.Unmarshal(data); err != nil {
 		return
 	}
+	demuxer.pat = pat
+	for _, entry := range pat.Entries {
+		// program 0 is network information
+		if entry.ProgramNumber != 0 {
+			demuxer.programs = append(demuxer.programs, &Program{
+				Number: entry.ProgramNumber,
+				PID:    entry.ProgramMapPID,
+			})
+		}
+	}
+	return
+}
 
-	demuxer.streams = []*Stream{}
-	for i, info := range demuxer.pmt.ElementaryStreamInfos {
+func (demuxer *Demuxer) initPMT(pid uint16, number uint16, data []byte) (err error) {
+	var program *Program
+	for _, p := range demuxer.programs {
+		if p.PID == pid && p.Number == number && p.PMT == nil {
+			program = p
+			break
+		}
+	}
+	if program == nil {
+		return
+	}
+
+	pmt := &tsio.PMT{}
+	if _, err = pmt.Unmarshal(data); err != nil {
+		return
+	}
+	program.PMT = pmt
+
+	program.streams = []*Stream{}
+	for _, info := range pmt.ElementaryStreamInfos {
 		stream := &Stream{}
-		stream.idx = i
+		stream.idx = -1
 		stream.demuxer = demuxer
+		stream.program = program
 		stream.pid = info.ElementaryPID
 		stream.streamType = info.StreamType
 		switch info.StreamType {
 		case tsio.ElementaryStreamTypeH264:
-			demuxer.streams = append(demuxer.streams, stream)
+			program.streams = append(program.streams, stream)
+		case tsio.ElementaryStreamTypeHEVC:
+			program.streams = append(program.streams, stream)
 		case tsio.ElementaryStreamTypeAdtsAAC:
-			demuxer.streams = append(demuxer.streams, stream)
+			program.streams = append(program.streams, stream)
+		case tsio.ElementaryStreamTypeMPEG1Audio, tsio.ElementaryStreamTypeMPEG2Audio:
+			program.streams = append(program.streams, stream)
+		case tsio.ElementaryStreamTypeAC3:
+			program.streams = append(program.streams, stream)
+		case tsio.ElementaryStreamTypePrivateData, tsio.ElementaryStreamTypeMetadata:
+			if isAC3Stream(info) {
+				stream.streamType = tsio.ElementaryStreamTypeAC3
+			} else if isKLVStream(info) {
+				stream.CodecData = codec.NewKLVCodecData()
+			} else {
+				stream.CodecData = codec.NewDataCodecData()
+			}
+			program.streams = append(program.streams, stream)
 		}
 	}
 	return
 }
 
+// isAC3Stream checks DVB AC-3 descriptor or "AC-3" registration
+func isAC3Stream(info tsio.ElementaryStreamInfo) bool {
+	for _, desc := range info.Descriptors {
+		switch desc.Tag {
+		case tsio.DescriptorTagAC3:
+			return true
+		case tsio.DescriptorTagRegistration:
+			if bytes.HasPrefix(desc.Data, tsio.FormatIdentifierAC3) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isKLVStream checks "KLVA" in registration or metadata descriptor
+func isKLVStream(info tsio.ElementaryStreamInfo) bool {
+	for _, desc := range info.Descriptors {
+		switch desc.Tag {
+		case tsio.DescriptorTagRegistration:
+			if bytes.HasPrefix(desc.Data, tsio.FormatIdentifierKLV) {
+				return true
+			}
+		case tsio.DescriptorTagMetadata:
+			if bytes.Contains(desc.Data, tsio.FormatIdentifierKLV) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (demuxer *Demuxer) payloadEnd() (n int, err error) {
-	for _, stream := range demuxer.streams {
-		var i int
-		if i, err = stream.payloadEnd(); err != nil {
-			return
+	for _, program := range demuxer.programs {
+		if !program.active() {
+			continue
+		}
+		for _, stream := range program.streams {
+			var i int
+			if i, err = stream.payloadEnd(); err != nil {
+				return
+			}
+			n += i
 		}
-		n += i
 	}
 	return
 }
@@ -144,43 +287,62 @@ func (demuxer *Demuxer) readTSPacket() (err error) {
 	var start bool
 	var iskeyframe bool
 
+	if err = demuxer.syncTSPacket(); err != nil {
+		return
+	}
 	if _, err = io.ReadFull(demuxer.r, demuxer.tshdr); err != nil {
 		return
 	}
+	// timecode of next M2TS packet or FEC bytes
+	if extra := demuxer.pktsize - tsio.TSPacketSize; extra > 0 {
+		demuxer.r.Discard(extra)
+	}
+	atomic.AddUint64(&demuxer.stats.Packets, 1)
 
 	if pid, start, iskeyframe, hdrlen, err = tsio.ParseTSHeader(demuxer.tshdr); err != nil {
+		atomic.AddUint64(&demuxer.stats.TransportErrors, 1)
+		demuxer.discardPID(pid)
+		err = nil
+		return
+	}
+	if !demuxer.checkContinuity(pid) {
 		return
 	}
 	payload := demuxer.tshdr[hdrlen:]
 
+	if pid == tsio.PatPID {
+		if demuxer.pat == nil {
+			err = demuxer.handlePSI(pid, start, payload)
+		}
+		return
+	}
 	if demuxer.pat == nil {
-		if pid == 0 {
-			var psihdrlen int
-			var datalen int
-			if _, _, psihdrlen, datalen, err = tsio.ParsePSI(payload); err != nil {
-				return
-			}
-			demuxer.pat = &tsio.PAT{}
-			if _, err = demuxer.pat.Unmarshal(payload[psihdrlen : psihdrlen+datalen]); err != nil {
+		return
+	}
+
+	// several programs may share PMT PID
+	pmtPID := false
+	for _, program := range demuxer.programs {
+		if program.PID == pid {
+			pmtPID = true
+			if program.PMT == nil {
+				err = demuxer.handlePSI(pid, start, payload)
 				return
 			}
 		}
-	} else if demuxer.pmt == nil {
-		for _, entry := range demuxer.pat.Entries {
-			if entry.ProgramMapPID == pid {
-				if err = demuxer.initPMT(payload); err != nil {
-					return
-				}
-				break
-			}
+	}
+	if pmtPID {
+		return
+	}
+
+	for _, program := range demuxer.programs {
+		if !program.active() {
+			continue
 		}
-	} else {
-		for _, stream := range demuxer.streams {
+		for _, stream := range program.streams {
 			if pid == stream.pid {
-				if err = stream.handleTSPacket(start, iskeyframe, payload); err != nil {
-					return
-				}
-				break
+				err = stream.handleTSPacket(start, iskeyframe, payload)
+				return
 			}
 		}
 	}
@@ -189,6 +351,11 @@ func (demuxer *Demuxer) readTSPacket() (err error) {
 }
 
 func (stream *Stream) addPacket(payload []byte, timedelta time.Duration) {
+	// stream of program not selected is only parsed for codec data
+	if stream.idx < 0 {
+		return
+	}
+
 	dts := stream.dts
 	pts := stream.pts
 	if dts == 0 {
@@ -213,11 +380,12 @@ func (stream *Stream) payloadEnd() (n int, err error) {
 	if payload == nil {
 		return
 	}
+	stream.data = nil
 	if stream.datalen != 0 && len(payload) != stream.datalen {
-		err = fmt.Errorf("ts: packet size mismatch size=%d correct=%d", len(payload), stream.datalen)
+		// lost or extra TS packet not found by continuity counter
+		atomic.AddUint64(&stream.demuxer.stats.DiscardedPES, 1)
 		return
 	}
-	stream.data = nil
 
 	switch stream.streamType {
 	case tsio.ElementaryStreamTypeAdtsAAC:
@@ -267,6 +435,81 @@ func (stream *Stream) payloadEnd() (n int, err error) {
 				return
 			}
 		}
+
+	case tsio.ElementaryStreamTypeHEVC:
+		nalus, _ := h264parser.SplitNALUs(payload)
+		var vps, sps, pps []byte
+		for _, nalu := range nalus {
+			if len(nalu) > 0 {
+				naltype := h265parser.NALUType(nalu)
+				switch {
+				case naltype == h265parser.NaluVps:
+					vps = nalu
+				case naltype == h265parser.NaluSps:
+					sps = nalu
+				case naltype == h265parser.NaluPps:
+					pps = nalu
+				case h265parser.IsDataNALU(nalu):
+					// raw nalu to hvcc
+					b := make([]byte, 4+len(nalu))
+					pio.PutU32BE(b[0:4], uint32(len(nalu)))
+					copy(b[4:], nalu)
+					stream.addPacket(b, time.Duration(0))
+					n++
+				}
+			}
+		}
+
+		if stream.CodecData == nil && len(vps) > 0 && len(sps) > 0 && len(pps) > 0 {
+			if stream.CodecData, err = h265parser.NewCodecDataFromVPSAndSPSAndPPS(vps, sps, pps); err != nil {
+				return
+			}
+		}
+
+	case tsio.ElementaryStreamTypeMPEG1Audio, tsio.ElementaryStreamTypeMPEG2Audio:
+		delta := time.Duration(0)
+		for len(payload) > 0 {
+			var hdr mp3parser.FrameHeader
+			if hdr, err = mp3parser.ParseFrameHeader(payload); err != nil {
+				return
+			}
+			if stream.CodecData == nil {
+				stream.CodecData = mp3parser.NewCodecDataFromFrameHeader(hdr)
+			}
+			framelen := hdr.FrameLength
+			// free format frame takes rest of payload
+			if framelen == 0 || framelen > len(payload) {
+				framelen = len(payload)
+			}
+			stream.addPacket(payload[:framelen], delta)
+			n++
+			delta += time.Duration(hdr.Samples) * time.Second / time.Duration(hdr.SampleRate)
+			payload = payload[framelen:]
+		}
+
+	case tsio.ElementaryStreamTypeAC3:
+		delta := time.Duration(0)
+		for len(payload) > 0 {
+			var hdr ac3parser.FrameHeader
+			if hdr, err = ac3parser.ParseFrameHeader(payload); err != nil {
+				return
+			}
+			if stream.CodecData == nil {
+				stream.CodecData = ac3parser.NewCodecDataFromFrameHeader(hdr)
+			}
+			framelen := hdr.FrameLength
+			if framelen > len(payload) {
+				framelen = len(payload)
+			}
+			stream.addPacket(payload[:framelen], delta)
+			n++
+			delta += time.Duration(ac3parser.SamplesPerFrame) * time.Second / time.Duration(hdr.SampleRate)
+			payload = payload[framelen:]
+		}
+
+	case tsio.ElementaryStreamTypePrivateData, tsio.ElementaryStreamTypeMetadata:
+		stream.addPacket(payload, time.Duration(0))
+		n++
 	}
 
 	return
@@ -278,7 +521,15 @@ func (stream *Stream) handleTSPacket(start bool, iskeyframe bool, payload []byte
 			return
 		}
 		var hdrlen int
-		if hdrlen, _, stream.datalen, stream.pts, stream.dts, err = tsio.ParsePESHeader(payload); err != nil {
+		if len(payload) < 9 {
+			err = tsio.ErrPESHeader
+		} else {
+			hdrlen, _, stream.datalen, stream.pts, stream.dts, err = tsio.ParsePESHeader(payload)
+		}
+		if err != nil || hdrlen > len(payload) || stream.datalen < 0 {
+			// wait for next PES
+			atomic.AddUint64(&stream.demuxer.stats.DiscardedPES, 1)
+			err = nil
 			return
 		}
 		stream.iskeyframe = iskeyframe
@@ -288,7 +539,8 @@ func (stream *Stream) handleTSPacket(start bool, iskeyframe bool, payload []byte
 			stream.data = make([]byte, 0, stream.datalen)
 		}
 		stream.data = append(stream.data, payload[hdrlen:]...)
-	} else {
+	} else if stream.data != nil {
+		// continuation of discarded PES is dropped
 		stream.data = append(stream.data, payload...)
 	}
 	return
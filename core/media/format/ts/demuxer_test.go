@@ -0,0 +1,168 @@
+package ts
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/codec"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/ac3parser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/h265parser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/mp3parser"
+	"github.com/Youngju-Heo/gomedia/core/media/format/ts/tsio"
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
+)
+
+func testHEVCStream(t *testing.T) (codecData av.CodecData, pkts []av.Packet) {
+	vps, _ := hex.DecodeString("40010c01ffff016000000300900000030000030078999809")
+	sps, _ := hex.DecodeString("420101016000000300900000030000030078a003c08010e58dae4932b4dc0404040200000300020000030032")
+	pps, _ := hex.DecodeString("4401c172b46240")
+	codecData, err := h265parser.NewCodecDataFromVPSAndSPSAndPPS(vps, sps, pps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		size := 300 + i
+		data := make([]byte, 4+size)
+		pio.PutU32BE(data, uint32(size))
+		// nonzero payload never forms start code
+		for j := 6; j < len(data); j++ {
+			data[j] = byte(i+j) | 0x80
+		}
+		pkt := av.Packet{
+			IsKeyFrame: i%5 == 0,
+			Time:       time.Duration(i) * 40 * time.Millisecond,
+			Data:       data,
+		}
+		if pkt.IsKeyFrame {
+			data[4], data[5] = h265parser.NaluIdrWRadl<<1, 1
+		} else {
+			data[4], data[5] = 1<<1, 1
+			pkt.CompositionTime = 80 * time.Millisecond
+		}
+		pkts = append(pkts, pkt)
+	}
+	return
+}
+
+// testAudioFrames makes n frames starting with hdr, duration is duration of one frame
+func testAudioFrames(hdr []byte, size, n int, duration time.Duration) (pkts []av.Packet) {
+	for i := 0; i < n; i++ {
+		data := make([]byte, size)
+		for j := range data {
+			data[j] = byte(i * j)
+		}
+		copy(data, hdr)
+		pkts = append(pkts, av.Packet{Time: time.Duration(i) * duration, Data: data})
+	}
+	return
+}
+
+func testMP3Stream(t *testing.T, hdr []byte) (codecData av.CodecData, pkts []av.Packet) {
+	h, err := mp3parser.ParseFrameHeader(hdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codecData = mp3parser.NewCodecDataFromFrameHeader(h)
+	pkts = testAudioFrames(hdr, h.FrameLength, 10, time.Duration(h.Samples)*time.Second/time.Duration(h.SampleRate))
+	return
+}
+
+func testAC3Stream(t *testing.T) (codecData av.CodecData, pkts []av.Packet) {
+	hdr := []byte{0x0b, 0x77, 0x00, 0x00, 0x1c, 0x40, 0xe1, 0x00}
+	h, err := ac3parser.ParseFrameHeader(hdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codecData = ac3parser.NewCodecDataFromFrameHeader(h)
+	pkts = testAudioFrames(hdr, h.FrameLength, 10, ac3parser.SamplesPerFrame*time.Second/time.Duration(h.SampleRate))
+	return
+}
+
+func testKLVStream() (codecData av.CodecData, pkts []av.Packet) {
+	codecData = codec.NewKLVCodecData()
+	for i := 0; i < 5; i++ {
+		data := append([]byte{0x06, 0x0e, 0x2b, 0x34, 0x02, 0x0b, 0x01, 0x01}, bytes.Repeat([]byte{byte(i)}, 20+i)...)
+		pkts = append(pkts, av.Packet{Time: time.Duration(i) * time.Second, Data: data})
+	}
+	return
+}
+
+func TestMuxerDemuxer(t *testing.T) {
+	type testStream func() (av.CodecData, []av.Packet)
+	for _, test := range []struct {
+		name       string
+		stream     testStream
+		streamType uint8
+	}{
+		{"hevc", func() (av.CodecData, []av.Packet) { return testHEVCStream(t) }, tsio.ElementaryStreamTypeHEVC},
+		{"mpeg1 audio", func() (av.CodecData, []av.Packet) {
+			return testMP3Stream(t, []byte{0xff, 0xfb, 0x90, 0x64})
+		}, tsio.ElementaryStreamTypeMPEG1Audio},
+		{"mpeg2 audio", func() (av.CodecData, []av.Packet) {
+			return testMP3Stream(t, []byte{0xff, 0xf3, 0x84, 0xc4})
+		}, tsio.ElementaryStreamTypeMPEG2Audio},
+		{"ac3", func() (av.CodecData, []av.Packet) { return testAC3Stream(t) }, tsio.ElementaryStreamTypeAC3},
+		{"klv", testKLVStream, tsio.ElementaryStreamTypePrivateData},
+	} {
+		codecData, pkts := test.stream()
+
+		buf := &bytes.Buffer{}
+		muxer := NewMuxer(buf)
+		if err := muxer.WriteHeader([]av.CodecData{codecData}); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		for _, pkt := range pkts {
+			if err := muxer.WritePacket(pkt); err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+		}
+		if err := muxer.WriteTrailer(); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		demuxer := NewDemuxer(buf)
+		streams, err := demuxer.Streams()
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if len(streams) != 1 || streams[0].Type() != codecData.Type() {
+			t.Fatalf("%s: streams=%v", test.name, streams)
+		}
+		if typ := demuxer.streams[0].streamType; typ != test.streamType {
+			t.Errorf("%s: stream type=0x%x, want 0x%x", test.name, typ, test.streamType)
+		}
+		if acodec, ok := codecData.(av.AudioCodecData); ok {
+			got := streams[0].(av.AudioCodecData)
+			if got.SampleRate() != acodec.SampleRate() || got.ChannelLayout() != acodec.ChannelLayout() {
+				t.Errorf("%s: audio=%d %v", test.name, got.SampleRate(), got.ChannelLayout())
+			}
+		}
+
+		for i, want := range pkts {
+			pkt, err := demuxer.ReadPacket()
+			if err != nil {
+				t.Fatalf("%s: packet#%d: %v", test.name, i, err)
+			}
+			if !bytes.Equal(pkt.Data, want.Data) {
+				t.Fatalf("%s: packet#%d len=%d, want %d", test.name, i, len(pkt.Data), len(want.Data))
+			}
+			// muxer starts timestamps at one second, 90khz clock
+			if diff := pkt.Time - time.Second - want.Time; diff < -20*time.Microsecond || diff > 20*time.Microsecond {
+				t.Errorf("%s: packet#%d time=%v, want %v", test.name, i, pkt.Time-time.Second, want.Time)
+			}
+			if diff := pkt.CompositionTime - want.CompositionTime; diff < -20*time.Microsecond || diff > 20*time.Microsecond {
+				t.Errorf("%s: packet#%d composition time=%v, want %v", test.name, i, pkt.CompositionTime, want.CompositionTime)
+			}
+			if codecData.Type().IsVideo() && pkt.IsKeyFrame != want.IsKeyFrame {
+				t.Errorf("%s: packet#%d keyframe=%v", test.name, i, pkt.IsKeyFrame)
+			}
+		}
+		if _, err = demuxer.ReadPacket(); err != io.EOF {
+			t.Errorf("%s: read after last packet err=%v", test.name, err)
+		}
+	}
+}
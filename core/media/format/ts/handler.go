@@ -23,5 +23,23 @@ func Handler(h *avutil.RegisterHandler) {
 		return NewMuxer(w)
 	}
 
+	h.URLDemuxer = func(uri string) (ok bool, demuxer av.DemuxCloser, err error) {
+		if !IsUDPURL(uri) {
+			return
+		}
+		ok = true
+		demuxer, err = NewUDPDemuxer(uri)
+		return
+	}
+
+	h.URLMuxer = func(uri string) (ok bool, muxer av.MuxCloser, err error) {
+		if !IsUDPURL(uri) {
+			return
+		}
+		ok = true
+		muxer, err = NewUDPMuxer(uri)
+		return
+	}
+
 	h.CodecTypes = CodecTypes
 }
@@ -8,11 +8,13 @@ import (
 	"github.com/Youngju-Heo/gomedia/core/media/av"
 	"github.com/Youngju-Heo/gomedia/core/media/codec/aacparser"
 	"github.com/Youngju-Heo/gomedia/core/media/codec/h264parser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/h265parser"
+	"github.com/Youngju-Heo/gomedia/core/media/codec/mp3parser"
 	"github.com/Youngju-Heo/gomedia/core/media/format/ts/tsio"
 )
 
 // CodecTypes var
-var CodecTypes = []av.CodecType{av.H264, av.AAC}
+var CodecTypes = []av.CodecType{av.H264, av.HEVC, av.AAC, av.MP3, av.AC3, av.KLV, av.DATA}
 
 // Muxer struct
 type Muxer struct {
@@ -123,6 +125,41 @@ func (inst *Muxer) WritePATPMT() (err error) {
 				StreamType:    tsio.ElementaryStreamTypeH264,
 				ElementaryPID: stream.pid,
 			})
+		case av.HEVC:
+			elemStreams = append(elemStreams, tsio.ElementaryStreamInfo{
+				StreamType:    tsio.ElementaryStreamTypeHEVC,
+				ElementaryPID: stream.pid,
+			})
+		case av.MP3:
+			streamType := uint8(tsio.ElementaryStreamTypeMPEG1Audio)
+			if codec, ok := stream.CodecData.(mp3parser.CodecData); ok && codec.Header.Version != mp3parser.MPEG1 {
+				streamType = tsio.ElementaryStreamTypeMPEG2Audio
+			}
+			elemStreams = append(elemStreams, tsio.ElementaryStreamInfo{
+				StreamType:    streamType,
+				ElementaryPID: stream.pid,
+			})
+		case av.AC3:
+			elemStreams = append(elemStreams, tsio.ElementaryStreamInfo{
+				StreamType:    tsio.ElementaryStreamTypeAC3,
+				ElementaryPID: stream.pid,
+				Descriptors: []tsio.Descriptor{
+					{Tag: tsio.DescriptorTagRegistration, Data: tsio.FormatIdentifierAC3},
+				},
+			})
+		case av.KLV:
+			elemStreams = append(elemStreams, tsio.ElementaryStreamInfo{
+				StreamType:    tsio.ElementaryStreamTypePrivateData,
+				ElementaryPID: stream.pid,
+				Descriptors: []tsio.Descriptor{
+					{Tag: tsio.DescriptorTagRegistration, Data: tsio.FormatIdentifierKLV},
+				},
+			})
+		case av.DATA:
+			elemStreams = append(elemStreams, tsio.ElementaryStreamInfo{
+				StreamType:    tsio.ElementaryStreamTypePrivateData,
+				ElementaryPID: stream.pid,
+			})
 		}
 	}
 
@@ -208,6 +245,61 @@ func (inst *Muxer) WritePacket(pkt av.Packet) (err error) {
 		if err = stream.tsw.WritePackets(inst.w, datav, pkt.Time, pkt.IsKeyFrame, false); err != nil {
 			return
 		}
+
+	case av.HEVC:
+		codec := stream.CodecData.(h265parser.CodecData)
+
+		nalus := inst.nalus[:0]
+		if pkt.IsKeyFrame {
+			nalus = append(nalus, codec.VPS())
+			nalus = append(nalus, codec.SPS())
+			nalus = append(nalus, codec.PPS())
+		}
+		pktnalus, _ := h264parser.SplitNALUs(pkt.Data)
+		for _, nalu := range pktnalus {
+			nalus = append(nalus, nalu)
+		}
+
+		datav := inst.datav[:1]
+		for i, nalu := range nalus {
+			if i == 0 {
+				datav = append(datav, h265parser.AUDBytes)
+			} else {
+				datav = append(datav, h264parser.StartCodeBytes)
+			}
+			datav = append(datav, nalu)
+		}
+
+		n := tsio.FillPESHeader(inst.peshdr, tsio.StreamIDHEVC, -1, pkt.Time+pkt.CompositionTime, pkt.Time)
+		datav[0] = inst.peshdr[:n]
+
+		if err = stream.tsw.WritePackets(inst.w, datav, pkt.Time, pkt.IsKeyFrame, false); err != nil {
+			return
+		}
+
+	case av.MP3, av.AC3:
+		streamID := uint8(tsio.StreamIDMPEGAudio)
+		if stream.Type() == av.AC3 {
+			streamID = tsio.StreamIDPrivate1
+		}
+
+		// frames are carried as is, they have own headers
+		n := tsio.FillPESHeader(inst.peshdr, streamID, len(pkt.Data), pkt.Time, 0)
+		inst.datav[0] = inst.peshdr[:n]
+		inst.datav[1] = pkt.Data
+
+		if err = stream.tsw.WritePackets(inst.w, inst.datav[:2], pkt.Time, true, false); err != nil {
+			return
+		}
+
+	case av.KLV, av.DATA:
+		n := tsio.FillPESHeader(inst.peshdr, tsio.StreamIDPrivate1, len(pkt.Data), pkt.Time, 0)
+		inst.datav[0] = inst.peshdr[:n]
+		inst.datav[1] = pkt.Data
+
+		if err = stream.tsw.WritePackets(inst.w, inst.datav[:2], 0, pkt.IsKeyFrame, false); err != nil {
+			return
+		}
 	}
 
 	return
@@ -0,0 +1,139 @@
+package ts
+
+import (
+	"fmt"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/format/ts/tsio"
+)
+
+// Program is a service of transport stream, found in PAT and described by PMT
+type Program struct {
+	Number uint16
+	PID    uint16
+	// PMT holds PCR PID, program descriptors and elementary stream infos
+	PMT *tsio.PMT
+
+	streams  []*Stream
+	selected bool
+	probing  bool
+}
+
+// active programs have their PES packets parsed
+func (program *Program) active() bool {
+	return program.selected || program.probing
+}
+
+// Programs returns all programs of PAT, waiting for PMT of each program
+func (demuxer *Demuxer) Programs() (programs []*Program, err error) {
+	return demuxer.findPrograms(nil)
+}
+
+// SelectPrograms chooses programs returned by Streams and ReadPacket, in PAT order.
+// It must be called before Streams or ReadPacket, first program is used by default.
+func (demuxer *Demuxer) SelectPrograms(numbers ...uint16) (err error) {
+	if demuxer.stage != 0 {
+		err = fmt.Errorf("ts: programs must be selected before reading streams")
+		return
+	}
+	demuxer.selected = numbers
+	return
+}
+
+// ProgramStreams returns codec data of streams of program, which need not be selected.
+// Packets read while probing unselected programs are dropped.
+func (demuxer *Demuxer) ProgramStreams(number uint16) (streams []av.CodecData, err error) {
+	var programs []*Program
+	if programs, err = demuxer.findPrograms([]uint16{number}); err != nil {
+		return
+	}
+	program := programs[0]
+
+	program.probing = true
+	defer func() {
+		program.probing = false
+	}()
+	for !probed(program.streams) {
+		if err = demuxer.poll(); err != nil {
+			return
+		}
+	}
+
+	for _, stream := range program.streams {
+		streams = append(streams, stream.CodecData)
+	}
+	return
+}
+
+func (demuxer *Demuxer) selectedPrograms() (programs []*Program, err error) {
+	numbers := demuxer.selected
+	if len(numbers) == 0 {
+		for demuxer.pat == nil {
+			if err = demuxer.poll(); err != nil {
+				return
+			}
+		}
+		if len(demuxer.programs) == 0 {
+			err = fmt.Errorf("ts: no program in PAT")
+			return
+		}
+		numbers = []uint16{demuxer.programs[0].Number}
+	}
+	return demuxer.findPrograms(numbers)
+}
+
+// findPrograms waits for PMT of programs, nil numbers means all programs
+func (demuxer *Demuxer) findPrograms(numbers []uint16) (programs []*Program, err error) {
+	for demuxer.pat == nil {
+		if err = demuxer.poll(); err != nil {
+			return
+		}
+	}
+
+	wanted := func(program *Program) bool {
+		if numbers == nil {
+			return true
+		}
+		for _, number := range numbers {
+			if program.Number == number {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, number := range numbers {
+		found := false
+		for _, program := range demuxer.programs {
+			if program.Number == number {
+				found = true
+				break
+			}
+		}
+		if !found {
+			err = fmt.Errorf("ts: program=%d not found in PAT", number)
+			return
+		}
+	}
+
+	for {
+		programs = programs[:0]
+		ready := true
+		for _, program := range demuxer.programs {
+			if !wanted(program) {
+				continue
+			}
+			if program.PMT == nil {
+				ready = false
+				break
+			}
+			programs = append(programs, program)
+		}
+		if ready {
+			return
+		}
+		if err = demuxer.poll(); err != nil {
+			return
+		}
+	}
+}
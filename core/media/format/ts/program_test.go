@@ -0,0 +1,204 @@
+package ts
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/format/ts/tsio"
+)
+
+// testWritePSI writes PSI section which may span several TS packets
+func testWritePSI(t *testing.T, w io.Writer, tsw *tsio.TSWriter, tableid uint8, tableext uint16, table interface {
+	Len() int
+	Marshal([]byte) int
+}) {
+	b := make([]byte, tsio.PSIHeaderLength+table.Len()+4)
+	table.Marshal(b[tsio.PSIHeaderLength:])
+	n := tsio.FillPSI(b, tableid, tableext, table.Len())
+	if err := tsw.WritePackets(w, [][]byte{b[:n]}, 0, false, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testWritePES(t *testing.T, w io.Writer, tsw *tsio.TSWriter, streamID uint8, pkt av.Packet) {
+	hdr := make([]byte, tsio.MaxPESHeaderLength)
+	n := tsio.FillPESHeader(hdr, streamID, len(pkt.Data), pkt.Time, 0)
+	if err := tsw.WritePackets(w, [][]byte{hdr[:n], pkt.Data}, 0, true, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testTwoPrograms makes stream of program 1 with MPEG audio and program 2 with AC-3 and
+// many private data streams, so PMT of program 2 spans several TS packets
+func testTwoPrograms(t *testing.T) (b []byte, mp3, ac3 []av.Packet) {
+	buf := &bytes.Buffer{}
+	pat := tsio.PAT{Entries: []tsio.PATEntry{
+		{ProgramNumber: 0, NetworkPID: 0x10},
+		{ProgramNumber: 1, ProgramMapPID: 0x1000},
+		{ProgramNumber: 2, ProgramMapPID: 0x1001},
+	}}
+	testWritePSI(t, buf, tsio.NewTSWriter(tsio.PatPID), tsio.TableIDPAT, tsio.TableExtPAT, pat)
+
+	pmt1 := tsio.PMT{
+		PCRPID: 0x100,
+		ElementaryStreamInfos: []tsio.ElementaryStreamInfo{
+			{StreamType: tsio.ElementaryStreamTypeMPEG1Audio, ElementaryPID: 0x100},
+		},
+	}
+	pmt2 := tsio.PMT{
+		PCRPID: 0x200,
+		ElementaryStreamInfos: []tsio.ElementaryStreamInfo{
+			{StreamType: tsio.ElementaryStreamTypeAC3, ElementaryPID: 0x200},
+		},
+	}
+	for i := 0; i < 20; i++ {
+		pmt2.ElementaryStreamInfos = append(pmt2.ElementaryStreamInfos, tsio.ElementaryStreamInfo{
+			StreamType:    tsio.ElementaryStreamTypePrivateData,
+			ElementaryPID: uint16(0x201 + i),
+			Descriptors:   []tsio.Descriptor{{Tag: 0x80, Data: []byte("private!")}},
+		})
+	}
+	if pmt2.Len()+tsio.PSIHeaderLength <= tsio.TSPacketSize-4 {
+		t.Fatalf("pmt len=%d fits in one TS packet", pmt2.Len())
+	}
+	testWritePSI(t, buf, tsio.NewTSWriter(0x1000), tsio.TableIDPMT, 1, pmt1)
+	testWritePSI(t, buf, tsio.NewTSWriter(0x1001), tsio.TableIDPMT, 2, pmt2)
+
+	_, mp3 = testMP3Stream(t, []byte{0xff, 0xfb, 0x90, 0x64})
+	_, ac3 = testAC3Stream(t)
+	mp3w, ac3w := tsio.NewTSWriter(0x100), tsio.NewTSWriter(0x200)
+	for i := range mp3 {
+		mp3[i].Time += time.Second
+		ac3[i].Time += time.Second
+		testWritePES(t, buf, mp3w, tsio.StreamIDMPEGAudio, mp3[i])
+		testWritePES(t, buf, ac3w, tsio.StreamIDPrivate1, ac3[i])
+	}
+	return buf.Bytes(), mp3, ac3
+}
+
+func testReadPackets(t *testing.T, demuxer *Demuxer) (pkts []av.Packet) {
+	for {
+		pkt, err := demuxer.ReadPacket()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkts = append(pkts, pkt)
+	}
+}
+
+// testCheckPackets compares packets of one stream in order, idx is index in Streams
+func testCheckPackets(t *testing.T, name string, pkts []av.Packet, idx int8, want []av.Packet) {
+	i := 0
+	for _, pkt := range pkts {
+		if pkt.Idx != idx {
+			continue
+		}
+		if i >= len(want) {
+			t.Errorf("%s: extra packet idx=%d", name, idx)
+			return
+		}
+		// 90khz timestamps
+		diff := pkt.Time - want[i].Time
+		if !bytes.Equal(pkt.Data, want[i].Data) || diff < -20*time.Microsecond || diff > 20*time.Microsecond {
+			t.Errorf("%s: packet#%d of idx=%d time=%v", name, i, idx, pkt.Time)
+		}
+		i++
+	}
+	if i != len(want) {
+		t.Errorf("%s: %d packets of idx=%d, want %d", name, i, idx, len(want))
+	}
+}
+
+func TestPrograms(t *testing.T) {
+	b, mp3, ac3 := testTwoPrograms(t)
+
+	demuxer := NewDemuxer(bytes.NewReader(b))
+	programs, err := demuxer.Programs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// network information entry is not program
+	if len(programs) != 2 || programs[0].Number != 1 || programs[1].Number != 2 || programs[1].PID != 0x1001 {
+		t.Fatalf("programs=%+v", programs)
+	}
+	if n := len(programs[1].PMT.ElementaryStreamInfos); n != 21 {
+		t.Errorf("program 2 has %d streams, want 21", n)
+	}
+	if desc := programs[1].PMT.ElementaryStreamInfos[20].Descriptors; len(desc) != 1 || string(desc[0].Data) != "private!" {
+		t.Errorf("last stream descriptors=%v", desc)
+	}
+
+	for _, test := range []struct {
+		name    string
+		numbers []uint16
+		types   []av.CodecType
+		pkts    [][]av.Packet
+	}{
+		{"default", nil, []av.CodecType{av.MP3}, [][]av.Packet{mp3}},
+		{"program 2", []uint16{2}, []av.CodecType{av.AC3}, [][]av.Packet{ac3}},
+		{"both programs", []uint16{2, 1}, []av.CodecType{av.MP3, av.AC3}, [][]av.Packet{mp3, ac3}},
+	} {
+		demuxer := NewDemuxer(bytes.NewReader(b))
+		if err = demuxer.SelectPrograms(test.numbers...); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		streams, err := demuxer.Streams()
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		// private data streams follow AC-3 in program 2
+		var types []av.CodecType
+		for _, stream := range streams {
+			if stream.Type() != av.DATA {
+				types = append(types, stream.Type())
+			}
+		}
+		if len(types) != len(test.types) {
+			t.Fatalf("%s: streams=%v", test.name, types)
+		}
+		for i := range types {
+			if types[i] != test.types[i] {
+				t.Errorf("%s: stream#%d type=%v, want %v", test.name, i, types[i], test.types[i])
+			}
+		}
+
+		pkts := testReadPackets(t, demuxer)
+		for i, want := range test.pkts {
+			testCheckPackets(t, test.name, pkts, int8(i), want)
+		}
+		if err = demuxer.SelectPrograms(1); err == nil {
+			t.Errorf("%s: select after reading streams", test.name)
+		}
+	}
+
+	// probing program 2 does not return its packets
+	demuxer = NewDemuxer(bytes.NewReader(b))
+	streams, err := demuxer.ProgramStreams(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 21 || streams[0].Type() != av.AC3 || streams[1].Type() != av.DATA {
+		t.Fatalf("program 2 streams=%d", len(streams))
+	}
+	if streams, err = demuxer.Streams(); err != nil || len(streams) != 1 || streams[0].Type() != av.MP3 {
+		t.Fatalf("streams=%v err=%v", streams, err)
+	}
+	// packets of program 1 read while probing are dropped as it was not selected yet
+	pkts := testReadPackets(t, demuxer)
+	if len(pkts) == 0 || len(pkts) > len(mp3) {
+		t.Fatalf("read %d packets", len(pkts))
+	}
+	testCheckPackets(t, "probed program 2", pkts, 0, mp3[len(mp3)-len(pkts):])
+
+	demuxer = NewDemuxer(bytes.NewReader(b))
+	demuxer.SelectPrograms(3)
+	if _, err = demuxer.Streams(); err == nil {
+		t.Error("program 3 not in PAT selected")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
+
+package ts
+
+import (
+	"fmt"
+	"net"
+)
+
+func setMulticastOptions(conn *net.UDPConn, ifaddr net.IP, ttl int) (err error) {
+	err = fmt.Errorf("ts: multicast options are not supported on this platform")
+	return
+}
@@ -0,0 +1,35 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package ts
+
+import (
+	"net"
+	"syscall"
+)
+
+// setMulticastOptions sets outgoing interface and TTL of IPv4 multicast, ttl is checked by caller
+func setMulticastOptions(conn *net.UDPConn, ifaddr net.IP, ttl int) (err error) {
+	var rc syscall.RawConn
+	if rc, err = conn.SyscallConn(); err != nil {
+		return
+	}
+	var serr error
+	if err = rc.Control(func(fd uintptr) {
+		if ifaddr != nil {
+			var addr [4]byte
+			copy(addr[:], ifaddr.To4())
+			if serr = syscall.SetsockoptInet4Addr(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_IF, addr); serr != nil {
+				return
+			}
+		}
+		if ttl > 0 {
+			// byte is accepted by all, int is not
+			serr = syscall.SetsockoptByte(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_TTL, byte(ttl))
+		}
+	}); err != nil {
+		return
+	}
+	err = serr
+	return
+}
@@ -13,6 +13,7 @@ type Stream struct {
 
 	demuxer *Demuxer
 	muxer   *Muxer
+	program *Program
 
 	pid        uint16
 	streamID   uint8
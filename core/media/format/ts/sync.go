@@ -0,0 +1,173 @@
+package ts
+
+import (
+	"io"
+	"sync/atomic"
+
+	"github.com/Youngju-Heo/gomedia/core/media/format/ts/tsio"
+)
+
+// Stats counts TS packets and errors found by Demuxer, safe to read from other goroutines
+type Stats struct {
+	Packets          uint64 // TS packets read
+	SyncLosses       uint64 // times sync byte was lost and searched again
+	SkippedBytes     uint64 // bytes skipped while searching sync byte
+	TransportErrors  uint64 // packets with transport error indicator or broken header
+	ContinuityErrors uint64 // continuity counter discontinuities
+	DuplicatePackets uint64
+	DiscardedPES     uint64 // PES packets dropped because they are damaged
+}
+
+// Stats returns error counters of demuxer
+func (demuxer *Demuxer) Stats() (stats Stats) {
+	stats.Packets = atomic.LoadUint64(&demuxer.stats.Packets)
+	stats.SyncLosses = atomic.LoadUint64(&demuxer.stats.SyncLosses)
+	stats.SkippedBytes = atomic.LoadUint64(&demuxer.stats.SkippedBytes)
+	stats.TransportErrors = atomic.LoadUint64(&demuxer.stats.TransportErrors)
+	stats.ContinuityErrors = atomic.LoadUint64(&demuxer.stats.ContinuityErrors)
+	stats.DuplicatePackets = atomic.LoadUint64(&demuxer.stats.DuplicatePackets)
+	stats.DiscardedPES = atomic.LoadUint64(&demuxer.stats.DiscardedPES)
+	return
+}
+
+// PacketSize returns detected size of TS packet, 188, 192 (M2TS) or 204 (FEC)
+func (demuxer *Demuxer) PacketSize() int {
+	return demuxer.pktsize
+}
+
+var packetSizes = []int{tsio.TSPacketSize, tsio.M2TSPacketSize, tsio.FECPacketSize}
+
+// number of following packets which must start with sync byte, when sync is searched
+const syncConfirmPackets = 2
+
+// matchPacketSize returns packet size for which b starts with sync byte and confirm following packets do too
+func (demuxer *Demuxer) matchPacketSize(b []byte, confirm int) int {
+	if b[0] != tsio.SyncByte {
+		return 0
+	}
+	for _, size := range packetSizes {
+		if demuxer.pktsize != 0 && size != demuxer.pktsize {
+			continue
+		}
+		ok := true
+		// last packets of stream can't be confirmed
+		for i := 1; i <= confirm && i*size < len(b); i++ {
+			if b[i*size] != tsio.SyncByte {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return size
+		}
+	}
+	return 0
+}
+
+// syncTSPacket skips bytes until sync byte of next TS packet. Packet size is detected
+// on first call, timecode of M2TS before first sync byte is skipped.
+func (demuxer *Demuxer) syncTSPacket() (err error) {
+	detecting := demuxer.pktsize == 0
+	skipped := 0
+	defer func() {
+		if skipped > 0 && !detecting {
+			atomic.AddUint64(&demuxer.stats.SyncLosses, 1)
+			atomic.AddUint64(&demuxer.stats.SkippedBytes, uint64(skipped))
+		}
+	}()
+
+	for {
+		peek := (syncConfirmPackets+1)*tsio.FECPacketSize + 1
+		if !detecting && skipped == 0 {
+			// live input must not wait for following packets while in sync
+			peek = demuxer.pktsize
+			if buffered := demuxer.r.Buffered(); buffered > peek {
+				peek = buffered
+			}
+		}
+		var b []byte
+		if b, err = demuxer.r.Peek(peek); len(b) < tsio.TSPacketSize {
+			demuxer.r.Discard(len(b))
+			skipped += len(b)
+			if err == nil {
+				err = io.EOF
+			}
+			return
+		}
+		err = nil
+
+		// sync byte of this packet is enough while in sync, garbage after it is found on next call
+		if !detecting && skipped == 0 && demuxer.matchPacketSize(b, 0) != 0 {
+			return
+		}
+		for i := 0; i+tsio.TSPacketSize <= len(b); i++ {
+			if size := demuxer.matchPacketSize(b[i:], syncConfirmPackets); size != 0 {
+				demuxer.pktsize = size
+				demuxer.r.Discard(i)
+				skipped += i
+				return
+			}
+		}
+		n := len(b) - tsio.TSPacketSize + 1
+		demuxer.r.Discard(n)
+		skipped += n
+	}
+}
+
+// continuity is last continuity counter of pid
+type continuity struct {
+	cc        uint8
+	duplicate bool // last packet repeated counter
+}
+
+// checkContinuity returns false if packet is duplicated and must be ignored,
+// damaged PES of pid is discarded on discontinuity
+func (demuxer *Demuxer) checkContinuity(pid uint16) bool {
+	cc, payload, discontinuity, transportError := tsio.ParseTSContinuity(demuxer.tshdr)
+	if transportError {
+		atomic.AddUint64(&demuxer.stats.TransportErrors, 1)
+		demuxer.discardPID(pid)
+		delete(demuxer.continuity, pid)
+		return false
+	}
+	if pid == tsio.NullPID {
+		return true
+	}
+
+	last, ok := demuxer.continuity[pid]
+	demuxer.continuity[pid] = continuity{cc: cc}
+	if !ok || discontinuity {
+		return true
+	}
+
+	expected := last.cc
+	if payload {
+		expected = (last.cc + 1) & 0xf
+		if cc == last.cc {
+			demuxer.continuity[pid] = continuity{cc: cc, duplicate: true}
+			// one duplicate is allowed, it is not a loss, next repeat is stuck counter
+			if !last.duplicate {
+				atomic.AddUint64(&demuxer.stats.DuplicatePackets, 1)
+				return false
+			}
+		}
+	}
+	if cc != expected {
+		atomic.AddUint64(&demuxer.stats.ContinuityErrors, 1)
+		demuxer.discardPID(pid)
+	}
+	return true
+}
+
+// discardPID drops partly collected PES or section of pid
+func (demuxer *Demuxer) discardPID(pid uint16) {
+	delete(demuxer.psi, pid)
+	for _, program := range demuxer.programs {
+		for _, stream := range program.streams {
+			if stream.pid == pid && stream.data != nil {
+				stream.data = nil
+				atomic.AddUint64(&demuxer.stats.DiscardedPES, 1)
+			}
+		}
+	}
+}
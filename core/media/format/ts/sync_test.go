@@ -0,0 +1,152 @@
+package ts
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/format/ts/tsio"
+)
+
+// testSplitTSPackets muxes AC-3 frames and splits output into 188 bytes TS packets
+func testSplitTSPackets(t *testing.T) (tspkts [][]byte, pkts []av.Packet) {
+	codecData, pkts := testAC3Stream(t)
+	buf := &bytes.Buffer{}
+	muxer := NewMuxer(buf)
+	if err := muxer.WriteHeader([]av.CodecData{codecData}); err != nil {
+		t.Fatal(err)
+	}
+	for _, pkt := range pkts {
+		if err := muxer.WritePacket(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := buf.Bytes()
+	for len(b) > 0 {
+		tspkts = append(tspkts, append([]byte{}, b[:tsio.TSPacketSize]...))
+		b = b[tsio.TSPacketSize:]
+	}
+	return
+}
+
+// testMiddlePacket returns index of TS packet in middle of PES of pid
+func testMiddlePacket(tspkts [][]byte) int {
+	for i := len(tspkts) / 2; i < len(tspkts); i++ {
+		pid, start, _, _, _ := tsio.ParseTSHeader(tspkts[i])
+		if pid == 0x100 && !start {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestSync(t *testing.T) {
+	garbage := bytes.Repeat([]byte{0x00, 0x11}, 25)
+
+	for _, test := range []struct {
+		name   string
+		size   int
+		modify func(tspkts [][]byte, k int) [][]byte
+		// garbage is written before packet k
+		garbage bool
+		frames  int
+		stats   Stats
+	}{
+		{name: "188", size: tsio.TSPacketSize, frames: 10},
+		{name: "m2ts", size: tsio.M2TSPacketSize, frames: 10},
+		{name: "fec", size: tsio.FECPacketSize, frames: 10},
+		{
+			name: "garbage", size: tsio.TSPacketSize, garbage: true, frames: 10,
+			stats: Stats{SyncLosses: 1, SkippedBytes: uint64(len(garbage))},
+		},
+		{
+			name: "m2ts garbage", size: tsio.M2TSPacketSize, garbage: true, frames: 10,
+			stats: Stats{SyncLosses: 1, SkippedBytes: uint64(len(garbage))},
+		},
+		{
+			name: "dropped packet", size: tsio.TSPacketSize, frames: 9,
+			modify: func(tspkts [][]byte, k int) [][]byte {
+				return append(tspkts[:k:k], tspkts[k+1:]...)
+			},
+			stats: Stats{ContinuityErrors: 1, DiscardedPES: 1},
+		},
+		{
+			name: "fec dropped packet", size: tsio.FECPacketSize, frames: 9,
+			modify: func(tspkts [][]byte, k int) [][]byte {
+				return append(tspkts[:k:k], tspkts[k+1:]...)
+			},
+			stats: Stats{ContinuityErrors: 1, DiscardedPES: 1},
+		},
+		{
+			name: "duplicate packet", size: tsio.TSPacketSize, frames: 10,
+			modify: func(tspkts [][]byte, k int) [][]byte {
+				return append(tspkts[:k+1:k+1], tspkts[k:]...)
+			},
+			stats: Stats{DuplicatePackets: 1},
+		},
+		{
+			// only one duplicate in a row is allowed
+			name: "stuck counter", size: tsio.TSPacketSize, frames: 9,
+			modify: func(tspkts [][]byte, k int) [][]byte {
+				return append(tspkts[:k+1:k+1], append([][]byte{tspkts[k], tspkts[k]}, tspkts[k+1:]...)...)
+			},
+			stats: Stats{DuplicatePackets: 1, ContinuityErrors: 1, DiscardedPES: 1},
+		},
+		{
+			name: "transport error", size: tsio.TSPacketSize, frames: 9,
+			modify: func(tspkts [][]byte, k int) [][]byte {
+				tspkts[k][1] |= 0x80
+				return tspkts
+			},
+			stats: Stats{TransportErrors: 1, DiscardedPES: 1},
+		},
+	} {
+		tspkts, pkts := testSplitTSPackets(t)
+		k := testMiddlePacket(tspkts)
+		if k < 0 {
+			t.Fatal("no middle packet of PES")
+		}
+		if test.modify != nil {
+			tspkts = test.modify(tspkts, k)
+		}
+
+		buf := &bytes.Buffer{}
+		for i, tspkt := range tspkts {
+			if test.garbage && i == k {
+				buf.Write(garbage)
+			}
+			if test.size == tsio.M2TSPacketSize {
+				buf.Write([]byte{0, 0, 0, byte(i)})
+			}
+			buf.Write(tspkt)
+			if test.size == tsio.FECPacketSize {
+				buf.Write(make([]byte, tsio.FECPacketSize-tsio.TSPacketSize))
+			}
+		}
+
+		demuxer := NewDemuxer(buf)
+		got := testReadPackets(t, demuxer)
+		if demuxer.PacketSize() != test.size {
+			t.Errorf("%s: packet size=%d, want %d", test.name, demuxer.PacketSize(), test.size)
+		}
+		if len(got) != test.frames {
+			t.Errorf("%s: %d frames, want %d", test.name, len(got), test.frames)
+		}
+		// damaged frames are dropped, others are intact and in order
+		i := 0
+		for _, pkt := range got {
+			for i < len(pkts) && !bytes.Equal(pkt.Data, pkts[i].Data) {
+				i++
+			}
+			if i == len(pkts) {
+				t.Errorf("%s: damaged frame len=%d returned", test.name, len(pkt.Data))
+				break
+			}
+		}
+
+		test.stats.Packets = uint64(len(tspkts))
+		if stats := demuxer.Stats(); stats != test.stats {
+			t.Errorf("%s: stats=%+v, want %+v", test.name, stats, test.stats)
+		}
+	}
+}
@@ -13,6 +13,12 @@ const (
 	StreamIDH264 = 0xe0
 	// StreamIDAAC const
 	StreamIDAAC = 0xc0
+	// StreamIDHEVC const
+	StreamIDHEVC = 0xe0
+	// StreamIDMPEGAudio const
+	StreamIDMPEGAudio = 0xc0
+	// StreamIDPrivate1 const, for AC-3 and private data
+	StreamIDPrivate1 = 0xbd
 )
 
 const (
@@ -34,6 +40,22 @@ const TableIDPAT = 0
 // TableExtPAT var
 const TableExtPAT = 1
 
+// TS packet sizes
+const (
+	// TSPacketSize const
+	TSPacketSize = 188
+	// M2TSPacketSize const, 4 bytes timecode precedes each TS packet
+	M2TSPacketSize = 192
+	// FECPacketSize const, 16 bytes Reed-Solomon parity follows each TS packet
+	FECPacketSize = 204
+)
+
+// SyncByte of TS packet
+const SyncByte = 0x47
+
+// NullPID const, null packets are stuffing
+const NullPID = 0x1fff
+
 // MaxPESHeaderLength var
 const MaxPESHeaderLength = 19
 
@@ -57,6 +79,35 @@ const (
 	ElementaryStreamTypeH264 = 0x1B
 	// ElementaryStreamTypeAdtsAAC const
 	ElementaryStreamTypeAdtsAAC = 0x0F
+	// ElementaryStreamTypeHEVC const
+	ElementaryStreamTypeHEVC = 0x24
+	// ElementaryStreamTypeMPEG1Audio const
+	ElementaryStreamTypeMPEG1Audio = 0x03
+	// ElementaryStreamTypeMPEG2Audio const
+	ElementaryStreamTypeMPEG2Audio = 0x04
+	// ElementaryStreamTypePrivateData const, PES private data such as DVB AC-3 or KLV
+	ElementaryStreamTypePrivateData = 0x06
+	// ElementaryStreamTypeMetadata const, metadata carried in PES
+	ElementaryStreamTypeMetadata = 0x15
+	// ElementaryStreamTypeAC3 const, ATSC AC-3
+	ElementaryStreamTypeAC3 = 0x81
+)
+
+const (
+	// DescriptorTagRegistration const, holds 4 bytes format identifier
+	DescriptorTagRegistration = 0x05
+	// DescriptorTagMetadata const
+	DescriptorTagMetadata = 0x26
+	// DescriptorTagAC3 const, DVB AC-3 descriptor
+	DescriptorTagAC3 = 0x6a
+)
+
+// format identifiers of registration descriptor
+var (
+	// FormatIdentifierAC3 var
+	FormatIdentifierAC3 = []byte("AC-3")
+	// FormatIdentifierKLV var
+	FormatIdentifierKLV = []byte("KLVA")
 )
 
 // PATEntry func
@@ -225,7 +276,7 @@ func (inst PMT) parseDescs(b []byte) (descs []Descriptor, err error) {
 			desc.Tag = b[n]
 			desc.Data = make([]byte, b[n+1])
 			n += 2
-			if n+len(desc.Data) < len(b) {
+			if n+len(desc.Data) <= len(b) {
 				copy(desc.Data, b[n:])
 				descs = append(descs, desc)
 				n += len(desc.Data)
@@ -367,6 +418,22 @@ func ParsePSI(h []byte) (tableid uint8, tableext uint16, hdrlen int, datalen int
 	return
 }
 
+// PSILength returns length of pointer field and section in h, or 0 if h is too short to tell.
+// Sections longer than one TS packet are collected until this length is reached.
+func PSILength(h []byte) (n int) {
+	if len(h) < 1 {
+		return
+	}
+	// pointer(8)
+	hdrlen := 1 + int(h[0])
+	if len(h) < hdrlen+3 {
+		return
+	}
+	// table_id(8), section_length(12)
+	n = hdrlen + 3 + int(pio.U16BE(h[hdrlen+1:]))&0x3ff
+	return
+}
+
 // PSIHeaderLength var
 const PSIHeaderLength = 9
 
@@ -631,7 +698,34 @@ func ParseTSHeader(tshdr []byte) (pid uint16, start bool, iskeyframe bool, hdrle
 	hdrlen += 4
 	if tshdr[3]&0x20 != 0 {
 		hdrlen += int(tshdr[4]) + 1
-		iskeyframe = tshdr[5]&0x40 != 0
+		if hdrlen > len(tshdr) {
+			err = fmt.Errorf("tshdr adaptation field length invalid")
+			return
+		}
+		iskeyframe = hdrlen > 5 && tshdr[5]&0x40 != 0
+	}
+	return
+}
+
+// ParseTSPCR returns PCR of TS header if it has one
+func ParseTSPCR(tshdr []byte) (pcr time.Duration, ok bool) {
+	// adaptation field with PCR flag, PCR(48)
+	if tshdr[3]&0x20 == 0 || tshdr[4] < 7 || tshdr[5]&0x10 == 0 {
+		return
+	}
+	pcr = PCRToTime(pio.U48BE(tshdr[6:12]))
+	ok = true
+	return
+}
+
+// ParseTSContinuity returns continuity counter and error flags of TS header
+func ParseTSContinuity(tshdr []byte) (cc uint8, payload bool, discontinuity bool, transportError bool) {
+	transportError = tshdr[1]&0x80 != 0
+	cc = tshdr[3] & 0xf
+	// counter is incremented only by packets with payload
+	payload = tshdr[3]&0x10 != 0
+	if tshdr[3]&0x20 != 0 && tshdr[4] > 0 {
+		discontinuity = tshdr[5]&0x80 != 0
 	}
 	return
 }
@@ -0,0 +1,457 @@
+package ts
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/av"
+	"github.com/Youngju-Heo/gomedia/core/media/format/ts/tsio"
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
+)
+
+// TS over UDP and RTP (RFC 2250) URLs, options are given in query:
+//
+//	udp://239.1.1.1:1234?iface=eth0&ttl=16&pkt_size=1316
+//	rtp://239.1.1.1:5004?localaddr=10.0.0.5
+//
+// iface or localaddr selects interface of multicast, ttl is multicast TTL,
+// pkt_size is payload size of output datagram, buffer_size is socket receive buffer
+// and pace=0 disables PCR pacing of output.
+
+const (
+	// DefaultUDPPacketSize is 7 TS packets, fits in ethernet MTU
+	DefaultUDPPacketSize = 7 * tsio.TSPacketSize
+	// RTPPayloadTypeMP2T is static RTP payload type of MPEG-TS
+	RTPPayloadTypeMP2T = 33
+
+	defaultUDPReadBuffer = 1024 * 1024
+	rtpHeaderLength      = 12
+	// larger gap of PCR and wall clock restarts pacing
+	maxPCRJump = time.Second
+)
+
+// IsUDPURL reports if uri is udp:// or rtp:// which is handled by OpenUDP and CreateUDP
+func IsUDPURL(uri string) bool {
+	return strings.HasPrefix(uri, "udp://") || strings.HasPrefix(uri, "rtp://")
+}
+
+var errInvalidTTL = fmt.Errorf("ts: ttl must be 0-255")
+
+type udpURL struct {
+	rtp   bool
+	addr  *net.UDPAddr
+	iface *net.Interface
+	query url.Values
+}
+
+func parseUDPURL(uri string) (inst udpURL, err error) {
+	var u *url.URL
+	if u, err = url.Parse(uri); err != nil {
+		return
+	}
+	switch u.Scheme {
+	case "udp":
+	case "rtp":
+		inst.rtp = true
+	default:
+		err = fmt.Errorf("ts: scheme of %s is not udp or rtp", uri)
+		return
+	}
+	if inst.addr, err = net.ResolveUDPAddr("udp", u.Host); err != nil {
+		return
+	}
+	inst.query = u.Query()
+
+	if name := inst.query.Get("iface"); name != "" {
+		if inst.iface, err = net.InterfaceByName(name); err != nil {
+			return
+		}
+	} else if addr := inst.query.Get("localaddr"); addr != "" {
+		if inst.iface, err = interfaceByAddr(net.ParseIP(addr)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (inst udpURL) intOption(name string, defval int) (val int, err error) {
+	s := inst.query.Get(name)
+	if s == "" {
+		val = defval
+		return
+	}
+	if val, err = strconv.Atoi(s); err != nil {
+		err = fmt.Errorf("ts: invalid %s=%s", name, s)
+		return
+	}
+	return
+}
+
+func interfaceByAddr(ip net.IP) (ifi *net.Interface, err error) {
+	if ip == nil {
+		err = fmt.Errorf("ts: invalid localaddr")
+		return
+	}
+	var ifaces []net.Interface
+	if ifaces, err = net.Interfaces(); err != nil {
+		return
+	}
+	for i := range ifaces {
+		addrs, _ := ifaces[i].Addrs()
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+				ifi = &ifaces[i]
+				return
+			}
+		}
+	}
+	err = fmt.Errorf("ts: no interface has address %s", ip)
+	return
+}
+
+func interfaceIPv4(ifi *net.Interface) (ip net.IP, err error) {
+	var addrs []net.Addr
+	if addrs, err = ifi.Addrs(); err != nil {
+		return
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok {
+			if ip = ipnet.IP.To4(); ip != nil {
+				return
+			}
+		}
+	}
+	err = fmt.Errorf("ts: interface %s has no IPv4 address", ifi.Name)
+	return
+}
+
+// UDPReader reads TS from UDP datagrams, RTP headers are removed for rtp://
+type UDPReader struct {
+	conn *net.UDPConn
+	rtp  bool
+	buf  []byte
+	data []byte
+}
+
+// OpenUDP listens udp:// or rtp:// uri, multicast group is joined if address is multicast
+func OpenUDP(uri string) (reader *UDPReader, err error) {
+	var u udpURL
+	if u, err = parseUDPURL(uri); err != nil {
+		return
+	}
+	var bufsize int
+	if bufsize, err = u.intOption("buffer_size", defaultUDPReadBuffer); err != nil {
+		return
+	}
+
+	var conn *net.UDPConn
+	if u.addr.IP != nil && u.addr.IP.IsMulticast() {
+		conn, err = net.ListenMulticastUDP("udp", u.iface, u.addr)
+	} else {
+		conn, err = net.ListenUDP("udp", u.addr)
+	}
+	if err != nil {
+		return
+	}
+	// kernel may cap size, it is not an error
+	conn.SetReadBuffer(bufsize)
+
+	reader = &UDPReader{
+		conn: conn,
+		rtp:  u.rtp,
+		buf:  make([]byte, 64*1024),
+	}
+	return
+}
+
+// Read func
+func (inst *UDPReader) Read(p []byte) (n int, err error) {
+	for len(inst.data) == 0 {
+		if n, _, err = inst.conn.ReadFromUDP(inst.buf); err != nil {
+			return
+		}
+		inst.data = inst.buf[:n]
+		if inst.rtp {
+			if inst.data, err = rtpPayload(inst.data); err != nil {
+				// not RTP, wait for next datagram
+				inst.data = nil
+				err = nil
+			}
+		}
+	}
+	n = copy(p, inst.data)
+	inst.data = inst.data[n:]
+	return
+}
+
+// Close func
+func (inst *UDPReader) Close() error {
+	return inst.conn.Close()
+}
+
+// LocalAddr func
+func (inst *UDPReader) LocalAddr() net.Addr {
+	return inst.conn.LocalAddr()
+}
+
+func rtpPayload(b []byte) (payload []byte, err error) {
+	if len(b) < rtpHeaderLength || b[0]>>6 != 2 {
+		err = fmt.Errorf("ts: invalid RTP header")
+		return
+	}
+	// CSRC list
+	n := rtpHeaderLength + int(b[0]&0xf)*4
+	// header extension
+	if b[0]&0x10 != 0 {
+		if len(b) < n+4 {
+			err = fmt.Errorf("ts: invalid RTP header extension")
+			return
+		}
+		n += 4 + int(pio.U16BE(b[n+2:]))*4
+	}
+	end := len(b)
+	// padding
+	if b[0]&0x20 != 0 {
+		end -= int(b[len(b)-1])
+	}
+	if n > end {
+		err = fmt.Errorf("ts: invalid RTP packet")
+		return
+	}
+	payload = b[n:end]
+	return
+}
+
+// UDPWriter sends TS packets in UDP datagrams, with RTP header for rtp://.
+// Datagrams are paced by PCR of first PID carrying PCR.
+type UDPWriter struct {
+	conn *net.UDPConn
+	rtp  bool
+	pace bool
+
+	pktsize int
+	buf     []byte
+	hdrlen  int
+
+	seq       uint16
+	ssrc      uint32
+	timestamp uint32
+	start     time.Time
+
+	pcrPID   int
+	pcr      time.Duration
+	hasPCR   bool
+	pcrBase  time.Duration
+	wallBase time.Time
+}
+
+// CreateUDP sends to udp:// or rtp:// uri
+func CreateUDP(uri string) (writer *UDPWriter, err error) {
+	var u udpURL
+	if u, err = parseUDPURL(uri); err != nil {
+		return
+	}
+	var pktsize, ttl, pace int
+	if pktsize, err = u.intOption("pkt_size", DefaultUDPPacketSize); err != nil {
+		return
+	}
+	if ttl, err = u.intOption("ttl", 0); err != nil {
+		return
+	}
+	if ttl < 0 || ttl > 255 {
+		err = errInvalidTTL
+		return
+	}
+	if pace, err = u.intOption("pace", 1); err != nil {
+		return
+	}
+	// whole TS packets
+	pktsize -= pktsize % tsio.TSPacketSize
+	if pktsize < tsio.TSPacketSize {
+		pktsize = tsio.TSPacketSize
+	}
+
+	var conn *net.UDPConn
+	if conn, err = net.DialUDP("udp", nil, u.addr); err != nil {
+		return
+	}
+	if u.addr.IP.IsMulticast() && (u.iface != nil || ttl > 0) {
+		var ifaddr net.IP
+		if u.iface != nil {
+			if ifaddr, err = interfaceIPv4(u.iface); err != nil {
+				conn.Close()
+				return
+			}
+		}
+		if err = setMulticastOptions(conn, ifaddr, ttl); err != nil {
+			conn.Close()
+			return
+		}
+	}
+
+	writer = &UDPWriter{
+		conn:    conn,
+		rtp:     u.rtp,
+		pace:    pace != 0,
+		pktsize: pktsize,
+		pcrPID:  -1,
+	}
+	if writer.rtp {
+		rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+		writer.hdrlen = rtpHeaderLength
+		writer.seq = uint16(rnd.Uint32())
+		writer.ssrc = rnd.Uint32()
+		writer.timestamp = rnd.Uint32()
+	}
+	writer.buf = make([]byte, writer.hdrlen, writer.hdrlen+pktsize)
+	return
+}
+
+// Write collects TS packets, datagram is sent when it is full
+func (inst *UDPWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		pos := len(inst.buf) - inst.hdrlen
+		// fill up to end of current TS packet
+		size := tsio.TSPacketSize - pos%tsio.TSPacketSize
+		if size > len(p) {
+			size = len(p)
+		}
+		inst.buf = append(inst.buf, p[:size]...)
+		p = p[size:]
+		n += size
+
+		if pos = len(inst.buf) - inst.hdrlen; pos%tsio.TSPacketSize == 0 {
+			inst.checkPCR(inst.buf[len(inst.buf)-tsio.TSPacketSize:])
+			if pos == inst.pktsize {
+				if err = inst.flush(); err != nil {
+					return
+				}
+			}
+		}
+	}
+	return
+}
+
+func (inst *UDPWriter) checkPCR(pkt []byte) {
+	pcr, ok := tsio.ParseTSPCR(pkt)
+	if !ok {
+		return
+	}
+	pid := int(pkt[1]&0x1f)<<8 | int(pkt[2])
+	if inst.pcrPID == -1 {
+		inst.pcrPID = pid
+	}
+	if pid == inst.pcrPID {
+		inst.pcr = pcr
+		inst.hasPCR = true
+	}
+}
+
+// wait holds datagram with PCR until wall clock reaches it
+func (inst *UDPWriter) wait() {
+	if !inst.hasPCR {
+		return
+	}
+	inst.hasPCR = false
+	now := time.Now()
+	delay := inst.pcr - inst.pcrBase - now.Sub(inst.wallBase)
+	if inst.wallBase.IsZero() || delay > maxPCRJump || delay < -maxPCRJump {
+		// first PCR or discontinuity
+		inst.pcrBase = inst.pcr
+		inst.wallBase = now
+		return
+	}
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+func (inst *UDPWriter) flush() (err error) {
+	if len(inst.buf) == inst.hdrlen {
+		return
+	}
+	if inst.pace {
+		inst.wait()
+	}
+	if inst.rtp {
+		now := time.Now()
+		if inst.start.IsZero() {
+			inst.start = now
+		}
+		// 90kHz clock of transmission time
+		ts := inst.timestamp + uint32(now.Sub(inst.start)*90000/time.Second)
+		inst.buf[0] = 2 << 6
+		inst.buf[1] = RTPPayloadTypeMP2T
+		pio.PutU16BE(inst.buf[2:], inst.seq)
+		pio.PutU32BE(inst.buf[4:], ts)
+		pio.PutU32BE(inst.buf[8:], inst.ssrc)
+		inst.seq++
+	}
+	_, err = inst.conn.Write(inst.buf)
+	inst.buf = inst.buf[:inst.hdrlen]
+	return
+}
+
+// Close sends rest of TS packets
+func (inst *UDPWriter) Close() (err error) {
+	if err = inst.flush(); err != nil {
+		inst.conn.Close()
+		return
+	}
+	return inst.conn.Close()
+}
+
+type udpDemuxer struct {
+	*Demuxer
+	r *UDPReader
+}
+
+// Close func
+func (inst *udpDemuxer) Close() error {
+	return inst.r.Close()
+}
+
+type udpMuxer struct {
+	*Muxer
+	w *UDPWriter
+}
+
+// Close func
+func (inst *udpMuxer) Close() (err error) {
+	if err = inst.WriteTrailer(); err != nil {
+		inst.w.Close()
+		return
+	}
+	return inst.w.Close()
+}
+
+// NewUDPDemuxer opens udp:// or rtp:// uri for demuxing
+func NewUDPDemuxer(uri string) (demuxer av.DemuxCloser, err error) {
+	var r *UDPReader
+	if r, err = OpenUDP(uri); err != nil {
+		return
+	}
+	demuxer = &udpDemuxer{
+		Demuxer: NewDemuxer(r),
+		r:       r,
+	}
+	return
+}
+
+// NewUDPMuxer creates udp:// or rtp:// uri for muxing
+func NewUDPMuxer(uri string) (muxer av.MuxCloser, err error) {
+	var w *UDPWriter
+	if w, err = CreateUDP(uri); err != nil {
+		return
+	}
+	muxer = &udpMuxer{
+		Muxer: NewMuxer(w),
+		w:     w,
+	}
+	return
+}
@@ -0,0 +1,190 @@
+package ts
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Youngju-Heo/gomedia/core/media/format/ts/tsio"
+	"github.com/Youngju-Heo/gomedia/core/media/utils/bits/pio"
+)
+
+// testTSData makes n TS packets with sync byte and packet number
+func testTSData(n int) []byte {
+	b := make([]byte, n*tsio.TSPacketSize)
+	for i := 0; i < n; i++ {
+		pkt := b[i*tsio.TSPacketSize : (i+1)*tsio.TSPacketSize]
+		pkt[0] = tsio.SyncByte
+		for j := 1; j < len(pkt); j++ {
+			pkt[j] = byte(i + j)
+		}
+	}
+	return b
+}
+
+// testWriteChunks writes data in chunks of size, which need not be aligned to TS packets
+func testWriteChunks(t *testing.T, w io.Writer, data []byte, size int) {
+	for len(data) > 0 {
+		n := size
+		if n > len(data) {
+			n = len(data)
+		}
+		if _, err := w.Write(data[:n]); err != nil {
+			t.Fatal(err)
+		}
+		data = data[n:]
+	}
+}
+
+func TestUDPLoopback(t *testing.T) {
+	for _, scheme := range []string{"udp", "rtp"} {
+		reader, err := OpenUDP(scheme + "://127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port := reader.LocalAddr().(*net.UDPAddr).Port
+		uri := scheme + "://127.0.0.1:" + strconv.Itoa(port)
+
+		if scheme == "rtp" {
+			// datagram which is not RTP is skipped
+			conn, err := net.Dial("udp", "127.0.0.1:"+strconv.Itoa(port))
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn.Write([]byte{0x47, 1, 2, 3})
+			conn.Close()
+		}
+
+		writer, err := CreateUDP(uri + "?pkt_size=400&pace=0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := testTSData(9)
+		testWriteChunks(t, writer, data, 100)
+		if err = writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		reader.conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+		got := make([]byte, len(data))
+		if _, err = io.ReadFull(reader, got); err != nil {
+			t.Fatalf("%s: %v", scheme, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: data mismatch", scheme)
+		}
+		reader.Close()
+	}
+}
+
+func TestUDPWriterDatagrams(t *testing.T) {
+	for _, test := range []struct {
+		uri    string
+		chunk  int
+		sizes  []int
+		hdrlen int
+	}{
+		// pkt_size is rounded down to whole TS packets
+		{"udp://%s?pkt_size=400&pace=0", 100, []int{376, 376, 188}, 0},
+		{"udp://%s?pace=0", 1000, []int{1316}, 0},
+		{"rtp://%s?pkt_size=376&pace=0", 333, []int{388, 388, 200}, rtpHeaderLength},
+		{"rtp://%s?pkt_size=100&pace=0", 7, []int{200, 200, 200, 200, 200}, rtpHeaderLength},
+	} {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		uri := fmt.Sprintf(test.uri, conn.LocalAddr().String())
+		writer, err := CreateUDP(uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for _, size := range test.sizes {
+			n += size - test.hdrlen
+		}
+		data := testTSData(n / tsio.TSPacketSize)
+		testWriteChunks(t, writer, data, test.chunk)
+		if err = writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+		buf := make([]byte, 64*1024)
+		var got []byte
+		var seq uint16
+		var ssrc uint32
+		for i, size := range test.sizes {
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Fatalf("%s: %v", uri, err)
+			}
+			if n != size {
+				t.Errorf("%s: datagram#%d size=%d, want %d", uri, i, n, size)
+			}
+			if test.hdrlen > 0 {
+				if buf[0] != 2<<6 || buf[1] != RTPPayloadTypeMP2T {
+					t.Errorf("%s: rtp header=% x", uri, buf[:2])
+				}
+				if i > 0 && (pio.U16BE(buf[2:]) != seq+1 || pio.U32BE(buf[8:]) != ssrc) {
+					t.Errorf("%s: datagram#%d seq=%d ssrc=%x", uri, i, pio.U16BE(buf[2:]), pio.U32BE(buf[8:]))
+				}
+				seq, ssrc = pio.U16BE(buf[2:]), pio.U32BE(buf[8:])
+			}
+			got = append(got, buf[test.hdrlen:n]...)
+		}
+		conn.Close()
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: data mismatch", uri)
+		}
+	}
+}
+
+func TestCreateUDPInvalidTTL(t *testing.T) {
+	for _, ttl := range []string{"-1", "256"} {
+		if writer, err := CreateUDP("udp://239.1.1.1:1234?ttl=" + ttl); err != errInvalidTTL {
+			if writer != nil {
+				writer.Close()
+			}
+			t.Errorf("ttl=%s: err=%v", ttl, err)
+		}
+	}
+}
+
+func TestRTPPayload(t *testing.T) {
+	payload := []byte{0x47, 1, 2, 3}
+	hdr := []byte{0x80, 33, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3}
+	for _, test := range []struct {
+		name string
+		b    []byte
+		ok   bool
+	}{
+		{"plain", append(append([]byte{}, hdr...), payload...), true},
+		{"csrc", append(append([]byte{0x82, 33, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3}, 1, 1, 1, 1, 2, 2, 2, 2), payload...), true},
+		{"extension", append(append([]byte{0x90, 33, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3}, 0xbe, 0xde, 0, 1, 9, 9, 9, 9), payload...), true},
+		{"csrc and extension", append(append([]byte{0x91, 33, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3}, 1, 1, 1, 1, 0xbe, 0xde, 0, 0), payload...), true},
+		{"padding", append(append([]byte{0xa0, 33, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3}, payload...), 0, 0, 3), true},
+		{"short", hdr[:11], false},
+		{"version 1", append([]byte{0x40}, hdr[1:]...), false},
+		{"truncated extension", []byte{0x90, 33, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3, 0xbe, 0xde}, false},
+		{"extension longer than packet", []byte{0x90, 33, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3, 0xbe, 0xde, 0, 2, 9, 9, 9, 9}, false},
+		{"padding longer than packet", []byte{0xa0, 33, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3, 0x47, 20}, false},
+	} {
+		got, err := rtpPayload(test.b)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%s: parsed without error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if !bytes.Equal(got, payload) {
+			t.Errorf("%s: payload=% x", test.name, got)
+		}
+	}
+}